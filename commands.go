@@ -0,0 +1,414 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"nScript/internal/cleanup"
+	"nScript/internal/cli"
+	"nScript/internal/config"
+	"nScript/internal/fsys"
+	"nScript/internal/logging"
+	"nScript/internal/profiles"
+	"nScript/internal/quarantine"
+	"nScript/internal/regbackup"
+	"nScript/internal/report"
+	"nScript/internal/system"
+	"nScript/internal/winreg"
+)
+
+// runVersion implements "version"
+func runVersion() int {
+	fmt.Printf("nScript %s (%s/%s)\n", config.Version, runtime.GOOS, runtime.GOARCH)
+	return cli.ExitSuccess
+}
+
+// runRestore implements "restore <run-id> [path-glob]"; without arguments it lists quarantine runs
+func runRestore(cmd *cli.Command) int {
+	args := cmd.Args
+	root, err := quarantine.DefaultRoot()
+	if err != nil {
+		logging.Error("Could not find the quarantine", "error", err)
+		return cli.ExitFailure
+	}
+	store := quarantine.NewStore(fsys.OS{}, root)
+
+	if len(args) == 0 {
+		runs, err := store.Runs()
+		if err != nil {
+			logging.Error("Could not list quarantine runs", "error", err)
+			return cli.ExitFailure
+		}
+		if len(runs) == 0 {
+			logging.Info(fmt.Sprintf("No quarantine runs in %s", store.Root()))
+			return cli.ExitSuccess
+		}
+		logging.Info("Quarantine runs:")
+		for _, run := range runs {
+			logging.Info(fmt.Sprintf("   %s  %6d items  %10.2f MB", run.ID, run.Items, float64(run.Bytes)/(1024*1024)))
+		}
+		logging.Info("Restore with: nScript.exe restore <run-id> [path-glob]")
+		return cli.ExitSuccess
+	}
+	pattern := ""
+	if len(args) == 2 {
+		pattern = args[1]
+	}
+
+	result, err := store.Restore(args[0], pattern)
+	if err != nil {
+		logging.Error("Restore failed", "run", args[0], "error", err)
+		if result == nil {
+			return cli.ExitFailure
+		}
+	}
+
+	for _, path := range result.Conflicts {
+		logging.Warn("Not restored, path exists again", "path", path)
+	}
+	for path, err := range result.Failed {
+		logging.Warn("Failed to restore", "path", path, "error", err)
+	}
+	logging.Success(fmt.Sprintf("Restored %d items from run %s", result.Restored, args[0]))
+
+	if err != nil || len(result.Failed) > 0 || len(result.Conflicts) > 0 {
+		return cli.ExitPartial
+	}
+	return cli.ExitSuccess
+}
+
+// runRestoreRegistry implements "restore-registry <backup-id|file.reg> [key]"
+func runRestoreRegistry(cmd *cli.Command) int {
+	cfg, err := config.Load(cmd.ConfigPath)
+	if err != nil {
+		logging.Error("Invalid configuration", "error", err)
+		return cli.ExitConfigError
+	}
+	rm := system.NewRegistryManager(winreg.OS{}, regbackup.NewStore(fsys.OS{}, cfg.RegistryBackupDir))
+	// Backups of signed-out users from an all-users run are under their SID
+	rm.SetHiveMounter(func(sid string) (func(), error) {
+		return mountProfileHive(cfg, sid)
+	})
+	defer rm.UnmountHives()
+
+	source := cmd.Args[0]
+	var imported int
+	if strings.EqualFold(filepath.Ext(source), ".reg") {
+		if len(cmd.Args) == 2 {
+			logging.Error("A key can only be given with a backup ID, not with a .reg file")
+			return cli.ExitConfigError
+		}
+		imported, err = rm.ImportBackup(source)
+	} else {
+		prefix := ""
+		if len(cmd.Args) == 2 {
+			prefix = cmd.Args[1]
+		}
+		imported, err = rm.RestoreBackup(source, prefix)
+	}
+
+	if err != nil {
+		logging.Error("Registry restore failed", "backup", source, "error", err)
+		if imported > 0 {
+			return cli.ExitPartial
+		}
+		return cli.ExitFailure
+	}
+	logging.Success(fmt.Sprintf("Restored %d registry keys from %s", imported, source))
+	return cli.ExitSuccess
+}
+
+// mountProfileHive loads the registry hive of the profile with sid
+func mountProfileHive(cfg *config.Config, sid string) (func(), error) {
+	list, err := profiles.List(winreg.OS{}, fsys.OS{}, cfg.UsersDir, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range list {
+		if !strings.EqualFold(p.SID, sid) {
+			continue
+		}
+		unmount, _, err := cleanup.MountHive(winreg.OS{}, winreg.OS{}, p)
+		if err != nil {
+			return nil, fmt.Errorf("%v; sign in as %s and restore again", err, p.User)
+		}
+		return unmount, nil
+	}
+	return nil, errors.New("no local profile has this SID; sign in as that user and restore again")
+}
+
+// runBackups implements "backups [list | show <backup-id> | prune]"
+func runBackups(cmd *cli.Command) int {
+	cfg, err := config.Load(cmd.ConfigPath)
+	if err != nil {
+		logging.Error("Invalid configuration", "error", err)
+		return cli.ExitConfigError
+	}
+	store := regbackup.NewStore(fsys.OS{}, cfg.RegistryBackupDir)
+
+	switch cmd.Args[0] {
+	case cli.BackupsShow:
+		manifest, err := store.Manifest(cmd.Args[1])
+		if err != nil {
+			logging.Error("Could not read registry backup", "error", err)
+			return cli.ExitFailure
+		}
+		logging.Info(fmt.Sprintf("Registry backup %s, created %s:", manifest.ID, manifest.Created.Format(time.DateTime)))
+		for _, entry := range manifest.Entries {
+			logging.Info(fmt.Sprintf("   %s  %s", entry.BackedUpAt.Format(time.TimeOnly), entry.Key), "file", entry.File)
+		}
+		logging.Info(fmt.Sprintf("Restore with: nScript.exe restore-registry %s [key]", manifest.ID))
+		return cli.ExitSuccess
+
+	case cli.BackupsPrune:
+		keep, maxAge := cfg.RegistryBackupKeep, cfg.RegistryBackupMaxAge
+		if cmd.Keep != "" {
+			keep, err = strconv.Atoi(cmd.Keep)
+			if err != nil || keep < 0 {
+				logging.Error("Invalid --keep, expected a number of backups", "value", cmd.Keep)
+				return cli.ExitConfigError
+			}
+		}
+		if cmd.OlderThan != "" {
+			maxAge, err = config.ParseDuration(cmd.OlderThan)
+			if err != nil {
+				logging.Error("Invalid --older-than", "error", err)
+				return cli.ExitConfigError
+			}
+		}
+		return pruneBackups(store, keep, maxAge)
+	}
+
+	runs, err := store.Runs()
+	if err != nil {
+		logging.Error("Could not list registry backups", "error", err)
+		return cli.ExitFailure
+	}
+	if len(runs) == 0 {
+		logging.Info(fmt.Sprintf("No registry backups in %s", store.Root()))
+		return cli.ExitSuccess
+	}
+	logging.Info(fmt.Sprintf("Registry backups in %s:", store.Root()))
+	for _, run := range runs {
+		line := fmt.Sprintf("   %s  %4d keys  %8.1f KB", run.ID, run.Entries, float64(run.Size)/1024)
+		if run.Incomplete {
+			line += "  (not archived)"
+		}
+		logging.Info(line)
+	}
+	logging.Info("Show one with: nScript.exe backups show <backup-id>")
+	return cli.ExitSuccess
+}
+
+// pruneBackups applies a retention limit to the registry backups
+func pruneBackups(store *regbackup.Store, keep int, maxAge time.Duration) int {
+	pruned, err := store.Prune(keep, maxAge)
+	for _, id := range pruned {
+		logging.Success(fmt.Sprintf("Pruned registry backup %s", id))
+	}
+	if err != nil {
+		logging.Error("Prune failed", "error", err)
+		if len(pruned) > 0 {
+			return cli.ExitPartial
+		}
+		return cli.ExitFailure
+	}
+	logging.Success(fmt.Sprintf("Pruned %d registry backups", len(pruned)))
+	return cli.ExitSuccess
+}
+
+// runPurge implements "purge --older-than <duration>"
+func runPurge(cmd *cli.Command) int {
+	age, err := config.ParseDuration(cmd.OlderThan)
+	if err != nil {
+		logging.Error("Invalid --older-than", "error", err)
+		return cli.ExitConfigError
+	}
+
+	root, err := quarantine.DefaultRoot()
+	if err != nil {
+		logging.Error("Could not find the quarantine", "error", err)
+		return cli.ExitFailure
+	}
+	purged, err := quarantine.NewStore(fsys.OS{}, root).Purge(age)
+	for _, id := range purged {
+		logging.Success(fmt.Sprintf("Purged quarantine run %s", id))
+	}
+	if err != nil {
+		logging.Error("Purge failed", "error", err)
+		if len(purged) > 0 {
+			return cli.ExitPartial
+		}
+		return cli.ExitFailure
+	}
+	logging.Success(fmt.Sprintf("Purged %d quarantine runs", len(purged)))
+	return cli.ExitSuccess
+}
+
+// runTargets implements "targets": it lists what a run would look at
+func runTargets(cmd *cli.Command) int {
+	cfg, err := config.Load(cmd.ConfigPath)
+	if err != nil {
+		logging.Error("Invalid configuration", "error", err)
+		return cli.ExitConfigError
+	}
+	if cfg.Source != "" {
+		logging.Info(fmt.Sprintf("Using configuration from %s", cfg.Source))
+	} else {
+		logging.Info("Using built-in configuration")
+	}
+
+	userProfiles, err := allUsers(cmd, cfg)
+	if err != nil {
+		logging.Error("Could not list user profiles", "error", err)
+		return cli.ExitFailure
+	}
+	if userProfiles != nil {
+		cfg = cfg.ForProfiles(profiles.Homes(userProfiles))
+	}
+
+	logging.Info(fmt.Sprintf("Targets (%d):", len(cfg.Targets)))
+	for _, t := range cfg.Targets {
+		state := "missing"
+		if _, err := os.Stat(t.Path); err == nil {
+			state = "present"
+		}
+		threshold := "any age"
+		if t.OlderThan > 0 {
+			threshold = "older than " + t.OlderThan.String()
+		}
+		logging.Info(fmt.Sprintf("   %-8s %s", state, t.Path),
+			"threshold", threshold, "ageSource", string(t.AgeSource), "rules", len(cfg.RulesFor(t)))
+	}
+
+	browsers := make([]string, 0, len(cfg.BrowserInformation))
+	for name := range cfg.BrowserInformation {
+		browsers = append(browsers, name)
+	}
+	sort.Strings(browsers)
+
+	logging.Info(fmt.Sprintf("Browser data (%d browsers):", len(browsers)))
+	for _, name := range browsers {
+		logging.Info("   " + name)
+		for _, path := range cfg.BrowserInformation[name] {
+			logging.Info("      " + path)
+		}
+	}
+	return cli.ExitSuccess
+}
+
+// allUsers returns the profiles to clean when --all-users or the config asks
+// for every user, and nil otherwise
+func allUsers(cmd *cli.Command, cfg *config.Config) ([]profiles.Profile, error) {
+	if !cmd.AllUsers && !cfg.AllUsers {
+		return nil, nil
+	}
+	list, err := profiles.List(winreg.OS{}, fsys.OS{}, cfg.UsersDir, cfg.ProfileAllowlist)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("no user profiles to clean in %s", cfg.UsersDir)
+	}
+	names := make([]string, 0, len(list))
+	for _, p := range list {
+		names = append(names, p.User)
+	}
+	logging.Info(fmt.Sprintf("All users: %d profiles (%s)", len(list), strings.Join(names, ", ")))
+	return list, nil
+}
+
+// runDoctor implements "doctor": it checks that a run can work and reports every problem
+func runDoctor(cmd *cli.Command) int {
+	failed := 0
+	check := func(name string, detail string, err error) {
+		if err != nil {
+			failed++
+			logging.Warn(name, "error", err)
+			return
+		}
+		logging.Success(name, "detail", detail)
+	}
+
+	if runtime.GOOS == "windows" {
+		major, minor, build, err := system.GetWindowsVersion()
+		check("Windows version", fmt.Sprintf("%d.%d build %d", major, minor, build), err)
+	}
+
+	cfg, err := config.Load(cmd.ConfigPath)
+	source := "built-in defaults"
+	if cfg != nil && cfg.Source != "" {
+		source = cfg.Source
+	}
+	check("Configuration", source, err)
+
+	if cfg != nil {
+		check("User profile", cfg.UserHome, cfg.CheckHome())
+
+		present := 0
+		for _, t := range cfg.Targets {
+			if _, err := os.Stat(t.Path); err == nil {
+				present++
+			}
+		}
+		var targetErr error
+		if present == 0 {
+			targetErr = errors.New("none of the configured targets exist")
+		}
+		check("Targets", fmt.Sprintf("%d of %d present", present, len(cfg.Targets)), targetErr)
+	}
+
+	backupDir := regbackup.DefaultRoot()
+	if cfg != nil {
+		backupDir = cfg.RegistryBackupDir
+	}
+	dirs := []struct{ name, path string }{
+		{"Log directory", logging.DefaultDir()},
+		{"Report directory", filepath.Dir(report.DefaultPath(time.Now()))},
+	}
+	if runtime.GOOS == "windows" {
+		dirs = append(dirs, struct{ name, path string }{"Registry backup directory", backupDir})
+	}
+	for _, dir := range dirs {
+		check(dir.name, dir.path, checkWritable(dir.path))
+	}
+	if root, err := quarantine.DefaultRoot(); err != nil {
+		check("Quarantine directory", "", err)
+	} else {
+		check("Quarantine directory", root, checkWritable(root))
+	}
+
+	disk, err := system.GetDiskInfo()
+	if err == nil {
+		check("Disk information", fmt.Sprintf("%.2f GB free of %.2f GB", disk.FreeGB, disk.TotalGB), nil)
+	} else {
+		check("Disk information", "", err)
+	}
+
+	if failed > 0 {
+		logging.Warn(fmt.Sprintf("%d checks failed", failed))
+		return cli.ExitFailure
+	}
+	logging.Success("All checks passed")
+	return cli.ExitSuccess
+}
+
+// checkWritable verifies that a file can be created in dir, creating dir if needed
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".nScript-doctor-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,174 @@
+// Package breaker stops a run that is about to delete far more than intended,
+// as a wrong configuration or a wrong profile path would
+package breaker
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Ceiling limits what may be deleted; a zero field sets no limit
+type Ceiling struct {
+	Files int64
+	Bytes int64
+	// VolumeShare is the largest fraction of a volume's size that may be freed
+	VolumeShare float64
+}
+
+// Limits are the ceilings for the whole run and for each target
+type Limits struct {
+	Run    Ceiling
+	Target Ceiling
+}
+
+// Names of the limits and of their scopes
+const (
+	LimitFiles       = "files"
+	LimitBytes       = "bytes"
+	LimitVolumeShare = "volume-share"
+
+	ScopeRun    = "run"
+	ScopeTarget = "target"
+)
+
+// Volume is the volume a target lives on
+type Volume struct {
+	// ID tells volumes apart, e.g. a drive's root or a device number
+	ID         string
+	TotalBytes uint64
+}
+
+// Trip describes the ceiling that stopped the run
+type Trip struct {
+	Limit string
+	Scope string
+	// Target is the target whose item would have exceeded the ceiling
+	Target string
+	// Volume is set for a volume share ceiling
+	Volume string
+	// Ceiling and Value are counts, bytes or fractions, depending on Limit
+	Ceiling float64
+	Value   float64
+}
+
+func (t *Trip) Error() string {
+	scope := "the run"
+	if t.Scope == ScopeTarget {
+		scope = "target " + t.Target
+	}
+	switch t.Limit {
+	case LimitFiles:
+		return fmt.Sprintf("safety limit reached: %s would delete %.0f files, more than its ceiling of %.0f", scope, t.Value, t.Ceiling)
+	case LimitBytes:
+		return fmt.Sprintf("safety limit reached: %s would free %.0f bytes, more than its ceiling of %.0f", scope, t.Value, t.Ceiling)
+	}
+	return fmt.Sprintf("safety limit reached: %s would free %.1f%% of volume %s, more than its ceiling of %.1f%%", scope, t.Value*100, t.Volume, t.Ceiling*100)
+}
+
+// Breaker counts what a run deletes against its limits. It is safe for concurrent use.
+type Breaker struct {
+	limits   Limits
+	volumeOf func(path string) (Volume, error)
+
+	mu      sync.Mutex
+	run     usage
+	targets map[string]*usage
+	// volumes holds the bytes freed on each volume over the run
+	volumes map[string]int64
+	// targetVolumes caches the volume of each target; a zero Volume is unknown
+	targetVolumes map[string]Volume
+	trip          *Trip
+}
+
+type usage struct {
+	files, bytes int64
+}
+
+// New creates a breaker enforcing limits. volumeOf finds the volume of a
+// target; volume share ceilings are not enforced for targets it fails on.
+func New(limits Limits, volumeOf func(path string) (Volume, error)) *Breaker {
+	return &Breaker{
+		limits:        limits,
+		volumeOf:      volumeOf,
+		targets:       make(map[string]*usage),
+		volumes:       make(map[string]int64),
+		targetVolumes: make(map[string]Volume),
+	}
+}
+
+// Reserve counts an item of files files and bytes bytes below target, to be
+// deleted next. When it would exceed a ceiling nothing is counted and the
+// *Trip is returned; from then on every call returns it.
+func (b *Breaker) Reserve(target string, files, bytes int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.trip != nil {
+		return b.trip
+	}
+
+	t, ok := b.targets[target]
+	if !ok {
+		t = &usage{}
+		b.targets[target] = t
+	}
+	volume := b.volume(target)
+
+	trip := exceeds(b.limits.Run, ScopeRun, b.run, files, bytes, volume, b.volumes[volume.ID])
+	if trip == nil {
+		trip = exceeds(b.limits.Target, ScopeTarget, *t, files, bytes, volume, t.bytes)
+	}
+	if trip != nil {
+		trip.Target = target
+		b.trip = trip
+		return trip
+	}
+
+	b.run.files += files
+	b.run.bytes += bytes
+	t.files += files
+	t.bytes += bytes
+	if volume.ID != "" {
+		b.volumes[volume.ID] += bytes
+	}
+	return nil
+}
+
+// volume returns the volume of target, looking it up once
+func (b *Breaker) volume(target string) Volume {
+	if v, ok := b.targetVolumes[target]; ok {
+		return v
+	}
+	var v Volume
+	if b.limits.Run.VolumeShare > 0 || b.limits.Target.VolumeShare > 0 {
+		if found, err := b.volumeOf(target); err == nil && found.TotalBytes > 0 {
+			v = found
+		}
+	}
+	b.targetVolumes[target] = v
+	return v
+}
+
+// exceeds returns the trip of the first ceiling in c that adding files and
+// bytes to used would exceed. onVolume is what used already freed on volume.
+func exceeds(c Ceiling, scope string, used usage, files, bytes int64, volume Volume, onVolume int64) *Trip {
+	switch {
+	case c.Files > 0 && used.files+files > c.Files:
+		return &Trip{Limit: LimitFiles, Scope: scope, Ceiling: float64(c.Files), Value: float64(used.files + files)}
+	case c.Bytes > 0 && used.bytes+bytes > c.Bytes:
+		return &Trip{Limit: LimitBytes, Scope: scope, Ceiling: float64(c.Bytes), Value: float64(used.bytes + bytes)}
+	}
+	if c.VolumeShare > 0 && volume.ID != "" {
+		if share := float64(onVolume+bytes) / float64(volume.TotalBytes); share > c.VolumeShare {
+			return &Trip{Limit: LimitVolumeShare, Scope: scope, Volume: volume.ID, Ceiling: c.VolumeShare, Value: share}
+		}
+	}
+	return nil
+}
+
+// Tripped returns the trip that stopped the run, nil while no ceiling was reached
+func (b *Breaker) Tripped() *Trip {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.trip
+}
@@ -0,0 +1,82 @@
+package breaker
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func noVolume(string) (Volume, error) {
+	return Volume{}, errors.New("no volume")
+}
+
+func TestRunCeiling(t *testing.T) {
+	b := New(Limits{Run: Ceiling{Files: 3, Bytes: 100}}, noVolume)
+
+	if err := b.Reserve("/a", 2, 40); err != nil {
+		t.Fatalf("Reserve = %v", err)
+	}
+	if err := b.Reserve("/b", 1, 40); err != nil {
+		t.Fatalf("Reserve = %v", err)
+	}
+	err := b.Reserve("/b", 1, 1)
+	var trip *Trip
+	if !errors.As(err, &trip) || trip.Limit != LimitFiles || trip.Scope != ScopeRun || trip.Target != "/b" || trip.Ceiling != 3 || trip.Value != 4 {
+		t.Fatalf("Reserve = %+v, want a run files trip at 4 of 3", err)
+	}
+	if !strings.HasPrefix(trip.Error(), "safety limit reached: the run would delete 4 files") {
+		t.Errorf("Error() = %q", trip.Error())
+	}
+
+	// Once tripped nothing more is allowed, even what would fit
+	if err := b.Reserve("/c", 0, 0); err != trip {
+		t.Errorf("Reserve after the trip = %v, want the trip", err)
+	}
+	if b.Tripped() != trip {
+		t.Errorf("Tripped = %v, want %v", b.Tripped(), trip)
+	}
+}
+
+func TestTargetCeiling(t *testing.T) {
+	b := New(Limits{Target: Ceiling{Bytes: 100}}, noVolume)
+
+	for _, target := range []string{"/a", "/b"} {
+		if err := b.Reserve(target, 1, 100); err != nil {
+			t.Fatalf("Reserve(%s) = %v", target, err)
+		}
+	}
+	err := b.Reserve("/a", 1, 1)
+	var trip *Trip
+	if !errors.As(err, &trip) || trip.Limit != LimitBytes || trip.Scope != ScopeTarget || trip.Target != "/a" || trip.Value != 101 {
+		t.Fatalf("Reserve = %+v, want a target bytes trip of /a", err)
+	}
+}
+
+func TestVolumeShare(t *testing.T) {
+	volumes := map[string]Volume{
+		"/home/a": {ID: "/home", TotalBytes: 1000},
+		"/home/b": {ID: "/home", TotalBytes: 1000},
+		"/data":   {ID: "/data", TotalBytes: 1000},
+	}
+	b := New(Limits{Run: Ceiling{VolumeShare: 0.5}}, func(path string) (Volume, error) {
+		if v, ok := volumes[path]; ok {
+			return v, nil
+		}
+		return Volume{}, errors.New("unknown")
+	})
+
+	// Targets on one volume share its ceiling; other volumes and unknown ones are apart
+	for _, r := range []struct {
+		target string
+		bytes  int64
+	}{{"/home/a", 300}, {"/data", 500}, {"/home/b", 200}, {"/unknown", 5000}} {
+		if err := b.Reserve(r.target, 1, r.bytes); err != nil {
+			t.Fatalf("Reserve(%s, %d) = %v", r.target, r.bytes, err)
+		}
+	}
+	err := b.Reserve("/home/b", 1, 1)
+	var trip *Trip
+	if !errors.As(err, &trip) || trip.Limit != LimitVolumeShare || trip.Volume != "/home" || trip.Ceiling != 0.5 || trip.Value != 0.501 {
+		t.Fatalf("Reserve = %+v, want a volume share trip of /home", err)
+	}
+}
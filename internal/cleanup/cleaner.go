@@ -1,398 +1,637 @@
 package cleanup
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
-	"sort"
+	"runtime"
+	"slices"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
+	"nScript/internal/breaker"
 	"nScript/internal/config"
+	"nScript/internal/fsys"
+	"nScript/internal/logging"
+	"nScript/internal/plan"
+	"nScript/internal/pool"
+	"nScript/internal/protect"
+	"nScript/internal/quarantine"
+	"nScript/internal/rules"
 	"nScript/internal/system"
 )
 
-// Stats tracks cleanup statistics
-type Stats struct {
-	DeletedFiles   atomic.Int64
-	DeletedFolders atomic.Int64
-	SkippedFiles   atomic.Int64
-	FailedFiles    atomic.Int64
-}
+// Phase names used when recording planned actions
+const (
+	PhaseFiles     = "files"
+	PhaseBrowsers  = "browsers"
+	PhaseEmptyDirs = "empty-dirs"
+	PhaseWindows   = "windows"
+)
+
+// Phases lists the cleanup phases in the order they run
+var Phases = []string{PhaseFiles, PhaseBrowsers, PhaseEmptyDirs, PhaseWindows}
 
 // Cleaner handles file and directory cleanup operations
 type Cleaner struct {
-	stats           *Stats
-	processManager  *system.ProcessManager
-	registryManager *system.RegistryManager
-	semaphore       chan struct{}
+	cfg            *config.Config
+	fs             fsys.FS
+	stats          *Stats
+	processManager *system.ProcessManager
+	// pool carries out the file operations of every phase
+	pool       *pool.Pool
+	plan       *plan.Plan
+	quarantine *quarantine.Run
+	protected  *protect.Policy
+	breaker    *breaker.Breaker
+	// held records the deletions the breaker stopped
+	held *plan.Plan
+	// realRoots caches each target directory with its links resolved
+	realRoots sync.Map
+	// volumes caches the volume each target is on
+	volumes sync.Map
 }
 
-// NewCleaner creates a new cleaner instance
-func NewCleaner() *Cleaner {
+// NewCleaner creates a new cleaner instance operating on filesystem
+func NewCleaner(cfg *config.Config, filesystem fsys.FS) *Cleaner {
+	processManager := system.NewProcessManager()
+	processManager.SetShutdownPolicies(cfg.Shutdown)
 	return &Cleaner{
-		stats:           &Stats{},
-		processManager:  system.NewProcessManager(),
-		registryManager: system.NewRegistryManager(),
-		semaphore:       make(chan struct{}, config.MaxConcurrentOps),
+		cfg:            cfg,
+		fs:             filesystem,
+		stats:          &Stats{},
+		processManager: processManager,
+		pool: pool.New(pool.Options{
+			Bounds:         boundsFor(system.VolumeUnknown, cfg.MaxConcurrentOps),
+			OpsPerSecond:   cfg.MaxOpsPerSecond,
+			BytesPerSecond: float64(cfg.MaxBytesPerSecond),
+			QueueSize:      config.QueueSize,
+		}),
+		protected: protect.New(cfg.ProtectedPaths),
+		breaker:   breaker.New(cfg.Limits, volumeOf),
+		held:      plan.New(),
 	}
 }
 
-// GetStats returns current cleanup statistics
-func (c *Cleaner) GetStats() *Stats {
-	return c.stats
+// volumeOf finds the volume of a target for the breaker's volume share ceilings
+func volumeOf(path string) (breaker.Volume, error) {
+	info, err := system.GetVolumeInfo(path)
+	if err != nil {
+		return breaker.Volume{}, err
+	}
+	return breaker.Volume{ID: info.Root, TotalBytes: info.TotalBytes}, nil
 }
 
-// ValidatePath ensures a path is safe to operate on
-func (c *Cleaner) ValidatePath(path string) error {
-	if path == "" {
-		return errors.New("path cannot be empty")
-	}
+// volumeBounds are the concurrency each kind of volume starts with and may
+// climb to. A spinning disk slows down once its head jumps between files;
+// a network share hides its latency behind requests in flight.
+var volumeBounds = map[system.VolumeKind]pool.Bounds{
+	system.VolumeSolid:      {Initial: 32, Max: config.MaxConcurrentOps},
+	system.VolumeRotational: {Initial: 2, Max: 8},
+	system.VolumeRemote:     {Initial: 8, Max: 64},
+	system.VolumeUnknown:    {Initial: 16, Max: config.MaxConcurrentOps},
+}
 
-	// Prevent operations on system critical paths
-	criticalPaths := []string{
-		"C:\\Windows\\System32",
-		"C:\\Windows\\SysWOW64",
-		"C:\\Program Files\\Windows NT",
-		"C:\\Program Files (x86)\\Windows NT",
+// boundsFor returns the bounds of a volume kind, capped at maxOps
+func boundsFor(kind system.VolumeKind, maxOps int) pool.Bounds {
+	b, ok := volumeBounds[kind]
+	if !ok {
+		b = volumeBounds[system.VolumeUnknown]
 	}
+	return pool.Bounds{Initial: min(b.Initial, maxOps), Max: min(b.Max, maxOps)}
+}
 
-	cleanPath := filepath.Clean(path)
-	for _, critical := range criticalPaths {
-		if strings.HasPrefix(strings.ToLower(cleanPath), strings.ToLower(critical)) {
-			return fmt.Errorf("cannot operate on critical system path: %s", path)
+// tune fits the pool to the volume holding path before work on it is submitted.
+// Volumes that cannot be identified share one unknown volume.
+func (c *Cleaner) tune(path string) {
+	volume := system.VolumeInfo{Kind: system.VolumeUnknown}
+	if cached, ok := c.volumes.Load(path); ok {
+		volume = cached.(system.VolumeInfo)
+	} else {
+		if info, err := system.GetVolumeInfo(path); err == nil && info.Kind != "" {
+			volume = *info
 		}
+		logging.Debug("Detected volume", "path", path, "root", volume.Root, "kind", volume.Kind)
+		c.volumes.Store(path, volume)
 	}
+	c.pool.Tune(volume.Root, boundsFor(volume.Kind, c.cfg.MaxConcurrentOps))
+}
 
-	return nil
+// Pool returns the worker pool, whose load the progress display shows
+func (c *Cleaner) Pool() *pool.Pool {
+	return c.pool
 }
 
-// IsFileAccessible checks if a file can be opened for writing (improved naming)
-func (c *Cleaner) IsFileAccessible(path string) bool {
-	file, err := os.OpenFile(path, os.O_RDWR, 0)
-	if err != nil {
+// SetPlan switches the cleaner to dry-run mode, recording actions into p instead of performing them
+func (c *Cleaner) SetPlan(p *plan.Plan) {
+	c.plan = p
+}
+
+// SetQuarantine makes the cleaner move matched items into run instead of deleting them
+func (c *Cleaner) SetQuarantine(run *quarantine.Run) {
+	c.quarantine = run
+}
+
+// removeItem deletes path, or moves it into quarantine when a quarantine run is
+// active. A link is only unlinked: moving it to another volume would copy what
+// it points to.
+func (c *Cleaner) removeItem(path string, info fs.FileInfo) error {
+	if fsys.IsLink(info) {
+		return c.fs.Remove(path)
+	}
+	if c.quarantine != nil {
+		return c.quarantine.Move(path, info)
+	}
+	return c.fs.RemoveAll(path)
+}
+
+// reserve counts an item about to be deleted against the circuit breaker's
+// ceilings. Once one is reached the item is not deleted but held: it is
+// recorded in Held and reserve returns false.
+func (c *Cleaner) reserve(target string, action plan.Action, files int64) bool {
+	if err := c.breaker.Reserve(target, files, action.Size); err != nil {
+		c.held.Add(action)
 		return false
 	}
-	file.Close()
 	return true
 }
 
-// ShouldExclude checks if a file should be excluded based on extension and keywords
-func (c *Cleaner) ShouldExclude(path string, excludedExts []string) bool {
-	ext := strings.ToLower(filepath.Ext(path))
-	for _, excluded := range excludedExts {
-		if ext == excluded {
-			allowKeywords := []string{"roblox", "paradox", "opera", "discord", "osu", "steam", "epic games"}
-			lowerName := strings.ToLower(filepath.Base(path))
-			for _, kw := range allowKeywords {
-				if strings.Contains(lowerName, kw) {
-					fmt.Printf("\n[*] Allowing deletion of excluded extension with '%s' in name: %s\n", kw, path)
-					return false
-				}
-			}
-			return true
-		}
+// Tripped returns the ceiling that stopped the run, nil while none was reached.
+// Once it is set every phase stops before deleting anything else.
+func (c *Cleaner) Tripped() *breaker.Trip {
+	return c.breaker.Tripped()
+}
+
+// Held returns the plan of the deletions that were decided but stopped by the breaker
+func (c *Cleaner) Held() *plan.Plan {
+	return c.held
+}
+
+// record adds an action to the plan when running in dry-run mode
+func (c *Cleaner) record(phase string, kind plan.Kind, target, reason string, size int64) {
+	if c.plan != nil {
+		c.plan.Add(plan.Action{Phase: phase, Kind: kind, Target: target, Reason: reason, Size: size})
 	}
-	return false
 }
 
-// SortByDepth sorts paths by depth (deepest first) using efficient O(n log n) algorithm
-func (c *Cleaner) SortByDepth(paths []string) {
-	sort.Slice(paths, func(i, j int) bool {
-		return strings.Count(paths[j], string(filepath.Separator)) >
-			strings.Count(paths[i], string(filepath.Separator))
-	})
+// GetStats returns current cleanup statistics
+func (c *Cleaner) GetStats() *Stats {
+	return c.stats
 }
 
-// ProcessItemsBatch processes a batch of items for cleanup
-func (c *Cleaner) ProcessItemsBatch(items []string, olderThan time.Duration, excludedExts []string, forceMode bool) {
-	var wg sync.WaitGroup
+// Killed returns the browser processes terminated in force mode
+func (c *Cleaner) Killed() []system.ProcessInfo {
+	return c.processManager.Killed()
+}
 
-	for _, item := range items {
-		if err := c.ValidatePath(item); err != nil {
-			fmt.Printf("[-] Skipping invalid path %s: %v\n", item, err)
-			c.stats.SkippedFiles.Add(1)
-			continue
-		}
+// ValidatePath ensures a path is safe to delete under the protected-path policy
+func (c *Cleaner) ValidatePath(path string) error {
+	if path == "" {
+		return errors.New("path cannot be empty")
+	}
+	return c.protected.Check(path)
+}
 
-		wg.Add(1)
-		c.semaphore <- struct{}{} // Acquire semaphore
+// validateTarget ensures a target directory may be cleaned; unlike the items
+// below it, it may be a folder that must not be removed itself
+func (c *Cleaner) validateTarget(dir string) error {
+	if dir == "" {
+		return errors.New("path cannot be empty")
+	}
+	return c.protected.CheckTarget(dir)
+}
 
-		go func(path string) {
-			defer wg.Done()
-			defer func() { <-c.semaphore }() // Release semaphore
+// isBelow reports whether path is dir or inside it
+func isBelow(path, dir string) bool {
+	rest, ok := strings.CutPrefix(path, dir)
+	return ok && (rest == "" || rest[0] == '\\' || rest[0] == '/')
+}
 
-			c.processItem(path, olderThan, excludedExts, forceMode)
-		}(item)
+// foldCase returns path as compared for containment; Windows paths are case-insensitive
+func foldCase(path string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ToLower(path)
 	}
+	return path
+}
 
-	wg.Wait()
+// resolveLocation returns where path really is: the links in the directories
+// above it are resolved, path itself is not, so a link resolves to itself
+func (c *Cleaner) resolveLocation(path string) (string, error) {
+	parent, err := c.fs.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %v", path, err)
+	}
+	return filepath.Join(parent, filepath.Base(path)), nil
 }
 
-// processItem processes a single item
-func (c *Cleaner) processItem(path string, olderThan time.Duration, excludedExts []string, forceMode bool) {
-	info, err := os.Stat(path)
+// realRoot returns root with its links resolved
+func (c *Cleaner) realRoot(root string) (string, error) {
+	if real, ok := c.realRoots.Load(root); ok {
+		return real.(string), nil
+	}
+	real, err := c.fs.EvalSymlinks(root)
 	if err != nil {
-		c.stats.FailedFiles.Add(1)
-		return
+		return "", fmt.Errorf("failed to resolve %s: %v", root, err)
 	}
+	c.realRoots.Store(root, real)
+	return real, nil
+}
 
-	if c.ShouldExclude(path, excludedExts) {
-		c.stats.SkippedFiles.Add(1)
-		return
+// checkContained returns an error unless path, once the links above it are
+// resolved, is still inside root and passes ValidatePath. It runs right before
+// each deletion, so a directory replaced by a link after the walk cannot
+// redirect it outside the target.
+func (c *Cleaner) checkContained(root, path string) error {
+	real, err := c.resolveLocation(path)
+	if err != nil {
+		return err
 	}
+	return c.checkResolved(root, path, real)
+}
 
-	ageHours := time.Since(info.ModTime())
-
-	if forceMode || ageHours > olderThan {
-		if info.IsDir() {
-			// Check if directory contains excluded files
-			hasExcluded := false
-			filepath.Walk(path, func(p string, i os.FileInfo, e error) error {
-				if e != nil || i.IsDir() {
-					return nil
-				}
-				if c.ShouldExclude(p, excludedExts) {
-					hasExcluded = true
-					return filepath.SkipDir
-				}
-				return nil
-			})
-			if hasExcluded {
-				c.stats.SkippedFiles.Add(1)
-				return
-			}
-		} else if !c.IsFileAccessible(path) {
-			c.stats.SkippedFiles.Add(1)
-			return
-		}
+// checkResolved is checkContained for a path already resolved to real
+func (c *Cleaner) checkResolved(root, path, real string) error {
+	realRoot, err := c.realRoot(root)
+	if err != nil {
+		return err
+	}
+	if foldCase(real) == foldCase(realRoot) || !isBelow(foldCase(real), foldCase(realRoot)) {
+		return fmt.Errorf("%s resolves to %s, outside the target", path, real)
+	}
+	return c.ValidatePath(real)
+}
 
-		err = os.RemoveAll(path)
-		if err == nil {
-			if info.IsDir() {
-				c.stats.DeletedFolders.Add(1)
-			} else {
-				c.stats.DeletedFiles.Add(1)
-			}
-		} else {
-			c.stats.FailedFiles.Add(1)
-		}
+// IsFileAccessible checks if a file can be opened for writing (improved naming)
+func (c *Cleaner) IsFileAccessible(path string) bool {
+	file, err := c.fs.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return false
 	}
+	file.Close()
+	return true
+}
+
+// compileRules builds the rule set evaluated for every path below a target
+func (c *Cleaner) compileRules(target config.Target) (*rules.Set, error) {
+	return rules.Compile(c.cfg.RulesFor(target))
+}
+
+// matchRule returns the first rule matching a path below the target directory
+func (c *Cleaner) matchRule(ruleSet *rules.Set, target config.Target, path string, info fs.FileInfo) (rules.Rule, bool) {
+	rel, err := filepath.Rel(target.Path, path)
+	if err != nil {
+		rel = filepath.Base(path)
+	}
+	return ruleSet.Match(rel, info, target.AgeSource.Age(info, time.Now()))
+}
+
+// ShouldExclude returns the rule that keeps a path below the target directory, if any
+func (c *Cleaner) ShouldExclude(ruleSet *rules.Set, target config.Target, path string, info fs.FileInfo) (rules.Rule, bool) {
+	r, ok := c.matchRule(ruleSet, target, path, info)
+	return r, ok && r.Action == rules.Exclude
+}
+
+// describeAge describes an item's age as measured by the target's age source
+func describeAge(source config.AgeSource, age time.Duration) string {
+	if source == config.AgeNewest {
+		return "newest timestamp " + plan.DescribeAge(age) + " ago"
+	}
+	return fmt.Sprintf("%s %s ago", source, plan.DescribeAge(age))
 }
 
-// StreamingCleanDirectories processes directories with streaming to reduce memory usage
-func (c *Cleaner) StreamingCleanDirectories(directories []string, olderThan time.Duration, excludedExts []string, forceMode bool) error {
+// sleep pauses for d, returning ctx's error if ctx is cancelled first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StreamingCleanDirectories processes target directories with streaming to reduce memory usage.
+// It stops starting new work once ctx is cancelled and then returns ctx's error,
+// or once a safety limit is reached and then returns the *breaker.Trip.
+func (c *Cleaner) StreamingCleanDirectories(ctx context.Context, targets []config.Target, forceMode bool) error {
 	if forceMode {
-		fmt.Println("[!] Removing ALL files regardless of age...")
+		logging.Notice("Removing ALL files regardless of age...")
+	} else if olderThan, shared := sharedThreshold(targets); shared {
+		logging.Info(fmt.Sprintf("Scanning directories, removing files older than %.0f hours...", olderThan.Hours()))
 	} else {
-		fmt.Printf("[*] Scanning directories, removing files older than %.0f hours...\n", olderThan.Hours())
+		logging.Info("Scanning directories, removing files older than each target's threshold...")
 	}
 
-	for _, dir := range directories {
-		if _, err := os.Stat(dir); os.IsNotExist(err) {
+	for _, target := range targets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		dir := target.Path
+		if _, err := c.fs.Stat(dir); os.IsNotExist(err) {
 			continue
 		}
 
-		if err := c.ValidatePath(dir); err != nil {
-			fmt.Printf("[-] Skipping invalid directory %s: %v\n", dir, err)
+		if err := c.validateTarget(dir); err != nil {
+			logging.Warn("Skipping invalid directory", "target", dir, "error", err)
 			continue
 		}
 
-		err := c.processDirectoryStreaming(dir, olderThan, excludedExts, forceMode)
+		ruleSet, err := c.compileRules(target)
 		if err != nil {
-			fmt.Printf("[-] Error processing directory %s: %v\n", dir, err)
+			logging.Warn("Skipping directory", "target", dir, "error", err)
+			continue
+		}
+
+		c.cleanTarget(ctx, target, ruleSet, forceMode)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if trip := c.Tripped(); trip != nil {
+			return trip
 		}
 	}
 
 	return nil
 }
 
-// processDirectoryStreaming processes a directory in streaming fashion
-func (c *Cleaner) processDirectoryStreaming(dir string, olderThan time.Duration, excludedExts []string, forceMode bool) error {
-	batch := make([]string, 0, config.MaxBatchSize)
-
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // Continue walking despite errors
-		}
-
-		if path != dir {
-			batch = append(batch, path)
-
-			// Process batch when it's full
-			if len(batch) >= config.MaxBatchSize {
-				c.SortByDepth(batch)
-				c.ProcessItemsBatch(batch, olderThan, excludedExts, forceMode)
-				batch = batch[:0] // Reset batch
-			}
+// sharedThreshold returns the age threshold when every target uses the same one
+func sharedThreshold(targets []config.Target) (time.Duration, bool) {
+	if len(targets) == 0 {
+		return 0, false
+	}
+	for _, t := range targets[1:] {
+		if t.OlderThan != targets[0].OlderThan {
+			return 0, false
 		}
-
-		return nil
-	})
-
-	// Process remaining items in batch
-	if len(batch) > 0 {
-		c.SortByDepth(batch)
-		c.ProcessItemsBatch(batch, olderThan, excludedExts, forceMode)
 	}
-
-	return err
+	return targets[0].OlderThan, true
 }
 
-// RemoveEmptyDirectories removes empty directories with streaming
-func (c *Cleaner) RemoveEmptyDirectories(directories []string) error {
-	fmt.Println("[*] Scanning for empty directories...")
+// RemoveEmptyDirectories removes empty directories below the targets, and the
+// directories that only held them, keeping directories excluded by a rule.
+// It stops starting new work once ctx is cancelled and then returns ctx's error.
+func (c *Cleaner) RemoveEmptyDirectories(ctx context.Context, targets []config.Target) error {
+	logging.Info("Scanning for empty directories...")
 
-	for _, dir := range directories {
-		if _, err := os.Stat(dir); os.IsNotExist(err) {
+	for _, target := range targets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		dir := target.Path
+		if _, err := c.fs.Stat(dir); os.IsNotExist(err) {
 			continue
 		}
 
-		if err := c.ValidatePath(dir); err != nil {
-			fmt.Printf("[-] Skipping invalid directory %s: %v\n", dir, err)
+		if err := c.validateTarget(dir); err != nil {
+			logging.Warn("Skipping invalid directory", "target", dir, "error", err)
 			continue
 		}
 
-		err := c.processEmptyDirectoriesStreaming(dir)
+		ruleSet, err := c.compileRules(target)
 		if err != nil {
-			fmt.Printf("[-] Error processing empty directories in %s: %v\n", dir, err)
+			logging.Warn("Skipping directory", "target", dir, "error", err)
+			continue
+		}
+
+		c.removeEmpty(ctx, target, ruleSet)
+		if err := ctx.Err(); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-// processEmptyDirectoriesStreaming processes empty directories in batches
-func (c *Cleaner) processEmptyDirectoriesStreaming(dir string) error {
-	batch := make([]string, 0, config.MaxBatchSize)
+// CleanBrowserData removes browser data if browsers aren't running. Browsers
+// are cleaned one after another, each with its directories on the shared pool.
+// Once ctx is cancelled, or a safety limit is reached, no browser is killed and
+// no new directory is started.
+func (c *Cleaner) CleanBrowserData(ctx context.Context, browserInfo map[string][]string, forceMode bool) error {
+	logging.Info("Checking browser data...")
 
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil || !info.IsDir() || path == dir {
-			return nil
+	// Every browser is checked against one process list
+	if err := c.processManager.Refresh(); err != nil {
+		logging.Debug("Could not list processes", "error", err)
+	}
+
+	for _, processName := range slices.Sorted(maps.Keys(browserInfo)) {
+		if ctx.Err() != nil || c.Tripped() != nil {
+			break
 		}
+		c.cleanBrowser(ctx, processName, browserInfo[processName], forceMode)
+	}
 
-		batch = append(batch, path)
+	if trip := c.Tripped(); trip != nil && ctx.Err() == nil {
+		return trip
+	}
+	return ctx.Err()
+}
 
-		// Process batch when it's full
-		if len(batch) >= config.MaxBatchSize {
-			c.SortByDepth(batch)
-			c.processEmptyDirectoryBatch(batch)
-			batch = batch[:0] // Reset batch
+// cleanBrowser skips the directories of a running browser or, in force mode,
+// closes it first
+func (c *Cleaner) cleanBrowser(ctx context.Context, processName string, directories []string, forceMode bool) {
+	running := c.processManager.IsProcessRunning(processName)
+
+	if running && !forceMode {
+		for _, dir := range directories {
+			if info, err := c.fs.Stat(dir); err == nil {
+				_, size := c.measure(dir, info)
+				c.stats.addSkipped(processName, TargetBrowser, size)
+				c.record(PhaseBrowsers, plan.Skip, dir, processName+" is running", size)
+			}
 		}
+		return
+	}
 
-		return nil
-	})
+	if c.plan != nil {
+		if running {
+			c.record(PhaseBrowsers, plan.KillProcess, processName, "force mode, browser is running", 0)
+		}
+		c.cleanBrowserDirectories(ctx, processName, directories, forceMode)
+		return
+	}
 
-	// Process remaining directories
-	if len(batch) > 0 {
-		c.SortByDepth(batch)
-		c.processEmptyDirectoryBatch(batch)
+	if running && forceMode {
+		logging.Info("Closing browser", "process", processName)
+		if err := c.processManager.KillProcess(processName); err != nil {
+			logging.Warn("Failed to kill browser", "process", processName, "error", err)
+			return
+		}
+		logging.Success("Browser stopped", "process", processName)
+		if sleep(ctx, 1*time.Second) != nil {
+			return
+		}
 	}
 
-	return err
+	c.cleanBrowserDirectories(ctx, processName, directories, forceMode)
 }
 
-// processEmptyDirectoryBatch processes a batch of empty directories
-func (c *Cleaner) processEmptyDirectoryBatch(directories []string) {
+// cleanBrowserDirectories cleans browser directories
+func (c *Cleaner) cleanBrowserDirectories(ctx context.Context, processName string, directories []string, forceMode bool) {
 	var wg sync.WaitGroup
+	defer wg.Wait()
 
-	for _, dirPath := range directories {
-		wg.Add(1)
-		c.semaphore <- struct{}{}
+	for _, dir := range directories {
+		if ctx.Err() != nil || c.Tripped() != nil {
+			return
+		}
+		if err := c.ValidatePath(dir); err != nil {
+			logging.Warn("Skipping invalid browser directory", "process", processName, "path", dir, "error", err)
+			continue
+		}
 
-		go func(path string) {
-			defer wg.Done()
-			defer func() { <-c.semaphore }()
+		if c.plan != nil {
+			c.planBrowserDirectory(processName, dir)
+			continue
+		}
 
-			entries, err := os.ReadDir(path)
-			if err == nil && len(entries) == 0 {
-				if err := os.Remove(path); err == nil {
-					c.stats.DeletedFolders.Add(1)
-				}
-			}
-		}(dirPath)
-	}
+		info, err := c.fs.Lstat(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err := c.checkLocation(dir); err != nil {
+			logging.Warn("Skipping invalid browser directory", "process", processName, "path", dir, "error", err)
+			continue
+		}
+		// Measured up front, so the deletion is counted against the safety
+		// limits in order and its bytes are reserved before it starts
+		var files, size int64
+		if info != nil {
+			files, size = c.measure(dir, info)
+		}
+		if !c.reserve(processName, browserAction(processName, dir, info, size), files) {
+			return
+		}
 
-	wg.Wait()
+		c.tune(dir)
+		wg.Add(1)
+		queued := c.pool.Submit(ctx, size, func() int64 {
+			defer wg.Done()
+			return c.removeBrowserDirectory(ctx, processName, dir, info, size, forceMode)
+		})
+		if !queued {
+			wg.Done()
+			return
+		}
+	}
 }
 
-// CleanBrowserData removes browser data if browsers aren't running
-func (c *Cleaner) CleanBrowserData(browserInfo map[string][]string, forceMode bool) error {
-	fmt.Println("[*] Checking browser data...")
-
-	var wg sync.WaitGroup
+// removeBrowserDirectory removes a measured browser data path, trying once
+// more after a pause in force mode; info is nil when it could not be read
+func (c *Cleaner) removeBrowserDirectory(ctx context.Context, processName, dir string, info fs.FileInfo, size int64, forceMode bool) int64 {
+	if ctx.Err() != nil {
+		return 0
+	}
 
-	for proc, dirs := range browserInfo {
-		wg.Add(1)
-		go func(processName string, directories []string) {
-			defer wg.Done()
+	maxRetries := 1
+	if forceMode {
+		maxRetries = 2
+	}
 
-			running := c.processManager.IsProcessRunning(processName)
-
-			if running && forceMode {
-				if err := c.processManager.KillProcess(processName, true); err != nil {
-					fmt.Printf("[-] Failed to kill %s: %v\n", processName, err)
-					return
-				}
-				fmt.Printf("[+] Killed %s\n", processName)
-				time.Sleep(1 * time.Second)
-			} else if running {
-				return
+	for attempt := 1; ; attempt++ {
+		var err error
+		if info == nil {
+			err = c.fs.RemoveAll(dir)
+		} else {
+			err = c.removeItem(dir, info)
+		}
+		if err == nil {
+			c.stats.addDeleted(processName, TargetBrowser, info != nil && info.IsDir(), size)
+			logging.Success("Removed browser data", "process", processName, "path", dir)
+			return size
+		}
+		if attempt == maxRetries {
+			// Count only what was left behind as failed
+			remaining := int64(0)
+			if rest, statErr := c.fs.Stat(dir); statErr == nil {
+				_, remaining = c.measure(dir, rest)
 			}
+			c.stats.addFailed(processName, TargetBrowser, dir, remaining, err)
+			logging.Warn("Failed to remove browser data", "process", processName, "path", dir, "error", err)
+			return 0
+		}
 
-			c.cleanBrowserDirectories(processName, directories, forceMode)
-		}(proc, dirs)
+		if sleep(ctx, 1*time.Second) != nil {
+			return 0
+		}
+		if info, err = c.fs.Lstat(dir); os.IsNotExist(err) {
+			return 0
+		}
+		if err := c.checkLocation(dir); err != nil {
+			logging.Warn("Skipping invalid browser directory", "process", processName, "path", dir, "error", err)
+			return 0
+		}
 	}
-
-	wg.Wait()
-	return nil
 }
 
-// cleanBrowserDirectories cleans browser directories
-func (c *Cleaner) cleanBrowserDirectories(processName string, directories []string, forceMode bool) {
-	var wg sync.WaitGroup
-
-	for _, dir := range directories {
-		if err := c.ValidatePath(dir); err != nil {
-			fmt.Printf("[-] Skipping invalid browser directory %s: %v\n", dir, err)
-			continue
-		}
+// checkLocation returns an error unless path, once the links above it are
+// resolved, passes ValidatePath
+func (c *Cleaner) checkLocation(path string) error {
+	real, err := c.resolveLocation(path)
+	if err != nil {
+		return err
+	}
+	return c.ValidatePath(real)
+}
 
-		wg.Add(1)
-		c.semaphore <- struct{}{}
+// planBrowserDirectory records the removal of a browser data path if it exists
+func (c *Cleaner) planBrowserDirectory(processName, path string) {
+	info, err := c.fs.Lstat(path)
+	if err != nil {
+		return
+	}
+	if err := c.checkLocation(path); err != nil {
+		c.record(PhaseBrowsers, plan.Skip, path, err.Error(), 0)
+		return
+	}
 
-		go func(d string) {
-			defer wg.Done()
-			defer func() { <-c.semaphore }()
+	files, size := c.measure(path, info)
+	action := browserAction(processName, path, info, size)
+	if !c.reserve(processName, action, files) {
+		return
+	}
+	c.stats.addDeleted(processName, TargetBrowser, action.Kind == plan.DeleteDirectory, size)
+	c.plan.Add(action)
+}
 
-			maxRetries := 1
-			if forceMode {
-				maxRetries = 2
-			}
+// browserAction describes the removal of a browser data path; info is nil when
+// it could not be read
+func browserAction(processName, path string, info fs.FileInfo, size int64) plan.Action {
+	kind := plan.DeleteFile
+	switch {
+	case info == nil:
+	case fsys.IsLink(info):
+		kind = plan.Unlink
+	case info.IsDir():
+		kind = plan.DeleteDirectory
+	}
+	return plan.Action{Phase: PhaseBrowsers, Kind: kind, Target: path, Reason: processName + " data", Size: size}
+}
 
-			for attempt := 1; attempt <= maxRetries; attempt++ {
-				_, err := os.Stat(d)
-				if os.IsNotExist(err) {
-					break
-				}
-
-				if attempt > 1 {
-					time.Sleep(1 * time.Second)
-				}
-
-				err = os.RemoveAll(d)
-				if err == nil {
-					fmt.Printf("[+] Removed %s data\n", processName)
-					break
-				} else if attempt == maxRetries {
-					fmt.Printf("[-] Failed to remove %s: %v\n", d, err)
-				}
-			}
-		}(dir)
+// measure returns the number and total size of the files a removal deletes:
+// a file, or the files below a directory. Removing a link deletes one entry
+// and frees nothing.
+func (c *Cleaner) measure(path string, info fs.FileInfo) (files, size int64) {
+	if fsys.IsLink(info) {
+		return 1, 0
+	}
+	if !info.IsDir() {
+		return 1, info.Size()
 	}
 
-	wg.Wait()
+	fsys.Walk(c.fs, path, func(p string, i os.FileInfo, e error) error {
+		if e == nil && !i.IsDir() {
+			files++
+			size += i.Size()
+		}
+		return nil
+	})
+	return files, size
 }
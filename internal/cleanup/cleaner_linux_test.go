@@ -0,0 +1,178 @@
+package cleanup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nScript/internal/config"
+	"nScript/internal/fsys"
+	"nScript/internal/plan"
+)
+
+// linkTree creates a target directory and, next to it, a directory outside the
+// target holding one old file. It returns both directories.
+func linkTree(t *testing.T) (root, outside string) {
+	t.Helper()
+	dir := t.TempDir()
+	root = filepath.Join(dir, "Downloads")
+	outside = filepath.Join(dir, "outside")
+	for _, d := range []string{root, outside} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeOld(t, filepath.Join(outside, "keep.txt"))
+	return root, outside
+}
+
+// writeOld creates a file last modified two days ago
+func writeOld(t *testing.T, path string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func symlink(t *testing.T, oldname, newname string) {
+	t.Helper()
+	if err := os.Symlink(oldname, newname); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newOSCleaner(links config.LinkPolicy) *Cleaner {
+	return NewCleaner(&config.Config{MaxConcurrentOps: 4, Links: links}, fsys.OS{})
+}
+
+func TestLinksAreUnlinkedNotFollowed(t *testing.T) {
+	root, outside := linkTree(t)
+	symlink(t, outside, filepath.Join(root, "dir-link"))
+	symlink(t, filepath.Join(outside, "keep.txt"), filepath.Join(root, "file-link"))
+	writeOld(t, filepath.Join(root, "old.zip"))
+
+	c := newOSCleaner(config.LinkUnlink)
+	if err := c.StreamingCleanDirectories(context.Background(), targets(root), true); err != nil {
+		t.Fatalf("StreamingCleanDirectories: %v", err)
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("%d entries left in the target, want 0", len(entries))
+	}
+	if _, err := os.Stat(filepath.Join(outside, "keep.txt")); err != nil {
+		t.Errorf("file behind the links was removed: %v", err)
+	}
+	if got, want := statsOf(c), (counts{deletedFiles: 3}); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestLinksSkipped(t *testing.T) {
+	root, outside := linkTree(t)
+	link := filepath.Join(root, "dir-link")
+	symlink(t, outside, link)
+
+	c := newOSCleaner(config.LinkSkip)
+	p := plan.New()
+	c.SetPlan(p)
+	c.StreamingCleanDirectories(context.Background(), targets(root), true)
+
+	actions := p.Actions()
+	if len(actions) != 1 || actions[0].Target != link || actions[0].Kind != plan.Skip {
+		t.Errorf("actions = %+v, want one skip of %s", actions, link)
+	}
+}
+
+func TestLinkSkippedInOldDirectory(t *testing.T) {
+	root, outside := linkTree(t)
+	dir := filepath.Join(root, "old", "nested")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "dir-link")
+	symlink(t, outside, link)
+	writeOld(t, filepath.Join(dir, "old.zip"))
+	old := time.Now().Add(-48 * time.Hour)
+	for _, d := range []string{dir, filepath.Dir(dir)} {
+		if err := os.Chtimes(d, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := newOSCleaner(config.LinkSkip)
+	if err := c.StreamingCleanDirectories(context.Background(), targets(root), false); err != nil {
+		t.Fatalf("StreamingCleanDirectories: %v", err)
+	}
+
+	// The old directories are kept for the link; the file next to it goes
+	if _, err := os.Lstat(link); err != nil {
+		t.Errorf("skipped link was removed with its directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.zip")); !os.IsNotExist(err) {
+		t.Errorf("old.zip next to the link was not removed: %v", err)
+	}
+	if got, want := statsOf(c), (counts{deletedFiles: 1, skipped: 3}); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestDryRunPlansUnlink(t *testing.T) {
+	root, outside := linkTree(t)
+	link := filepath.Join(root, "dir-link")
+	symlink(t, outside, link)
+
+	c := newOSCleaner(config.LinkUnlink)
+	p := plan.New()
+	c.SetPlan(p)
+	c.StreamingCleanDirectories(context.Background(), targets(root), true)
+
+	actions := p.Actions()
+	if len(actions) != 1 || actions[0].Target != link || actions[0].Kind != plan.Unlink {
+		t.Errorf("actions = %+v, want one unlink of %s", actions, link)
+	}
+	if _, err := os.Lstat(link); err != nil {
+		t.Errorf("dry run removed the link: %v", err)
+	}
+}
+
+func TestDeletionThroughLinkedParentIsRefused(t *testing.T) {
+	// A directory replaced by a link after the walk listed its contents
+	root, outside := linkTree(t)
+	symlink(t, outside, filepath.Join(root, "sub"))
+
+	c := newOSCleaner(config.LinkUnlink)
+	tgt := target(root)
+	c.CleanItems(context.Background(), tgt, ruleSetFor(t, c, tgt), []string{filepath.Join(root, "sub", "keep.txt")}, true)
+
+	if _, err := os.Stat(filepath.Join(outside, "keep.txt")); err != nil {
+		t.Errorf("file outside the target was removed: %v", err)
+	}
+	if got, want := statsOf(c), (counts{skipped: 1}); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestLinkedTargetIsFollowed(t *testing.T) {
+	root, outside := linkTree(t)
+	linkedRoot := filepath.Join(root, "linked")
+	symlink(t, outside, linkedRoot)
+
+	c := newOSCleaner(config.LinkUnlink)
+	if err := c.StreamingCleanDirectories(context.Background(), targets(linkedRoot), true); err != nil {
+		t.Fatalf("StreamingCleanDirectories: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "keep.txt")); !os.IsNotExist(err) {
+		t.Errorf("file in the linked target was not removed: %v", err)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package cleanup
+
+import "testing"
+
+func TestValidatePath(t *testing.T) {
+	c, _ := newTestCleaner(t, 1)
+
+	for _, path := range []string{"", "/usr/lib", "/etc", "/", "usr/lib"} {
+		if err := c.ValidatePath(path); err == nil {
+			t.Errorf("ValidatePath(%q) = nil, want error", path)
+		}
+	}
+	for _, path := range []string{home("Downloads"), "/usrdata"} {
+		if err := c.ValidatePath(path); err != nil {
+			t.Errorf("ValidatePath(%q) = %v, want nil", path, err)
+		}
+	}
+}
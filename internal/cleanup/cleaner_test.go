@@ -0,0 +1,737 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"nScript/internal/breaker"
+	"nScript/internal/config"
+	"nScript/internal/fsys"
+	"nScript/internal/plan"
+	"nScript/internal/profiles"
+	"nScript/internal/quarantine"
+	"nScript/internal/rules"
+	"nScript/internal/tweaks"
+	"nScript/internal/winreg"
+)
+
+var excludedExts = []string{".iso", ".lnk"}
+
+func home(parts ...string) string {
+	return filepath.Join(append([]string{string(filepath.Separator), "home", "student"}, parts...)...)
+}
+
+func newTestCleaner(t *testing.T, maxOps int) (*Cleaner, *fsys.Mem) {
+	t.Helper()
+	mem := fsys.NewMem()
+	cfg := &config.Config{
+		Rules:              config.Default().Rules,
+		ExcludedExtensions: excludedExts,
+		MaxConcurrentOps:   maxOps,
+	}
+	return NewCleaner(cfg, mem), mem
+}
+
+func target(path string) config.Target {
+	return config.Target{Path: path, OlderThan: 24 * time.Hour, AgeSource: config.AgeModified}
+}
+
+func targets(paths ...string) []config.Target {
+	list := make([]config.Target, 0, len(paths))
+	for _, path := range paths {
+		list = append(list, target(path))
+	}
+	return list
+}
+
+func ruleSetFor(t *testing.T, c *Cleaner, target config.Target) *rules.Set {
+	t.Helper()
+	ruleSet, err := c.compileRules(target)
+	if err != nil {
+		t.Fatalf("compileRules: %v", err)
+	}
+	return ruleSet
+}
+
+type counts struct {
+	deletedFiles, deletedFolders, skipped, failed int64
+}
+
+func statsOf(c *Cleaner) counts {
+	s := c.GetStats()
+	return counts{s.DeletedFiles.Load(), s.DeletedFolders.Load(), s.SkippedFiles.Load(), s.FailedFiles.Load()}
+}
+
+func TestShouldExclude(t *testing.T) {
+	c, mem := newTestCleaner(t, 1)
+	ruleSet := ruleSetFor(t, c, target(home()))
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{home("Downloads", "ubuntu.iso"), true},
+		{home("Downloads", "UBUNTU.ISO"), true},
+		{home("Desktop", "Word.lnk"), true},
+		{home("Desktop", "Roblox Player.lnk"), false},
+		{home("Desktop", "Steam.lnk"), false},
+		{home("Desktop", "Epic Games Launcher.lnk"), false},
+		{home("Downloads", "steam.iso.zip"), false},
+		{home("Downloads", "notes.txt"), false},
+		{home("Downloads", "noextension"), false},
+	}
+
+	for _, tt := range tests {
+		mem.AddFile(tt.path, nil, time.Now())
+		info, err := mem.Stat(tt.path)
+		if err != nil {
+			t.Fatalf("Stat: %v", err)
+		}
+		if _, got := c.ShouldExclude(ruleSet, target(home()), tt.path, info); got != tt.want {
+			t.Errorf("ShouldExclude(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestTargetRules(t *testing.T) {
+	c, mem := newTestCleaner(t, 4)
+	old := time.Now().Add(-48 * time.Hour)
+	mem.AddFile(home("Documents", "School", "essay.docx"), []byte("essay"), old)
+	mem.AddFile(home("Documents", "Games", "slot1.sav"), []byte("save"), old)
+	mem.AddFile(home("Documents", "Games", "big.sav"), make([]byte, 2048), old)
+	mem.AddFile(home("Documents", "notes.txt"), []byte("notes"), old)
+	mem.AddDir(home("Documents", "School", "Empty"), old)
+
+	documents := target(home("Documents"))
+	documents.Rules = []rules.Rule{
+		rules.Parse("!School/**"),
+		{Action: rules.Include, Pattern: "**/*.sav", MinSize: 1024},
+		rules.Parse("!*.sav"),
+	}
+	c.StreamingCleanDirectories(context.Background(), []config.Target{documents}, false)
+	c.RemoveEmptyDirectories(context.Background(), []config.Target{documents})
+
+	for _, path := range []string{home("Documents", "School", "essay.docx"), home("Documents", "School", "Empty"), home("Documents", "Games", "slot1.sav")} {
+		if !mem.Exists(path) {
+			t.Errorf("%s was removed despite an exclude rule", path)
+		}
+	}
+	for _, path := range []string{home("Documents", "Games", "big.sav"), home("Documents", "notes.txt")} {
+		if mem.Exists(path) {
+			t.Errorf("%s was kept", path)
+		}
+	}
+}
+
+func TestProcessItem(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+	young := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		setup     func(mem *fsys.Mem)
+		path      string
+		force     bool
+		want      counts
+		wantExist bool
+	}{
+		{
+			name:  "old file is deleted",
+			setup: func(mem *fsys.Mem) { mem.AddFile(home("Downloads", "a.zip"), []byte("x"), old) },
+			path:  home("Downloads", "a.zip"),
+			want:  counts{deletedFiles: 1},
+		},
+		{
+			name:      "young file is kept",
+			setup:     func(mem *fsys.Mem) { mem.AddFile(home("Downloads", "a.zip"), nil, young) },
+			path:      home("Downloads", "a.zip"),
+			wantExist: true,
+		},
+		{
+			name:  "force mode deletes young file",
+			setup: func(mem *fsys.Mem) { mem.AddFile(home("Downloads", "a.zip"), nil, young) },
+			path:  home("Downloads", "a.zip"),
+			force: true,
+			want:  counts{deletedFiles: 1},
+		},
+		{
+			name:      "excluded extension is skipped",
+			setup:     func(mem *fsys.Mem) { mem.AddFile(home("Downloads", "win.iso"), nil, old) },
+			path:      home("Downloads", "win.iso"),
+			force:     true,
+			want:      counts{skipped: 1},
+			wantExist: true,
+		},
+		{
+			name:  "excluded extension with allowed keyword is deleted",
+			setup: func(mem *fsys.Mem) { mem.AddFile(home("Desktop", "osu!.lnk"), nil, old) },
+			path:  home("Desktop", "osu!.lnk"),
+			want:  counts{deletedFiles: 1},
+		},
+		{
+			name: "locked file is skipped",
+			setup: func(mem *fsys.Mem) {
+				mem.AddFile(home("Downloads", "a.zip"), nil, old)
+				mem.Lock(home("Downloads", "a.zip"))
+			},
+			path:      home("Downloads", "a.zip"),
+			want:      counts{skipped: 1},
+			wantExist: true,
+		},
+		{
+			name: "old directory is deleted with its young contents",
+			setup: func(mem *fsys.Mem) {
+				mem.AddFile(home("Documents", "game", "save.dat"), nil, young)
+				mem.AddDir(home("Documents", "game"), old)
+			},
+			path: home("Documents", "game"),
+			want: counts{deletedFolders: 1},
+		},
+		{
+			name: "directory containing excluded files is kept",
+			setup: func(mem *fsys.Mem) {
+				mem.AddFile(home("Documents", "vm", "disk.iso"), nil, old)
+				mem.AddDir(home("Documents", "vm"), old)
+			},
+			path:      home("Documents", "vm"),
+			want:      counts{skipped: 2},
+			wantExist: true,
+		},
+		{
+			name: "directory with a locked file fails",
+			setup: func(mem *fsys.Mem) {
+				mem.AddFile(home("Documents", "app", "app.log"), nil, young)
+				mem.AddDir(home("Documents", "app"), old)
+				mem.Lock(home("Documents", "app", "app.log"))
+			},
+			path:      home("Documents", "app"),
+			want:      counts{failed: 1},
+			wantExist: true,
+		},
+		{
+			name: "directory with a locked old file is kept",
+			setup: func(mem *fsys.Mem) {
+				mem.AddFile(home("Documents", "app", "app.log"), nil, old)
+				mem.AddDir(home("Documents", "app"), old)
+				mem.Lock(home("Documents", "app", "app.log"))
+			},
+			path:      home("Documents", "app"),
+			want:      counts{skipped: 2},
+			wantExist: true,
+		},
+		{
+			name:  "missing path fails",
+			setup: func(mem *fsys.Mem) {},
+			path:  home("Downloads", "gone.zip"),
+			want:  counts{failed: 1},
+		},
+		{
+			name: "permission denied fails",
+			setup: func(mem *fsys.Mem) {
+				mem.AddFile(home("AppData", "x", "y.dat"), nil, old)
+				mem.Deny(home("AppData", "x"))
+			},
+			path: home("AppData", "x", "y.dat"),
+			want: counts{failed: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, mem := newTestCleaner(t, 1)
+			tt.setup(mem)
+
+			c.CleanItems(context.Background(), target(home()), ruleSetFor(t, c, target(home())), []string{tt.path}, tt.force)
+
+			if got := statsOf(c); got != tt.want {
+				t.Errorf("stats = %+v, want %+v", got, tt.want)
+			}
+			if tt.name == "permission denied fails" {
+				return
+			}
+			if exists := mem.Exists(tt.path); exists != tt.wantExist {
+				t.Errorf("exists = %v, want %v", exists, tt.wantExist)
+			}
+		})
+	}
+}
+
+func TestTargetAgeSource(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	recent := now.Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		source    config.AgeSource
+		olderThan time.Duration
+		times     fsys.Times
+		wantKept  bool
+		reason    string
+	}{
+		{"modified ignores recent access", config.AgeModified, 24 * time.Hour, fsys.Times{Modified: old, Accessed: recent, Created: old}, false, "modified 2d ago"},
+		{"accessed keeps recently opened file", config.AgeAccessed, 24 * time.Hour, fsys.Times{Modified: old, Accessed: recent, Created: old}, true, "accessed 1h ago, not older than 1d"},
+		{"created", config.AgeCreated, 24 * time.Hour, fsys.Times{Modified: recent, Accessed: recent, Created: old}, false, "created 2d ago"},
+		{"newest uses most recent timestamp", config.AgeNewest, 24 * time.Hour, fsys.Times{Modified: old, Accessed: old, Created: recent}, true, "newest timestamp 1h ago"},
+		{"zero threshold cleans immediately", config.AgeModified, 0, fsys.Times{Modified: now, Accessed: now, Created: now}, false, "regardless of age"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, mem := newTestCleaner(t, 1)
+			path := home("AppData", "Local", "Temp", "setup.log")
+			mem.AddFile(path, nil, tt.times.Modified)
+			mem.SetTimes(path, tt.times)
+
+			p := plan.New()
+			c.SetPlan(p)
+			temp := config.Target{Path: home("AppData", "Local", "Temp"), OlderThan: tt.olderThan, AgeSource: tt.source}
+			c.CleanItems(context.Background(), temp, ruleSetFor(t, c, temp), []string{path}, false)
+
+			actions := p.Actions()
+			if len(actions) != 1 {
+				t.Fatalf("actions = %+v", actions)
+			}
+			if kept := actions[0].Kind == plan.Skip; kept != tt.wantKept {
+				t.Errorf("kept = %v, want %v (%+v)", kept, tt.wantKept, actions[0])
+			}
+			if !strings.Contains(actions[0].Reason, tt.reason) {
+				t.Errorf("reason = %q, want it to contain %q", actions[0].Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestPlanReasonNamesMatchedRule(t *testing.T) {
+	c, mem := newTestCleaner(t, 1)
+	old := time.Now().Add(-48 * time.Hour)
+	mem.AddFile(home("Desktop", "Steam.lnk"), nil, old)
+	mem.AddFile(home("Desktop", "game", "disk.iso"), nil, old)
+	mem.AddDir(home("Desktop", "game"), old)
+
+	p := plan.New()
+	c.SetPlan(p)
+	desktop := target(home("Desktop"))
+	c.CleanItems(context.Background(), desktop, ruleSetFor(t, c, desktop), []string{home("Desktop", "Steam.lnk"), home("Desktop", "game")}, false)
+
+	reasons := make(map[string]string)
+	for _, a := range p.Actions() {
+		reasons[a.Target] = a.Reason
+	}
+	if got := reasons[home("Desktop", "Steam.lnk")]; !strings.Contains(got, "name contains 'steam'") {
+		t.Errorf("Steam.lnk reason = %q", got)
+	}
+	if got := reasons[home("Desktop", "game")]; got != "contains excluded files (excluded extension .iso)" {
+		t.Errorf("game reason = %q", got)
+	}
+}
+
+func TestProcessItemsBatchSkipsCriticalPaths(t *testing.T) {
+	c, mem := newTestCleaner(t, 4)
+	old := time.Now().Add(-48 * time.Hour)
+	mem.AddFile(home("Downloads", "a.zip"), nil, old)
+	mem.AddFile(home("Downloads", "b.zip"), nil, old)
+
+	c.CleanItems(context.Background(), target(home("Downloads")), ruleSetFor(t, c, target(home("Downloads"))), []string{
+		home("Downloads", "a.zip"),
+		`C:\Windows\System32\kernel32.dll`,
+		home("Downloads", "b.zip"),
+	}, false)
+
+	if got, want := statsOf(c), (counts{deletedFiles: 2, skipped: 1}); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestStreamingCleanDirectoriesBeyondTheQueue(t *testing.T) {
+	c, mem := newTestCleaner(t, 8)
+	old := time.Now().Add(-48 * time.Hour)
+	now := time.Now()
+
+	// More files than the queue holds, spread over young directories that must survive
+	total := config.QueueSize + config.QueueSize/2
+	for i := 0; i < total; i++ {
+		mem.AddFile(home("Downloads", fmt.Sprintf("dir%02d", i%20), fmt.Sprintf("file%04d.tmp", i)), nil, old)
+	}
+	for i := 0; i < 20; i++ {
+		mem.AddDir(home("Downloads", fmt.Sprintf("dir%02d", i)), now)
+	}
+	mem.AddFile(home("Downloads", "keep.iso"), nil, old)
+	mem.AddFile(home("Downloads", "new.txt"), nil, now)
+	mem.AddDir(home("Downloads"), now)
+
+	err := c.StreamingCleanDirectories(context.Background(), targets(home("Downloads"), home("Missing")), false)
+	if err != nil {
+		t.Fatalf("StreamingCleanDirectories: %v", err)
+	}
+
+	if got, want := statsOf(c), (counts{deletedFiles: int64(total), skipped: 1}); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+	for _, path := range []string{home("Downloads", "keep.iso"), home("Downloads", "new.txt"), home("Downloads", "dir00")} {
+		if !mem.Exists(path) {
+			t.Errorf("%s was removed", path)
+		}
+	}
+	if mem.Exists(home("Downloads", "dir00", "file0000.tmp")) {
+		t.Error("old file was not removed")
+	}
+}
+
+func TestCancelledContextStartsNoWork(t *testing.T) {
+	c, mem := newTestCleaner(t, 4)
+	old := time.Now().Add(-48 * time.Hour)
+	mem.AddFile(home("Downloads", "a.tmp"), nil, old)
+	mem.AddDir(home("Downloads", "empty"), old)
+	mem.AddFile(home("AppData", "Chrome", "cache.bin"), nil, old)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := c.StreamingCleanDirectories(ctx, targets(home("Downloads")), false); !errors.Is(err, context.Canceled) {
+		t.Errorf("StreamingCleanDirectories = %v, want context.Canceled", err)
+	}
+	if err := c.CleanBrowserData(ctx, map[string][]string{"chrome.exe": {home("AppData", "Chrome")}}, false); !errors.Is(err, context.Canceled) {
+		t.Errorf("CleanBrowserData = %v, want context.Canceled", err)
+	}
+	if err := c.RemoveEmptyDirectories(ctx, targets(home("Downloads"))); !errors.Is(err, context.Canceled) {
+		t.Errorf("RemoveEmptyDirectories = %v, want context.Canceled", err)
+	}
+	c.CleanItems(ctx, target(home("Downloads")), ruleSetFor(t, c, target(home("Downloads"))), []string{home("Downloads", "a.tmp")}, false)
+
+	for _, path := range []string{home("Downloads", "a.tmp"), home("Downloads", "empty"), home("AppData", "Chrome", "cache.bin")} {
+		if !mem.Exists(path) {
+			t.Errorf("%s was removed after cancellation", path)
+		}
+	}
+	if got := statsOf(c); got != (counts{}) {
+		t.Errorf("stats = %+v, want nothing processed", got)
+	}
+}
+
+func TestBytesAccountingPerTarget(t *testing.T) {
+	c, mem := newTestCleaner(t, 4)
+	old := time.Now().Add(-48 * time.Hour)
+	mem.AddFile(home("Downloads", "a.zip"), []byte("1234567890"), old)
+	mem.AddFile(home("Downloads", "keep.iso"), []byte("123"), old)
+	mem.AddFile(home("Desktop", "b.txt"), []byte("12345"), old)
+	mem.AddFile(home("Desktop", "locked.txt"), []byte("12"), old)
+	mem.Lock(home("Desktop", "locked.txt"))
+	// A locked old file is skipped and keeps its directory
+	mem.AddFile(home("Desktop", "app", "app.log"), []byte("1234"), old)
+	mem.AddDir(home("Desktop", "app"), old)
+	mem.Lock(home("Desktop", "app", "app.log"))
+	// A young file goes with its old directory, which fails while the file is locked
+	mem.AddFile(home("Desktop", "cache", "cache.db"), []byte("1234"), time.Now())
+	mem.AddDir(home("Desktop", "cache"), old)
+	mem.Lock(home("Desktop", "cache", "cache.db"))
+
+	c.StreamingCleanDirectories(context.Background(), targets(home("Downloads")), false)
+	c.CleanItems(context.Background(), target(home("Desktop")), ruleSetFor(t, c, target(home("Desktop"))), []string{home("Desktop", "b.txt"), home("Desktop", "locked.txt"), home("Desktop", "app"), home("Desktop", "cache")}, false)
+
+	s := c.GetStats()
+	if freed, skipped, failed := s.BytesFreed.Load(), s.BytesSkipped.Load(), s.BytesFailed.Load(); freed != 15 || skipped != 9 || failed != 4 {
+		t.Errorf("bytes freed/skipped/failed = %d/%d/%d, want 15/9/4", freed, skipped, failed)
+	}
+
+	targets := s.Targets()
+	if len(targets) != 2 {
+		t.Fatalf("targets = %+v", targets)
+	}
+	if got := targets[0]; got.Name != home("Downloads") || got.Kind != TargetDirectory || got.BytesFreed != 10 || got.BytesSkipped != 3 || got.DeletedFiles != 1 {
+		t.Errorf("first target = %+v", got)
+	}
+	if got := targets[1]; got.Name != home("Desktop") || got.BytesFreed != 5 || got.BytesFailed != 4 || got.Failed != 1 {
+		t.Errorf("second target = %+v", got)
+	}
+
+	failures, omitted := s.Failures()
+	if len(failures) != 1 || omitted != 0 || failures[0].Path != home("Desktop", "cache") || failures[0].Phase != PhaseFiles || failures[0].Err == "" {
+		t.Errorf("failures = %+v, %d omitted", failures, omitted)
+	}
+}
+
+func TestBrowserRetryStopsOnCancel(t *testing.T) {
+	c, mem := newTestCleaner(t, 4)
+	mem.AddFile(home("AppData", "Chrome", "cache.bin"), nil, time.Now())
+	mem.Lock(home("AppData", "Chrome", "cache.bin"))
+
+	// Force mode retries a failed removal after a pause, which cancelling cuts short
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	c.CleanBrowserData(ctx, map[string][]string{"chrome.exe": {home("AppData", "Chrome")}}, true)
+
+	if took := time.Since(start); took > 500*time.Millisecond {
+		t.Errorf("CleanBrowserData took %v after the context was cancelled", took)
+	}
+	if !mem.Exists(home("AppData", "Chrome", "cache.bin")) {
+		t.Error("locked file was removed")
+	}
+}
+
+func TestRemoveEmptyDirectories(t *testing.T) {
+	c, mem := newTestCleaner(t, config.MaxConcurrentOps)
+	now := time.Now()
+	mem.AddDir(home("Documents", "a", "b", "c"), now)
+	// Many siblings whose parent must wait for all of them
+	for i := range 50 {
+		mem.AddDir(home("Documents", "wide", fmt.Sprintf("d%02d", i), "inner"), now)
+	}
+	mem.AddFile(home("Documents", "full", "doc.txt"), nil, now)
+	mem.AddDir(home("Documents", "locked", "inner"), now)
+	mem.Deny(home("Documents", "locked"))
+
+	if err := c.RemoveEmptyDirectories(context.Background(), targets(home("Documents"), home("Missing"))); err != nil {
+		t.Fatalf("RemoveEmptyDirectories: %v", err)
+	}
+
+	if mem.Exists(home("Documents", "a")) || mem.Exists(home("Documents", "wide")) {
+		t.Error("nested empty directories were not removed")
+	}
+	for _, path := range []string{home("Documents"), home("Documents", "full"), home("Documents", "locked")} {
+		if !mem.Exists(path) {
+			t.Errorf("%s was removed", path)
+		}
+	}
+	if got := statsOf(c).deletedFolders; got != 104 {
+		t.Errorf("deleted folders = %d, want 104", got)
+	}
+}
+
+func TestEmptyDirectoriesPlanMatchesRun(t *testing.T) {
+	tree := func(mem *fsys.Mem) {
+		now := time.Now()
+		for i := range 20 {
+			mem.AddDir(home("Downloads", fmt.Sprintf("d%02d", i), "a", "b"), now)
+		}
+		mem.AddFile(home("Downloads", "d03", "a", "keep.txt"), nil, now)
+		mem.AddDir(home("Downloads", "d07", "a", "b", "c"), now)
+	}
+
+	planner, planMem := newTestCleaner(t, config.MaxConcurrentOps)
+	tree(planMem)
+	p := plan.New()
+	planner.SetPlan(p)
+	planner.RemoveEmptyDirectories(context.Background(), targets(home("Downloads")))
+
+	runner, runMem := newTestCleaner(t, config.MaxConcurrentOps)
+	tree(runMem)
+	runner.RemoveEmptyDirectories(context.Background(), targets(home("Downloads")))
+
+	planned := 0
+	for _, a := range p.Actions() {
+		if runMem.Exists(a.Target) {
+			t.Errorf("planned %s, which a real run keeps", a.Target)
+		}
+		planned++
+	}
+	if removed := statsOf(runner).deletedFolders; int64(planned) != removed {
+		t.Errorf("planned %d removals, a real run made %d", planned, removed)
+	}
+	if !runMem.Exists(home("Downloads", "d03", "a", "keep.txt")) || runMem.Exists(home("Downloads", "d03", "a", "b")) {
+		t.Error("wrong directories removed around the kept file")
+	}
+}
+
+func TestSafetyLimitHaltsPhase(t *testing.T) {
+	c, mem := newTestCleaner(t, 1)
+	c.breaker = breaker.New(breaker.Limits{Run: breaker.Ceiling{Files: 2}}, volumeOf)
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"a.zip", "b.zip", "c.zip", "d.zip"} {
+		mem.AddFile(home("Downloads", name), []byte("12345"), old)
+	}
+	mem.AddFile(home("AppData", "Chrome", "cache.bin"), nil, old)
+
+	err := c.StreamingCleanDirectories(context.Background(), targets(home("Downloads")), false)
+	var trip *breaker.Trip
+	if !errors.As(err, &trip) || trip.Limit != breaker.LimitFiles || trip.Scope != breaker.ScopeRun {
+		t.Fatalf("StreamingCleanDirectories = %v, want a run files trip", err)
+	}
+	if c.Tripped() != trip {
+		t.Errorf("Tripped = %v, want %v", c.Tripped(), trip)
+	}
+	if got, want := statsOf(c), (counts{deletedFiles: 2}); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+
+	// The item that would have exceeded the ceiling is kept as a plan
+	held := c.Held().Actions()
+	if len(held) != 1 || held[0].Kind != plan.DeleteFile || held[0].Size != 5 || !mem.Exists(held[0].Target) {
+		t.Errorf("held = %+v, want the existing third file", held)
+	}
+
+	// Later phases delete nothing
+	if err := c.CleanBrowserData(context.Background(), map[string][]string{"chrome.exe": {home("AppData", "Chrome")}}, false); !errors.As(err, &trip) {
+		t.Errorf("CleanBrowserData = %v, want the trip", err)
+	}
+	if !mem.Exists(home("AppData", "Chrome", "cache.bin")) {
+		t.Error("browser data was removed after the trip")
+	}
+}
+
+func TestSafetyLimitPerTarget(t *testing.T) {
+	c, mem := newTestCleaner(t, 1)
+	c.breaker = breaker.New(breaker.Limits{Target: breaker.Ceiling{Bytes: 12}}, volumeOf)
+	old := time.Now().Add(-48 * time.Hour)
+	mem.AddFile(home("Desktop", "a.txt"), []byte("12345678"), old)
+	mem.AddFile(home("Downloads", "a.zip"), []byte("12345678"), old)
+	mem.AddFile(home("Downloads", "cache", "b.zip"), []byte("12345678"), old)
+	mem.AddDir(home("Downloads", "cache"), old)
+
+	p := plan.New()
+	c.SetPlan(p)
+	c.StreamingCleanDirectories(context.Background(), targets(home("Desktop"), home("Downloads")), false)
+
+	trip := c.Tripped()
+	if trip == nil || trip.Limit != breaker.LimitBytes || trip.Scope != breaker.ScopeTarget || trip.Target != home("Downloads") || trip.Value != 16 {
+		t.Fatalf("Tripped = %+v, want the bytes ceiling of Downloads", trip)
+	}
+	// Dry runs plan only what a real run would delete before it stops
+	if actions := p.Actions(); len(actions) != 2 {
+		t.Errorf("planned = %+v, want the two files below the ceilings", actions)
+	}
+	if held := c.Held().Actions(); len(held) != 1 {
+		t.Errorf("held = %+v, want one action", held)
+	}
+}
+
+func TestDryRunTouchesNothing(t *testing.T) {
+	c, mem := newTestCleaner(t, 4)
+	old := time.Now().Add(-48 * time.Hour)
+	now := time.Now()
+	mem.AddFile(home("Downloads", "old.zip"), []byte("12345"), old)
+	mem.AddFile(home("Downloads", "new.zip"), nil, now)
+	mem.AddFile(home("Downloads", "disk.iso"), nil, old)
+	mem.AddDir(home("Downloads", "empty", "nested"), now)
+	mem.AddDir(home("Downloads"), now)
+
+	p := plan.New()
+	c.SetPlan(p)
+	c.StreamingCleanDirectories(context.Background(), targets(home("Downloads")), false)
+	c.RemoveEmptyDirectories(context.Background(), targets(home("Downloads")))
+
+	for _, path := range []string{home("Downloads", "old.zip"), home("Downloads", "new.zip"), home("Downloads", "empty", "nested")} {
+		if !mem.Exists(path) {
+			t.Errorf("dry run removed %s", path)
+		}
+	}
+
+	byTarget := make(map[string]plan.Action)
+	for _, action := range p.Actions() {
+		byTarget[action.Target] = action
+	}
+
+	if a := byTarget[home("Downloads", "old.zip")]; a.Kind != plan.DeleteFile || a.Size != 5 || !strings.Contains(a.Reason, "older than") {
+		t.Errorf("old.zip action = %+v", a)
+	}
+	if a := byTarget[home("Downloads", "disk.iso")]; a.Kind != plan.Skip || !strings.Contains(a.Reason, "excluded extension .iso") {
+		t.Errorf("disk.iso action = %+v", a)
+	}
+	if a := byTarget[home("Downloads", "new.zip")]; a.Kind != plan.Skip {
+		t.Errorf("new.zip action = %+v", a)
+	}
+	for _, dir := range []string{home("Downloads", "empty"), home("Downloads", "empty", "nested")} {
+		if a := byTarget[dir]; a.Kind != plan.DeleteDirectory || a.Phase != PhaseEmptyDirs {
+			t.Errorf("%s action = %+v", dir, a)
+		}
+	}
+}
+
+func TestQuarantineModeMovesInsteadOfDeleting(t *testing.T) {
+	c, mem := newTestCleaner(t, 4)
+	old := time.Now().Add(-48 * time.Hour)
+	mem.AddFile(home("Downloads", "old.zip"), []byte("zip"), old)
+	mem.AddFile(home("Downloads", "new.zip"), nil, time.Now())
+	mem.AddDir(home("Downloads"), time.Now())
+
+	store := quarantine.NewStore(mem, filepath.Join(string(filepath.Separator), "quarantine"))
+	run, err := store.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	c.SetQuarantine(run)
+
+	c.StreamingCleanDirectories(context.Background(), targets(home("Downloads")), false)
+
+	if mem.Exists(home("Downloads", "old.zip")) || !mem.Exists(home("Downloads", "new.zip")) {
+		t.Fatal("quarantine moved the wrong files")
+	}
+	if got := statsOf(c).deletedFiles; got != 1 {
+		t.Errorf("deleted files = %d, want 1", got)
+	}
+
+	entries, err := store.Entries(run.ID())
+	if err != nil || len(entries) != 1 || entries[0].Original != home("Downloads", "old.zip") {
+		t.Fatalf("entries = %+v, %v", entries, err)
+	}
+	if _, err := store.Restore(run.ID(), ""); err != nil || !mem.Exists(home("Downloads", "old.zip")) {
+		t.Errorf("restore failed: %v", err)
+	}
+}
+
+func TestOperations(t *testing.T) {
+	// Every phase and Windows operation is either reserved or made of built-in tweaks
+	builtin := tweaks.Names(tweaks.Defaults())
+	for _, name := range append(slices.Clone(Phases), WindowsOperations...) {
+		if slices.Contains(tweaks.Reserved, name) == slices.Contains(builtin, name) {
+			t.Errorf("%s must be either reserved or a built-in registry operation", name)
+		}
+	}
+
+	list := append(tweaks.Defaults(),
+		tweaks.Tweak{Name: "wordwheel-query"}, tweaks.Tweak{Name: "dark-mode"}, tweaks.Tweak{Name: "wallpaper"})
+	want := append(slices.Clone(WindowsOperations), "wordwheel-query", "wallpaper")
+	if got := Operations(list); !slices.Equal(got, want) {
+		t.Errorf("Operations() = %q, want %q", got, want)
+	}
+}
+
+func TestMountHive(t *testing.T) {
+	reg := winreg.NewMem()
+	wc := &WindowsCleaner{reg: reg, hives: reg}
+	profile := func(name, sid string) user {
+		return profileUser(profiles.Profile{User: name, SID: sid, Home: home("..", name)})
+	}
+
+	// A signed-in user's hive is already mounted and is left alone
+	signedIn := profile("alice", "S-1-5-21-1-1001")
+	reg.CreateKey(winreg.Users, signedIn.profile.SID, winreg.Write)
+	wc.mountHive(&signedIn)()
+	if signedIn.hive != HiveSignedIn || signedIn.hiveErr != nil || !reg.Exists(winreg.Users, signedIn.profile.SID) {
+		t.Errorf("signed in: %q, %v", signedIn.hive, signedIn.hiveErr)
+	}
+
+	// A signed-out user's hive is loaded until the returned function runs
+	signedOut := profile("bob", "S-1-5-21-1-1002")
+	reg.AddHive(signedOut.profile.Hive())
+	unmount := wc.mountHive(&signedOut)
+	if signedOut.hive != HiveLoaded || !reg.Exists(winreg.Users, signedOut.profile.SID) {
+		t.Fatalf("signed out: %q, %v", signedOut.hive, signedOut.hiveErr)
+	}
+	unmount()
+	if reg.Exists(winreg.Users, signedOut.profile.SID) {
+		t.Error("hive still loaded after unmount")
+	}
+
+	missing := profile("carol", "S-1-5-21-1-1003")
+	wc.mountHive(&missing)()
+	if missing.hive != HiveUnavailable || missing.hiveErr == nil {
+		t.Errorf("missing hive: %q, %v", missing.hive, missing.hiveErr)
+	}
+
+	// A dry run records the load instead of doing it
+	wc.plan = plan.New()
+	preview := profile("bob", "S-1-5-21-1-1002")
+	wc.mountHive(&preview)()
+	actions := wc.plan.Actions()
+	if preview.hive != HiveNotPreviewed || reg.Exists(winreg.Users, preview.profile.SID) || len(actions) != 1 || actions[0].Kind != plan.LoadRegistryHive {
+		t.Errorf("dry run: %q, %+v", preview.hive, actions)
+	}
+}
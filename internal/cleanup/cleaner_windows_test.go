@@ -0,0 +1,34 @@
+package cleanup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidatePath(t *testing.T) {
+	systemRoot, profile := os.Getenv("SystemRoot"), os.Getenv("USERPROFILE")
+	if systemRoot == "" || profile == "" {
+		t.Skip("SystemRoot or USERPROFILE is not set")
+	}
+	c, _ := newTestCleaner(t, 1)
+
+	for _, path := range []string{
+		"",
+		filepath.Join(systemRoot, "System32", "drivers"),
+		strings.ToLower(filepath.Join(systemRoot, "SysWOW64")),
+		filepath.Join(os.Getenv("ProgramFiles"), "Windows NT", "Accessories"),
+		filepath.VolumeName(systemRoot) + `\`,
+		`\Windows\System32`,
+	} {
+		if err := c.ValidatePath(path); err == nil {
+			t.Errorf("ValidatePath(%q) = nil, want error", path)
+		}
+	}
+	for _, path := range []string{filepath.Join(profile, "Downloads"), filepath.Join(profile, "Desktop", "osu!.lnk")} {
+		if err := c.ValidatePath(path); err != nil {
+			t.Errorf("ValidatePath(%q) = %v, want nil", path, err)
+		}
+	}
+}
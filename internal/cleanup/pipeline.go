@@ -0,0 +1,475 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"nScript/internal/config"
+	"nScript/internal/fsys"
+	"nScript/internal/logging"
+	"nScript/internal/plan"
+	"nScript/internal/rules"
+)
+
+// pipeline cleans a target in one walk. The walk decides every entry once, on
+// a single goroutine, and submits the deletions to the cleaner's worker pool,
+// which does the I/O. Directories are handled post-order: a directory is only removed
+// once every deletion below it is done, never while entries below it still
+// wait in the queue. The walk also counts each deletion against the safety
+// limits before submitting it, so a trip stops it at the same entry whatever
+// the workers are doing, and every deletion submitted is within the limits.
+type pipeline struct {
+	c         *Cleaner
+	ctx       context.Context
+	target    config.Target
+	ruleSet   *rules.Set
+	forceMode bool
+	// done counts the jobs submitted and not yet finished
+	done sync.WaitGroup
+}
+
+// job is an entry the walk decided to delete, or a directory waiting for the
+// jobs below it
+type job struct {
+	parent *job
+	path   string
+	info   fs.FileInfo
+	// action is the deletion; nil for a directory that is kept
+	action *plan.Action
+	files  int64
+	// pending counts the jobs below a directory that are not done yet, plus
+	// one while the walk is still inside it
+	pending atomic.Int64
+	// blocked is set when something below could not be removed
+	blocked atomic.Bool
+	// real is where the directory really is, resolved once for the checks of
+	// everything directly inside it
+	resolve sync.Once
+	real    string
+	realErr error
+}
+
+// rest is what is left of an entry once the deletions the walk queued for it
+// are done, and so what removing its parent would still delete
+type rest struct {
+	files, size int64
+	// keep is why the parent must be kept, empty when it may be removed
+	keep string
+}
+
+// runPipeline fits the pool to the target's volume, lets walk submit the jobs
+// below top and returns once every job is done
+func (c *Cleaner) runPipeline(ctx context.Context, target config.Target, ruleSet *rules.Set, forceMode bool, walk func(p *pipeline, top *job)) {
+	p := &pipeline{
+		c:         c,
+		ctx:       ctx,
+		target:    target,
+		ruleSet:   ruleSet,
+		forceMode: forceMode,
+	}
+	c.tune(target.Path)
+
+	top := &job{path: target.Path}
+	top.pending.Store(1)
+	walk(p, top)
+	p.leave(top)
+	p.done.Wait()
+}
+
+// cleanTarget cleans everything below target's directory; the directory itself is kept
+func (c *Cleaner) cleanTarget(ctx context.Context, target config.Target, ruleSet *rules.Set, forceMode bool) {
+	c.runPipeline(ctx, target, ruleSet, forceMode, func(p *pipeline, top *job) {
+		p.walkChildren(top, target.Path)
+	})
+}
+
+// CleanItems cleans items below the target directory, each with everything below it.
+// Once ctx is cancelled, or a safety limit is reached, no new item is decided or
+// started; deletions already in flight finish.
+func (c *Cleaner) CleanItems(ctx context.Context, target config.Target, ruleSet *rules.Set, items []string, forceMode bool) {
+	c.runPipeline(ctx, target, ruleSet, forceMode, func(p *pipeline, top *job) {
+		for _, item := range items {
+			if p.stopped() {
+				return
+			}
+			p.walk(top, item, nil)
+		}
+	})
+}
+
+// removeEmpty removes the empty directories below target's directory; the directory itself is kept
+func (c *Cleaner) removeEmpty(ctx context.Context, target config.Target, ruleSet *rules.Set) {
+	c.runPipeline(ctx, target, ruleSet, false, func(p *pipeline, top *job) {
+		p.walkEmpty(top, target.Path)
+	})
+}
+
+// stopped reports whether the walk must stop deciding entries
+func (p *pipeline) stopped() bool {
+	return p.ctx.Err() != nil || p.c.Tripped() != nil
+}
+
+// leave marks the walk done with directory j and submits j once nothing
+// below it is pending
+func (p *pipeline) leave(j *job) {
+	if j.pending.Add(-1) == 0 {
+		p.submit(j)
+	}
+}
+
+// submit hands j to the pool. Finishing the last job below a directory makes
+// the directory ready, and the worker that finished it handles it right away
+// rather than submitting it, so a task never waits on the pool's queue. A job
+// the pool refuses once the run is interrupted is dropped, and so are the
+// directories above it.
+func (p *pipeline) submit(j *job) {
+	var size int64
+	if j.action != nil {
+		size = j.action.Size
+	}
+	p.done.Add(1)
+	queued := p.c.pool.Submit(p.ctx, size, func() int64 {
+		defer p.done.Done()
+		n := p.handle(j)
+		for d := j.parent; d != nil && d.pending.Add(-1) == 0; d = d.parent {
+			n += p.handle(d)
+		}
+		return n
+	})
+	if !queued {
+		p.done.Done()
+	}
+}
+
+// walk decides path and, for a directory, everything below it, queueing the
+// deletions below parent. info is nil for an item that still has to be read.
+func (p *pipeline) walk(parent *job, path string, info fs.FileInfo) rest {
+	c, t := p.c, p.target.Path
+
+	if err := c.ValidatePath(path); err != nil {
+		logging.Warn("Skipping invalid path", "target", t, "path", path, "error", err)
+		c.stats.addSkipped(t, TargetDirectory, 0)
+		c.record(PhaseFiles, plan.Skip, path, err.Error(), 0)
+		// A protected folder such as Documents is kept, but its contents may be cleaned
+		if info != nil && info.IsDir() && !fsys.IsLink(info) && c.validateTarget(path) == nil {
+			p.walkDirectory(parent, path, info, nil)
+		}
+		return rest{keep: "contains protected paths"}
+	}
+
+	if info == nil {
+		var err error
+		if info, err = c.fs.Lstat(path); err != nil {
+			logging.Warn("Failed to read", "target", t, "path", path, "error", err)
+			c.stats.addFailed(t, TargetDirectory, path, 0, err)
+			return rest{keep: "contains entries that could not be read"}
+		}
+	}
+
+	size := info.Size()
+	if fsys.IsLink(info) {
+		size = 0
+	}
+	action, keep := p.decide(path, info, size)
+
+	if info.IsDir() && !fsys.IsLink(info) {
+		return p.walkDirectory(parent, path, info, action).with(keep)
+	}
+	if action == nil {
+		return rest{files: 1, size: size, keep: keep}
+	}
+	if !c.reserve(t, *action, 1) {
+		return rest{files: 1, size: size}
+	}
+	p.queue(parent, &job{path: path, info: info, action: action, files: 1})
+	return rest{}
+}
+
+// decide returns the deletion of path, nil when it is kept. keep is set when
+// path must also not be removed with its parent.
+func (p *pipeline) decide(path string, info fs.FileInfo, size int64) (action *plan.Action, keep string) {
+	c, t := p.c, p.target.Path
+
+	r, matched := c.matchRule(p.ruleSet, p.target, path, info)
+	if matched && r.Action == rules.Exclude {
+		c.stats.addSkipped(t, TargetDirectory, size)
+		c.record(PhaseFiles, plan.Skip, path, r.String(), size)
+		return nil, "contains excluded files (" + r.String() + ")"
+	}
+
+	// Links are kept whatever their age, and so is the directory holding them,
+	// which would take the link with it
+	if fsys.IsLink(info) && c.cfg.Links == config.LinkSkip {
+		c.stats.addSkipped(t, TargetDirectory, 0)
+		c.record(PhaseFiles, plan.Skip, path, "link, links are skipped", 0)
+		return nil, "contains skipped links"
+	}
+
+	age := p.target.AgeSource.Age(info, time.Now())
+	if !p.forceMode && p.target.OlderThan > 0 && age <= p.target.OlderThan {
+		c.record(PhaseFiles, plan.Skip, path, fmt.Sprintf("%s, not older than %s", describeAge(p.target.AgeSource, age), plan.DescribeAge(p.target.OlderThan)), size)
+		return nil, ""
+	}
+
+	var reason string
+	switch {
+	case p.forceMode:
+		reason = "force mode"
+	case p.target.OlderThan == 0:
+		reason = "target is cleaned regardless of age"
+	default:
+		reason = fmt.Sprintf("%s, older than %s", describeAge(p.target.AgeSource, age), plan.DescribeAge(p.target.OlderThan))
+	}
+	if matched {
+		reason += " (" + r.String() + ")"
+	}
+
+	kind := plan.DeleteFile
+	switch {
+	case fsys.IsLink(info):
+		kind = plan.Unlink
+	case info.IsDir():
+		kind = plan.DeleteDirectory
+	}
+	return &plan.Action{Phase: PhaseFiles, Kind: kind, Target: path, Reason: reason, Size: size}, ""
+}
+
+// walkDirectory walks the entries below a directory and then settles the
+// directory itself: action removes it with what is left below it, unless
+// something below must be kept
+func (p *pipeline) walkDirectory(parent *job, path string, info fs.FileInfo, action *plan.Action) rest {
+	c, t := p.c, p.target.Path
+
+	j := &job{parent: parent, path: path, info: info}
+	j.pending.Store(1)
+	parent.pending.Add(1)
+	defer p.leave(j)
+
+	below := p.walkChildren(j, path)
+	switch {
+	case action == nil || p.stopped():
+		return below
+	case below.keep != "":
+		c.stats.addSkipped(t, TargetDirectory, 0)
+		c.record(PhaseFiles, plan.Skip, path, below.keep, 0)
+		return below
+	}
+	action.Size = below.size
+	if !c.reserve(t, *action, below.files) {
+		return below
+	}
+	j.action, j.files = action, below.files
+	return rest{}
+}
+
+// walkChildren walks the entries of a directory below j and sums what is left of them
+func (p *pipeline) walkChildren(j *job, path string) rest {
+	c, t := p.c, p.target.Path
+
+	entries, err := c.fs.ReadDir(path)
+	if err != nil {
+		logging.Warn("Failed to read", "target", t, "path", path, "error", err)
+		c.stats.addFailed(t, TargetDirectory, path, 0, err)
+		return rest{keep: "contains entries that could not be read"}
+	}
+
+	var below rest
+	for _, entry := range entries {
+		if p.stopped() {
+			break
+		}
+		name := filepath.Join(path, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			logging.Warn("Failed to read", "target", t, "path", name, "error", err)
+			c.stats.addFailed(t, TargetDirectory, name, 0, err)
+			below = below.with("contains entries that could not be read")
+			continue
+		}
+		r := p.walk(j, name, info)
+		below.files += r.files
+		below.size += r.size
+		below = below.with(r.keep)
+	}
+	return below
+}
+
+// walkEmpty walks the directories below path, queueing each one that holds
+// nothing but directories queued before it, and reports whether path will be
+// empty once they are removed. In a dry run what the plan already removes
+// counts as gone, as it would be by the time a real run gets here.
+func (p *pipeline) walkEmpty(j *job, path string) bool {
+	c := p.c
+
+	entries, err := c.fs.ReadDir(path)
+	if err != nil {
+		return false
+	}
+
+	empty := true
+	for _, entry := range entries {
+		if p.stopped() {
+			return false
+		}
+		name := filepath.Join(path, entry.Name())
+		if c.plan != nil && c.plan.Removed(name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.IsDir() || fsys.IsLink(info) {
+			empty = false
+			continue
+		}
+		if !p.emptyDirectory(j, name, info) {
+			empty = false
+		}
+	}
+	return empty
+}
+
+// emptyDirectory walks a directory below parent and queues its removal once
+// the directories below it are removed, unless something below is kept or a
+// rule excludes it
+func (p *pipeline) emptyDirectory(parent *job, path string, info fs.FileInfo) bool {
+	j := &job{parent: parent, path: path, info: info}
+	j.pending.Store(1)
+	parent.pending.Add(1)
+	defer p.leave(j)
+
+	_, excluded := p.c.ShouldExclude(p.ruleSet, p.target, path, info)
+	if !p.walkEmpty(j, path) || excluded || p.stopped() {
+		return false
+	}
+	j.action = &plan.Action{Phase: PhaseEmptyDirs, Kind: plan.DeleteDirectory, Target: path, Reason: "empty directory"}
+	return true
+}
+
+// with returns r with keep set, unless it already has a reason
+func (r rest) with(keep string) rest {
+	if r.keep == "" {
+		r.keep = keep
+	}
+	return r
+}
+
+// queue adds a job below parent and submits it
+func (p *pipeline) queue(parent *job, j *job) {
+	j.parent = parent
+	parent.pending.Add(1)
+	p.submit(j)
+}
+
+// handle carries out the deletion of a job and returns the bytes it removed.
+// Every deletion is checked against its target just before it is issued. A job
+// that is not carried out blocks its parent directory, which would fail to be
+// removed or take the kept entry with it.
+func (p *pipeline) handle(j *job) int64 {
+	c, t := p.c, p.target.Path
+	if j.action == nil || p.ctx.Err() != nil {
+		p.propagate(j)
+		return 0
+	}
+	action := *j.action
+	if action.Phase == PhaseEmptyDirs {
+		p.removeIfEmpty(j)
+		return 0
+	}
+
+	if j.blocked.Load() {
+		c.stats.addSkipped(t, TargetDirectory, 0)
+		c.record(PhaseFiles, plan.Skip, j.path, "contains files that could not be removed", 0)
+		p.propagate(j)
+		return 0
+	}
+	if err := p.checkContained(j); err != nil {
+		logging.Warn("Skipping path outside target", "target", t, "path", j.path, "error", err)
+		c.stats.addSkipped(t, TargetDirectory, 0)
+		c.record(PhaseFiles, plan.Skip, j.path, err.Error(), 0)
+		p.block(j)
+		return 0
+	}
+	// A dry run does not open files, so a locked file is planned as deleted
+	if action.Kind == plan.DeleteFile && c.plan == nil && !c.IsFileAccessible(j.path) {
+		c.stats.addSkipped(t, TargetDirectory, action.Size)
+		c.record(PhaseFiles, plan.Skip, j.path, "file is locked", action.Size)
+		p.block(j)
+		return 0
+	}
+	isDir := action.Kind == plan.DeleteDirectory
+	if c.plan != nil {
+		c.stats.addDeleted(t, TargetDirectory, isDir, action.Size)
+		c.plan.Add(action)
+		return 0
+	}
+
+	if err := c.removeItem(j.path, j.info); err != nil {
+		logging.Warn("Failed to remove", "target", t, "path", j.path, "error", err)
+		c.stats.addFailed(t, TargetDirectory, j.path, action.Size, err)
+		p.block(j)
+		return 0
+	}
+	logging.Debug("Removed", "target", t, "path", j.path, "reason", action.Reason)
+	c.stats.addDeleted(t, TargetDirectory, isDir, action.Size)
+	return action.Size
+}
+
+// removeIfEmpty removes a directory the walk found to hold only directories
+// removed before it. A directory something was added to since is left alone.
+func (p *pipeline) removeIfEmpty(j *job) {
+	c, t := p.c, p.target.Path
+	if err := p.checkContained(j); err != nil {
+		logging.Warn("Skipping path outside target", "target", t, "path", j.path, "error", err)
+		return
+	}
+
+	if c.plan != nil {
+		c.stats.addDeleted(t, TargetDirectory, true, 0)
+		c.plan.Add(*j.action)
+		return
+	}
+	if entries, err := c.fs.ReadDir(j.path); err != nil || len(entries) > 0 {
+		return
+	}
+	if err := c.fs.Remove(j.path); err != nil {
+		logging.Debug("Failed to remove empty directory", "target", t, "path", j.path, "error", err)
+		return
+	}
+	c.stats.addDeleted(t, TargetDirectory, true, 0)
+}
+
+// checkContained is Cleaner.checkContained for the path of j. The directory
+// holding it is resolved once for everything inside, rather than once per item,
+// just before the first deletion in it, so a directory replaced by a link
+// after the walk listed it is still caught.
+func (p *pipeline) checkContained(j *job) error {
+	d := j.parent
+	if d == nil || filepath.Dir(j.path) != d.path {
+		return p.c.checkContained(p.target.Path, j.path)
+	}
+	d.resolve.Do(func() {
+		d.real, d.realErr = p.c.fs.EvalSymlinks(d.path)
+	})
+	if d.realErr != nil {
+		return fmt.Errorf("failed to resolve %s: %v", j.path, d.realErr)
+	}
+	return p.c.checkResolved(p.target.Path, j.path, filepath.Join(d.real, filepath.Base(j.path)))
+}
+
+// block keeps the parent directory of a job that was not carried out
+func (p *pipeline) block(j *job) {
+	if j.parent != nil {
+		j.parent.blocked.Store(true)
+	}
+}
+
+// propagate blocks the parent of a kept directory something below was blocked in
+func (p *pipeline) propagate(j *job) {
+	if j.blocked.Load() {
+		p.block(j)
+	}
+}
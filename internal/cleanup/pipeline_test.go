@@ -0,0 +1,149 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sync"
+	"testing"
+	"time"
+
+	"nScript/internal/config"
+	"nScript/internal/fsys"
+	"nScript/internal/plan"
+)
+
+// countingFS counts how often each directory is listed
+type countingFS struct {
+	*fsys.Mem
+	mu    sync.Mutex
+	reads map[string]int
+}
+
+func (c *countingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	c.mu.Lock()
+	c.reads[name]++
+	c.mu.Unlock()
+	return c.Mem.ReadDir(name)
+}
+
+func TestDirectoriesAfterTheirContents(t *testing.T) {
+	c, mem := newTestCleaner(t, 8)
+	old := time.Now().Add(-48 * time.Hour)
+
+	// More entries below one directory than the queue holds
+	total := 3 * config.QueueSize
+	for i := range total {
+		mem.AddFile(home("Downloads", "big", fmt.Sprintf("sub%d", i%5), fmt.Sprintf("file%04d.tmp", i)), []byte("x"), old)
+	}
+
+	if err := c.StreamingCleanDirectories(context.Background(), targets(home("Downloads")), false); err != nil {
+		t.Fatalf("StreamingCleanDirectories: %v", err)
+	}
+
+	if got, want := statsOf(c), (counts{deletedFiles: int64(total), deletedFolders: 6}); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+	if freed := c.GetStats().BytesFreed.Load(); freed != int64(total) {
+		t.Errorf("bytes freed = %d, want %d", freed, total)
+	}
+	if mem.Exists(home("Downloads", "big")) {
+		t.Error("directory was not removed")
+	}
+}
+
+func TestKeptEntryKeepsItsDirectories(t *testing.T) {
+	c, mem := newTestCleaner(t, 4)
+	old := time.Now().Add(-48 * time.Hour)
+	mem.AddFile(home("Downloads", "a", "b", "c", "disk.iso"), nil, old)
+	mem.AddFile(home("Downloads", "a", "b", "old.txt"), nil, old)
+	mem.AddFile(home("Downloads", "x", "young.txt"), nil, time.Now())
+	mem.AddDir(home("Downloads", "x"), old)
+
+	p := plan.New()
+	c.SetPlan(p)
+	c.StreamingCleanDirectories(context.Background(), targets(home("Downloads")), false)
+
+	actions := make(map[string]plan.Action)
+	for _, a := range p.Actions() {
+		actions[a.Target] = a
+	}
+	for _, dir := range []string{home("Downloads", "a"), home("Downloads", "a", "b"), home("Downloads", "a", "b", "c")} {
+		if a := actions[dir]; a.Kind != plan.Skip || a.Reason != "contains excluded files (excluded extension .iso)" {
+			t.Errorf("%s action = %+v", dir, a)
+		}
+	}
+	if a := actions[home("Downloads", "a", "b", "old.txt")]; a.Kind != plan.DeleteFile {
+		t.Errorf("old.txt action = %+v", a)
+	}
+	// A young file goes with its old directory
+	if a := actions[home("Downloads", "x")]; a.Kind != plan.DeleteDirectory {
+		t.Errorf("x action = %+v", a)
+	}
+}
+
+func TestEachDirectoryIsListedOnce(t *testing.T) {
+	counter := &countingFS{Mem: fsys.NewMem(), reads: make(map[string]int)}
+	c := NewCleaner(&config.Config{Rules: config.Default().Rules, ExcludedExtensions: excludedExts, MaxConcurrentOps: 4}, counter)
+	old := time.Now().Add(-48 * time.Hour)
+	for i := range 50 {
+		counter.AddFile(home("Downloads", fmt.Sprintf("d%d", i%3), fmt.Sprintf("e%d", i%2), fmt.Sprintf("f%d.tmp", i)), nil, old)
+	}
+
+	c.StreamingCleanDirectories(context.Background(), targets(home("Downloads")), false)
+
+	if len(counter.reads) != 10 {
+		t.Errorf("%d directories listed, want 10", len(counter.reads))
+	}
+	for dir, n := range counter.reads {
+		if n != 1 {
+			t.Errorf("%s listed %d times", dir, n)
+		}
+	}
+}
+
+// syntheticTree adds files old files below root, 100 to a directory and 100
+// directories to a parent
+func syntheticTree(mem *fsys.Mem, root string, files int) {
+	old := time.Now().Add(-48 * time.Hour)
+	for i := range files {
+		leaf := i / 100
+		mem.AddFile(fmt.Sprintf("%s/d%03d/d%03d/f%02d.tmp", root, leaf/100, leaf%100, i%100), []byte("x"), old)
+	}
+}
+
+// BenchmarkPipeline cleans synthetic trees of up to 1M files, once planning
+// only and once deleting them
+func BenchmarkPipeline(b *testing.B) {
+	root := home("Downloads")
+	for _, files := range []int{10000, 100000, 1000000} {
+		b.Run(fmt.Sprintf("plan/files=%d", files), func(b *testing.B) {
+			mem := fsys.NewMem()
+			syntheticTree(mem, root, files)
+			b.ResetTimer()
+
+			for range b.N {
+				c := NewCleaner(&config.Config{Rules: config.Default().Rules, MaxConcurrentOps: config.MaxConcurrentOps}, mem)
+				c.SetPlan(plan.New())
+				c.StreamingCleanDirectories(context.Background(), targets(root), false)
+			}
+			b.ReportMetric(float64(files*b.N)/b.Elapsed().Seconds(), "files/s")
+		})
+
+		b.Run(fmt.Sprintf("delete/files=%d", files), func(b *testing.B) {
+			for range b.N {
+				b.StopTimer()
+				mem := fsys.NewMem()
+				syntheticTree(mem, root, files)
+				c := NewCleaner(&config.Config{Rules: config.Default().Rules, MaxConcurrentOps: config.MaxConcurrentOps}, mem)
+				b.StartTimer()
+
+				c.StreamingCleanDirectories(context.Background(), targets(root), false)
+				if deleted := c.GetStats().DeletedFiles.Load(); deleted != int64(files) {
+					b.Fatalf("%d files deleted, want %d", deleted, files)
+				}
+			}
+			b.ReportMetric(float64(files*b.N)/b.Elapsed().Seconds(), "files/s")
+		})
+	}
+}
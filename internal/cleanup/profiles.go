@@ -0,0 +1,144 @@
+package cleanup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"nScript/internal/logging"
+	"nScript/internal/plan"
+	"nScript/internal/profiles"
+	"nScript/internal/winreg"
+)
+
+// States of a profile's registry hive during an all-users run
+const (
+	HiveSignedIn     = "signed in"
+	HiveLoaded       = "loaded"
+	HiveNotPreviewed = "not loaded in a dry run"
+	HiveUnavailable  = "unavailable"
+)
+
+// user is the profile the Windows operations work on
+type user struct {
+	profile      *profiles.Profile // nil for the account running nScript
+	home         string
+	appData      string
+	localAppData string
+
+	hive    string
+	hiveErr error
+}
+
+// currentUser is the account running nScript, with its folders from the environment
+func currentUser() user {
+	return user{
+		home:         os.Getenv("USERPROFILE"),
+		appData:      os.Getenv("APPDATA"),
+		localAppData: os.Getenv("LOCALAPPDATA"),
+	}
+}
+
+// profileUser is another account's profile, with the default folder layout
+func profileUser(p profiles.Profile) user {
+	return user{
+		profile:      &p,
+		home:         p.Home,
+		appData:      filepath.Join(p.Home, "AppData", "Roaming"),
+		localAppData: filepath.Join(p.Home, "AppData", "Local"),
+	}
+}
+
+// label names the user in logs and failures
+func (u *user) label() string {
+	if u.profile == nil {
+		return "current user"
+	}
+	return u.profile.User
+}
+
+// ProfileResult is how the Windows cleanup of one profile went in an all-users run
+type ProfileResult struct {
+	Profile profiles.Profile
+	Hive    string
+	Err     string
+}
+
+// SetProfiles makes RunAllWindowsCleanup work on each of list instead of the
+// account running nScript
+func (wc *WindowsCleaner) SetProfiles(list []profiles.Profile) {
+	wc.users = make([]user, 0, len(list))
+	for _, p := range list {
+		wc.users = append(wc.users, profileUser(p))
+	}
+}
+
+// Profiles returns the outcome per profile of an all-users run
+func (wc *WindowsCleaner) Profiles() []ProfileResult {
+	return wc.profileResults
+}
+
+// userTweaksSelected reports whether a selected operation changes HKEY_CURRENT_USER
+func (wc *WindowsCleaner) userTweaksSelected() bool {
+	for _, t := range wc.tweaks {
+		if t.Root == winreg.CurrentUser && (wc.enabled == nil || wc.enabled(t.Name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// mountHive makes a profile's registry hive available as HKEY_USERS\<SID> with
+// MountHive. When the hive cannot be used, u.hiveErr is set and the profile's
+// HKCU tweaks are skipped.
+func (wc *WindowsCleaner) mountHive(u *user) func() {
+	if u.profile == nil {
+		return func() {}
+	}
+
+	// Loading a hive is not previewed: a dry run leaves every file alone
+	if wc.plan != nil && u.profile.SID != "" && !hiveMounted(wc.reg, u.profile.SID) {
+		wc.record(plan.LoadRegistryHive, u.profile.Hive(), fmt.Sprintf("%s is signed out; registry changes are not previewed", u.label()))
+		u.hive, u.hiveErr = HiveNotPreviewed, errors.New("registry hive not loaded in a dry run")
+		return func() {}
+	}
+
+	unmount, state, err := MountHive(wc.reg, wc.hives, *u.profile)
+	u.hive, u.hiveErr = state, err
+	return unmount
+}
+
+// MountHive makes a profile's registry hive available as HKEY_USERS\<SID> and
+// returns the function that undoes it and the hive's state. A signed-in user's
+// hive is already there; a signed-out user's NTUSER.DAT is loaded until the
+// returned function unloads it.
+func MountHive(reg winreg.Registry, hives winreg.Hives, p profiles.Profile) (func(), string, error) {
+	unmounted := func() {}
+	if p.SID == "" {
+		return unmounted, HiveUnavailable, errors.New("the profile's SID is unknown")
+	}
+	if hiveMounted(reg, p.SID) {
+		return unmounted, HiveSignedIn, nil
+	}
+
+	if err := hives.LoadHive(p.SID, p.Hive()); err != nil {
+		return unmounted, HiveUnavailable, fmt.Errorf("failed to load %s: %v", p.Hive(), err)
+	}
+	logging.Debug("Loaded registry hive", "user", p.User, "hive", p.Hive())
+	return func() {
+		if err := hives.UnloadHive(p.SID); err != nil {
+			logging.Warn("Failed to unload registry hive", "user", p.User, "error", err)
+		}
+	}, HiveLoaded, nil
+}
+
+// hiveMounted reports whether HKEY_USERS\<sid> is there
+func hiveMounted(reg winreg.Registry, sid string) bool {
+	key, err := reg.OpenKey(winreg.Users, sid, winreg.Read)
+	if err != nil {
+		return false
+	}
+	key.Close()
+	return true
+}
@@ -0,0 +1,156 @@
+package cleanup
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Target kinds used in per-target statistics
+const (
+	TargetDirectory = "directory"
+	TargetBrowser   = "browser"
+)
+
+// Stats tracks cleanup statistics
+type Stats struct {
+	DeletedFiles   atomic.Int64
+	DeletedFolders atomic.Int64
+	SkippedFiles   atomic.Int64
+	FailedFiles    atomic.Int64
+
+	BytesFreed   atomic.Int64
+	BytesSkipped atomic.Int64
+	BytesFailed  atomic.Int64
+
+	// targets maps target names to their *targetCounters; it is read for
+	// every item, so counting never waits on mu
+	targets  sync.Map
+	mu       sync.Mutex
+	failures []Failure
+	dropped  int64
+}
+
+// maxRecordedFailures bounds the failures kept for the report; later ones are only counted
+const maxRecordedFailures = 1000
+
+// Failure is an item that could not be removed
+type Failure struct {
+	Phase  string
+	Target string
+	Path   string
+	Err    string
+}
+
+// targetCounters holds the counters of one top-level target directory or browser
+type targetCounters struct {
+	kind           string
+	deletedFiles   atomic.Int64
+	deletedFolders atomic.Int64
+	skipped        atomic.Int64
+	failed         atomic.Int64
+	bytesFreed     atomic.Int64
+	bytesSkipped   atomic.Int64
+	bytesFailed    atomic.Int64
+}
+
+// TargetStats is a snapshot of the statistics of one target
+type TargetStats struct {
+	Name           string
+	Kind           string
+	DeletedFiles   int64
+	DeletedFolders int64
+	Skipped        int64
+	Failed         int64
+	BytesFreed     int64
+	BytesSkipped   int64
+	BytesFailed    int64
+}
+
+// target returns the counters for name, creating them on first use
+func (s *Stats) target(name, kind string) *targetCounters {
+	if t, ok := s.targets.Load(name); ok {
+		return t.(*targetCounters)
+	}
+	t, _ := s.targets.LoadOrStore(name, &targetCounters{kind: kind})
+	return t.(*targetCounters)
+}
+
+// addDeleted counts a removed file or folder and the bytes it freed
+func (s *Stats) addDeleted(target, kind string, dir bool, bytes int64) {
+	t := s.target(target, kind)
+	if dir {
+		s.DeletedFolders.Add(1)
+		t.deletedFolders.Add(1)
+	} else {
+		s.DeletedFiles.Add(1)
+		t.deletedFiles.Add(1)
+	}
+	s.BytesFreed.Add(bytes)
+	t.bytesFreed.Add(bytes)
+}
+
+// addSkipped counts an item that was deliberately left in place
+func (s *Stats) addSkipped(target, kind string, bytes int64) {
+	t := s.target(target, kind)
+	s.SkippedFiles.Add(1)
+	t.skipped.Add(1)
+	s.BytesSkipped.Add(bytes)
+	t.bytesSkipped.Add(bytes)
+}
+
+// addFailed counts an item that could not be removed and records why
+func (s *Stats) addFailed(target, kind, path string, bytes int64, err error) {
+	t := s.target(target, kind)
+	s.FailedFiles.Add(1)
+	t.failed.Add(1)
+	s.BytesFailed.Add(bytes)
+	t.bytesFailed.Add(bytes)
+
+	phase := PhaseFiles
+	if kind == TargetBrowser {
+		phase = PhaseBrowsers
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.failures) >= maxRecordedFailures {
+		s.dropped++
+		return
+	}
+	s.failures = append(s.failures, Failure{Phase: phase, Target: target, Path: path, Err: err.Error()})
+}
+
+// Failures returns the recorded failures and how many more were counted but not recorded
+func (s *Stats) Failures() ([]Failure, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Failure(nil), s.failures...), s.dropped
+}
+
+// Targets returns per-target statistics, largest bytes freed first
+func (s *Stats) Targets() []TargetStats {
+	targets := []TargetStats{}
+	for name, counters := range s.targets.Range {
+		t := counters.(*targetCounters)
+		targets = append(targets, TargetStats{
+			Name:           name.(string),
+			Kind:           t.kind,
+			DeletedFiles:   t.deletedFiles.Load(),
+			DeletedFolders: t.deletedFolders.Load(),
+			Skipped:        t.skipped.Load(),
+			Failed:         t.failed.Load(),
+			BytesFreed:     t.bytesFreed.Load(),
+			BytesSkipped:   t.bytesSkipped.Load(),
+			BytesFailed:    t.bytesFailed.Load(),
+		})
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].BytesFreed != targets[j].BytesFreed {
+			return targets[i].BytesFreed > targets[j].BytesFreed
+		}
+		return targets[i].Name < targets[j].Name
+	})
+	return targets
+}
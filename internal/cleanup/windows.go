@@ -1,93 +1,329 @@
 package cleanup
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"nScript/internal/config"
+	"nScript/internal/fsys"
+	"nScript/internal/logging"
+	"nScript/internal/plan"
+	"nScript/internal/protect"
+	"nScript/internal/regbackup"
 	"nScript/internal/system"
+	"nScript/internal/tweaks"
+	"nScript/internal/winreg"
 )
 
+// Windows operation names, selectable with --only and --skip
+const (
+	OpStartMenu   = "start-menu"
+	OpQuickAccess = "quick-access"
+	OpRecentItems = "recent-items"
+	OpThumbnails  = "thumbnails"
+	OpUserAssist  = "userassist"
+	OpComDlgMRU   = "comdlg-mru"
+	OpDarkMode    = "dark-mode"
+	OpRecycleBin  = "recycle-bin"
+)
+
+// WindowsOperations lists the Windows operations in the order RunAllWindowsCleanup runs them
+var WindowsOperations = []string{OpStartMenu, OpQuickAccess, OpRecentItems, OpThumbnails, OpUserAssist, OpComDlgMRU, OpDarkMode, OpRecycleBin}
+
 // WindowsCleaner handles Windows-specific cleanup operations
 type WindowsCleaner struct {
+	fs              fsys.FS
+	reg             winreg.Registry
+	hives           winreg.Hives
+	tweaks          []tweaks.Tweak
 	registryManager *system.RegistryManager
 	processManager  *system.ProcessManager
+	plan            *plan.Plan
+	protected       *protect.Policy
+	failures        []Failure
+	enabled         func(op string) bool
+
+	// users are the profiles of an all-users run, nil to clean the account running nScript
+	users          []user
+	profileResults []ProfileResult
+	// user is the profile being cleaned; machine-wide tweaks run with the first one only
+	user        user
+	machineWide bool
 }
 
-// NewWindowsCleaner creates a new Windows-specific cleaner
-func NewWindowsCleaner() *WindowsCleaner {
+// NewWindowsCleaner creates a new Windows-specific cleaner operating on filesystem
+func NewWindowsCleaner(cfg *config.Config, filesystem fsys.FS) *WindowsCleaner {
+	processManager := system.NewProcessManager()
+	processManager.SetShutdownPolicies(cfg.Shutdown)
 	return &WindowsCleaner{
-		registryManager: system.NewRegistryManager(),
-		processManager:  system.NewProcessManager(),
+		fs:              filesystem,
+		reg:             winreg.OS{},
+		hives:           winreg.OS{},
+		tweaks:          cfg.RegistryTweaks,
+		registryManager: system.NewRegistryManager(winreg.OS{}, regbackup.NewStore(filesystem, cfg.RegistryBackupDir)),
+		processManager:  processManager,
+		protected:       protect.New(cfg.ProtectedPaths),
+	}
+}
+
+// SetPlan switches the cleaner to dry-run mode, recording actions into p instead of performing them
+func (wc *WindowsCleaner) SetPlan(p *plan.Plan) {
+	wc.plan = p
+	wc.registryManager.SetPlan(p)
+}
+
+// SetOperationFilter limits RunAllWindowsCleanup to the operations for which enabled returns true
+func (wc *WindowsCleaner) SetOperationFilter(enabled func(op string) bool) {
+	wc.enabled = enabled
+}
+
+// operationEnabled reports whether the operation was selected to run
+func (wc *WindowsCleaner) operationEnabled(op string) bool {
+	if wc.enabled != nil && !wc.enabled(op) {
+		logging.Debug("Skipping Windows operation", "operation", op)
+		return false
 	}
+	return true
+}
+
+// Failures returns the Windows operations that failed
+func (wc *WindowsCleaner) Failures() []Failure {
+	return wc.failures
+}
+
+// Killed returns the processes terminated by Windows cleanup
+func (wc *WindowsCleaner) Killed() []system.ProcessInfo {
+	return wc.processManager.Killed()
+}
+
+// RegistryBackups returns the registry keys backed up before deletion
+func (wc *WindowsCleaner) RegistryBackups() []system.RegistryBackup {
+	return wc.registryManager.Backups()
+}
+
+// RegistryBackupDirectory returns where registry backups are written
+func (wc *WindowsCleaner) RegistryBackupDirectory() string {
+	return wc.registryManager.GetBackupDirectory()
+}
+
+// FinishRegistryBackups archives the registry backups of the run and returns the archive path
+func (wc *WindowsCleaner) FinishRegistryBackups() (string, error) {
+	return wc.registryManager.FinishBackups()
+}
+
+// RegistryBackupID returns the ID restore-registry takes to undo this run's registry changes
+func (wc *WindowsCleaner) RegistryBackupID() string {
+	return wc.registryManager.BackupID()
+}
+
+// DeletedRegistryKeys returns the registry keys deleted by Windows cleanup
+func (wc *WindowsCleaner) DeletedRegistryKeys() []string {
+	return wc.registryManager.DeletedKeys()
+}
+
+// ChangedRegistryValues returns the registry values set or deleted by Windows cleanup
+func (wc *WindowsCleaner) ChangedRegistryValues() []string {
+	return wc.registryManager.ChangedValues()
+}
+
+// Operations returns the Windows operation names: the built-in ones, then the
+// registry operations only defined in the config
+func Operations(list []tweaks.Tweak) []string {
+	names := slices.Clone(WindowsOperations)
+	for _, name := range tweaks.Names(list) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// applyTweaks applies the registry tweaks of one operation that fit the Windows
+// build. A failed tweak does not stop the others; the last error is returned.
+func (wc *WindowsCleaner) applyTweaks(ctx context.Context, op string, build uint32) error {
+	var lastError error
+	for _, t := range wc.tweaks {
+		if t.Name != op {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !t.AppliesTo(build) {
+			logging.Debug("Skipping registry tweak for another Windows build", "operation", op, "tweak", t.String())
+			continue
+		}
+		// In an all-users run HKCU means each profile's hive, and other roots are changed once
+		switch {
+		case t.Root != winreg.CurrentUser:
+			if !wc.machineWide {
+				continue
+			}
+		case wc.user.profile != nil:
+			if wc.user.hiveErr != nil {
+				logging.Debug("Skipping registry tweak, the profile's hive is unavailable", "user", wc.user.label(), "tweak", t.String())
+				continue
+			}
+			t = t.ForUser(wc.user.profile.SID)
+		}
+		if err := wc.registryManager.ApplyTweak(ctx, t); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logging.Warn("Registry tweak failed", "operation", op, "tweak", t.String(), "error", err)
+			lastError = err
+		}
+	}
+	return lastError
+}
+
+// tweakOperation returns an operation made only of registry tweaks
+func (wc *WindowsCleaner) tweakOperation(op, start, done string, build uint32) func(context.Context) error {
+	return func(ctx context.Context) error {
+		logging.Info(start)
+		if err := wc.applyTweaks(ctx, op, build); err != nil {
+			return err
+		}
+		logging.Success(done)
+		return nil
+	}
+}
+
+// record adds an action to the plan when running in dry-run mode
+func (wc *WindowsCleaner) record(kind plan.Kind, target, reason string) {
+	if wc.plan != nil {
+		wc.plan.Add(plan.Action{Phase: PhaseWindows, Kind: kind, Target: target, Reason: reason})
+	}
+}
+
+// removePath removes a file or directory tree, or records the removal in
+// dry-run mode. Protected paths are refused.
+func (wc *WindowsCleaner) removePath(path, reason string) error {
+	if err := wc.protected.Check(path); err != nil {
+		return err
+	}
+	if wc.plan == nil {
+		return wc.fs.RemoveAll(path)
+	}
+
+	info, err := wc.fs.Stat(path)
+	if err != nil {
+		return nil
+	}
+	kind := plan.DeleteFile
+	if info.IsDir() {
+		kind = plan.DeleteDirectory
+	}
+	wc.record(kind, path, reason)
+	return nil
+}
+
+// killProcess terminates a process, or records the termination in dry-run mode
+func (wc *WindowsCleaner) killProcess(name, reason string) error {
+	if wc.plan == nil {
+		return wc.processManager.KillProcess(name)
+	}
+	if wc.processManager.IsProcessRunning(name) {
+		wc.record(plan.KillProcess, name, reason)
+	}
+	return nil
 }
 
 // ClearStartMenuTiles clears Start Menu tiles with improved safety
-func (wc *WindowsCleaner) ClearStartMenuTiles() error {
-	fmt.Println("[*] Unpinning all Start Menu tiles...")
+func (wc *WindowsCleaner) ClearStartMenuTiles(ctx context.Context) error {
+	logging.Info("Unpinning all Start Menu tiles...")
 
 	major, _, build, err := system.GetWindowsVersion()
 	if err != nil {
 		return fmt.Errorf("failed to get Windows version: %v", err)
 	}
 
-	userHome := os.Getenv("LOCALAPPDATA")
+	userHome := wc.user.localAppData
 	if userHome == "" {
 		return fmt.Errorf("LOCALAPPDATA environment variable not set")
 	}
 
-	// Stop Start Menu process
-	if err := wc.processManager.KillProcess("StartMenuExperienceHost.exe", true); err != nil {
-		fmt.Printf("[-] Warning: Failed to stop Start Menu process: %v\n", err)
+	// Stop Start Menu process; in an all-users run this stops it in every session at once
+	if wc.machineWide {
+		if err := wc.killProcess("StartMenuExperienceHost.exe", "unlock Start Menu database"); err != nil {
+			logging.Warn("Failed to stop Start Menu process", "error", err)
+		}
+		if wc.plan == nil {
+			if err := sleep(ctx, 1*time.Second); err != nil {
+				return err
+			}
+		}
 	}
-	time.Sleep(1 * time.Second)
 
 	// Method 1: Delete the Start Menu database directly
-	fmt.Println("[*] Clearing Start Menu database...")
+	logging.Info("Clearing Start Menu database...")
 	startDbPath := filepath.Join(userHome, "Packages", "Microsoft.Windows.StartMenuExperienceHost_cw5n1h2txyewy", "LocalState")
-	if _, err := os.Stat(startDbPath); err == nil {
+	if _, err := wc.fs.Stat(startDbPath); err == nil {
 		dbFiles := []string{
 			filepath.Join(startDbPath, "start.db"),
 			filepath.Join(startDbPath, "start.db-journal"),
 		}
 
 		for _, dbFile := range dbFiles {
-			if err := os.Remove(dbFile); err == nil && strings.HasSuffix(dbFile, "start.db") {
-				fmt.Println("[+] Removed Start Menu database")
+			if wc.plan != nil {
+				wc.removePath(dbFile, "Start Menu database")
+				continue
+			}
+			if err := wc.fs.Remove(dbFile); err == nil && strings.HasSuffix(dbFile, "start.db") {
+				logging.Success("Removed Start Menu database")
 			}
 		}
 	}
 
 	// Method 2: Clear TileDataLayer database
-	fmt.Println("[*] Clearing TileDataLayer...")
+	logging.Info("Clearing TileDataLayer...")
 	tileDataPath := filepath.Join(userHome, "Packages", "Microsoft.Windows.StartMenuExperienceHost_cw5n1h2txyewy", "TileDataLayer")
-	if _, err := os.Stat(tileDataPath); err == nil {
-		wc.processManager.KillProcess("StartMenuExperienceHost.exe", true)
-		time.Sleep(1 * time.Second)
+	if _, err := wc.fs.Stat(tileDataPath); err == nil && wc.plan != nil {
+		wc.removePath(tileDataPath, "Start Menu tile data")
+	} else if err == nil {
+		if wc.user.profile == nil {
+			wc.processManager.KillProcess("StartMenuExperienceHost.exe")
+			if err := sleep(ctx, 1*time.Second); err != nil {
+				return err
+			}
+		}
 
 		// Recursively remove all files in TileDataLayer
-		err := filepath.Walk(tileDataPath, func(path string, info os.FileInfo, err error) error {
+		err := fsys.Walk(wc.fs, tileDataPath, func(path string, info os.FileInfo, err error) error {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
 			if err != nil {
 				return nil
 			}
 			if path != tileDataPath {
-				os.RemoveAll(path)
+				wc.fs.RemoveAll(path)
 			}
 			return nil
 		})
 
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if err == nil {
-			if err := os.RemoveAll(tileDataPath); err == nil {
-				fmt.Println("[+] Cleared TileDataLayer")
+			if err := wc.fs.RemoveAll(tileDataPath); err == nil {
+				logging.Success("Cleared TileDataLayer")
 			}
 		}
 	}
 
 	// Method 3: Clear Start Menu registry entries
-	if err := wc.registryManager.ClearStartMenuRegistry(); err != nil {
-		fmt.Printf("[-] Warning: Failed to clear Start Menu registry: %v\n", err)
+	logging.Info("Clearing Start Menu registry entries...")
+	if err := wc.applyTweaks(ctx, OpStartMenu, build); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		logging.Warn("Failed to clear Start Menu registry", "error", err)
 	}
 
 	// Windows 10 specific cleanup (for older builds)
@@ -95,23 +331,37 @@ func (wc *WindowsCleaner) ClearStartMenuTiles() error {
 		wc.cleanWindows10StartMenu()
 	}
 
-	fmt.Println("[+] Start Menu tiles cleared")
-	fmt.Println("[!] Restarting Windows Explorer...")
+	// Other users' Explorer is not restarted; their Start Menu changes apply at their next sign-in
+	if wc.user.profile != nil {
+		if wc.plan == nil {
+			logging.Success("Start Menu tiles cleared", "user", wc.user.label())
+		}
+		return nil
+	}
+
+	if wc.plan != nil {
+		wc.record(plan.KillProcess, "explorer.exe", "restart Explorer to apply Start Menu changes")
+		wc.record(plan.StartProcess, "explorer.exe", "restart Explorer to apply Start Menu changes")
+		return nil
+	}
 
-	if err := system.RestartExplorer(); err != nil {
-		fmt.Printf("[-] Warning: Failed to restart Explorer: %v\n", err)
+	logging.Success("Start Menu tiles cleared")
+	logging.Notice("Restarting Windows Explorer...")
+
+	if err := system.RestartExplorer(wc.processManager); err != nil {
+		logging.Warn("Failed to restart Explorer", "error", err)
 	} else {
-		fmt.Println("[+] Windows Explorer restarted")
+		logging.Success("Windows Explorer restarted")
 	}
 
-	fmt.Println("[!] Please sign out and sign back in for complete effect")
+	logging.Notice("Please sign out and sign back in for complete effect")
 	return nil
 }
 
 // cleanWindows10StartMenu cleans Windows 10 specific Start Menu files
 func (wc *WindowsCleaner) cleanWindows10StartMenu() {
-	userProfile := os.Getenv("USERPROFILE")
-	userLocal := os.Getenv("LOCALAPPDATA")
+	userProfile := wc.user.home
+	userLocal := wc.user.localAppData
 
 	locations := []string{
 		filepath.Join(userProfile, "AppData", "Local", "TileDataLayer"),
@@ -119,18 +369,60 @@ func (wc *WindowsCleaner) cleanWindows10StartMenu() {
 	}
 
 	for _, location := range locations {
-		if _, err := os.Stat(location); err == nil {
-			if err := os.RemoveAll(location); err == nil {
-				fmt.Printf("[+] Cleared Windows 10 location: %s\n", filepath.Base(location))
+		if _, err := wc.fs.Stat(location); err == nil {
+			if err := wc.removePath(location, "Windows 10 Start Menu cache"); err == nil && wc.plan == nil {
+				logging.Success("Cleared Windows 10 location", "path", location)
+			}
+		}
+	}
+}
+
+// ClearQuickAccess clears the Quick Access registry history and the jump lists
+func (wc *WindowsCleaner) ClearQuickAccess(ctx context.Context, build uint32) error {
+	logging.Info("Clearing File Explorer Quick Access recent files...")
+
+	lastError := wc.applyTweaks(ctx, OpQuickAccess, build)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	appData := wc.user.appData
+	if appData == "" {
+		return fmt.Errorf("APPDATA environment variable not set")
+	}
+	locations := []string{
+		filepath.Join(appData, "Microsoft", "Windows", "Recent", "AutomaticDestinations"),
+		filepath.Join(appData, "Microsoft", "Windows", "Recent", "CustomDestinations"),
+	}
+
+	for _, location := range locations {
+		entries, err := wc.fs.ReadDir(location)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			p := filepath.Join(location, entry.Name())
+			if err := wc.removePath(p, "jump list"); err != nil {
+				logging.Warn("Failed to remove", "path", p, "error", err)
+				wc.failures = append(wc.failures, Failure{Phase: PhaseWindows, Path: p, Err: err.Error()})
 			}
 		}
 	}
+
+	if lastError != nil {
+		return lastError
+	}
+	logging.Success("File Explorer Quick Access cleared")
+	return nil
 }
 
 // ClearRecentItemsFolder clears the Recent Items folder
-func (wc *WindowsCleaner) ClearRecentItemsFolder() error {
-	fmt.Println("[*] Clearing Recent Items folder...")
-	appData := os.Getenv("APPDATA")
+func (wc *WindowsCleaner) ClearRecentItemsFolder(ctx context.Context) error {
+	logging.Info("Clearing Recent Items folder...")
+	appData := wc.user.appData
 	if appData == "" {
 		return fmt.Errorf("APPDATA environment variable not set")
 	}
@@ -138,16 +430,19 @@ func (wc *WindowsCleaner) ClearRecentItemsFolder() error {
 	recentPath := filepath.Join(appData, "Microsoft", "Windows", "Recent")
 
 	// If the directory doesn't exist, nothing to do
-	if _, err := os.Stat(recentPath); os.IsNotExist(err) {
+	if _, err := wc.fs.Stat(recentPath); os.IsNotExist(err) {
 		return nil
 	}
 
-	entries, err := os.ReadDir(recentPath)
+	entries, err := wc.fs.ReadDir(recentPath)
 	if err != nil {
 		return fmt.Errorf("failed to read Recent folder: %v", err)
 	}
 
 	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		name := entry.Name()
 		// Skip subdirectories that are handled elsewhere
 		if entry.IsDir() && (name == "AutomaticDestinations" || name == "CustomDestinations") {
@@ -156,81 +451,169 @@ func (wc *WindowsCleaner) ClearRecentItemsFolder() error {
 
 		// Remove files and shortcuts in the Recent folder
 		p := filepath.Join(recentPath, name)
-		if err := os.RemoveAll(p); err != nil {
-			fmt.Printf("[-] Failed to remove %s: %v\n", p, err)
+		if err := wc.removePath(p, "recent item"); err != nil {
+			logging.Warn("Failed to remove", "path", p, "error", err)
+			wc.failures = append(wc.failures, Failure{Phase: PhaseWindows, Path: p, Err: err.Error()})
 		}
 	}
 
-	fmt.Println("[+] Recent Items folder cleared")
+	logging.Success("Recent Items folder cleared")
 	return nil
 }
 
 // ClearThumbnailCache clears Explorer thumbnail cache
-func (wc *WindowsCleaner) ClearThumbnailCache() error {
-	fmt.Println("[*] Clearing Explorer thumbnail cache...")
-	localAppData := os.Getenv("LOCALAPPDATA")
+func (wc *WindowsCleaner) ClearThumbnailCache(ctx context.Context) error {
+	logging.Info("Clearing Explorer thumbnail cache...")
+	localAppData := wc.user.localAppData
 	if localAppData == "" {
 		return fmt.Errorf("LOCALAPPDATA environment variable not set")
 	}
 
 	explorerPath := filepath.Join(localAppData, "Microsoft", "Windows", "Explorer")
 
-	if _, err := os.Stat(explorerPath); os.IsNotExist(err) {
+	if _, err := wc.fs.Stat(explorerPath); os.IsNotExist(err) {
 		return nil
 	}
 
-	entries, err := os.ReadDir(explorerPath)
+	entries, err := wc.fs.ReadDir(explorerPath)
 	if err != nil {
 		return fmt.Errorf("failed to read Explorer cache directory: %v", err)
 	}
 
 	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		name := strings.ToLower(entry.Name())
 		// Remove the Thumbcache and icon cache files
 		if strings.HasPrefix(name, "thumbcache_") ||
 			strings.HasPrefix(name, "iconcache_") ||
 			strings.HasPrefix(name, "iconcache") {
 			p := filepath.Join(explorerPath, entry.Name())
-			if err := os.RemoveAll(p); err != nil {
-				fmt.Printf("[-] Failed to remove %s: %v\n", p, err)
+			if err := wc.removePath(p, "thumbnail cache"); err != nil {
+				logging.Warn("Failed to remove", "path", p, "error", err)
+				wc.failures = append(wc.failures, Failure{Phase: PhaseWindows, Path: p, Err: err.Error()})
 			}
 		}
 	}
 
-	fmt.Println("[+] Explorer thumbnail cache cleared")
+	logging.Success("Explorer thumbnail cache cleared")
 	return nil
 }
 
-// RunAllWindowsCleanup runs all Windows-specific cleanup operations
-func (wc *WindowsCleaner) RunAllWindowsCleanup() error {
-	operations := []struct {
-		name string
-		fn   func() error
-	}{
-		{"Start Menu tiles", wc.ClearStartMenuTiles},
-		{"Quick Access recent files", wc.registryManager.ClearQuickAccessRecent},
-		{"Recent Items folder", wc.ClearRecentItemsFolder},
-		{"Thumbnail cache", wc.ClearThumbnailCache},
-		{"Explorer UserAssist", wc.registryManager.ClearExplorerUserAssist},
-		{"ComDlg MRU", wc.registryManager.ClearComDlgMRU},
-		{"Dark mode", wc.registryManager.EnableDarkMode},
+// operation is one selectable Windows cleanup operation
+type operation struct {
+	id   string
+	name string
+	fn   func(context.Context) error
+}
+
+// cleanUser runs the operations for one profile, mounting its registry hive in
+// an all-users run. The last failure is returned.
+func (wc *WindowsCleaner) cleanUser(ctx context.Context, u user, first bool, operations []operation) error {
+	if wc.userTweaksSelected() {
+		unmount := wc.mountHive(&u)
+		defer unmount()
+	}
+	wc.user, wc.machineWide = u, first
+
+	target := func(name string) string { return name }
+	if u.profile != nil {
+		logging.Info(fmt.Sprintf("\nWindows cleanup for %s", u.label()), "hive", u.hive)
+		target = func(name string) string { return name + " (" + u.label() + ")" }
+
+		result := ProfileResult{Profile: *u.profile, Hive: u.hive}
+		if u.hiveErr != nil {
+			result.Err = u.hiveErr.Error()
+			if wc.plan == nil {
+				logging.Warn("Registry operations skipped for this profile", "user", u.label(), "error", u.hiveErr)
+				wc.failures = append(wc.failures, Failure{Phase: PhaseWindows, Target: target("Registry hive"), Path: u.profile.Hive(), Err: result.Err})
+			}
+		}
+		wc.profileResults = append(wc.profileResults, result)
 	}
 
 	var lastError error
 	for _, op := range operations {
-		if err := op.fn(); err != nil {
-			fmt.Printf("[-] Warning: %s operation failed: %v\n", op.name, err)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !wc.operationEnabled(op.id) {
+			continue
+		}
+		if err := op.fn(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logging.Warn("Windows cleanup operation failed", "operation", target(op.name), "error", err)
+			wc.failures = append(wc.failures, Failure{Phase: PhaseWindows, Target: target(op.name), Err: err.Error()})
+			lastError = err
+		}
+	}
+	return lastError
+}
+
+// RunAllWindowsCleanup runs all Windows-specific cleanup operations. Once ctx is
+// cancelled no further operation is started and ctx's error is returned.
+func (wc *WindowsCleaner) RunAllWindowsCleanup(ctx context.Context) error {
+	// Tweaks limited to a build range are skipped when the build is unknown
+	_, _, build, _ := system.GetWindowsVersion()
+
+	if err := wc.processManager.Refresh(); err != nil {
+		logging.Debug("Could not list processes", "error", err)
+	}
+
+	operations := []operation{
+		{OpStartMenu, "Start Menu tiles", wc.ClearStartMenuTiles},
+		{OpQuickAccess, "Quick Access recent files", func(ctx context.Context) error { return wc.ClearQuickAccess(ctx, build) }},
+		{OpRecentItems, "Recent Items folder", wc.ClearRecentItemsFolder},
+		{OpThumbnails, "Thumbnail cache", wc.ClearThumbnailCache},
+		{OpUserAssist, "Explorer UserAssist", wc.tweakOperation(OpUserAssist,
+			"Clearing Explorer UserAssist data (registry)...", "Explorer UserAssist data cleared", build)},
+		{OpComDlgMRU, "ComDlg MRU", wc.tweakOperation(OpComDlgMRU,
+			"Clearing common Open/Save dialog MRU entries (ComDlg32)...", "ComDlg32 MRU entries cleared", build)},
+		{OpDarkMode, "Dark mode", wc.tweakOperation(OpDarkMode, "Enabling dark mode...", "Dark mode enabled", build)},
+	}
+	// Registry operations defined only in the config run last, before the recycle bin
+	for _, name := range Operations(wc.tweaks)[len(WindowsOperations):] {
+		operations = append(operations, operation{name, name, wc.tweakOperation(name,
+			fmt.Sprintf("Applying registry operation %s...", name), fmt.Sprintf("Registry operation %s applied", name), build)})
+	}
+
+	users := wc.users
+	if users == nil {
+		users = []user{currentUser()}
+	}
+
+	var lastError error
+	for i, u := range users {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := wc.cleanUser(ctx, u, i == 0, operations); err != nil {
 			lastError = err
 		}
 	}
 
 	// Clear recycle bin last
-	fmt.Println("[*] Emptying recycle bin...")
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !wc.operationEnabled(OpRecycleBin) {
+		return lastError
+	}
+	if wc.plan != nil {
+		wc.record(plan.EmptyRecycleBin, "all drives", "recycle bin")
+		return lastError
+	}
+
+	logging.Info("Emptying recycle bin...")
 	if err := system.ClearRecycleBin(); err != nil {
-		fmt.Printf("[-] Warning: Failed to empty recycle bin: %v\n", err)
+		logging.Warn("Failed to empty recycle bin", "error", err)
+		wc.failures = append(wc.failures, Failure{Phase: PhaseWindows, Target: "Recycle bin", Err: err.Error()})
 		lastError = err
 	} else {
-		fmt.Println("[+] Recycle bin emptied")
+		logging.Success("Recycle bin emptied")
 	}
 
 	return lastError
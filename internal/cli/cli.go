@@ -0,0 +1,297 @@
+package cli
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"nScript/internal/cleanup"
+)
+
+// Subcommands
+const (
+	CmdRun             = "run"
+	CmdPlan            = "plan"
+	CmdRestore         = "restore"
+	CmdRestoreRegistry = "restore-registry"
+	CmdPurge           = "purge"
+	CmdBackups         = "backups"
+	CmdTargets         = "targets"
+	CmdVersion         = "version"
+	CmdDoctor          = "doctor"
+	CmdHelp            = "help"
+)
+
+// commands lists every subcommand in the order shown in the usage text
+var commands = []string{CmdRun, CmdPlan, CmdRestore, CmdRestoreRegistry, CmdPurge, CmdBackups, CmdTargets, CmdVersion, CmdDoctor, CmdHelp}
+
+// Actions of the backups command
+const (
+	BackupsList  = "list"
+	BackupsShow  = "show"
+	BackupsPrune = "prune"
+)
+
+// Command is a parsed command line
+type Command struct {
+	Name       string
+	Force      bool
+	Quarantine bool
+	Unattended bool
+	AllUsers   bool
+	Verbose    bool
+	Quiet      bool
+	ConfigPath string
+	PlanFile   string
+	ReportFile string
+	OlderThan  string
+	Keep       string
+	Only       []string
+	Skip       []string
+	Args       []string // positional arguments, used by restore, restore-registry and backups
+}
+
+// flagKind says whether a flag is a switch, takes one value or takes a comma-separated list
+type flagKind int
+
+const (
+	switchFlag flagKind = iota
+	valueFlag
+	listFlag
+)
+
+// flagSpec describes one flag, its aliases and the subcommands accepting it
+type flagSpec struct {
+	names    []string
+	kind     flagKind
+	commands []string
+	apply    func(c *Command, value string)
+}
+
+var flags = []flagSpec{
+	{[]string{"--force", "-Force"}, switchFlag, []string{CmdRun, CmdPlan},
+		func(c *Command, _ string) { c.Force = true }},
+	{[]string{"--quarantine", "-Quarantine"}, switchFlag, []string{CmdRun},
+		func(c *Command, _ string) { c.Quarantine = true }},
+	{[]string{"--unattended", "-Unattended"}, switchFlag, []string{CmdRun, CmdPlan},
+		func(c *Command, _ string) { c.Unattended = true }},
+	{[]string{"--all-users", "-AllUsers"}, switchFlag, []string{CmdRun, CmdPlan, CmdTargets},
+		func(c *Command, _ string) { c.AllUsers = true }},
+	{[]string{"--config", "-Config"}, valueFlag, []string{CmdRun, CmdPlan, CmdRestoreRegistry, CmdBackups, CmdTargets, CmdDoctor},
+		func(c *Command, v string) { c.ConfigPath = v }},
+	{[]string{"--plan-file"}, valueFlag, []string{CmdPlan},
+		func(c *Command, v string) { c.PlanFile = v }},
+	{[]string{"--report"}, valueFlag, []string{CmdRun, CmdPlan},
+		func(c *Command, v string) { c.ReportFile = v }},
+	{[]string{"--only"}, listFlag, []string{CmdRun, CmdPlan},
+		func(c *Command, v string) { c.Only = append(c.Only, v) }},
+	{[]string{"--skip"}, listFlag, []string{CmdRun, CmdPlan},
+		func(c *Command, v string) { c.Skip = append(c.Skip, v) }},
+	{[]string{"--older-than"}, valueFlag, []string{CmdPurge, CmdBackups},
+		func(c *Command, v string) { c.OlderThan = v }},
+	{[]string{"--keep"}, valueFlag, []string{CmdBackups},
+		func(c *Command, v string) { c.Keep = v }},
+	{[]string{"--verbose", "-Verbose"}, switchFlag, commands,
+		func(c *Command, _ string) { c.Verbose = true }},
+	{[]string{"--quiet", "-Quiet"}, switchFlag, commands,
+		func(c *Command, _ string) { c.Quiet = true }},
+}
+
+// maxArgs is the number of positional arguments each subcommand accepts
+var maxArgs = map[string]int{CmdRestore: 2, CmdRestoreRegistry: 2, CmdBackups: 2}
+
+// Parse parses the command line without the program name. Without a subcommand
+// it runs the cleanup, and the old --dry-run and --plan-file flags select plan.
+func Parse(args []string) (*Command, error) {
+	cmd := &Command{Name: CmdRun}
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		if !slices.Contains(commands, args[0]) {
+			return nil, fmt.Errorf("unknown command %q", args[0])
+		}
+		cmd.Name = args[0]
+		args = args[1:]
+	} else if slices.ContainsFunc(args, isPlanFlag) {
+		cmd.Name = CmdPlan
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-h" || arg == "--help" || arg == "-Help":
+			return &Command{Name: CmdHelp}, nil
+		case arg == "--dry-run" || arg == "-DryRun":
+			if cmd.Name != CmdPlan {
+				return nil, fmt.Errorf("%s cannot be used with %s", arg, cmd.Name)
+			}
+			continue
+		case !strings.HasPrefix(arg, "-"):
+			if len(cmd.Args) >= maxArgs[cmd.Name] {
+				return nil, fmt.Errorf("unexpected argument %q for %s", arg, cmd.Name)
+			}
+			cmd.Args = append(cmd.Args, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		spec := lookupFlag(name)
+		if spec == nil {
+			return nil, fmt.Errorf("unknown flag %s", name)
+		}
+		if !slices.Contains(spec.commands, cmd.Name) {
+			return nil, fmt.Errorf("%s cannot be used with %s", name, cmd.Name)
+		}
+
+		if spec.kind == switchFlag {
+			if hasValue {
+				return nil, fmt.Errorf("%s does not take a value", name)
+			}
+			spec.apply(cmd, "")
+			continue
+		}
+		if !hasValue {
+			// A flag that follows is not taken as the value: --report --quiet
+			// lacks a file rather than writing to one named --quiet
+			if i+1 >= len(args) || isFlag(args[i+1]) {
+				return nil, fmt.Errorf("missing value for %s", name)
+			}
+			i++
+			value = args[i]
+		}
+		if value == "" {
+			return nil, fmt.Errorf("empty value for %s", name)
+		}
+		if spec.kind == listFlag {
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+					spec.apply(cmd, item)
+				}
+			}
+			continue
+		}
+		spec.apply(cmd, value)
+	}
+
+	if cmd.Verbose && cmd.Quiet {
+		return nil, fmt.Errorf("--verbose and --quiet cannot be used together")
+	}
+	if cmd.Name == CmdPurge && cmd.OlderThan == "" {
+		return nil, fmt.Errorf("purge requires --older-than, e.g. --older-than 30d")
+	}
+	if cmd.Name == CmdRestoreRegistry && len(cmd.Args) == 0 {
+		return nil, fmt.Errorf("restore-registry requires a backup file or ID")
+	}
+	if cmd.Name == CmdBackups {
+		if err := checkBackupsArgs(cmd); err != nil {
+			return nil, err
+		}
+	}
+	return cmd, nil
+}
+
+// checkBackupsArgs validates the action of the backups command, defaulting to list
+func checkBackupsArgs(cmd *Command) error {
+	if len(cmd.Args) == 0 {
+		cmd.Args = []string{BackupsList}
+	}
+	action := cmd.Args[0]
+	switch action {
+	case BackupsList, BackupsPrune:
+		if len(cmd.Args) > 1 {
+			return fmt.Errorf("unexpected argument %q for backups %s", cmd.Args[1], action)
+		}
+	case BackupsShow:
+		if len(cmd.Args) < 2 {
+			return fmt.Errorf("backups show requires a backup ID")
+		}
+	default:
+		return fmt.Errorf("unknown backups action %q, expected list, show or prune", action)
+	}
+	if action != BackupsPrune && (cmd.Keep != "" || cmd.OlderThan != "") {
+		return fmt.Errorf("--keep and --older-than can only be used with backups prune")
+	}
+	return nil
+}
+
+// isPlanFlag reports whether a flag selects a dry run in the old flag-only syntax
+func isPlanFlag(arg string) bool {
+	name, _, _ := strings.Cut(arg, "=")
+	return name == "--dry-run" || name == "-DryRun" || name == "--plan-file"
+}
+
+// isFlag reports whether arg is a flag this parser knows
+func isFlag(arg string) bool {
+	name, _, _ := strings.Cut(arg, "=")
+	switch name {
+	case "-h", "--help", "-Help", "--dry-run", "-DryRun":
+		return true
+	}
+	return lookupFlag(name) != nil
+}
+
+// lookupFlag returns the flag with the given name or alias
+func lookupFlag(name string) *flagSpec {
+	for i := range flags {
+		if slices.Contains(flags[i].names, name) {
+			return &flags[i]
+		}
+	}
+	return nil
+}
+
+// Usage returns the help text
+func Usage() string {
+	return `nScript - Windows System Cleaner
+
+Usage:
+  nScript.exe [run] [flags]     Clean up (the default when no command is given)
+  nScript.exe plan [flags]      Dry run: report what would be removed without touching anything
+  nScript.exe restore [<run-id> [path-glob]]
+                                List quarantine runs, or put a run's items back
+  nScript.exe restore-registry <backup-id|file.reg> [key]
+                                Undo a run's registry changes, or only those below [key]
+  nScript.exe purge --older-than <duration>
+                                Delete quarantine runs older than <duration>, e.g. 30d
+  nScript.exe backups [list | show <backup-id> | prune [--keep <n>] [--older-than <duration>]]
+                                List, inspect or delete registry backups; prune without
+                                flags applies the configured retention
+  nScript.exe targets           List the configured targets and browser data paths
+  nScript.exe doctor            Check configuration, permissions and output directories
+  nScript.exe version           Print the version
+
+Flags for run and plan:
+  --force, -Force               Remove ALL matched files regardless of age
+  --quarantine                  Move matched files to a quarantine instead of deleting them (run only)
+  --unattended                  No pauses or countdowns, for scheduled tasks and logon scripts
+  --all-users                   Clean every local user profile, not only your own
+                                (also for targets)
+  --plan-file <file>            Write the dry-run plan to <file> (plan only)
+  --report <file>               Write the JSON run report to <file> instead of
+                                %ProgramData%\nScript\reports
+  --only <names>                Run only these phases or Windows operations (comma-separated)
+  --skip <names>                Skip these phases or Windows operations (comma-separated)
+  --config <file>               Load configuration from <file> instead of
+                                nScript.json next to the binary or in %ProgramData%\nScript
+                                (also for restore-registry, backups, targets and doctor)
+
+Output flags for every command:
+  --verbose                     Also show every removed item
+  --quiet                       Only show warnings and errors
+                                (the log in %ProgramData%\nScript\logs keeps everything)
+
+Phases:             ` + strings.Join(cleanup.Phases, ", ") + `
+Windows operations: ` + strings.Join(cleanup.WindowsOperations, ", ") + `
+
+The old flag-only syntax still works: --dry-run selects plan, --plan-file implies it.
+
+Exit codes:
+  0    success
+  1    failure: the command could not do its work
+  2    partial failure: the run finished, but some items or operations failed
+  3    aborted by a safety check
+  4    invalid command line or configuration
+  130  interrupted with Ctrl+C
+
+WARNING: Force mode is destructive and cannot be undone!
+Always ensure you have backups of important data before running.
+`
+}
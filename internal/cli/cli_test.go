@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"nScript/internal/cleanup"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		args []string
+		want Command
+	}{
+		{nil, Command{Name: CmdRun}},
+		{[]string{"-Force"}, Command{Name: CmdRun, Force: true}},
+		{[]string{"run", "--unattended", "--force"}, Command{Name: CmdRun, Unattended: true, Force: true}},
+		{[]string{"run", "--quarantine", "--config=lab.json"}, Command{Name: CmdRun, Quarantine: true, ConfigPath: "lab.json"}},
+		{[]string{"--dry-run", "--force"}, Command{Name: CmdPlan, Force: true}},
+		{[]string{"--plan-file", "p.json"}, Command{Name: CmdPlan, PlanFile: "p.json"}},
+		{[]string{"plan", "--only", "files,Browsers", "--only=dark-mode"}, Command{Name: CmdPlan, Only: []string{"files", "browsers", "dark-mode"}}},
+		{[]string{"run", "--skip", "dark-mode", "--report", "r.json"}, Command{Name: CmdRun, Skip: []string{"dark-mode"}, ReportFile: "r.json"}},
+		{[]string{"restore", "20240601-080000", "*.docx"}, Command{Name: CmdRestore, Args: []string{"20240601-080000", "*.docx"}}},
+		{[]string{"restore-registry", `C:\backup\x.reg`}, Command{Name: CmdRestoreRegistry, Args: []string{`C:\backup\x.reg`}}},
+		{[]string{"restore-registry", "20240601-080000", `HKCU\Software\x`}, Command{Name: CmdRestoreRegistry, Args: []string{"20240601-080000", `HKCU\Software\x`}}},
+		{[]string{"purge", "--older-than", "30d"}, Command{Name: CmdPurge, OlderThan: "30d"}},
+		{[]string{"backups"}, Command{Name: CmdBackups, Args: []string{BackupsList}}},
+		{[]string{"backups", "show", "20240601-080000"}, Command{Name: CmdBackups, Args: []string{BackupsShow, "20240601-080000"}}},
+		{[]string{"backups", "prune", "--keep", "5", "--older-than", "30d"}, Command{Name: CmdBackups, Args: []string{BackupsPrune}, Keep: "5", OlderThan: "30d"}},
+		{[]string{"plan", "--all-users"}, Command{Name: CmdPlan, AllUsers: true}},
+		{[]string{"targets", "-Config", "lab.json", "-AllUsers"}, Command{Name: CmdTargets, ConfigPath: "lab.json", AllUsers: true}},
+		{[]string{"doctor"}, Command{Name: CmdDoctor}},
+		{[]string{"version"}, Command{Name: CmdVersion}},
+		{[]string{"run", "--help"}, Command{Name: CmdHelp}},
+		{[]string{"run", "--report", "r.json", "--quiet"}, Command{Name: CmdRun, ReportFile: "r.json", Quiet: true}},
+		{[]string{"-Verbose", "--force"}, Command{Name: CmdRun, Verbose: true, Force: true}},
+		{[]string{"restore", "--quiet"}, Command{Name: CmdRestore, Quiet: true}},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.args)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.args, *got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"clean"}, `unknown command "clean"`},
+		{[]string{"--bogus"}, "unknown flag --bogus"},
+		{[]string{"run", "--dry-run"}, "--dry-run cannot be used with run"},
+		{[]string{"plan", "--quarantine"}, "--quarantine cannot be used with plan"},
+		{[]string{"version", "--force"}, "--force cannot be used with version"},
+		{[]string{"doctor", "--all-users"}, "--all-users cannot be used with doctor"},
+		{[]string{"--config"}, "missing value for --config"},
+		{[]string{"--force=yes"}, "--force does not take a value"},
+		{[]string{"--only="}, "empty value for --only"},
+		{[]string{"restore", "a", "b", "c"}, `unexpected argument "c" for restore`},
+		{[]string{"run", "extra"}, `unexpected argument "extra" for run`},
+		{[]string{"purge"}, "purge requires --older-than"},
+		{[]string{"restore-registry"}, "restore-registry requires a backup file"},
+		{[]string{"restore-registry", "a.reg", "key", "b.reg"}, `unexpected argument "b.reg" for restore-registry`},
+		{[]string{"backups", "delete"}, `unknown backups action "delete"`},
+		{[]string{"backups", "show"}, "backups show requires a backup ID"},
+		{[]string{"backups", "list", "x"}, `unexpected argument "x" for backups list`},
+		{[]string{"backups", "--keep", "3"}, "can only be used with backups prune"},
+		{[]string{"run", "--report", "--quiet"}, "missing value for --report"},
+		{[]string{"plan", "--verbose", "--quiet"}, "--verbose and --quiet cannot be used together"},
+		{[]string{"--quiet=yes"}, "--quiet does not take a value"},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.args)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v, want %q", tt.args, err, tt.want)
+		}
+	}
+}
+
+func TestSelection(t *testing.T) {
+	tests := []struct {
+		name       string
+		only, skip []string
+		phases     string
+		ops        string
+	}{
+		{"everything by default", nil, nil, "files browsers empty-dirs windows", "start-menu dark-mode recycle-bin"},
+		{"skip a phase", nil, []string{"browsers"}, "files empty-dirs windows", "start-menu dark-mode recycle-bin"},
+		{"skip dark mode", nil, []string{"dark-mode"}, "files browsers empty-dirs windows", "start-menu recycle-bin"},
+		{"only phases", []string{"files", "empty-dirs"}, nil, "files empty-dirs", "start-menu dark-mode recycle-bin"},
+		{"only one operation", []string{"recycle-bin"}, nil, "windows", "recycle-bin"},
+		{"only windows minus one", []string{"windows"}, []string{"dark-mode"}, "windows", "start-menu recycle-bin"},
+	}
+
+	for _, tt := range tests {
+		s, err := NewSelection(tt.only, tt.skip, cleanup.WindowsOperations)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var phases, ops []string
+		for _, p := range cleanup.Phases {
+			if s.Phase(p) {
+				phases = append(phases, p)
+			}
+		}
+		for _, op := range []string{"start-menu", "dark-mode", "recycle-bin"} {
+			if s.WindowsOperation(op) {
+				ops = append(ops, op)
+			}
+		}
+		if got := strings.Join(phases, " "); got != tt.phases {
+			t.Errorf("%s: phases = %q, want %q", tt.name, got, tt.phases)
+		}
+		if got := strings.Join(ops, " "); got != tt.ops {
+			t.Errorf("%s: operations = %q, want %q", tt.name, got, tt.ops)
+		}
+	}
+
+	if _, err := NewSelection([]string{"registry"}, nil, cleanup.WindowsOperations); err == nil {
+		t.Error("unknown name was accepted")
+	}
+
+	// Registry operations from the config are accepted like built-in operations
+	s, err := NewSelection([]string{"wordwheel-query"}, nil, append(cleanup.WindowsOperations, "wordwheel-query"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Phase(cleanup.PhaseWindows) || !s.WindowsOperation("wordwheel-query") || s.WindowsOperation(cleanup.OpDarkMode) {
+		t.Error("config operation not selected on its own")
+	}
+}
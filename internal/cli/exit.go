@@ -0,0 +1,12 @@
+package cli
+
+// Exit codes. They are part of the command line contract: deployment tooling
+// relies on them, so existing codes must not change meaning.
+const (
+	ExitSuccess     = 0   // everything selected ran without errors
+	ExitFailure     = 1   // the command could not do its work, e.g. the quarantine could not be created
+	ExitPartial     = 2   // the run finished, but some items or operations failed
+	ExitSafetyAbort = 3   // a safety check stopped the run before it could do damage
+	ExitConfigError = 4   // invalid command line or configuration; nothing was done
+	ExitInterrupted = 130 // stopped with Ctrl+C
+)
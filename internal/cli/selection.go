@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"fmt"
+	"slices"
+
+	"nScript/internal/cleanup"
+)
+
+// Selection decides which phases and Windows operations run, from --only and --skip
+type Selection struct {
+	only       map[string]bool
+	skip       map[string]bool
+	operations []string
+}
+
+// NewSelection validates the names given to --only and --skip against the phases
+// and the Windows operations, including those defined in the config. A Windows
+// operation in --only also selects the windows phase, limited to the named operations.
+func NewSelection(only, skip, operations []string) (*Selection, error) {
+	s := &Selection{only: map[string]bool{}, skip: map[string]bool{}, operations: operations}
+	for _, list := range []struct {
+		flag  string
+		names []string
+		set   map[string]bool
+	}{{"--only", only, s.only}, {"--skip", skip, s.skip}} {
+		for _, name := range list.names {
+			if !slices.Contains(cleanup.Phases, name) && !slices.Contains(operations, name) {
+				return nil, fmt.Errorf("%s: unknown phase or Windows operation %q", list.flag, name)
+			}
+			list.set[name] = true
+		}
+	}
+	return s, nil
+}
+
+// Phase reports whether a phase runs
+func (s *Selection) Phase(phase string) bool {
+	if s.skip[phase] {
+		return false
+	}
+	if len(s.only) == 0 || s.only[phase] {
+		return true
+	}
+	return phase == cleanup.PhaseWindows && s.anyOperationListed()
+}
+
+// WindowsOperation reports whether a Windows operation runs within the windows phase
+func (s *Selection) WindowsOperation(op string) bool {
+	if s.skip[op] {
+		return false
+	}
+	if len(s.only) == 0 || s.only[cleanup.PhaseWindows] || !s.anyOperationListed() {
+		return true
+	}
+	return s.only[op]
+}
+
+// anyOperationListed reports whether --only names individual Windows operations
+func (s *Selection) anyOperationListed() bool {
+	for _, op := range s.operations {
+		if s.only[op] {
+			return true
+		}
+	}
+	return false
+}
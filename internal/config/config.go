@@ -1,9 +1,19 @@
 package config
 
 import (
+	"fmt"
+	"io/fs"
 	"os"
-	"path/filepath"
+	"runtime"
+	"strings"
 	"time"
+
+	"nScript/internal/breaker"
+	"nScript/internal/fsys"
+	"nScript/internal/regbackup"
+	"nScript/internal/rules"
+	"nScript/internal/system"
+	"nScript/internal/tweaks"
 )
 
 const (
@@ -11,233 +21,306 @@ const (
 	OnlyRemoveOlderThan = 24 * time.Hour
 	MaxConcurrentOps    = 500
 	UpdateInterval      = 50 * time.Millisecond
-	MaxBatchSize        = 1000 // For streaming file processing
+	QueueSize           = 1000 // Deletions decided by the walk and waiting for a worker
+	ForceWarningDelay   = 3 * time.Second
+	ClosingDelay        = 3 * time.Second
+
+	// Built-in targets other than the user's folders have their own age
+	// thresholds: Downloads, Temp and the caches, and the data of games
+	DownloadsOlderThan = 7 * 24 * time.Hour
+	TemporaryOlderThan = time.Hour
+	GamesOlderThan     = 0
+
+	// Registry backup archives are kept for the newest runs and for a limited time
+	RegistryBackupKeep   = 20
+	RegistryBackupMaxAge = 90 * 24 * time.Hour
+
+	// ShutdownTimeout is how long a browser or app asked to close may take to exit
+	ShutdownTimeout = 10 * time.Second
+
+	// A run stops before it deletes more files or frees more of a volume than this
+	MaxRunFiles       = 1000000
+	MaxRunVolumeShare = 0.5
 )
 
 type Config struct {
-	UserDirectories    []string
+	Targets []Target
+	// Rules apply to every target after the target's own rules
+	Rules              []rules.Rule
 	BrowserInformation map[string][]string
 	ExcludedExtensions []string
+	// OlderThan and AgeSource are the defaults for targets that do not set their own
+	OlderThan time.Duration
+	AgeSource AgeSource
+	// MaxConcurrentOps caps how many file operations run at once; within it
+	// the worker pool adapts to each volume
+	MaxConcurrentOps int
+	// MaxOpsPerSecond and MaxBytesPerSecond cap the rate of file operations
+	// and of bytes deleted; zero leaves a rate uncapped
+	MaxOpsPerSecond   float64
+	MaxBytesPerSecond int64
+	// Links says what happens to symbolic links, junctions and other reparse
+	// points found below a target; they are never followed
+	Links LinkPolicy
+	// ProtectedPaths are never deleted, nor anything below them, in addition
+	// to the built-in protected system and profile folders
+	ProtectedPaths []string
+	// Limits are the ceilings at which the deletion circuit breaker stops a run
+	Limits breaker.Limits
+	// RegistryTweaks are the built-in registry operations followed by the configured ones
+	RegistryTweaks []tweaks.Tweak
+	// RegistryBackupDir holds one backup archive per run; RegistryBackupKeep and
+	// RegistryBackupMaxAge limit how many are kept, zero meaning no limit
+	RegistryBackupDir    string
+	RegistryBackupKeep   int
+	RegistryBackupMaxAge time.Duration
+	// Shutdown says how running browsers and apps are ended before their data is removed
+	Shutdown system.ShutdownPolicies
+
+	// UserHome is the profile the per-user paths were built for, %USERPROFILE%
+	// or $HOME when the configuration was loaded
+	UserHome string
+	// AllUsers cleans every local profile instead of only UserHome's; profiles
+	// of the accounts in ProfileAllowlist are left alone
+	AllUsers         bool
+	ProfileAllowlist []string
+	// UsersDir is searched for profiles when the ProfileList registry key cannot be read
+	UsersDir string
+
+	// Source is the file the configuration was loaded from, empty for built-in defaults
+	Source string
+}
+
+// Target is a directory to clean with the rules and age threshold that apply only to it
+type Target struct {
+	Path  string
+	Rules []rules.Rule
+
+	// OlderThan is the minimum age of removed items; zero cleans immediately
+	OlderThan time.Duration
+	AgeSource AgeSource
+
+	// inherit is set on built-in targets that follow the global threshold
+	// rather than having their own
+	inherit bool
 }
 
-// GetConfig returns the hardcoded configuration as requested
-func GetConfig() *Config {
-	userHome := os.Getenv("USERPROFILE")
-	programData := os.Getenv("ProgramData")
-	programFilesX86 := os.Getenv("ProgramFiles(x86)")
+// AgeSource selects the timestamp that decides how old an item is
+type AgeSource string
+
+const (
+	AgeModified AgeSource = "modified"
+	AgeAccessed AgeSource = "accessed"
+	AgeCreated  AgeSource = "created"
+	// AgeNewest uses the most recent of the three timestamps
+	AgeNewest AgeSource = "newest"
+)
+
+// ParseAgeSource validates an age source name
+func ParseAgeSource(s string) (AgeSource, error) {
+	switch source := AgeSource(s); source {
+	case AgeModified, AgeAccessed, AgeCreated, AgeNewest:
+		return source, nil
+	}
+	return "", fmt.Errorf("unknown age source %q, expected modified, accessed, created or newest", s)
+}
+
+// LinkPolicy says what the cleanup does with a link found below a target
+type LinkPolicy string
+
+const (
+	// LinkUnlink removes the link itself, leaving what it points to alone
+	LinkUnlink LinkPolicy = "unlink"
+	// LinkSkip leaves the link in place
+	LinkSkip LinkPolicy = "skip"
+)
+
+// ParseLinkPolicy validates a link policy name
+func ParseLinkPolicy(s string) (LinkPolicy, error) {
+	switch policy := LinkPolicy(s); policy {
+	case LinkUnlink, LinkSkip:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown link policy %q, expected unlink or skip", s)
+}
+
+// Time returns the timestamp selected by the age source
+func (s AgeSource) Time(t fsys.Times) time.Time {
+	switch s {
+	case AgeAccessed:
+		return t.Accessed
+	case AgeCreated:
+		return t.Created
+	case AgeNewest:
+		newest := t.Modified
+		for _, candidate := range []time.Time{t.Accessed, t.Created} {
+			if candidate.After(newest) {
+				newest = candidate
+			}
+		}
+		return newest
+	}
+	return t.Modified
+}
+
+// Age returns how old a file is according to the age source
+func (s AgeSource) Age(info fs.FileInfo, now time.Time) time.Duration {
+	return now.Sub(s.Time(fsys.TimesOf(info)))
+}
+
+// RulesFor returns the ordered rule list for a target: its own rules, then the
+// shared rules, then one exclude rule per excluded extension
+func (c *Config) RulesFor(t Target) []rules.Rule {
+	list := make([]rules.Rule, 0, len(t.Rules)+len(c.Rules)+len(c.ExcludedExtensions))
+	list = append(list, t.Rules...)
+	list = append(list, c.Rules...)
+	for _, ext := range c.ExcludedExtensions {
+		list = append(list, rules.Rule{Action: rules.Exclude, Pattern: "*" + ext, Name: "excluded extension " + ext})
+	}
+	return list
+}
+
+// Default returns the built-in configuration used when no config file is present
+func Default() *Config {
+	userHome := homeDir()
 
 	return &Config{
-		UserDirectories:    buildUserDirectories(userHome, programData, programFilesX86),
-		BrowserInformation: buildBrowserInfo(userHome),
-		ExcludedExtensions: []string{
-			".iso", ".lnk",
-			// ".vdi", ".sav", ".vbox", ".vbox-prev", ".ovf", ".vbox-extpack", ".vhdx", ".qcow2", ".img", ".vmdk", ".vhd", ".hdd", ".nvram", ".ova",
+		Targets:              defaultDirectories(userHome),
+		Rules:                defaultRules(),
+		BrowserInformation:   defaultBrowsers(userHome),
+		ExcludedExtensions:   defaultExcludedExtensions(),
+		OlderThan:            OnlyRemoveOlderThan,
+		AgeSource:            AgeModified,
+		MaxConcurrentOps:     MaxConcurrentOps,
+		Links:                LinkUnlink,
+		RegistryTweaks:       tweaks.Defaults(),
+		RegistryBackupDir:    regbackup.DefaultRoot(),
+		RegistryBackupKeep:   RegistryBackupKeep,
+		RegistryBackupMaxAge: RegistryBackupMaxAge,
+		Shutdown:             defaultShutdown(),
+		Limits:               breaker.Limits{Run: breaker.Ceiling{Files: MaxRunFiles, VolumeShare: MaxRunVolumeShare}},
+		UserHome:             userHome,
+		UsersDir:             defaultUsersDir(),
+	}
+}
+
+// defaultShutdown asks every process to close before terminating it with its
+// process tree. The Start Menu host has no window to close and starts no
+// processes. Explorer is only terminated: asked to close it offers to shut
+// Windows down, and its tree holds every program the user started.
+func defaultShutdown() system.ShutdownPolicies {
+	return system.ShutdownPolicies{
+		Default: system.ShutdownPolicy{Close: true, Timeout: ShutdownTimeout, Tree: true},
+		Overrides: map[string]system.ShutdownPolicy{
+			"startmenuexperiencehost.exe": {},
+			"explorer.exe":                {},
 		},
 	}
 }
 
-func buildUserDirectories(userHome, programData, programFilesX86 string) []string {
+// CheckHome returns an error when the profile the per-user paths are built
+// from is unknown. They would then be relative to wherever nScript was
+// started, so a run must not go ahead.
+func (c *Config) CheckHome() error {
+	if c.UserHome == "" {
+		return fmt.Errorf("environment variable %s is not set, so the per-user paths have no profile", HomeVariable)
+	}
+	return nil
+}
+
+// ForProfiles returns a copy of the configuration whose per-user targets and
+// browser paths, those inside UserHome, are repeated for each of homes instead.
+// Machine-wide paths are kept once.
+func (c *Config) ForProfiles(homes []string) *Config {
+	profileCfg := *c
+	profileCfg.Targets = nil
+	var userTargets []Target
+	for _, t := range c.Targets {
+		if _, ok := rebase(t.Path, c.UserHome, c.UserHome); ok {
+			userTargets = append(userTargets, t)
+		} else {
+			profileCfg.Targets = append(profileCfg.Targets, t)
+		}
+	}
+	for _, home := range homes {
+		for _, t := range userTargets {
+			t.Path, _ = rebase(t.Path, c.UserHome, home)
+			profileCfg.Targets = append(profileCfg.Targets, t)
+		}
+	}
+
+	profileCfg.BrowserInformation = make(map[string][]string, len(c.BrowserInformation))
+	for process, dirs := range c.BrowserInformation {
+		var rebased []string
+		for _, dir := range dirs {
+			if _, ok := rebase(dir, c.UserHome, c.UserHome); !ok {
+				rebased = append(rebased, dir)
+				continue
+			}
+			for _, home := range homes {
+				path, _ := rebase(dir, c.UserHome, home)
+				rebased = append(rebased, path)
+			}
+		}
+		profileCfg.BrowserInformation[process] = rebased
+	}
+	return &profileCfg
+}
+
+// rebase moves path from inside oldHome to the same place inside newHome and
+// reports whether path was inside oldHome. Windows paths compare case-insensitively.
+func rebase(path, oldHome, newHome string) (string, bool) {
+	if oldHome == "" || len(path) <= len(oldHome) {
+		return path, false
+	}
+	prefix, rest := path[:len(oldHome)], path[len(oldHome):]
+	if !os.IsPathSeparator(rest[0]) || !samePath(prefix, oldHome) {
+		return path, false
+	}
+	return newHome + rest, true
+}
+
+// samePath compares paths the way the filesystem does
+func samePath(a, b string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+func defaultExcludedExtensions() []string {
 	return []string{
-		filepath.Join(userHome, "Downloads"),
-		filepath.Join(userHome, "Documents"),
-		filepath.Join(userHome, "Desktop"),
-		filepath.Join(userHome, "Videos"),
-		filepath.Join(userHome, "Music"),
-		filepath.Join(userHome, "Pictures"),
-		filepath.Join(userHome, "3D Objects"),
-		filepath.Join(userHome, "Saved Games"),
-		filepath.Join(userHome, "Contacts"),
-		filepath.Join(userHome, "Links"),
-		filepath.Join(userHome, "Favorites"),
-		filepath.Join(userHome, "AppData", "Local", "Temp"),
-		filepath.Join(userHome, "AppData", "Roaming", "Microsoft", "Windows", "Recent"),
-		filepath.Join(userHome, "AppData", "Local", "Low", "Microsoft", "Internet Explorer"),
-		filepath.Join(userHome, "AppData", "Local", "Microsoft", "Windows", "INetCache"),
-		filepath.Join(userHome, "AppData", "Local", "Microsoft", "Windows", "INetCookies"),
-		filepath.Join(userHome, "AppData", "Roaming", "Microsoft", "Office", "Recent"),
-		filepath.Join(userHome, "AppData", "Local", "Microsoft", "Windows", "Clipboard"),
-		filepath.Join(userHome, ".cache"),
-		filepath.Join(userHome, "AppData", "Local", "Roblox"),
-		filepath.Join(userHome, "AppData", "Roaming", "Microsoft", "Windows", "Start Menu", "Programs", "Roblox"),
-		filepath.Join(userHome, "AppData", "Roaming", "Microsoft", "Windows", "Start Menu", "Programs", "Discord Inc"),
-		filepath.Join(userHome, "AppData", "Local", "Discord"),
-		filepath.Join(programData, "Microsoft", "Windows", "Start Menu", "Programs", "Epic Games Launcher.lnk"),
-		filepath.Join(programFilesX86, "Epic Games"),
-		filepath.Join(userHome, "AppData", "Roaming", "Microsoft", "Windows", "Start Menu", "Programs", "osu!.lnk"),
-		filepath.Join(userHome, "AppData", "Local", "osu!"),
-		filepath.Join(userHome, "AppData", "Roaming", "Microsoft", "Windows", "Start Menu", "Programs", "Paradox Interactive"),
-		filepath.Join(userHome, "AppData", "Local", "Programs", "Paradox Interactive"),
-		filepath.Join(userHome, "MicrosoftEdgeBackups"),
-		filepath.Join(userHome, "AppData", "Roaming", "Godot"),
-		filepath.Join(userHome, "AppData", "Roaming", ".tlauncher"),
-		filepath.Join(userHome, "AppData", "Roaming", ".minecraft"),
-		filepath.Join("C:", "Steam"),
-		filepath.Join("C:", "Flashpoint"),
-		filepath.Join("C:", "Program Files", "Epic Games"),
-		filepath.Join("C:", "ProgramData", "Riot Games"),
-		filepath.Join(userHome, "AppData", "Local", "Riot Games"),
-		filepath.Join(userHome, "AppData", "Roaming", "Riot Games"),
-		filepath.Join("C:", "Riot Games"),
-		filepath.Join(userHome, "AppData", "Local", "Programs", "Riot Games"),
-		filepath.Join(userHome, "AppData", "Roaming", "Microsoft", "Windows", "Start Menu", "Programs", "Riot Games"),
-		filepath.Join(userHome, "AppData", "Local", "EA Games"),
-		filepath.Join(userHome, "AppData", "Roaming", "Origin"),
-		filepath.Join(userHome, "AppData", "Local", "Origin"),
-		filepath.Join("C:", "Program Files", "Origin"),
-		filepath.Join("C:", "Program Files (x86)", "Origin"),
-		filepath.Join(userHome, "AppData", "Local", "Battle.net"),
-		filepath.Join(userHome, "AppData", "Roaming", "Battle.net"),
-		filepath.Join("C:", "Program Files (x86)", "Battle.net"),
-		filepath.Join(userHome, "AppData", "Local", "Blizzard Entertainment"),
-		filepath.Join(userHome, "AppData", "Roaming", "Blizzard Entertainment"),
-		filepath.Join(userHome, "AppData", "Local", "Steam"),
-		filepath.Join(userHome, "AppData", "Roaming", "Steam"),
-		filepath.Join(userHome, "AppData", "Local", "Programs", "Steam"),
-		filepath.Join("C:", "Program Files (x86)", "Steam"),
-		filepath.Join(userHome, "AppData", "Local", "Ubisoft Game Launcher"),
-		filepath.Join("C:", "Program Files (x86)", "Ubisoft"),
-		filepath.Join(userHome, "AppData", "Roaming", "GOG.com"),
-		filepath.Join(userHome, "AppData", "Local", "GOG.com"),
-		filepath.Join("C:", "Program Files (x86)", "GOG Galaxy"),
-		filepath.Join(userHome, "AppData", "Roaming", "Minecraft Launcher"),
-		filepath.Join(userHome, "AppData", "Local", "Packages", "Microsoft.MinecraftUWP_8wekyb3d8bbwe"),
-		filepath.Join(userHome, "AppData", "Local", "CrashDumps"),
-		filepath.Join(userHome, "AppData", "Local", "FortniteGame"),
-		filepath.Join(userHome, "AppData", "Local", "UnrealEngine"),
-		filepath.Join(userHome, "AppData", "Local", "VALORANT"),
-		filepath.Join(userHome, "AppData", "Local", "Rockstar Games"),
-		filepath.Join(userHome, "AppData", "Roaming", "Microsoft", "Windows", "Start Menu", "Programs", "Rockstar Games"),
-		filepath.Join("C:", "Program Files", "Rockstar Games"),
-		filepath.Join(userHome, "AppData", "Local", "2K"),
-		filepath.Join(userHome, "AppData", "Roaming", "2K"),
-		filepath.Join(userHome, "AppData", "Local", "ROBLOX Corporation"),
-		filepath.Join(userHome, "AppData", "Local", "Roblox Studio"),
-		filepath.Join(userHome, "AppData", "Local", "Programs", "Roblox"),
-		filepath.Join("C:", "Program Files (x86)", "Roblox"),
-		filepath.Join(userHome, "AppData", "Local", "Microsoft", "Games"),
-		filepath.Join(userHome, "AppData", "Local", "Packages", "Microsoft.GamingApp_8wekyb3d8bbwe"),
-		filepath.Join(userHome, "AppData", "Local", "Packages", "Microsoft.XboxApp_8wekyb3d8bbwe"),
-		filepath.Join(userHome, "AppData", "Local", "Packages", "Microsoft.XboxGamingOverlay_8wekyb3d8bbwe"),
-		filepath.Join(userHome, "AppData", "Local", "SquareEnix"),
-		filepath.Join(userHome, "Documents", "My Games"),
-		filepath.Join(userHome, "Documents", "EA Games"),
-		filepath.Join(userHome, "Documents", "Rockstar Games"),
-		filepath.Join(userHome, "Saved Games", "EA"),
-		filepath.Join(userHome, "AppData", "Local", "TeamViewer"),
-		filepath.Join(userHome, "AppData", "Roaming", "TeamViewer"),
-		filepath.Join("C:", "Program Files (x86)", "TeamViewer"),
-		filepath.Join(userHome, "AppData", "Local", "AnyDesk"),
-		filepath.Join(userHome, "AppData", "Roaming", "AnyDesk"),
-		filepath.Join("C:", "Program Files (x86)", "AnyDesk"),
-		filepath.Join(userHome, "AppData", "Local", "Spotify"),
-		filepath.Join(userHome, "AppData", "Roaming", "Spotify"),
-		filepath.Join(userHome, "AppData", "Local", "Programs", "Spotify"),
-		filepath.Join(userHome, "AppData", "Local", "slack"),
-		filepath.Join(userHome, "AppData", "Roaming", "Slack"),
-		filepath.Join(userHome, "AppData", "Local", "Programs", "slack"),
-		filepath.Join(userHome, "AppData", "Local", "Skype"),
-		filepath.Join(userHome, "AppData", "Roaming", "Skype"),
-		filepath.Join(userHome, "AppData", "Local", "Microsoft", "Skype for Desktop"),
-		filepath.Join(userHome, "AppData", "Local", "WhatsApp"),
-		filepath.Join(userHome, "AppData", "Roaming", "WhatsApp"),
-		filepath.Join(userHome, "AppData", "Local", "Telegram Desktop"),
-		filepath.Join(userHome, "AppData", "Roaming", "Telegram Desktop"),
-		filepath.Join(userHome, "AppData", "Local", "qBittorrent"),
-		filepath.Join(userHome, "AppData", "Roaming", "qBittorrent"),
-		filepath.Join(userHome, "AppData", "Roaming", "uTorrent"),
-		filepath.Join(userHome, "AppData", "Local", "uTorrent"),
-		filepath.Join(userHome, "AppData", "Roaming", "BitTorrent"),
-		filepath.Join(userHome, "AppData", "Local", "BitTorrent"),
-		filepath.Join(userHome, "AppData", "Local", "Twitch"),
-		filepath.Join(userHome, "AppData", "Roaming", "Twitch"),
-		filepath.Join(userHome, "AppData", "Local", "Programs", "Twitch"),
-		filepath.Join(userHome, "AppData", "Local", "itch"),
-		filepath.Join(userHome, "AppData", "Roaming", "itch"),
-	}
-}
-
-func buildBrowserInfo(userHome string) map[string][]string {
-	return map[string][]string{
-		"firefox.exe": {
-			filepath.Join(userHome, "AppData", "Roaming", "Mozilla", "Firefox", "Profiles"),
-			filepath.Join(userHome, "AppData", "Local", "Mozilla", "Firefox", "Profiles"),
-			filepath.Join(userHome, "AppData", "Roaming", "Mozilla", "Firefox", "profiles.ini"),
-		},
-		"chrome.exe": {
-			filepath.Join(userHome, "AppData", "Local", "Google", "Chrome", "User Data"),
-		},
-		"msedge.exe": {
-			filepath.Join(userHome, "AppData", "Local", "Microsoft", "Edge", "User Data"),
-		},
-		"opera.exe": {
-			filepath.Join(userHome, "AppData", "Roaming", "Opera Software", "Opera Stable"),
-			filepath.Join(userHome, "AppData", "Local", "Opera Software", "Opera Stable"),
-			filepath.Join(userHome, "AppData", "Roaming", "Opera Software"),
-			filepath.Join(userHome, "AppData", "Local", "Opera Software"),
-			filepath.Join(userHome, "AppData", "Local", "Programs", "Opera"),
-		},
-		"opera_gx.exe": {
-			filepath.Join(userHome, "AppData", "Roaming", "Opera Software", "Opera GX Stable"),
-			filepath.Join(userHome, "AppData", "Local", "Opera Software", "Opera GX Stable"),
-			filepath.Join(userHome, "AppData", "Roaming", "Microsoft", "Windows", "Start Menu", "Programs", "Przeglądarka Opera GX.lnk"),
-			filepath.Join(userHome, "AppData", "Local", "Programs", "Opera GX"),
-		},
-		"brave.exe": {
-			filepath.Join(userHome, "AppData", "Local", "BraveSoftware", "Brave-Browser", "User Data"),
-			filepath.Join(userHome, "AppData", "Roaming", "BraveSoftware"),
-		},
-		"vivaldi.exe": {
-			filepath.Join(userHome, "AppData", "Local", "Vivaldi", "User Data"),
-			filepath.Join(userHome, "AppData", "Roaming", "Vivaldi"),
-		},
-		"avgsecurebrowser.exe": {
-			filepath.Join(userHome, "AppData", "Local", "AVG", "Browser", "User Data"),
-			filepath.Join(userHome, "AppData", "Roaming", "AVG", "Browser"),
-		},
-		"avastsecurebrowser.exe": {
-			filepath.Join(userHome, "AppData", "Local", "AVAST Software", "Browser", "User Data"),
-			filepath.Join(userHome, "AppData", "Roaming", "AVAST Software", "Browser"),
-		},
-		"yandex.exe": {
-			filepath.Join(userHome, "AppData", "Local", "Yandex", "YandexBrowser", "User Data"),
-			filepath.Join(userHome, "AppData", "Roaming", "Yandex"),
-		},
-		"torch.exe": {
-			filepath.Join(userHome, "AppData", "Local", "Torch", "User Data"),
-			filepath.Join(userHome, "AppData", "Roaming", "Torch"),
-		},
-		"chromium.exe": {
-			filepath.Join(userHome, "AppData", "Local", "Chromium", "User Data"),
-		},
-		"iexplore.exe": {
-			filepath.Join(userHome, "AppData", "Local", "Microsoft", "Windows", "INetCache"),
-			filepath.Join(userHome, "AppData", "Local", "Microsoft", "Windows", "INetCookies"),
-			filepath.Join(userHome, "AppData", "Local", "Microsoft", "Internet Explorer"),
-		},
-		"maxthon.exe": {
-			filepath.Join(userHome, "AppData", "Roaming", "Maxthon5"),
-			filepath.Join(userHome, "AppData", "Local", "Maxthon5"),
-		},
-		"seamonkey.exe": {
-			filepath.Join(userHome, "AppData", "Roaming", "Mozilla", "SeaMonkey"),
-			filepath.Join(userHome, "AppData", "Local", "Mozilla", "SeaMonkey"),
-		},
-		"waterfox.exe": {
-			filepath.Join(userHome, "AppData", "Roaming", "Waterfox"),
-			filepath.Join(userHome, "AppData", "Local", "Waterfox"),
-		},
-		"palemoon.exe": {
-			filepath.Join(userHome, "AppData", "Roaming", "Moonchild Productions", "Pale Moon"),
-			filepath.Join(userHome, "AppData", "Local", "Moonchild Productions", "Pale Moon"),
-		},
-		"slimjet.exe": {
-			filepath.Join(userHome, "AppData", "Local", "Slimjet", "User Data"),
-		},
-		"cent.exe": {
-			filepath.Join(userHome, "AppData", "Local", "CentBrowser", "User Data"),
-		},
-		"onedrive.exe": {
-			filepath.Join(userHome, "AppData", "Local", "Microsoft", "OneDrive"),
-		},
+		".iso", ".lnk",
+		// ".vdi", ".sav", ".vbox", ".vbox-prev", ".ovf", ".vbox-extpack", ".vhdx", ".qcow2", ".img", ".vmdk", ".vhd", ".hdd", ".nvram", ".ova",
+	}
+}
+
+// defaultRules lets launcher shortcuts and installers with these names be removed
+// even when their extension is excluded
+func defaultRules() []rules.Rule {
+	keywords := []string{"roblox", "paradox", "opera", "discord", "osu", "steam", "epic games"}
+	list := make([]rules.Rule, 0, len(keywords))
+	for _, kw := range keywords {
+		list = append(list, rules.Rule{Action: rules.Include, Pattern: "*" + kw + "*", Name: "name contains '" + kw + "'"})
+	}
+	return list
+}
+
+// targetsFor returns the built-in targets at paths, cleaned of items older than olderThan
+func targetsFor(paths []string, olderThan time.Duration) []Target {
+	targets := make([]Target, 0, len(paths))
+	for _, path := range paths {
+		targets = append(targets, Target{Path: path, OlderThan: olderThan, AgeSource: AgeModified})
+	}
+	return targets
+}
+
+// inheritedTargets returns the built-in targets at paths that follow the
+// global threshold, OnlyRemoveOlderThan unless a configuration changes it
+func inheritedTargets(paths []string) []Target {
+	targets := targetsFor(paths, OnlyRemoveOlderThan)
+	for i := range targets {
+		targets[i].inherit = true
 	}
+	return targets
 }
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// targetsByPath returns the targets of cfg keyed by path
+func targetsByPath(cfg *Config) map[string]Target {
+	targets := make(map[string]Target, len(cfg.Targets))
+	for _, target := range cfg.Targets {
+		targets[target.Path] = target
+	}
+	return targets
+}
+
+func TestDefaultThresholds(t *testing.T) {
+	home := filepath.Join(root, "student")
+	temp, game, app := filepath.Join(home, ".cache"), filepath.Join(home, ".minecraft"), filepath.Join(home, ".config", "spotify")
+	if runtime.GOOS == "windows" {
+		t.Setenv("USERPROFILE", home)
+		temp = filepath.Join(home, "AppData", "Local", "Temp")
+		game = filepath.Join(home, "AppData", "Roaming", ".minecraft")
+		app = filepath.Join(home, "AppData", "Roaming", "Spotify")
+	} else {
+		t.Setenv("HOME", home)
+		for _, env := range []string{"XDG_CONFIG_HOME", "XDG_DATA_HOME", "XDG_CACHE_HOME"} {
+			t.Setenv(env, "")
+		}
+	}
+	downloads, documents := filepath.Join(home, "Downloads"), filepath.Join(home, "Documents")
+
+	want := map[string]time.Duration{
+		temp:      time.Hour,
+		downloads: 7 * 24 * time.Hour,
+		game:      0,
+		app:       24 * time.Hour,
+		documents: 24 * time.Hour,
+	}
+	targets := targetsByPath(Default())
+	for path, olderThan := range want {
+		target, ok := targets[path]
+		if !ok {
+			t.Errorf("no built-in target %s", path)
+		} else if target.OlderThan != olderThan {
+			t.Errorf("%s is cleaned after %v, want %v", path, target.OlderThan, olderThan)
+		}
+	}
+
+	// A configured threshold moves the targets that follow the global one
+	// and leaves those with their own alone
+	cfg, err := Parse([]byte(`{ "onlyRemoveOlderThan": "48h", "ageSource": "accessed" }`), FileName, lookupEnv)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want[documents], want[app] = 48*time.Hour, 48*time.Hour
+	targets = targetsByPath(cfg)
+	for path, olderThan := range want {
+		if target := targets[path]; target.OlderThan != olderThan || target.AgeSource != AgeAccessed {
+			t.Errorf("%s is cleaned after %v by %s time, want %v by accessed time", path, target.OlderThan, target.AgeSource, olderThan)
+		}
+	}
+}
+
+func TestCheckHome(t *testing.T) {
+	t.Setenv(HomeVariable, "")
+	if err := Default().CheckHome(); err == nil || !strings.Contains(err.Error(), HomeVariable) {
+		t.Errorf("CheckHome without a profile = %v, want an error naming %s", err, HomeVariable)
+	}
+
+	t.Setenv(HomeVariable, filepath.Join(root, "student"))
+	if err := Default().CheckHome(); err != nil {
+		t.Errorf("CheckHome = %v", err)
+	}
+}
+
+func TestExplorerIsOnlyTerminated(t *testing.T) {
+	cfg, err := Parse([]byte(`{ "shutdown": { "timeout": "20s", "tree": true } }`), FileName, lookupEnv)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if policy := cfg.Shutdown.For("Explorer.EXE"); policy.Close || policy.Tree {
+		t.Errorf("explorer.exe policy = %+v, want it terminated alone without being asked to close", policy)
+	}
+}
+
+func TestExplicitThresholdIsKept(t *testing.T) {
+	data := `{
+		"onlyRemoveOlderThan": "48h",
+		"targets": [
+			{ "path": "%ROOT%/explicit", "olderThan": "24h" },
+			{ "path": "%ROOT%/inherited" }
+		]
+	}`
+	cfg, err := Parse([]byte(data), FileName, lookupEnv)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	targets := targetsByPath(cfg)
+	if got := targets[filepath.Join(root, "explicit")].OlderThan; got != 24*time.Hour {
+		t.Errorf("target set to 24h is cleaned after %v under a global 48h", got)
+	}
+	if got := targets[filepath.Join(root, "inherited")].OlderThan; got != 48*time.Hour {
+		t.Errorf("target without a threshold is cleaned after %v, want the global 48h", got)
+	}
+
+	// A built-in target's own threshold is kept even when it equals the default
+	cfg = Default()
+	cfg.Targets = append(inheritedTargets([]string{filepath.Join(root, "inherited")}), targetsFor([]string{filepath.Join(root, "own")}, OnlyRemoveOlderThan)...)
+	cfg.OlderThan = 48 * time.Hour
+	cfg.applyGlobalAge()
+	targets = targetsByPath(cfg)
+	if got := targets[filepath.Join(root, "own")].OlderThan; got != OnlyRemoveOlderThan {
+		t.Errorf("built-in target with its own %v is cleaned after %v", OnlyRemoveOlderThan, got)
+	}
+	if got := targets[filepath.Join(root, "inherited")].OlderThan; got != 48*time.Hour {
+		t.Errorf("built-in target following the global threshold is cleaned after %v, want 48h", got)
+	}
+}
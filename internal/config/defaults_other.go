@@ -0,0 +1,165 @@
+//go:build !windows
+
+package config
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// HomeVariable holds the home directory of the account running nScript
+const HomeVariable = "HOME"
+
+// homeDir returns the home directory of the account running nScript
+func homeDir() string {
+	return os.Getenv(HomeVariable)
+}
+
+// defaultUsersDir returns the directory holding the home directories
+func defaultUsersDir() string {
+	return "/home"
+}
+
+// xdgDir returns the XDG base directory set in env, or fallback inside userHome
+// when it is unset or not absolute, as the XDG Base Directory spec requires
+func xdgDir(env, userHome string, fallback ...string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(append([]string{userHome}, fallback...)...)
+}
+
+// userDirs reads the localized folder names from xdg-user-dirs' user-dirs.dirs,
+// keyed by name without the XDG_ prefix and _DIR suffix, e.g. DOWNLOAD. Folders
+// missing from the file get their English default name.
+func userDirs(userHome, configHome string) map[string]string {
+	dirs := map[string]string{
+		"DESKTOP":   filepath.Join(userHome, "Desktop"),
+		"DOWNLOAD":  filepath.Join(userHome, "Downloads"),
+		"DOCUMENTS": filepath.Join(userHome, "Documents"),
+		"MUSIC":     filepath.Join(userHome, "Music"),
+		"PICTURES":  filepath.Join(userHome, "Pictures"),
+		"VIDEOS":    filepath.Join(userHome, "Videos"),
+	}
+
+	f, err := os.Open(filepath.Join(configHome, "user-dirs.dirs"))
+	if err != nil {
+		return dirs
+	}
+	defer f.Close()
+
+	// Lines look like XDG_DOWNLOAD_DIR="$HOME/Pobrane"
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || !strings.HasPrefix(name, "XDG_") || !strings.HasSuffix(name, "_DIR") {
+			continue
+		}
+		value = strings.Trim(value, `"`)
+		if rest, ok := strings.CutPrefix(value, "$HOME"); ok {
+			value = userHome + rest
+		}
+		// A folder set to the home directory itself is disabled
+		if !filepath.IsAbs(value) || filepath.Clean(value) == filepath.Clean(userHome) {
+			continue
+		}
+		dirs[strings.TrimSuffix(strings.TrimPrefix(name, "XDG_"), "_DIR")] = filepath.Clean(value)
+	}
+	return dirs
+}
+
+// defaultDirectories returns the built-in targets with their age thresholds:
+// Downloads after a week, the user's XDG folders and the data of the apps
+// students install after a day, the caches and trash after an hour, and games
+// at once
+func defaultDirectories(userHome string) []Target {
+	configHome := xdgDir("XDG_CONFIG_HOME", userHome, ".config")
+	dataHome := xdgDir("XDG_DATA_HOME", userHome, ".local", "share")
+	dirs := userDirs(userHome, configHome)
+	flatpak := filepath.Join(userHome, ".var", "app")
+
+	folders := []string{
+		dirs["DOCUMENTS"],
+		dirs["DESKTOP"],
+		dirs["VIDEOS"],
+		dirs["MUSIC"],
+		dirs["PICTURES"],
+	}
+	temporary := []string{
+		xdgDir("XDG_CACHE_HOME", userHome, ".cache"),
+		filepath.Join(dataHome, "Trash"),
+	}
+	games := []string{
+		filepath.Join(userHome, ".steam"),
+		filepath.Join(dataHome, "Steam"),
+		filepath.Join(flatpak, "com.valvesoftware.Steam"),
+		filepath.Join(userHome, ".minecraft"),
+		filepath.Join(userHome, ".tlauncher"),
+		filepath.Join(flatpak, "com.mojang.Minecraft"),
+		filepath.Join(dataHome, "osu"),
+		filepath.Join(configHome, "itch"),
+	}
+	apps := []string{
+		filepath.Join(configHome, "discord"),
+		filepath.Join(flatpak, "com.discordapp.Discord"),
+		filepath.Join(dataHome, "godot"),
+		filepath.Join(configHome, "godot"),
+		filepath.Join(dataHome, "TelegramDesktop"),
+		filepath.Join(configHome, "spotify"),
+		filepath.Join(configHome, "Slack"),
+		filepath.Join(configHome, "qBittorrent"),
+		filepath.Join(dataHome, "qBittorrent"),
+	}
+
+	return slices.Concat(
+		targetsFor([]string{dirs["DOWNLOAD"]}, DownloadsOlderThan),
+		inheritedTargets(folders),
+		targetsFor(temporary, TemporaryOlderThan),
+		targetsFor(games, GamesOlderThan),
+		inheritedTargets(apps),
+	)
+}
+
+// defaultBrowsers returns the data paths of each browser, keyed by process name
+func defaultBrowsers(userHome string) map[string][]string {
+	configHome := xdgDir("XDG_CONFIG_HOME", userHome, ".config")
+	cacheHome := xdgDir("XDG_CACHE_HOME", userHome, ".cache")
+	snap := filepath.Join(userHome, "snap")
+
+	return map[string][]string{
+		"firefox": {
+			filepath.Join(userHome, ".mozilla", "firefox"),
+			filepath.Join(cacheHome, "mozilla", "firefox"),
+			filepath.Join(snap, "firefox", "common", ".mozilla", "firefox"),
+		},
+		"chrome": {
+			filepath.Join(configHome, "google-chrome"),
+			filepath.Join(cacheHome, "google-chrome"),
+		},
+		"chromium": {
+			filepath.Join(configHome, "chromium"),
+			filepath.Join(cacheHome, "chromium"),
+			filepath.Join(snap, "chromium", "common", "chromium"),
+		},
+		"msedge": {
+			filepath.Join(configHome, "microsoft-edge"),
+			filepath.Join(cacheHome, "microsoft-edge"),
+		},
+		"opera": {
+			filepath.Join(configHome, "opera"),
+			filepath.Join(cacheHome, "opera"),
+		},
+		"brave": {
+			filepath.Join(configHome, "BraveSoftware", "Brave-Browser"),
+			filepath.Join(cacheHome, "BraveSoftware", "Brave-Browser"),
+		},
+		"vivaldi-bin": {
+			filepath.Join(configHome, "vivaldi"),
+			filepath.Join(cacheHome, "vivaldi"),
+		},
+	}
+}
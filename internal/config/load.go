@@ -0,0 +1,1010 @@
+package config
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"nScript/internal/breaker"
+	"nScript/internal/regfile"
+	"nScript/internal/rules"
+	"nScript/internal/system"
+	"nScript/internal/tweaks"
+	"nScript/internal/winreg"
+)
+
+// FileName is the config file name looked up next to the binary and in ProgramData
+const FileName = "nScript.json"
+
+// Config files are JSON only. nScript runs elevated and deletes files, so it
+// keeps to the standard library rather than taking on YAML and TOML parsers,
+// and the file, line and field of validation errors come from the offsets of
+// the JSON decoder. Files with these extensions are refused up front rather
+// than failing as malformed JSON.
+var unsupportedExtensions = map[string]string{".yaml": "YAML", ".yml": "YAML", ".toml": "TOML"}
+
+// File is the on-disk configuration schema. Omitted fields keep the built-in defaults.
+type File struct {
+	Targets             []FileTarget        `json:"targets"`
+	UserDirectories     []string            `json:"userDirectories"`
+	Rules               []FileRule          `json:"rules"`
+	Browsers            map[string][]string `json:"browsers"`
+	ExcludedExtensions  []string            `json:"excludedExtensions"`
+	OnlyRemoveOlderThan *Duration           `json:"onlyRemoveOlderThan"`
+	AgeSource           *string             `json:"ageSource"`
+	MaxConcurrentOps    *int                `json:"maxConcurrentOps"`
+	MaxOpsPerSecond     *float64            `json:"maxOpsPerSecond"`
+	MaxBytesPerSecond   *Size               `json:"maxBytesPerSecond"`
+	Links               *string             `json:"links"`
+	ProtectedPaths      []string            `json:"protectedPaths"`
+	Registry            []FileTweak         `json:"registry"`
+	RegistryBackups     *FileBackups        `json:"registryBackups"`
+	Profiles            *FileProfiles       `json:"profiles"`
+	Shutdown            *FileShutdown       `json:"shutdown"`
+	Limits              *FileLimits         `json:"limits"`
+}
+
+// FileLimits sets the ceilings of the deletion circuit breaker for the whole
+// run and, in perTarget, for each target
+type FileLimits struct {
+	MaxFiles       *int64       `json:"maxFiles"`
+	MaxBytes       *Size        `json:"maxBytes"`
+	MaxVolumeShare *Share       `json:"maxVolumeShare"`
+	PerTarget      *FileCeiling `json:"perTarget"`
+}
+
+// FileCeiling is a set of ceilings whose unset fields are inherited; zero removes a ceiling
+type FileCeiling struct {
+	MaxFiles       *int64 `json:"maxFiles"`
+	MaxBytes       *Size  `json:"maxBytes"`
+	MaxVolumeShare *Share `json:"maxVolumeShare"`
+}
+
+// apply overrides the fields of ceiling that are set
+func (c FileCeiling) apply(ceiling breaker.Ceiling) (breaker.Ceiling, error) {
+	if c.MaxFiles != nil {
+		if *c.MaxFiles < 0 {
+			return ceiling, errors.New("maxFiles cannot be negative")
+		}
+		ceiling.Files = *c.MaxFiles
+	}
+	if c.MaxBytes != nil {
+		if *c.MaxBytes < 0 {
+			return ceiling, errors.New("maxBytes cannot be negative")
+		}
+		ceiling.Bytes = int64(*c.MaxBytes)
+	}
+	if c.MaxVolumeShare != nil {
+		ceiling.VolumeShare = float64(*c.MaxVolumeShare)
+	}
+	return ceiling, nil
+}
+
+// FileShutdown sets how running browsers and apps are ended, for every process
+// and for single processes keyed by process name
+type FileShutdown struct {
+	Close     *bool                         `json:"close"`
+	Timeout   *Duration                     `json:"timeout"`
+	Tree      *bool                         `json:"tree"`
+	Processes map[string]FileShutdownPolicy `json:"processes"`
+}
+
+// FileShutdownPolicy is a shutdown policy whose unset fields are inherited
+type FileShutdownPolicy struct {
+	Close   *bool     `json:"close"`
+	Timeout *Duration `json:"timeout"`
+	Tree    *bool     `json:"tree"`
+}
+
+// apply overrides the fields of policy that are set
+func (p FileShutdownPolicy) apply(policy system.ShutdownPolicy) (system.ShutdownPolicy, error) {
+	if p.Close != nil {
+		policy.Close = *p.Close
+	}
+	if p.Timeout != nil {
+		if *p.Timeout < 0 {
+			return policy, errors.New("duration cannot be negative")
+		}
+		policy.Timeout = time.Duration(*p.Timeout)
+	}
+	if p.Tree != nil {
+		policy.Tree = *p.Tree
+	}
+	return policy, nil
+}
+
+// FileProfiles selects which user profiles a run cleans
+type FileProfiles struct {
+	AllUsers       bool     `json:"allUsers"`
+	Allowlist      []string `json:"allowlist"`
+	UsersDirectory string   `json:"usersDirectory"`
+}
+
+// FileBackups sets where registry backups are kept and for how long
+type FileBackups struct {
+	Directory string    `json:"directory"`
+	Keep      *int      `json:"keep"`
+	MaxAge    *Duration `json:"maxAge"`
+}
+
+// FileTarget is a target directory with its own rules and age threshold
+type FileTarget struct {
+	Path      string     `json:"path"`
+	Rules     []FileRule `json:"rules"`
+	OlderThan *Duration  `json:"olderThan"`
+	AgeSource *string    `json:"ageSource"`
+}
+
+// FileRule is either a pattern string such as "!School/**" or an object adding limits
+type FileRule struct {
+	Pattern    string    `json:"pattern"`
+	MinSize    *Size     `json:"minSize"`
+	MaxSize    *Size     `json:"maxSize"`
+	OlderThan  *Duration `json:"olderThan"`
+	NewerThan  *Duration `json:"newerThan"`
+	Attributes []string  `json:"attributes"`
+}
+
+// UnmarshalJSON accepts a bare pattern string as well as the object form
+func (r *FileRule) UnmarshalJSON(data []byte) error {
+	var pattern string
+	if err := json.Unmarshal(data, &pattern); err == nil {
+		*r = FileRule{Pattern: pattern}
+		return nil
+	}
+
+	type plain FileRule
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return errors.New("rule must be a pattern string or an object")
+	}
+	*r = FileRule(p)
+	return nil
+}
+
+// rule converts the file form into a rule
+func (r FileRule) rule() rules.Rule {
+	rule := rules.Parse(r.Pattern)
+	if r.MinSize != nil {
+		rule.MinSize = int64(*r.MinSize)
+	}
+	if r.MaxSize != nil {
+		rule.MaxSize = int64(*r.MaxSize)
+	}
+	if r.OlderThan != nil {
+		rule.OlderThan = time.Duration(*r.OlderThan)
+	}
+	if r.NewerThan != nil {
+		rule.NewerThan = time.Duration(*r.NewerThan)
+	}
+	rule.Attributes = r.Attributes
+	return rule
+}
+
+// FileTweak is a registry change added to the built-in ones
+type FileTweak struct {
+	Name     string          `json:"name"`
+	Action   string          `json:"action"`
+	Hive     string          `json:"hive"`
+	Key      string          `json:"key"`
+	Pattern  string          `json:"pattern"`
+	Value    string          `json:"value"`
+	Type     string          `json:"type"`
+	Data     json.RawMessage `json:"data"`
+	MinBuild uint32          `json:"minBuild"`
+	MaxBuild uint32          `json:"maxBuild"`
+}
+
+// tweak converts and validates the file form, returning the field at fault with the error
+func (t FileTweak) tweak() (tweaks.Tweak, string, error) {
+	tweak := tweaks.Tweak{
+		Name:     t.Name,
+		Kind:     tweaks.Kind(t.Action),
+		Key:      strings.Trim(t.Key, `\`),
+		Pattern:  t.Pattern,
+		Value:    regfile.Value{Name: t.Value},
+		MinBuild: t.MinBuild,
+		MaxBuild: t.MaxBuild,
+	}
+	root, err := winreg.ParseRoot(t.Hive)
+	if err != nil {
+		return tweaks.Tweak{}, "hive", err
+	}
+	tweak.Root = root
+
+	if tweak.Kind == tweaks.SetValue {
+		if t.Type == "" {
+			return tweaks.Tweak{}, "type", errors.New("setValue needs a type")
+		}
+		valueType, err := tweaks.ParseType(t.Type)
+		if err != nil {
+			return tweaks.Tweak{}, "type", err
+		}
+		if tweak.Value, err = parseData(t.Value, valueType, t.Data); err != nil {
+			return tweaks.Tweak{}, "data", err
+		}
+	} else if t.Type != "" || t.Data != nil {
+		return tweaks.Tweak{}, "data", fmt.Errorf("%s does not take a type or data", t.Action)
+	}
+
+	if err := tweak.Validate(); err != nil {
+		return tweaks.Tweak{}, "", err
+	}
+	return tweak, "", nil
+}
+
+// parseData decodes the data of a setValue tweak according to its type: a string
+// for REG_SZ and REG_EXPAND_SZ, a list of strings for REG_MULTI_SZ, a number or
+// "0x" hex string for REG_DWORD and REG_QWORD, and hex bytes such as "01,ff" for REG_BINARY
+func parseData(name string, valueType regfile.ValueType, data json.RawMessage) (regfile.Value, error) {
+	if data == nil {
+		return regfile.Value{}, errors.New("setValue needs data")
+	}
+	switch valueType {
+	case regfile.SZ, regfile.ExpandSZ:
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return regfile.Value{}, fmt.Errorf("%s data must be a string", tweaks.TypeName(valueType))
+		}
+		if valueType == regfile.SZ {
+			return regfile.String(name, s), nil
+		}
+		return regfile.ExpandString(name, s), nil
+	case regfile.MultiSZ:
+		var list []string
+		if err := json.Unmarshal(data, &list); err != nil {
+			return regfile.Value{}, errors.New("REG_MULTI_SZ data must be a list of strings")
+		}
+		return regfile.MultiString(name, list), nil
+	case regfile.DWord, regfile.QWord:
+		bits := 32
+		if valueType == regfile.QWord {
+			bits = 64
+		}
+		text := string(data)
+		var s string
+		if json.Unmarshal(data, &s) == nil {
+			text = s
+		}
+		n, err := strconv.ParseUint(text, 0, bits)
+		if err != nil {
+			return regfile.Value{}, fmt.Errorf("%s data must be an unsigned %d-bit number", tweaks.TypeName(valueType), bits)
+		}
+		if valueType == regfile.QWord {
+			return regfile.QWordValue(name, n), nil
+		}
+		return regfile.DWordValue(name, uint32(n)), nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return regfile.Value{}, errors.New("REG_BINARY data must be a hex string such as \"01,02,ff\"")
+	}
+	raw, err := hex.DecodeString(strings.NewReplacer(",", "", " ", "").Replace(s))
+	if err != nil {
+		return regfile.Value{}, fmt.Errorf("invalid hex data %q", s)
+	}
+	return regfile.BinaryValue(name, raw), nil
+}
+
+// Size is a byte count that unmarshals from a number or a string such as "500MB"
+type Size int64
+
+// UnmarshalJSON parses a byte count or a size string with a B, KB, MB, GB or TB suffix
+func (s *Size) UnmarshalJSON(data []byte) error {
+	var n int64
+	if err := json.Unmarshal(data, &n); err == nil {
+		*s = Size(n)
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return errors.New("size must be a number of bytes or a string such as \"500MB\"")
+	}
+	parsed, err := ParseSize(str)
+	if err != nil {
+		return err
+	}
+	*s = Size(parsed)
+	return nil
+}
+
+// ParseSize parses sizes such as "512", "64KB" or "1.5GB" using binary units
+func ParseSize(str string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(str))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if number, ok := strings.CutSuffix(s, unit.suffix); ok {
+			s, multiplier = strings.TrimSpace(number), unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", str)
+	}
+	// Also rejects NaN and infinity, which have no int64 value
+	size := n * float64(multiplier)
+	if !(size < math.MaxInt64) {
+		return 0, fmt.Errorf("size %q is too large", str)
+	}
+	return int64(size), nil
+}
+
+// Share is a fraction that unmarshals from a percentage string such as "25%"
+type Share float64
+
+// UnmarshalJSON parses a percentage between 0% and 100%
+func (s *Share) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return errors.New("share must be a percentage such as \"25%\"")
+	}
+	number, ok := strings.CutSuffix(strings.TrimSpace(str), "%")
+	n, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if !ok || err != nil || n < 0 || n > 100 {
+		return fmt.Errorf("invalid share %q, expected a percentage such as \"25%%\"", str)
+	}
+	*s = Share(n / 100)
+	return nil
+}
+
+// Duration is a time.Duration that unmarshals from strings such as "90m", "24h" or "7d"
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string, accepting a "d" suffix for days
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.New("duration must be a string such as \"24h\" or \"7d\"")
+	}
+	parsed, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes the duration in Go duration syntax
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// ParseDuration parses a Go duration string, additionally accepting whole days ("7d")
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return parsed, nil
+}
+
+// ValidationError describes a problem in a config file
+type ValidationError struct {
+	File  string
+	Line  int
+	Field string
+	Err   error
+}
+
+func (e *ValidationError) Error() string {
+	location := e.File
+	if e.Line > 0 {
+		location = fmt.Sprintf("%s:%d", e.File, e.Line)
+	}
+	if e.Field == "" {
+		return fmt.Sprintf("%s: %v", location, e.Err)
+	}
+	return fmt.Sprintf("%s: %s: %v", location, e.Field, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// SearchPaths returns the locations checked for a config file, in order
+func SearchPaths() []string {
+	var paths []string
+	if exe, err := os.Executable(); err == nil {
+		paths = append(paths, filepath.Join(filepath.Dir(exe), FileName))
+	}
+	if programData := os.Getenv("ProgramData"); programData != "" {
+		paths = append(paths, filepath.Join(programData, "nScript", FileName))
+	}
+	return paths
+}
+
+// Load returns the configuration from path, or from the first file found in
+// SearchPaths when path is empty. The built-in defaults are used when no file exists.
+func Load(path string) (*Config, error) {
+	if path != "" {
+		return LoadFile(path)
+	}
+
+	for _, candidate := range SearchPaths() {
+		if _, err := os.Stat(candidate); err == nil {
+			return LoadFile(candidate)
+		}
+	}
+
+	return Default(), nil
+}
+
+// LoadFile reads and validates a config file, layering it over the built-in defaults
+func LoadFile(path string) (*Config, error) {
+	if format, ok := unsupportedExtensions[strings.ToLower(filepath.Ext(path))]; ok {
+		return nil, &ValidationError{File: path, Err: fmt.Errorf("%s config files are not supported, write the configuration as JSON", format)}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	cfg, err := Parse(data, path, os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Source = path
+	return cfg, nil
+}
+
+// Parse decodes config file contents. name is only used in error messages and
+// lookupEnv resolves %VARIABLE% references in paths.
+func Parse(data []byte, name string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	lines, err := fieldLines(data)
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, &ValidationError{File: name, Line: lineAt(data, syntaxErr.Offset), Err: err}
+		}
+		return nil, &ValidationError{File: name, Err: err}
+	}
+
+	fail := func(field string, err error) error {
+		return &ValidationError{File: name, Line: lines[field], Field: field, Err: err}
+	}
+
+	var generic any
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, &ValidationError{File: name, Err: err}
+	}
+	if field := unknownField(generic, reflect.TypeFor[File](), ""); field != "" {
+		return nil, fail(field, errors.New("unknown field"))
+	}
+
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, &ValidationError{File: name, Line: lineAt(data, typeErr.Offset), Field: typeErr.Field,
+				Err: fmt.Errorf("expected %s, got JSON %s", typeErr.Type, typeErr.Value)}
+		}
+		// Sizes, durations and the like report errors without saying where
+		if field, fieldErr := invalidField(generic, reflect.TypeFor[File](), ""); field != "" {
+			return nil, fail(field, fieldErr)
+		}
+		return nil, &ValidationError{File: name, Err: err}
+	}
+
+	cfg := Default()
+
+	if file.OnlyRemoveOlderThan != nil {
+		if *file.OnlyRemoveOlderThan < 0 {
+			return nil, fail("onlyRemoveOlderThan", errors.New("duration cannot be negative"))
+		}
+		cfg.OlderThan = time.Duration(*file.OnlyRemoveOlderThan)
+	}
+
+	if file.AgeSource != nil {
+		source, err := ParseAgeSource(*file.AgeSource)
+		if err != nil {
+			return nil, fail("ageSource", err)
+		}
+		cfg.AgeSource = source
+	}
+
+	if file.Links != nil {
+		policy, err := ParseLinkPolicy(*file.Links)
+		if err != nil {
+			return nil, fail("links", err)
+		}
+		cfg.Links = policy
+	}
+
+	cfg.applyGlobalAge()
+
+	if file.Targets != nil || file.UserDirectories != nil {
+		cfg.Targets = make([]Target, 0, len(file.Targets)+len(file.UserDirectories))
+		for i, t := range file.Targets {
+			field := fmt.Sprintf("targets[%d]", i)
+			expanded, err := expandPath(t.Path, lookupEnv)
+			if err != nil {
+				return nil, fail(field+".path", err)
+			}
+			targetRules, err := convertRules(t.Rules, field+".rules", fail)
+			if err != nil {
+				return nil, err
+			}
+			target := Target{Path: expanded, Rules: targetRules, OlderThan: cfg.OlderThan, AgeSource: cfg.AgeSource}
+			if t.OlderThan != nil {
+				if *t.OlderThan < 0 {
+					return nil, fail(field+".olderThan", errors.New("duration cannot be negative"))
+				}
+				target.OlderThan = time.Duration(*t.OlderThan)
+			}
+			if t.AgeSource != nil {
+				source, err := ParseAgeSource(*t.AgeSource)
+				if err != nil {
+					return nil, fail(field+".ageSource", err)
+				}
+				target.AgeSource = source
+			}
+			cfg.Targets = append(cfg.Targets, target)
+		}
+		for i, dir := range file.UserDirectories {
+			field := fmt.Sprintf("userDirectories[%d]", i)
+			expanded, err := expandPath(dir, lookupEnv)
+			if err != nil {
+				return nil, fail(field, err)
+			}
+			cfg.Targets = append(cfg.Targets, Target{Path: expanded, OlderThan: cfg.OlderThan, AgeSource: cfg.AgeSource})
+		}
+	}
+
+	for i, dir := range file.ProtectedPaths {
+		expanded, err := expandPath(dir, lookupEnv)
+		if err != nil {
+			return nil, fail(fmt.Sprintf("protectedPaths[%d]", i), err)
+		}
+		cfg.ProtectedPaths = append(cfg.ProtectedPaths, expanded)
+	}
+
+	if file.Rules != nil {
+		sharedRules, err := convertRules(file.Rules, "rules", fail)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Rules = sharedRules
+	}
+
+	if file.Browsers != nil {
+		cfg.BrowserInformation = make(map[string][]string, len(file.Browsers))
+		for process, dirs := range file.Browsers {
+			field := "browsers." + process
+			selector, err := processSelector(process, lookupEnv)
+			if err != nil {
+				return nil, fail(field, err)
+			}
+			expandedDirs := make([]string, 0, len(dirs))
+			for i, dir := range dirs {
+				expanded, err := expandPath(dir, lookupEnv)
+				if err != nil {
+					return nil, fail(fmt.Sprintf("%s[%d]", field, i), err)
+				}
+				expandedDirs = append(expandedDirs, expanded)
+			}
+			cfg.BrowserInformation[selector] = expandedDirs
+		}
+	}
+
+	if file.ExcludedExtensions != nil {
+		cfg.ExcludedExtensions = make([]string, 0, len(file.ExcludedExtensions))
+		for i, ext := range file.ExcludedExtensions {
+			if !strings.HasPrefix(ext, ".") || len(ext) < 2 {
+				return nil, fail(fmt.Sprintf("excludedExtensions[%d]", i), fmt.Errorf("extension %q must start with a dot", ext))
+			}
+			cfg.ExcludedExtensions = append(cfg.ExcludedExtensions, strings.ToLower(ext))
+		}
+	}
+
+	if file.MaxConcurrentOps != nil {
+		if *file.MaxConcurrentOps < 1 {
+			return nil, fail("maxConcurrentOps", errors.New("must be at least 1"))
+		}
+		cfg.MaxConcurrentOps = *file.MaxConcurrentOps
+	}
+	if file.MaxOpsPerSecond != nil {
+		if *file.MaxOpsPerSecond < 0 {
+			return nil, fail("maxOpsPerSecond", errors.New("cannot be negative"))
+		}
+		cfg.MaxOpsPerSecond = *file.MaxOpsPerSecond
+	}
+	if file.MaxBytesPerSecond != nil {
+		if *file.MaxBytesPerSecond < 0 {
+			return nil, fail("maxBytesPerSecond", errors.New("cannot be negative"))
+		}
+		cfg.MaxBytesPerSecond = int64(*file.MaxBytesPerSecond)
+	}
+
+	// Configured tweaks add to the built-in ones
+	for i, t := range file.Registry {
+		tweak, sub, err := t.tweak()
+		if err != nil {
+			field := fmt.Sprintf("registry[%d]", i)
+			if sub != "" {
+				field += "." + sub
+			}
+			return nil, fail(field, err)
+		}
+		cfg.RegistryTweaks = append(cfg.RegistryTweaks, tweak)
+	}
+
+	if b := file.RegistryBackups; b != nil {
+		if b.Directory != "" {
+			expanded, err := expandPath(b.Directory, lookupEnv)
+			if err != nil {
+				return nil, fail("registryBackups.directory", err)
+			}
+			cfg.RegistryBackupDir = expanded
+		}
+		if b.Keep != nil {
+			if *b.Keep < 0 {
+				return nil, fail("registryBackups.keep", errors.New("cannot be negative"))
+			}
+			cfg.RegistryBackupKeep = *b.Keep
+		}
+		if b.MaxAge != nil {
+			if *b.MaxAge < 0 {
+				return nil, fail("registryBackups.maxAge", errors.New("duration cannot be negative"))
+			}
+			cfg.RegistryBackupMaxAge = time.Duration(*b.MaxAge)
+		}
+	}
+
+	if p := file.Profiles; p != nil {
+		cfg.AllUsers = p.AllUsers
+		for i, name := range p.Allowlist {
+			if strings.TrimSpace(name) == "" || strings.ContainsAny(name, `\/`) {
+				return nil, fail(fmt.Sprintf("profiles.allowlist[%d]", i), fmt.Errorf("%q is not an account name", name))
+			}
+		}
+		cfg.ProfileAllowlist = p.Allowlist
+		if p.UsersDirectory != "" {
+			expanded, err := expandPath(p.UsersDirectory, lookupEnv)
+			if err != nil {
+				return nil, fail("profiles.usersDirectory", err)
+			}
+			cfg.UsersDir = expanded
+		}
+	}
+
+	if l := file.Limits; l != nil {
+		run, err := FileCeiling{MaxFiles: l.MaxFiles, MaxBytes: l.MaxBytes, MaxVolumeShare: l.MaxVolumeShare}.apply(cfg.Limits.Run)
+		if err != nil {
+			return nil, fail("limits", err)
+		}
+		cfg.Limits.Run = run
+		if l.PerTarget != nil {
+			target, err := l.PerTarget.apply(cfg.Limits.Target)
+			if err != nil {
+				return nil, fail("limits.perTarget", err)
+			}
+			cfg.Limits.Target = target
+		}
+	}
+
+	if sh := file.Shutdown; sh != nil {
+		policy, err := FileShutdownPolicy{Close: sh.Close, Timeout: sh.Timeout, Tree: sh.Tree}.apply(cfg.Shutdown.Default)
+		if err != nil {
+			return nil, fail("shutdown.timeout", err)
+		}
+		// Built-in overrides keep their own settings unless the file replaces them
+		overrides := make(map[string]system.ShutdownPolicy, len(cfg.Shutdown.Overrides)+len(sh.Processes))
+		for name, override := range cfg.Shutdown.Overrides {
+			overrides[name] = override
+		}
+		for name, p := range sh.Processes {
+			selector, err := processSelector(name, lookupEnv)
+			if err != nil {
+				return nil, fail("shutdown.processes."+name, err)
+			}
+			override, err := p.apply(policy)
+			if err != nil {
+				return nil, fail(fmt.Sprintf("shutdown.processes.%s.timeout", name), err)
+			}
+			overrides[strings.ToLower(selector)] = override
+		}
+		cfg.Shutdown = system.ShutdownPolicies{Default: policy, Overrides: overrides}
+	}
+
+	return cfg, nil
+}
+
+// applyGlobalAge makes the built-in targets follow the global age source, and
+// the global threshold unless they have their own, such as Temp's hour
+func (c *Config) applyGlobalAge() {
+	for i := range c.Targets {
+		if c.Targets[i].inherit {
+			c.Targets[i].OlderThan = c.OlderThan
+		}
+		c.Targets[i].AgeSource = c.AgeSource
+	}
+}
+
+// convertRules converts and validates the rules of one list, reporting errors against field
+func convertRules(list []FileRule, field string, fail func(string, error) error) ([]rules.Rule, error) {
+	converted := make([]rules.Rule, 0, len(list))
+	for i, r := range list {
+		rule := r.rule()
+		if err := rule.Validate(); err != nil {
+			return nil, fail(fmt.Sprintf("%s[%d]", field, i), err)
+		}
+		converted = append(converted, rule)
+	}
+	return converted, nil
+}
+
+// processSelector validates a process name, or expands an image path glob such
+// as %ProgramFiles%\Google\**\chrome.exe, which is told apart by its separators
+func processSelector(selector string, lookupEnv func(string) (string, bool)) (string, error) {
+	if strings.TrimSpace(selector) == "" {
+		return "", errors.New("process name cannot be empty")
+	}
+	if !strings.ContainsAny(selector, `\/`) {
+		return selector, nil
+	}
+	expanded, err := expandPath(selector, lookupEnv)
+	if err != nil {
+		return "", err
+	}
+	for _, segment := range strings.FieldsFunc(expanded, func(r rune) bool { return r == '\\' || r == '/' }) {
+		if _, err := path.Match(segment, ""); err != nil {
+			return "", fmt.Errorf("invalid image path pattern %q", selector)
+		}
+	}
+	return expanded, nil
+}
+
+// expandPath expands environment references in a configured path and checks it is absolute
+func expandPath(path string, lookupEnv func(string) (string, bool)) (string, error) {
+	expanded, err := ExpandEnv(path, lookupEnv)
+	if err != nil {
+		return "", err
+	}
+	if expanded == "" {
+		return "", errors.New("path cannot be empty")
+	}
+	if !filepath.IsAbs(expanded) {
+		return "", fmt.Errorf("path %q is not absolute", expanded)
+	}
+	return filepath.Clean(expanded), nil
+}
+
+// ExpandEnv replaces %NAME% references with environment values. "%%" is a literal
+// percent sign. Referencing an undefined variable is an error rather than an
+// empty string, so a missing variable can never turn a path into a parent directory.
+func ExpandEnv(s string, lookupEnv func(string) (string, bool)) (string, error) {
+	var out strings.Builder
+	for {
+		start := strings.IndexByte(s, '%')
+		if start < 0 {
+			out.WriteString(s)
+			return out.String(), nil
+		}
+		out.WriteString(s[:start])
+
+		end := strings.IndexByte(s[start+1:], '%')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated environment variable in %q", s)
+		}
+		name := s[start+1 : start+1+end]
+		s = s[start+2+end:]
+
+		if name == "" {
+			out.WriteByte('%')
+			continue
+		}
+		value, ok := lookupEnv(name)
+		if !ok || value == "" {
+			return "", fmt.Errorf("environment variable %%%s%% is not set", name)
+		}
+		out.WriteString(value)
+	}
+}
+
+// unknownField returns the path of the first field in v that does not exist in t
+func unknownField(v any, t reflect.Type, path string) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch value := v.(type) {
+	case map[string]any:
+		switch t.Kind() {
+		case reflect.Map:
+			for key, child := range value {
+				if field := unknownField(child, t.Elem(), joinField(path, key)); field != "" {
+					return field
+				}
+			}
+		case reflect.Struct:
+			fields := jsonFields(t)
+			for key, child := range value {
+				fieldType, ok := fields[key]
+				if !ok {
+					return joinField(path, key)
+				}
+				if field := unknownField(child, fieldType, joinField(path, key)); field != "" {
+					return field
+				}
+			}
+		}
+	case []any:
+		if t.Kind() == reflect.Slice {
+			for i, child := range value {
+				if field := unknownField(child, t.Elem(), fmt.Sprintf("%s[%d]", path, i)); field != "" {
+					return field
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// invalidField returns the path of the first value in v that the type at the
+// same place in t fails to decode, with the error. Values below are checked
+// before the value holding them, so a bad duration inside a rule is reported
+// at the duration rather than as a bad rule.
+func invalidField(v any, t reflect.Type, path string) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch value := v.(type) {
+	case map[string]any:
+		switch t.Kind() {
+		case reflect.Map:
+			for key, child := range value {
+				if field, err := invalidField(child, t.Elem(), joinField(path, key)); field != "" {
+					return field, err
+				}
+			}
+		case reflect.Struct:
+			fields := jsonFields(t)
+			for key, child := range value {
+				if field, err := invalidField(child, fields[key], joinField(path, key)); field != "" {
+					return field, err
+				}
+			}
+		}
+	case []any:
+		if t.Kind() == reflect.Slice {
+			for i, child := range value {
+				if field, err := invalidField(child, t.Elem(), fmt.Sprintf("%s[%d]", path, i)); field != "" {
+					return field, err
+				}
+			}
+		}
+	}
+
+	if !reflect.PointerTo(t).Implements(reflect.TypeFor[json.Unmarshaler]()) {
+		return "", nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", nil
+	}
+	if err := json.Unmarshal(data, reflect.New(t).Interface()); err != nil {
+		return path, err
+	}
+	return "", nil
+}
+
+// jsonFields maps the JSON names of a struct's fields to their types
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func joinField(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// fieldLines maps every field path in a JSON document (e.g. "userDirectories[2]")
+// to the line it starts on
+func fieldLines(data []byte) (map[string]int, error) {
+	lines := make(map[string]int)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := walkFields(dec, data, "", lines); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err == nil {
+		return nil, errors.New("unexpected data after top-level value")
+	}
+	return lines, nil
+}
+
+func walkFields(dec *json.Decoder, data []byte, path string, lines map[string]int) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		for dec.More() {
+			start := nextTokenOffset(data, dec.InputOffset())
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			field := joinField(path, key.(string))
+			lines[field] = lineAt(data, start)
+			if err := walkFields(dec, data, field, lines); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+	case json.Delim('['):
+		for i := 0; dec.More(); i++ {
+			field := fmt.Sprintf("%s[%d]", path, i)
+			lines[field] = lineAt(data, nextTokenOffset(data, dec.InputOffset()))
+			if err := walkFields(dec, data, field, lines); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+	}
+	return err
+}
+
+// nextTokenOffset skips whitespace and separators following a decoder position
+func nextTokenOffset(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) {
+		switch data[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+// lineAt returns the 1-based line number of a byte offset
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
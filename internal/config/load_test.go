@@ -0,0 +1,304 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// root is an absolute directory on the running system that paths in the
+// test files are built from through %ROOT%
+var root = func() string {
+	if runtime.GOOS == "windows" {
+		return `C:\srv`
+	}
+	return "/srv"
+}()
+
+func lookupEnv(name string) (string, bool) {
+	value, ok := map[string]string{"ROOT": root, "EMPTY": ""}[name]
+	return value, ok
+}
+
+func TestParse(t *testing.T) {
+	data := `{
+  "targets": [
+    { "path": "%ROOT%/Downloads", "olderThan": "7d", "ageSource": "newest", "rules": ["!School/**"] }
+  ],
+  "userDirectories": ["%ROOT%/Temp"],
+  "browsers": { "chrome.exe": ["%ROOT%/Chrome"] },
+  "excludedExtensions": [".ISO"],
+  "onlyRemoveOlderThan": "90m",
+  "maxConcurrentOps": 8,
+  "maxBytesPerSecond": "1.5KB",
+  "limits": { "maxFiles": 10, "perTarget": { "maxVolumeShare": "25%" } }
+}`
+	cfg, err := Parse([]byte(data), FileName, lookupEnv)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if len(cfg.Targets) != 2 {
+		t.Fatalf("targets = %+v, want the target and the user directory", cfg.Targets)
+	}
+	downloads, temp := cfg.Targets[0], cfg.Targets[1]
+	if downloads.Path != filepath.Join(root, "Downloads") || downloads.OlderThan != 7*24*time.Hour ||
+		downloads.AgeSource != AgeNewest || len(downloads.Rules) != 1 {
+		t.Errorf("target = %+v", downloads)
+	}
+	// A user directory follows the global threshold
+	if temp.Path != filepath.Join(root, "Temp") || temp.OlderThan != 90*time.Minute || temp.AgeSource != AgeModified {
+		t.Errorf("user directory = %+v", temp)
+	}
+	if dirs := cfg.BrowserInformation["chrome.exe"]; len(cfg.BrowserInformation) != 1 || len(dirs) != 1 || dirs[0] != filepath.Join(root, "Chrome") {
+		t.Errorf("browsers = %v", cfg.BrowserInformation)
+	}
+	if len(cfg.ExcludedExtensions) != 1 || cfg.ExcludedExtensions[0] != ".iso" {
+		t.Errorf("excluded extensions = %v, want [.iso]", cfg.ExcludedExtensions)
+	}
+	if cfg.MaxConcurrentOps != 8 || cfg.MaxBytesPerSecond != 1536 {
+		t.Errorf("maxConcurrentOps = %d, maxBytesPerSecond = %d", cfg.MaxConcurrentOps, cfg.MaxBytesPerSecond)
+	}
+	if cfg.Limits.Run.Files != 10 || cfg.Limits.Run.VolumeShare != MaxRunVolumeShare || cfg.Limits.Target.VolumeShare != 0.25 {
+		t.Errorf("limits = %+v", cfg.Limits)
+	}
+}
+
+func TestParseKeepsDefaults(t *testing.T) {
+	cfg, err := Parse([]byte("{}"), FileName, lookupEnv)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	def := Default()
+
+	if len(cfg.Targets) != len(def.Targets) || len(cfg.BrowserInformation) != len(def.BrowserInformation) {
+		t.Errorf("an empty file has %d targets and %d browsers, want the built-in %d and %d",
+			len(cfg.Targets), len(cfg.BrowserInformation), len(def.Targets), len(def.BrowserInformation))
+	}
+	for i := range min(len(cfg.Targets), len(def.Targets)) {
+		if cfg.Targets[i].Path != def.Targets[i].Path {
+			t.Errorf("target %d = %s, want %s", i, cfg.Targets[i].Path, def.Targets[i].Path)
+		}
+	}
+	if cfg.OlderThan != OnlyRemoveOlderThan || cfg.MaxConcurrentOps != MaxConcurrentOps || cfg.Links != LinkUnlink ||
+		strings.Join(cfg.ExcludedExtensions, " ") != strings.Join(def.ExcludedExtensions, " ") {
+		t.Errorf("an empty file changed the defaults: %+v", cfg)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"syntax", "{\n  \"maxConcurrentOps\": 4,\n}",
+			"nScript.json:2: invalid character ',' looking for beginning of value"},
+		{"unknown field", "{\n  \"targets\": [\n    { \"path\": \"/x\", \"olderThen\": \"1h\" }\n  ]\n}",
+			"nScript.json:3: targets[0].olderThen: unknown field"},
+		{"wrong type", "{\n  \"maxConcurrentOps\": \"many\"\n}",
+			"nScript.json:2: maxConcurrentOps: expected int, got JSON string"},
+		{"unset variable", "{\n  \"userDirectories\": [\n    \"%ROOT%/Temp\",\n    \"%NOPE%/Downloads\"\n  ]\n}",
+			"nScript.json:4: userDirectories[1]: environment variable %NOPE% is not set"},
+		{"empty variable", "{\n  \"protectedPaths\": [\"%EMPTY%/School\"]\n}",
+			"nScript.json:2: protectedPaths[0]: environment variable %EMPTY% is not set"},
+		{"relative path", "{\n  \"targets\": [{ \"path\": \"Downloads\" }]\n}",
+			"nScript.json:2: targets[0].path: path \"Downloads\" is not absolute"},
+		{"negative duration", "{\n  \"onlyRemoveOlderThan\": \"-1h\"\n}",
+			"nScript.json:2: onlyRemoveOlderThan: duration cannot be negative"},
+		{"bad duration", "{\n  \"onlyRemoveOlderThan\": \"soon\"\n}",
+			"nScript.json:2: onlyRemoveOlderThan: invalid duration \"soon\""},
+		{"bad size", "{\n  \"limits\": {\n    \"perTarget\": { \"maxBytes\": \"lots\" }\n  }\n}",
+			"nScript.json:3: limits.perTarget.maxBytes: invalid size \"lots\""},
+		{"bad share", "{\n  \"limits\": { \"maxVolumeShare\": \"150%\" }\n}",
+			"nScript.json:2: limits.maxVolumeShare: invalid share \"150%\", expected a percentage such as \"25%\""},
+		{"duration in a rule", "{\n  \"rules\": [\n    { \"pattern\": \"*.tmp\", \"olderThan\": \"later\" }\n  ]\n}",
+			"nScript.json:3: rules[0].olderThan: invalid duration \"later\""},
+		{"age source", "{\n  \"ageSource\": \"changed\"\n}",
+			"nScript.json:2: ageSource: unknown age source \"changed\", expected modified, accessed, created or newest"},
+		{"no workers", "{\n  \"maxConcurrentOps\": 0\n}",
+			"nScript.json:2: maxConcurrentOps: must be at least 1"},
+		{"extension", "{\n  \"excludedExtensions\": [\".iso\", \"vmdk\"]\n}",
+			"nScript.json:2: excludedExtensions[1]: extension \"vmdk\" must start with a dot"},
+		{"bad rule", "{\n  \"rules\": [\n    { \"pattern\": \"*.tmp\", \"attributes\": [\"shiny\"] }\n  ]\n}",
+			"nScript.json:3: rules[0]: unknown attribute \"shiny\""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data), FileName, lookupEnv)
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Parse error = %v, want a ValidationError", err)
+			}
+			if got := err.Error(); got != tt.want {
+				t.Errorf("error = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFallsBackToDefaults(t *testing.T) {
+	t.Setenv("ProgramData", t.TempDir())
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Source != "" || len(cfg.Targets) != len(Default().Targets) {
+		t.Errorf("Load without a file = %+v, want the built-in defaults", cfg)
+	}
+}
+
+func TestLoadFromProgramData(t *testing.T) {
+	programData := t.TempDir()
+	t.Setenv("ProgramData", programData)
+	path := filepath.Join(programData, "nScript", FileName)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{ "maxConcurrentOps": 3 }`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Source != path || cfg.MaxConcurrentOps != 3 {
+		t.Errorf("Load = source %q, maxConcurrentOps %d, want %q and 3", cfg.Source, cfg.MaxConcurrentOps, path)
+	}
+}
+
+func TestLoadFileRefusesOtherFormats(t *testing.T) {
+	for _, name := range []string{"nScript.yaml", "nScript.YML", "nScript.toml"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte("maxConcurrentOps: 3\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadFile(path); err == nil || !strings.Contains(err.Error(), "write the configuration as JSON") {
+			t.Errorf("LoadFile(%s) error = %v, want it refused as not JSON", name, err)
+		}
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"plain", "plain", false},
+		{"%ROOT%", root, false},
+		{"%ROOT%%ROOT%", root + root, false},
+		{"100%% done", "100% done", false},
+		{"%NOPE%", "", true},
+		{"%EMPTY%", "", true},
+		{"%ROOT", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ExpandEnv(tt.in, lookupEnv)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ExpandEnv(%q) = %q, %v, want %q (error %t)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"512", 512, false},
+		{"512B", 512, false},
+		{" 64 kb ", 64 << 10, false},
+		{"1.5GB", 3 << 29, false},
+		{"2TB", 2 << 40, false},
+		{"0", 0, false},
+		{"", 0, true},
+		{"MB", 0, true},
+		{"-1KB", 0, true},
+		{"lots", 0, true},
+		{"8388607TB", 8388607 << 40, false},
+		{"8388608TB", 0, true},
+		{"1e30", 0, true},
+		{"NaN", 0, true},
+		{"Inf", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d (error %t)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSizeUnmarshal(t *testing.T) {
+	var s Size
+	if err := json.Unmarshal([]byte(`1048576`), &s); err != nil || s != 1<<20 {
+		t.Errorf("a number = %d, %v", s, err)
+	}
+	if err := json.Unmarshal([]byte(`"1MB"`), &s); err != nil || s != 1<<20 {
+		t.Errorf("a string = %d, %v", s, err)
+	}
+	if err := json.Unmarshal([]byte(`true`), &s); err == nil {
+		t.Error("a boolean was accepted as a size")
+	}
+}
+
+func TestShare(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Share
+		wantErr bool
+	}{
+		{`"25%"`, 0.25, false},
+		{`" 50 % "`, 0.5, false},
+		{`"0%"`, 0, false},
+		{`"100%"`, 1, false},
+		{`"101%"`, 0, true},
+		{`"-5%"`, 0, true},
+		{`"25"`, 0, true},
+		{`0.25`, 0, true},
+	}
+
+	for _, tt := range tests {
+		var got Share
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Share %s = %v, %v, want %v (error %t)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"90m", 90 * time.Minute, false},
+		{"24h", 24 * time.Hour, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{" 0s ", 0, false},
+		{"1.5d", 0, true},
+		{"d", 0, true},
+		{"soon", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, %v, want %v (error %t)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
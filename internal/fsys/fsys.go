@@ -0,0 +1,139 @@
+package fsys
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ErrCrossDevice is returned when a rename crosses volumes and the data has to be copied instead
+var ErrCrossDevice = errors.New("cannot move a file to a different volume")
+
+// File is an open file handle
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+}
+
+// FS is the set of filesystem operations used by the cleanup package
+type FS interface {
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	Remove(name string) error
+	RemoveAll(name string) error
+	Rename(oldpath, newpath string) error
+	MkdirAll(path string, perm fs.FileMode) error
+	Chtimes(name string, atime, mtime time.Time) error
+	// EvalSymlinks returns name with every link in it resolved
+	EvalSymlinks(name string) (string, error)
+}
+
+// OS is the FS backed by the real operating system
+type OS struct{}
+
+func (OS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (OS) Lstat(name string) (fs.FileInfo, error)     { return os.Lstat(name) }
+func (OS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (OS) Remove(name string) error                   { return os.Remove(name) }
+func (OS) RemoveAll(name string) error                { return os.RemoveAll(name) }
+func (OS) Rename(oldpath, newpath string) error       { return os.Rename(oldpath, newpath) }
+
+func (OS) MkdirAll(path string, perm fs.FileMode) error { return os.MkdirAll(path, perm) }
+func (OS) EvalSymlinks(name string) (string, error)     { return filepath.EvalSymlinks(name) }
+
+func (OS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+func (OS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+// ReadFile reads a whole file through fsys
+func ReadFile(fsys FS, name string) ([]byte, error) {
+	file, err := fsys.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// WriteFile creates or truncates name and writes data to it through fsys
+func WriteFile(fsys FS, name string, data []byte, perm fs.FileMode) error {
+	file, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// IsLink reports whether info describes a symbolic link or another reparse
+// point, such as a junction, a mount point or a OneDrive placeholder. Removing
+// one with Remove unlinks it and leaves what it points to alone.
+func IsLink(info fs.FileInfo) bool {
+	return info.Mode()&(fs.ModeSymlink|fs.ModeIrregular) != 0 || isReparsePoint(info)
+}
+
+// Walk walks the tree rooted at root like filepath.Walk, but through fsys.
+// Entries are visited in lexical order. Links below root are visited but never
+// followed, even those that report themselves as directories, like Windows
+// junctions; root itself is followed, as configured directories often are links.
+func Walk(fsys FS, root string, fn filepath.WalkFunc) error {
+	info, err := fsys.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walk(fsys, root, info, fn)
+	}
+	if errors.Is(err, filepath.SkipDir) || errors.Is(err, filepath.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+func walk(fsys FS, path string, info fs.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() || IsLink(info) {
+		return fn(path, info, nil)
+	}
+
+	entries, err := fsys.ReadDir(path)
+	err1 := fn(path, info, err)
+	// If err != nil, walk can't walk into this directory.
+	// err1 != nil means fn wants walk to skip this directory or stop walking.
+	if err != nil || err1 != nil {
+		return err1
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		name := filepath.Join(path, entry.Name())
+		childInfo, err := fsys.Lstat(name)
+		if err != nil {
+			if err := fn(name, childInfo, err); err != nil && !errors.Is(err, filepath.SkipDir) {
+				return err
+			}
+			continue
+		}
+
+		err = walk(fsys, name, childInfo, fn)
+		if err != nil {
+			if !childInfo.IsDir() || IsLink(childInfo) || !errors.Is(err, filepath.SkipDir) {
+				return err
+			}
+		}
+	}
+	return nil
+}
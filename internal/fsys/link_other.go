@@ -0,0 +1,10 @@
+//go:build !windows
+
+package fsys
+
+import "io/fs"
+
+// isReparsePoint reports false; outside Windows every link has fs.ModeSymlink
+func isReparsePoint(info fs.FileInfo) bool {
+	return false
+}
@@ -0,0 +1,13 @@
+package fsys
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// isReparsePoint reports whether info has the reparse point attribute, which
+// junctions, mount points and cloud placeholders carry whatever mode Go reports
+func isReparsePoint(info fs.FileInfo) bool {
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	return ok && data.FileAttributes&syscall.FILE_ATTRIBUTE_REPARSE_POINT != 0
+}
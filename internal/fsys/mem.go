@@ -0,0 +1,478 @@
+package fsys
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLocked is returned by Mem for files opened for writing or removed while locked,
+// mirroring a sharing violation on Windows
+var ErrLocked = errors.New("the process cannot access the file because it is being used by another process")
+
+// Mem is an in-memory FS for tests. It supports file timestamps, locked files,
+// permission errors and separate volumes.
+type Mem struct {
+	mu    sync.Mutex
+	roots map[string]*memNode
+}
+
+type memNode struct {
+	name     string
+	dir      bool
+	mode     fs.FileMode
+	modTime  time.Time
+	atime    time.Time
+	ctime    time.Time
+	data     []byte
+	locked   bool
+	denied   bool
+	device   bool
+	children map[string]*memNode
+}
+
+// NewMem creates an empty in-memory filesystem
+func NewMem() *Mem {
+	return &Mem{roots: make(map[string]*memNode)}
+}
+
+// split separates a path into its volume and cleaned components
+func split(name string) (string, []string) {
+	name = filepath.Clean(name)
+	volume := filepath.VolumeName(name)
+	rest := strings.Trim(name[len(volume):], string(filepath.Separator))
+	if rest == "" || rest == "." {
+		return volume, nil
+	}
+	return volume, strings.Split(rest, string(filepath.Separator))
+}
+
+// lookup finds the node for name, returning fs.ErrPermission when a denied
+// directory is traversed and fs.ErrNotExist when any component is missing
+func (m *Mem) lookup(name string) (*memNode, error) {
+	volume, parts := split(name)
+	node, ok := m.roots[volume]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	for _, part := range parts {
+		if node.denied {
+			return nil, fs.ErrPermission
+		}
+		child, ok := node.children[part]
+		if !ok || !node.dir {
+			return nil, fs.ErrNotExist
+		}
+		node = child
+	}
+	return node, nil
+}
+
+// ensureDir creates name and its parents as directories
+func (m *Mem) ensureDir(name string, modTime time.Time) *memNode {
+	volume, parts := split(name)
+	node, ok := m.roots[volume]
+	if !ok {
+		node = &memNode{name: volume + string(filepath.Separator), dir: true, mode: fs.ModeDir | 0755, modTime: modTime, children: make(map[string]*memNode)}
+		m.roots[volume] = node
+	}
+	for _, part := range parts {
+		child, ok := node.children[part]
+		if !ok {
+			child = &memNode{name: part, dir: true, mode: fs.ModeDir | 0755, modTime: modTime, children: make(map[string]*memNode)}
+			node.children[part] = child
+		}
+		node = child
+	}
+	return node
+}
+
+// AddDir creates a directory, and any missing parents, with the given modification time
+func (m *Mem) AddDir(name string, modTime time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ensureDir(name, modTime).modTime = modTime
+}
+
+// AddFile creates a file with the given contents and modification time, creating parents as needed
+func (m *Mem) AddFile(name string, data []byte, modTime time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parent := m.ensureDir(filepath.Dir(name), modTime)
+	base := filepath.Base(name)
+	parent.children[base] = &memNode{name: base, mode: 0644, modTime: modTime, atime: modTime, ctime: modTime, data: data}
+}
+
+// SetTimes sets all timestamps of an existing file or directory
+func (m *Mem) SetTimes(name string, t Times) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if node, err := m.lookup(name); err == nil {
+		node.modTime, node.atime, node.ctime = t.Modified, t.Accessed, t.Created
+	}
+}
+
+// Lock marks a file as in use; it cannot be opened for writing or removed
+func (m *Mem) Lock(name string) {
+	m.setFlag(name, func(n *memNode) { n.locked = true })
+}
+
+// Deny makes every operation on name, and on anything below it, fail with a permission error
+func (m *Mem) Deny(name string) {
+	m.setFlag(name, func(n *memNode) { n.denied = true })
+}
+
+func (m *Mem) setFlag(name string, set func(*memNode)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if node, err := m.lookup(name); err == nil {
+		set(node)
+	}
+}
+
+// SplitDevice makes name the root of a separate volume, so renames into or out of it fail with ErrCrossDevice
+func (m *Mem) SplitDevice(name string) {
+	m.setFlag(name, func(n *memNode) { n.device = true })
+}
+
+// deviceOf returns the node acting as the volume root of name
+func (m *Mem) deviceOf(name string) *memNode {
+	volume, parts := split(name)
+	node, ok := m.roots[volume]
+	if !ok {
+		return nil
+	}
+	device := node
+	for _, part := range parts {
+		child, ok := node.children[part]
+		if !ok {
+			break
+		}
+		node = child
+		if node.device {
+			device = node
+		}
+	}
+	return device
+}
+
+// Exists reports whether name exists
+func (m *Mem) Exists(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := m.lookup(name)
+	return err == nil
+}
+
+func pathError(op, name string, err error) error {
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// Stat returns file information for name
+func (m *Mem) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup(name)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return node.info(), nil
+}
+
+// Lstat is Stat; Mem has no symbolic links
+func (m *Mem) Lstat(name string) (fs.FileInfo, error) {
+	return m.Stat(name)
+}
+
+// EvalSymlinks returns name cleaned once it exists; Mem has no links
+func (m *Mem) EvalSymlinks(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.lookup(name); err != nil {
+		return "", pathError("lstat", name, err)
+	}
+	return filepath.Clean(name), nil
+}
+
+// ReadDir lists a directory in name order
+func (m *Mem) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup(name)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	if node.denied {
+		return nil, pathError("readdir", name, fs.ErrPermission)
+	}
+	if !node.dir {
+		return nil, pathError("readdir", name, errors.New("not a directory"))
+	}
+
+	entries := make([]fs.DirEntry, 0, len(node.children))
+	for _, child := range node.children {
+		entries = append(entries, fs.FileInfoToDirEntry(child.info()))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// OpenFile opens a file, creating it with os.O_CREATE. Opening a locked file for
+// writing fails with ErrLocked.
+func (m *Mem) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup(name)
+	if errors.Is(err, fs.ErrNotExist) && flag&os.O_CREATE != 0 {
+		parent, parentErr := m.lookup(filepath.Dir(filepath.Clean(name)))
+		if parentErr != nil {
+			return nil, pathError("open", name, parentErr)
+		}
+		if parent.denied {
+			return nil, pathError("open", name, fs.ErrPermission)
+		}
+		base := filepath.Base(name)
+		node = &memNode{name: base, mode: perm, modTime: time.Now()}
+		parent.children[base] = node
+		err = nil
+	}
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	if node.denied {
+		return nil, pathError("open", name, fs.ErrPermission)
+	}
+	if node.dir {
+		return nil, pathError("open", name, errors.New("is a directory"))
+	}
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if node.locked && writable {
+		return nil, pathError("open", name, ErrLocked)
+	}
+	if writable && flag&os.O_TRUNC != 0 {
+		node.data = nil
+	}
+	return &memFile{mem: m, node: node, Reader: bytes.NewReader(node.data)}, nil
+}
+
+// MkdirAll creates a directory and any missing parents
+func (m *Mem) MkdirAll(path string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup(path)
+	if err == nil {
+		if !node.dir {
+			return pathError("mkdir", path, errors.New("not a directory"))
+		}
+		return nil
+	}
+	if errors.Is(err, fs.ErrPermission) {
+		return pathError("mkdir", path, err)
+	}
+	m.ensureDir(path, time.Now())
+	return nil
+}
+
+// Chtimes changes the access and modification times of name
+func (m *Mem) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup(name)
+	if err != nil {
+		return pathError("chtimes", name, err)
+	}
+	if node.denied {
+		return pathError("chtimes", name, fs.ErrPermission)
+	}
+	node.modTime, node.atime = mtime, atime
+	return nil
+}
+
+// Rename moves a file or directory, replacing an existing file at newpath.
+// Moving between volumes created with SplitDevice fails with ErrCrossDevice.
+func (m *Mem) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	linkError := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+
+	oldParent, node, err := m.lookupWithParent(oldpath)
+	if err != nil {
+		return linkError(err)
+	}
+	if err := node.removable(); err != nil {
+		return linkError(err)
+	}
+
+	newParent, err := m.lookup(filepath.Dir(filepath.Clean(newpath)))
+	if err != nil {
+		return linkError(err)
+	}
+	if newParent.denied || !newParent.dir {
+		return linkError(fs.ErrPermission)
+	}
+	if m.deviceOf(oldpath) != m.deviceOf(filepath.Dir(filepath.Clean(newpath))) {
+		return linkError(ErrCrossDevice)
+	}
+
+	base := filepath.Base(newpath)
+	if existing, ok := newParent.children[base]; ok && existing.dir {
+		return linkError(fs.ErrExist)
+	}
+
+	delete(oldParent.children, node.name)
+	node.name = base
+	newParent.children[base] = node
+	return nil
+}
+
+// Remove removes a file or an empty directory
+func (m *Mem) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parent, node, err := m.lookupWithParent(name)
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+	if err := node.removable(); err != nil {
+		return pathError("remove", name, err)
+	}
+	if node.dir && len(node.children) > 0 {
+		return pathError("remove", name, errors.New("directory not empty"))
+	}
+	delete(parent.children, node.name)
+	return nil
+}
+
+// RemoveAll removes name and everything below it. Like os.RemoveAll it removes
+// as much as it can and returns the first error; a missing path is not an error.
+func (m *Mem) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parent, node, err := m.lookupWithParent(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return pathError("unlinkat", name, err)
+	}
+
+	if err := removeTree(node, name); err != nil {
+		return err
+	}
+	delete(parent.children, node.name)
+	return nil
+}
+
+// removeTree empties a directory node, leaving behind anything that cannot be removed
+func removeTree(node *memNode, name string) error {
+	if err := node.removable(); err != nil {
+		return pathError("unlinkat", name, err)
+	}
+
+	var firstErr error
+	for childName, child := range node.children {
+		if err := removeTree(child, filepath.Join(name, childName)); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		delete(node.children, childName)
+	}
+	return firstErr
+}
+
+func (m *Mem) lookupWithParent(name string) (*memNode, *memNode, error) {
+	node, err := m.lookup(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	parent, err := m.lookup(filepath.Dir(filepath.Clean(name)))
+	if err != nil || parent == node {
+		return nil, nil, fs.ErrPermission
+	}
+	if parent.denied {
+		return nil, nil, fs.ErrPermission
+	}
+	return parent, node, nil
+}
+
+func (n *memNode) removable() error {
+	if n.denied {
+		return fs.ErrPermission
+	}
+	if n.locked {
+		return ErrLocked
+	}
+	return nil
+}
+
+func (n *memNode) info() fs.FileInfo {
+	times := Times{Modified: n.modTime, Accessed: n.atime, Created: n.ctime}
+	// Nodes created without explicit timestamps report the modification time
+	if times.Accessed.IsZero() {
+		times.Accessed = n.modTime
+	}
+	if times.Created.IsZero() {
+		times.Created = n.modTime
+	}
+	return &memInfo{name: n.name, dir: n.dir, mode: n.mode, modTime: n.modTime, size: int64(len(n.data)), times: times}
+}
+
+type memInfo struct {
+	name    string
+	dir     bool
+	mode    fs.FileMode
+	modTime time.Time
+	size    int64
+	times   Times
+}
+
+func (i *memInfo) Name() string       { return i.name }
+func (i *memInfo) Size() int64        { return i.size }
+func (i *memInfo) Mode() fs.FileMode  { return i.mode }
+func (i *memInfo) ModTime() time.Time { return i.modTime }
+func (i *memInfo) IsDir() bool        { return i.dir }
+func (i *memInfo) Sys() any           { return &i.times }
+
+// memFile reads a snapshot of a file's contents taken at open; writes are appended to the file
+type memFile struct {
+	*bytes.Reader
+	mem  *Mem
+	node *memNode
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.mem.mu.Lock()
+	defer f.mem.mu.Unlock()
+
+	f.node.data = append(f.node.data, p...)
+	return len(p), nil
+}
+
+func (f *memFile) Close() error { return nil }
+
+var _ io.ReadWriteCloser = (*memFile)(nil)
@@ -0,0 +1,175 @@
+package fsys
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func root(parts ...string) string {
+	return filepath.Join(append([]string{string(filepath.Separator), "home", "student"}, parts...)...)
+}
+
+func TestMemStatAndReadDir(t *testing.T) {
+	mem := NewMem()
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	mem.AddFile(root("Downloads", "b.txt"), []byte("hello"), modTime)
+	mem.AddFile(root("Downloads", "a.txt"), nil, modTime)
+	mem.AddDir(root("Downloads", "c"), modTime)
+
+	info, err := mem.Stat(root("Downloads", "b.txt"))
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size() != 5 || !info.ModTime().Equal(modTime) || info.IsDir() {
+		t.Errorf("Stat = size %d, mtime %v, dir %v", info.Size(), info.ModTime(), info.IsDir())
+	}
+
+	entries, err := mem.ReadDir(root("Downloads"))
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{"a.txt", "b.txt", "c"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ReadDir names = %v, want %v", names, want)
+	}
+
+	if _, err := mem.Stat(root("missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat missing = %v, want ErrNotExist", err)
+	}
+}
+
+func TestMemLockedFile(t *testing.T) {
+	mem := NewMem()
+	path := root("Downloads", "setup.exe")
+	mem.AddFile(path, nil, time.Now())
+	mem.Lock(path)
+
+	if _, err := mem.OpenFile(path, os.O_RDONLY, 0); err != nil {
+		t.Errorf("read-only open of locked file failed: %v", err)
+	}
+	if _, err := mem.OpenFile(path, os.O_RDWR, 0); !errors.Is(err, ErrLocked) {
+		t.Errorf("read-write open of locked file = %v, want ErrLocked", err)
+	}
+	if err := mem.Remove(path); !errors.Is(err, ErrLocked) {
+		t.Errorf("Remove locked file = %v, want ErrLocked", err)
+	}
+	if !mem.Exists(path) {
+		t.Error("locked file was removed")
+	}
+}
+
+func TestMemRemoveAllLeavesLockedFiles(t *testing.T) {
+	mem := NewMem()
+	locked := root("Downloads", "game", "save.dat")
+	other := root("Downloads", "game", "readme.txt")
+	mem.AddFile(locked, nil, time.Now())
+	mem.AddFile(other, nil, time.Now())
+	mem.Lock(locked)
+
+	if err := mem.RemoveAll(root("Downloads", "game")); !errors.Is(err, ErrLocked) {
+		t.Errorf("RemoveAll = %v, want ErrLocked", err)
+	}
+	if !mem.Exists(locked) {
+		t.Error("locked file was removed")
+	}
+	if mem.Exists(other) {
+		t.Error("unlocked sibling was not removed")
+	}
+}
+
+func TestMemDenied(t *testing.T) {
+	mem := NewMem()
+	mem.AddFile(root("AppData", "secret", "key.bin"), nil, time.Now())
+	mem.Deny(root("AppData", "secret"))
+
+	if _, err := mem.ReadDir(root("AppData", "secret")); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("ReadDir denied = %v, want ErrPermission", err)
+	}
+	if _, err := mem.Stat(root("AppData", "secret", "key.bin")); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("Stat below denied = %v, want ErrPermission", err)
+	}
+	if err := mem.RemoveAll(root("AppData", "secret")); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("RemoveAll denied = %v, want ErrPermission", err)
+	}
+	if err := mem.RemoveAll(root("AppData", "missing")); err != nil {
+		t.Errorf("RemoveAll missing = %v, want nil", err)
+	}
+}
+
+func TestMemRemoveNonEmptyDirectory(t *testing.T) {
+	mem := NewMem()
+	mem.AddFile(root("Music", "song.mp3"), nil, time.Now())
+
+	if err := mem.Remove(root("Music")); err == nil {
+		t.Error("Remove of non-empty directory succeeded")
+	}
+	if err := mem.Remove(root("Music", "song.mp3")); err != nil {
+		t.Fatalf("Remove file: %v", err)
+	}
+	if err := mem.Remove(root("Music")); err != nil {
+		t.Errorf("Remove of empty directory: %v", err)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	mem := NewMem()
+	now := time.Now()
+	mem.AddFile(root("Videos", "b", "clip.mp4"), nil, now)
+	mem.AddFile(root("Videos", "a.mp4"), nil, now)
+	mem.AddFile(root("Videos", "c", "skip", "x.mp4"), nil, now)
+	mem.AddDir(root("Videos", "denied"), now)
+	mem.Deny(root("Videos", "denied"))
+
+	var visited []string
+	var errs []string
+	err := Walk(mem, root("Videos"), func(path string, info fs.FileInfo, err error) error {
+		rel, _ := filepath.Rel(root("Videos"), path)
+		if err != nil {
+			errs = append(errs, rel)
+			return nil
+		}
+		visited = append(visited, rel)
+		if info.Name() == "skip" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+
+	want := []string{".", "a.mp4", "b", filepath.Join("b", "clip.mp4"), "c", filepath.Join("c", "skip")}
+	if !reflect.DeepEqual(visited, want) {
+		t.Errorf("visited = %v, want %v", visited, want)
+	}
+	if !reflect.DeepEqual(errs, []string{"denied"}) {
+		t.Errorf("errors reported for %v, want [denied]", errs)
+	}
+}
+
+func TestWalkOS(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	os.WriteFile(filepath.Join(dir, "sub", "f.txt"), []byte("x"), 0644)
+
+	var visited []string
+	err := Walk(OS{}, dir, func(path string, info fs.FileInfo, err error) error {
+		rel, _ := filepath.Rel(dir, path)
+		visited = append(visited, rel)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	if want := []string{".", "sub", filepath.Join("sub", "f.txt")}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("visited = %v, want %v", visited, want)
+	}
+}
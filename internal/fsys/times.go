@@ -0,0 +1,22 @@
+package fsys
+
+import (
+	"io/fs"
+	"time"
+)
+
+// Times holds the timestamps of a file. Filesystems that do not record a
+// timestamp report the modification time in its place.
+type Times struct {
+	Modified time.Time
+	Accessed time.Time
+	Created  time.Time
+}
+
+// TimesOf returns the timestamps of a file from its FileInfo
+func TimesOf(info fs.FileInfo) Times {
+	if t, ok := info.Sys().(*Times); ok {
+		return *t
+	}
+	return platformTimes(info)
+}
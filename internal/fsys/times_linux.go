@@ -0,0 +1,21 @@
+package fsys
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// platformTimes reads the access time from stat. Linux stat has no creation
+// time, so the modification time stands in for it.
+func platformTimes(info fs.FileInfo) Times {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return Times{Modified: info.ModTime(), Accessed: info.ModTime(), Created: info.ModTime()}
+	}
+	return Times{
+		Modified: info.ModTime(),
+		Accessed: time.Unix(st.Atim.Unix()),
+		Created:  info.ModTime(),
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !windows && !linux
+
+package fsys
+
+import "io/fs"
+
+func platformTimes(info fs.FileInfo) Times {
+	return Times{Modified: info.ModTime(), Accessed: info.ModTime(), Created: info.ModTime()}
+}
@@ -0,0 +1,48 @@
+package fsys
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTimesOfMem(t *testing.T) {
+	mem := NewMem()
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	name := filepath.Join(string(filepath.Separator), "tmp", "a.txt")
+	mem.AddFile(name, nil, modified)
+
+	info, _ := mem.Stat(name)
+	if got := TimesOf(info); !got.Accessed.Equal(modified) || !got.Created.Equal(modified) {
+		t.Errorf("default times = %+v, want all %v", got, modified)
+	}
+
+	want := Times{Modified: modified, Accessed: modified.Add(time.Hour), Created: modified.Add(-time.Hour)}
+	mem.SetTimes(name, want)
+	info, _ = mem.Stat(name)
+	if got := TimesOf(info); got != want {
+		t.Errorf("TimesOf = %+v, want %+v", got, want)
+	}
+}
+
+func TestTimesOfOS(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(name, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	atime := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	mtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(name, atime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := TimesOf(info)
+	if !got.Modified.Equal(mtime) || !got.Accessed.Equal(atime) {
+		t.Errorf("TimesOf = %+v, want modified %v and accessed %v", got, mtime, atime)
+	}
+}
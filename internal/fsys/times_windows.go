@@ -0,0 +1,19 @@
+package fsys
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+func platformTimes(info fs.FileInfo) Times {
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return Times{Modified: info.ModTime(), Accessed: info.ModTime(), Created: info.ModTime()}
+	}
+	return Times{
+		Modified: time.Unix(0, data.LastWriteTime.Nanoseconds()),
+		Accessed: time.Unix(0, data.LastAccessTime.Nanoseconds()),
+		Created:  time.Unix(0, data.CreationTime.Nanoseconds()),
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package fsys
+
+import (
+	"errors"
+	"syscall"
+)
+
+// IsCrossDevice reports whether err is a rename failing because source and destination are on different volumes
+func IsCrossDevice(err error) bool {
+	return errors.Is(err, ErrCrossDevice) || errors.Is(err, syscall.EXDEV)
+}
@@ -0,0 +1,12 @@
+package fsys
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// IsCrossDevice reports whether err is a rename failing because source and destination are on different volumes
+func IsCrossDevice(err error) bool {
+	return errors.Is(err, ErrCrossDevice) || errors.Is(err, windows.ERROR_NOT_SAME_DEVICE)
+}
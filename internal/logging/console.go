@@ -0,0 +1,159 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ConsoleHandler writes records in nScript's "[*] message key=value" style. It
+// owns the transient status line so log output never garbles the progress display.
+type ConsoleHandler struct {
+	state  *consoleState
+	level  slog.Leveler
+	attrs  string
+	prefix string
+}
+
+// consoleState is shared by a handler and the handlers derived from it
+type consoleState struct {
+	mu     sync.Mutex
+	out    io.Writer
+	status string
+}
+
+// NewConsoleHandler creates a console handler writing records of level or above to out
+func NewConsoleHandler(out io.Writer, level slog.Leveler) *ConsoleHandler {
+	return &ConsoleHandler{state: &consoleState{out: out}, level: level}
+}
+
+// Enabled reports whether records of the level are shown
+func (h *ConsoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle writes one record, redrawing the status line below it
+func (h *ConsoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+
+	// Leading newlines separate sections and are kept in front of the prefix
+	msg := strings.TrimLeft(r.Message, "\n")
+	b.WriteString(r.Message[:len(r.Message)-len(msg)])
+	b.WriteString(Prefix(r.Level))
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&b, h.prefix, a)
+		return true
+	})
+	b.WriteByte('\n')
+
+	s := h.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clearLine()
+	if _, err := io.WriteString(s.out, b.String()); err != nil {
+		return err
+	}
+	if s.status != "" {
+		io.WriteString(s.out, s.status)
+	}
+	return nil
+}
+
+// WithAttrs returns a handler that appends attrs to every record
+func (h *ConsoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	for _, a := range attrs {
+		writeAttr(&b, h.prefix, a)
+	}
+	h2 := *h
+	h2.attrs += b.String()
+	return &h2
+}
+
+// WithGroup returns a handler that qualifies later attribute keys with name
+func (h *ConsoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix += name + "."
+	return &h2
+}
+
+// SetStatus replaces the status line
+func (h *ConsoleHandler) SetStatus(line string) {
+	s := h.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clearLine()
+	s.status = line
+	io.WriteString(s.out, line)
+}
+
+// ClearStatus ends the status line with a newline so later records start below it
+func (h *ConsoleHandler) ClearStatus() {
+	s := h.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status != "" {
+		io.WriteString(s.out, "\n")
+		s.status = ""
+	}
+}
+
+// clearLine blanks the status line; the caller holds mu
+func (s *consoleState) clearLine() {
+	if s.status != "" {
+		fmt.Fprintf(s.out, "\r%s\r", strings.Repeat(" ", len(s.status)))
+	}
+}
+
+// Prefix returns the console prefix of a level
+func Prefix(level slog.Level) string {
+	switch {
+	case level < LevelInfo:
+		return "[.]"
+	case level < LevelSuccess:
+		return "[*]"
+	case level < LevelNotice:
+		return "[+]"
+	case level < LevelWarn:
+		return "[!]"
+	}
+	return "[-]"
+}
+
+// writeAttr appends " key=value", quoting values that contain spaces
+func writeAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			writeAttr(b, prefix, ga)
+		}
+		return
+	}
+
+	value := a.Value.String()
+	if value == "" || strings.ContainsFunc(value, unicode.IsSpace) || strings.Contains(value, `"`) {
+		value = strconv.Quote(value)
+	}
+	b.WriteByte(' ')
+	b.WriteString(prefix)
+	b.WriteString(a.Key)
+	b.WriteByte('=')
+	b.WriteString(value)
+}
@@ -0,0 +1,129 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// Levels used by nScript. Success and Notice sit between Info and Warn so the
+// console can keep its "[+]" and "[!]" prefixes.
+const (
+	LevelDebug   = slog.LevelDebug
+	LevelInfo    = slog.LevelInfo
+	LevelSuccess = slog.LevelInfo + 1
+	LevelNotice  = slog.LevelInfo + 2
+	LevelWarn    = slog.LevelWarn
+	LevelError   = slog.LevelError
+)
+
+// Log file rotation limits
+const (
+	MaxLogSize    = 10 * 1024 * 1024
+	MaxLogBackups = 5
+)
+
+// Options configures the loggers installed by Setup
+type Options struct {
+	Console io.Writer  // console output, os.Stdout when nil
+	Level   slog.Level // minimum level shown on the console
+	LogDir  string     // directory of the rotating log file, no file log when empty
+}
+
+// console is the installed console handler, used for the progress status line
+var console *ConsoleHandler
+
+// Setup installs the console handler, and the rotating file handler when a log
+// directory is given, as the default slog logger. The returned function closes the log file.
+func Setup(opts Options) (func() error, error) {
+	out := opts.Console
+	if out == nil {
+		out = os.Stdout
+	}
+	console = NewConsoleHandler(out, opts.Level)
+
+	if opts.LogDir == "" {
+		slog.SetDefault(slog.New(console))
+		return func() error { return nil }, nil
+	}
+
+	file, err := OpenRotatingFile(filepath.Join(opts.LogDir, "nScript.log"), MaxLogSize, MaxLogBackups)
+	if err != nil {
+		slog.SetDefault(slog.New(console))
+		return func() error { return nil }, err
+	}
+
+	// The file keeps Info and above even when the console is quiet
+	fileLevel := min(opts.Level, LevelInfo)
+	fileHandler := slog.NewJSONHandler(file, &slog.HandlerOptions{Level: fileLevel, ReplaceAttr: replaceLevel})
+	slog.SetDefault(slog.New(slog.NewMultiHandler(console, fileHandler)))
+	return file.Close, nil
+}
+
+// DefaultDir returns the log directory under ProgramData, or under the temp directory when ProgramData is unset
+func DefaultDir() string {
+	if programData := os.Getenv("ProgramData"); programData != "" {
+		return filepath.Join(programData, "nScript", "logs")
+	}
+	return filepath.Join(os.TempDir(), "nScript", "logs")
+}
+
+// LevelName returns the name written to the log file for a level
+func LevelName(level slog.Level) string {
+	switch level {
+	case LevelSuccess:
+		return "SUCCESS"
+	case LevelNotice:
+		return "NOTICE"
+	}
+	return level.String()
+}
+
+// replaceLevel names the custom levels in file records
+func replaceLevel(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey && len(groups) == 0 {
+		if level, ok := a.Value.Any().(slog.Level); ok {
+			a.Value = slog.StringValue(LevelName(level))
+		}
+	}
+	return a
+}
+
+// SetStatus shows a transient status line below the log output, replacing the previous one
+func SetStatus(format string, args ...any) {
+	if console != nil {
+		console.SetStatus(fmt.Sprintf(format, args...))
+	}
+}
+
+// ClearStatus ends the status line, leaving its last text on screen
+func ClearStatus() {
+	if console != nil {
+		console.ClearStatus()
+	}
+}
+
+// Debug logs at debug level, shown on the console only with --verbose
+func Debug(msg string, args ...any) { log(LevelDebug, msg, args...) }
+
+// Info logs progress information
+func Info(msg string, args ...any) { log(LevelInfo, msg, args...) }
+
+// Success logs a completed operation
+func Success(msg string, args ...any) { log(LevelSuccess, msg, args...) }
+
+// Notice logs something the user should pay attention to
+func Notice(msg string, args ...any) { log(LevelNotice, msg, args...) }
+
+// Warn logs a failed operation the run continues after
+func Warn(msg string, args ...any) { log(LevelWarn, msg, args...) }
+
+// Error logs a failure that stops the current command
+func Error(msg string, args ...any) { log(LevelError, msg, args...) }
+
+func log(level slog.Level, msg string, args ...any) {
+	slog.Default().Log(context.Background(), level, msg, args...)
+}
@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConsoleFormat(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(NewConsoleHandler(&out, LevelInfo))
+
+	logger.Debug("hidden")
+	logger.Info("\nPhase 1: File and directory cleanup")
+	logger.Log(context.Background(), LevelSuccess, "Killed", "process", "chrome.exe")
+	logger.Log(context.Background(), LevelNotice, "Force mode enabled")
+	logger.With("target", `C:\Temp`).Warn("Failed to remove", "path", `C:\Temp\a b.txt`, "error", errors.New("access denied"))
+
+	want := "\n[*] Phase 1: File and directory cleanup\n" +
+		"[+] Killed process=chrome.exe\n" +
+		"[!] Force mode enabled\n" +
+		`[-] Failed to remove target=C:\Temp path="C:\\Temp\\a b.txt" error="access denied"` + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("console output:\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestStatusLineIsRedrawn(t *testing.T) {
+	var out bytes.Buffer
+	h := NewConsoleHandler(&out, LevelInfo)
+	logger := slog.New(h)
+
+	h.SetStatus("[*] Files: 1")
+	logger.Warn("Failed")
+	h.ClearStatus()
+
+	want := "[*] Files: 1" + "\r            \r" + "[-] Failed\n" + "[*] Files: 1" + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestSetupWritesJSONFile(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	dir := t.TempDir()
+	var out bytes.Buffer
+	closeLog, err := Setup(Options{Console: &out, Level: LevelWarn, LogDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Success("Removed", "path", "a.txt")
+	Debug("not recorded")
+	Warn("Failed to remove", "path", "b.txt")
+	closeLog()
+
+	if got := out.String(); got != "[-] Failed to remove path=b.txt\n" {
+		t.Errorf("quiet console = %q", got)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "nScript.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("log file has %d records, want 2:\n%s", len(lines), data)
+	}
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec["level"] != "SUCCESS" || rec["msg"] != "Removed" || rec["path"] != "a.txt" {
+		t.Errorf("record = %v", rec)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nScript.log")
+	rf, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rf.Close()
+
+	for name, want := range map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	} {
+		data, err := os.ReadFile(name)
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", filepath.Base(name), data, err, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("more backups kept than configured")
+	}
+}
@@ -0,0 +1,189 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind identifies what a planned action would do
+type Kind string
+
+const (
+	DeleteFile      Kind = "delete-file"
+	DeleteDirectory Kind = "delete-directory"
+	Skip            Kind = "skip"
+	// Unlink removes a link without touching what it points to
+	Unlink              Kind = "unlink"
+	DeleteRegistryKey   Kind = "delete-registry-key"
+	SetRegistryValue    Kind = "set-registry-value"
+	DeleteRegistryValue Kind = "delete-registry-value"
+	LoadRegistryHive    Kind = "load-registry-hive"
+	KillProcess         Kind = "kill-process"
+	StartProcess        Kind = "start-process"
+	EmptyRecycleBin     Kind = "empty-recycle-bin"
+)
+
+// Action is a single operation a run would perform
+type Action struct {
+	Phase  string `json:"phase"`
+	Kind   Kind   `json:"kind"`
+	Target string `json:"target"`
+	Reason string `json:"reason,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+}
+
+// Plan records the actions of a dry run instead of performing them
+type Plan struct {
+	mu      sync.Mutex
+	created time.Time
+	actions []Action
+	removed map[string]struct{}
+}
+
+// New creates an empty plan
+func New() *Plan {
+	return &Plan{
+		created: time.Now(),
+		removed: make(map[string]struct{}),
+	}
+}
+
+// Add records an action
+func (p *Plan) Add(action Action) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.actions = append(p.actions, action)
+	if action.Kind == DeleteFile || action.Kind == DeleteDirectory || action.Kind == Unlink {
+		p.removed[filepath.Clean(action.Target)] = struct{}{}
+	}
+}
+
+// Removed reports whether path, or one of its parents, is planned for deletion
+func (p *Plan) Removed(path string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	path = filepath.Clean(path)
+	for {
+		if _, ok := p.removed[path]; ok {
+			return true
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return false
+		}
+		path = parent
+	}
+}
+
+// Actions returns a copy of the recorded actions in the order they were added
+func (p *Plan) Actions() []Action {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	actions := make([]Action, len(p.actions))
+	copy(actions, p.actions)
+	return actions
+}
+
+// SummaryLine aggregates the actions of one kind within a phase
+type SummaryLine struct {
+	Phase string `json:"phase"`
+	Kind  Kind   `json:"kind"`
+	Count int    `json:"count"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Summary groups actions by phase and kind, in phase order of first appearance
+func (p *Plan) Summary() []SummaryLine {
+	actions := p.Actions()
+
+	phaseOrder := make(map[string]int)
+	index := make(map[string]int)
+	var lines []SummaryLine
+
+	for _, action := range actions {
+		if _, ok := phaseOrder[action.Phase]; !ok {
+			phaseOrder[action.Phase] = len(phaseOrder)
+		}
+		key := action.Phase + "\x00" + string(action.Kind)
+		i, ok := index[key]
+		if !ok {
+			i = len(lines)
+			index[key] = i
+			lines = append(lines, SummaryLine{Phase: action.Phase, Kind: action.Kind})
+		}
+		lines[i].Count++
+		lines[i].Bytes += action.Size
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		if lines[i].Phase != lines[j].Phase {
+			return phaseOrder[lines[i].Phase] < phaseOrder[lines[j].Phase]
+		}
+		return lines[i].Kind < lines[j].Kind
+	})
+	return lines
+}
+
+// document is the on-disk plan format
+type document struct {
+	Version string        `json:"version"`
+	Created time.Time     `json:"created"`
+	Summary []SummaryLine `json:"summary"`
+	Actions []Action      `json:"actions"`
+}
+
+// WriteFile saves the plan as JSON
+func (p *Plan) WriteFile(path, version string) error {
+	doc := document{
+		Version: version,
+		Created: p.created,
+		Summary: p.Summary(),
+		Actions: p.Actions(),
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write plan file: %v", err)
+	}
+	return nil
+}
+
+// DefaultFileName returns a timestamped plan file name in the working directory
+func DefaultFileName() string {
+	return fmt.Sprintf("nScript-plan-%s.json", time.Now().Format("20060102_150405"))
+}
+
+// DescribeAge formats an age for action reasons, e.g. "3d4h"
+func DescribeAge(age time.Duration) string {
+	if age < time.Minute {
+		return "<1m"
+	}
+	days := int(age / (24 * time.Hour))
+	rest := age % (24 * time.Hour)
+
+	var b strings.Builder
+	if days > 0 {
+		fmt.Fprintf(&b, "%dd", days)
+	}
+	if hours := int(rest / time.Hour); hours > 0 {
+		fmt.Fprintf(&b, "%dh", hours)
+	}
+	if days == 0 {
+		if minutes := int((rest % time.Hour) / time.Minute); minutes > 0 {
+			fmt.Fprintf(&b, "%dm", minutes)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,207 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sample returns a plan of two phases with the second one's actions added
+// between the first one's
+func sample() (*Plan, []Action) {
+	actions := []Action{
+		{Phase: "files", Kind: DeleteFile, Target: filepath.Join("home", "a.zip"), Reason: "modified 3d ago", Size: 100},
+		{Phase: "files", Kind: Skip, Target: filepath.Join("home", "win.iso"), Reason: "excluded extension .iso"},
+		{Phase: "browsers", Kind: KillProcess, Target: "chrome.exe"},
+		{Phase: "files", Kind: DeleteFile, Target: filepath.Join("home", "b.zip"), Size: 50},
+		{Phase: "browsers", Kind: DeleteDirectory, Target: filepath.Join("home", "cache"), Size: 1000},
+		{Phase: "files", Kind: DeleteDirectory, Target: filepath.Join("home", "old"), Reason: "empty directory"},
+	}
+	p := New()
+	for _, action := range actions {
+		p.Add(action)
+	}
+	return p, actions
+}
+
+func TestActionsKeepOrder(t *testing.T) {
+	p, want := sample()
+
+	got := p.Actions()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Actions() = %+v, want %+v", got, want)
+	}
+	// The copy is the caller's own
+	got[0].Target = "changed"
+	if p.Actions()[0].Target != want[0].Target {
+		t.Error("changing the result of Actions changed the plan")
+	}
+
+	if got := New().Actions(); len(got) != 0 {
+		t.Errorf("Actions() of an empty plan = %v", got)
+	}
+}
+
+func TestAddIsSafeForConcurrentUse(t *testing.T) {
+	p := New()
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				p.Add(Action{Phase: "files", Kind: DeleteFile, Target: filepath.Join("home", fmt.Sprintf("f_%d_%d", i, j))})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(p.Actions()); got != 800 {
+		t.Errorf("%d actions recorded, want 800", got)
+	}
+	if !p.Removed(filepath.Join("home", "f_7_99")) {
+		t.Error("a file added concurrently is not removed")
+	}
+}
+
+func TestRemoved(t *testing.T) {
+	p, _ := sample()
+
+	for _, path := range []string{
+		filepath.Join("home", "a.zip"),
+		filepath.Join("home", "cache"),
+		filepath.Join("home", "cache", "data", "f_000001"),
+		filepath.Join("home", "old") + string(filepath.Separator),
+		filepath.Join("home", "x", "..", "b.zip"),
+	} {
+		if !p.Removed(path) {
+			t.Errorf("Removed(%q) = false, want true", path)
+		}
+	}
+	// Skipped files, processes and unrelated paths are not removed
+	for _, path := range []string{
+		filepath.Join("home", "win.iso"),
+		"chrome.exe",
+		"home",
+		filepath.Join("home", "cache2"),
+	} {
+		if p.Removed(path) {
+			t.Errorf("Removed(%q) = true, want false", path)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	p, _ := sample()
+
+	// Phases in order of first appearance, kinds sorted within a phase
+	want := []SummaryLine{
+		{Phase: "files", Kind: DeleteDirectory, Count: 1},
+		{Phase: "files", Kind: DeleteFile, Count: 2, Bytes: 150},
+		{Phase: "files", Kind: Skip, Count: 1},
+		{Phase: "browsers", Kind: DeleteDirectory, Count: 1, Bytes: 1000},
+		{Phase: "browsers", Kind: KillProcess, Count: 1},
+	}
+	if got := p.Summary(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Summary() = %+v, want %+v", got, want)
+	}
+	if got := New().Summary(); len(got) != 0 {
+		t.Errorf("Summary() of an empty plan = %v", got)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	p, actions := sample()
+
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := p.WriteFile(path, "2.0.8"); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Scripts read plans; these names are part of the format
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("plan is not valid JSON: %v", err)
+	}
+	for _, key := range []string{"version", "created", "summary", "actions"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("plan has no %q field", key)
+		}
+	}
+	var first map[string]any
+	var all []json.RawMessage
+	if err := json.Unmarshal(fields["actions"], &all); err != nil || len(all) == 0 {
+		t.Fatalf("actions = %s", fields["actions"])
+	}
+	if err := json.Unmarshal(all[0], &first); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"phase", "kind", "target", "reason", "size"} {
+		if _, ok := first[key]; !ok {
+			t.Errorf("action has no %q field", key)
+		}
+	}
+	// Empty reasons and sizes are left out
+	var kill map[string]any
+	if err := json.Unmarshal(all[2], &kill); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := kill["reason"]; ok {
+		t.Errorf("action without a reason = %s", all[2])
+	}
+	if _, ok := kill["size"]; ok {
+		t.Errorf("action without a size = %s", all[2])
+	}
+
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != "2.0.8" || !doc.Created.Equal(p.created) {
+		t.Errorf("header = %q created %v, want 2.0.8 created %v", doc.Version, doc.Created, p.created)
+	}
+	if !reflect.DeepEqual(doc.Actions, actions) {
+		t.Errorf("actions = %+v, want %+v", doc.Actions, actions)
+	}
+	if !reflect.DeepEqual(doc.Summary, p.Summary()) {
+		t.Errorf("summary = %+v, want %+v", doc.Summary, p.Summary())
+	}
+}
+
+func TestWriteFileFails(t *testing.T) {
+	p, _ := sample()
+	if err := p.WriteFile(filepath.Join(t.TempDir(), "missing", "plan.json"), "2.0.8"); err == nil {
+		t.Error("WriteFile into a missing directory = nil, want error")
+	}
+}
+
+func TestDescribeAge(t *testing.T) {
+	tests := []struct {
+		age  time.Duration
+		want string
+	}{
+		{0, "<1m"},
+		{59 * time.Second, "<1m"},
+		{time.Minute, "1m"},
+		{45*time.Minute + 30*time.Second, "45m"},
+		{time.Hour, "1h"},
+		{2*time.Hour + 5*time.Minute, "2h5m"},
+		{24 * time.Hour, "1d"},
+		{3*24*time.Hour + 4*time.Hour + 59*time.Minute, "3d4h"},
+		{400 * 24 * time.Hour, "400d"},
+	}
+	for _, tt := range tests {
+		if got := DescribeAge(tt.age); got != tt.want {
+			t.Errorf("DescribeAge(%v) = %q, want %q", tt.age, got, tt.want)
+		}
+	}
+}
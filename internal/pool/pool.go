@@ -0,0 +1,317 @@
+// Package pool runs the file operations of a run on one shared set of workers.
+// How many run at once adapts to the volume being cleaned, and the rate of
+// operations and bytes can be capped.
+package pool
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// adaptInterval is how long throughput is measured before the concurrency is adjusted
+const adaptInterval = 500 * time.Millisecond
+
+// Bounds are the concurrency a pool starts with and never exceeds
+type Bounds struct {
+	Initial int
+	Max     int
+}
+
+// normalize returns b with at least one worker and Initial within Max
+func (b Bounds) normalize() Bounds {
+	b.Max = max(b.Max, 1)
+	b.Initial = min(max(b.Initial, 1), b.Max)
+	return b
+}
+
+// Options configure a pool
+type Options struct {
+	Bounds Bounds
+	// OpsPerSecond and BytesPerSecond cap how many tasks start and how many
+	// bytes they delete each second; zero sets no cap
+	OpsPerSecond   float64
+	BytesPerSecond float64
+	// QueueSize is how many tasks may wait before Submit blocks
+	QueueSize int
+}
+
+// Load is a snapshot of a pool for progress displays
+type Load struct {
+	// Queued tasks wait for a worker; Active ones are running
+	Queued int
+	Active int
+	// Limit is how many tasks may run at once right now
+	Limit          int
+	OpsPerSecond   float64
+	BytesPerSecond float64
+}
+
+// Pool runs tasks on workers that are started as tasks arrive and exit when
+// the queue is empty. Every adaptInterval it compares throughput with the
+// interval before and moves the concurrency towards the better side: on an
+// SSD it climbs, on a spinning disk or a slow share it settles low instead of
+// thrashing. It is safe for concurrent use.
+type Pool struct {
+	opts Options
+
+	mu      sync.Mutex
+	notFull *sync.Cond
+	queue   []task
+	workers int
+	active  int
+	limit   int
+	bounds  Bounds
+	ops     limiter
+	bytes   limiter
+
+	// volume is the volume the next tasks work on; learned keeps what was
+	// learned about the others
+	volume  string
+	learned map[string]learning
+
+	// window measures throughput since start
+	window struct {
+		start      time.Time
+		tasks      int
+		bytes      int64
+		saturated  int
+		throughput float64
+	}
+	// direction is +1 while adding workers raises throughput, -1 otherwise
+	direction int
+	rates     struct {
+		ops, bytes float64
+		at         time.Time
+	}
+}
+
+// learning is what a pool learned about the concurrency of one volume
+type learning struct {
+	bounds     Bounds
+	limit      int
+	direction  int
+	throughput float64
+}
+
+type task struct {
+	ctx  context.Context
+	size int64
+	run  func() int64
+}
+
+// New creates a pool
+func New(opts Options) *Pool {
+	if opts.QueueSize < 1 {
+		opts.QueueSize = 1
+	}
+	p := &Pool{
+		opts:    opts,
+		ops:     limiter{rate: opts.OpsPerSecond},
+		bytes:   limiter{rate: opts.BytesPerSecond, burst: time.Second},
+		learned: make(map[string]learning),
+	}
+	p.notFull = sync.NewCond(&p.mu)
+	p.tune(opts.Bounds)
+	return p
+}
+
+// Tune switches to the volume the next tasks work on, with the bounds of its
+// kind. A volume seen before resumes at the concurrency learned for it, so
+// work on one volume never undoes what was learned about another.
+func (p *Pool) Tune(volume string, b Bounds) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b = b.normalize()
+	if volume == p.volume && b == p.bounds {
+		return
+	}
+
+	p.learned[p.volume] = learning{bounds: p.bounds, limit: p.limit, direction: p.direction, throughput: p.window.throughput}
+	p.volume = volume
+	l, ok := p.learned[volume]
+	if !ok || l.bounds != b {
+		p.tune(b)
+		return
+	}
+	p.bounds, p.limit, p.direction, p.window.throughput = l.bounds, l.limit, l.direction, l.throughput
+	p.spawn()
+}
+
+// tune starts over with the bounds b
+func (p *Pool) tune(b Bounds) {
+	p.bounds = b.normalize()
+	p.limit = b.Initial
+	p.direction = 1
+	p.window.throughput = 0
+	p.spawn()
+}
+
+// Submit queues run, blocking while the queue is full, and reports whether it
+// was queued; once ctx is cancelled it gives up waiting and returns false.
+// size is the number of bytes run is about to delete or move. It is reserved
+// against the byte rate before run starts, so a large deletion waits for its
+// budget rather than overrunning the cap. run returns the bytes it actually
+// handled, and what it handled beyond size is charged afterwards. Once ctx is
+// cancelled run is started without waiting for the rate caps, so it can
+// notice and return at once.
+func (p *Pool) Submit(ctx context.Context, size int64, run func() int64) bool {
+	// Wake this Submit, and any other waiting, when ctx is cancelled
+	stop := context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.notFull.Broadcast()
+	})
+	defer stop()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.queue) >= p.opts.QueueSize {
+		if ctx.Err() != nil {
+			return false
+		}
+		p.notFull.Wait()
+	}
+	p.queue = append(p.queue, task{ctx: ctx, size: size, run: run})
+	p.spawn()
+	return true
+}
+
+// spawn starts workers up to the limit while tasks are waiting
+func (p *Pool) spawn() {
+	for p.workers < p.limit && p.workers-p.active < len(p.queue) {
+		p.workers++
+		go p.work()
+	}
+}
+
+// work runs queued tasks until the queue is empty or the pool has more
+// workers than its limit
+func (p *Pool) work() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.queue) > 0 && p.workers <= p.limit {
+		t := p.queue[0]
+		p.queue[0] = task{}
+		p.queue = p.queue[1:]
+		p.notFull.Signal()
+		p.active++
+
+		now := time.Now()
+		at := p.ops.take(1, now)
+		if budget := p.bytes.take(float64(t.size), now); budget.After(at) {
+			at = budget
+		}
+		p.mu.Unlock()
+
+		if t.ctx.Err() == nil {
+			wait(t.ctx, time.Until(at))
+		}
+		n := t.run()
+
+		p.mu.Lock()
+		p.active--
+		end := time.Now()
+		if n > t.size {
+			p.bytes.take(float64(n-t.size), end)
+		}
+		p.completed(end, n)
+	}
+	p.workers--
+}
+
+// completed counts a finished task and, at the end of an interval, updates
+// the rates and adapts the limit
+func (p *Pool) completed(now time.Time, n int64) {
+	w := &p.window
+	if w.start.IsZero() {
+		w.start = now
+	}
+	w.tasks++
+	w.bytes += n
+	if len(p.queue) > 0 {
+		w.saturated++
+	}
+
+	elapsed := now.Sub(w.start)
+	if elapsed < adaptInterval {
+		return
+	}
+	throughput := float64(w.tasks) / elapsed.Seconds()
+	p.rates.ops, p.rates.bytes, p.rates.at = throughput, float64(w.bytes)/elapsed.Seconds(), now
+
+	// The limit only matters while tasks wait for a worker
+	if w.saturated*2 > w.tasks {
+		p.climb(throughput)
+	}
+	w.start, w.tasks, w.bytes, w.saturated = now, 0, 0, 0
+}
+
+// climb steps the limit in the direction that raised throughput over the
+// last interval and turns around when it did not
+func (p *Pool) climb(throughput float64) {
+	last := p.window.throughput
+	p.window.throughput = throughput
+	if last > 0 && throughput < last*1.05 {
+		p.direction = -p.direction
+	}
+	step := max(1, p.limit/8)
+	p.limit = min(max(p.limit+p.direction*step, 1), p.bounds.Max)
+	p.spawn()
+}
+
+// Load returns the current queue depth, concurrency and throughput
+func (p *Pool) Load() Load {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	load := Load{Queued: len(p.queue), Active: p.active, Limit: p.limit}
+	// Rates of an interval long past are stale
+	if time.Since(p.rates.at) < 2*adaptInterval {
+		load.OpsPerSecond, load.BytesPerSecond = p.rates.ops, p.rates.bytes
+	}
+	return load
+}
+
+// limiter spaces units of work out to a rate. Units are paid for before they
+// are used: n units may be used once the ones before them are paid off and n
+// more have accrued, less burst, which lets work that was idle start at once.
+// Over any stretch of time no more than rate units per second plus burst's
+// worth are used, however large a single reservation is.
+type limiter struct {
+	rate  float64
+	burst time.Duration
+	// paid is when every unit reserved so far will have accrued
+	paid time.Time
+}
+
+// take reserves n units and returns when they may be used
+func (l *limiter) take(n float64, now time.Time) time.Time {
+	if l.rate <= 0 {
+		return now
+	}
+	if l.paid.Before(now) {
+		l.paid = now
+	}
+	l.paid = l.paid.Add(time.Duration(n / l.rate * float64(time.Second)))
+	at := l.paid.Add(-max(l.burst, time.Duration(float64(time.Second)/l.rate)))
+	if at.Before(now) {
+		return now
+	}
+	return at
+}
+
+// wait pauses for d or until ctx is cancelled
+func wait(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,225 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimitIsRespected(t *testing.T) {
+	p := New(Options{Bounds: Bounds{Initial: 3, Max: 3}, QueueSize: 10})
+
+	var running, peak atomic.Int64
+	var wg sync.WaitGroup
+	for range 30 {
+		wg.Add(1)
+		p.Submit(context.Background(), 0, func() int64 {
+			defer wg.Done()
+			n := running.Add(1)
+			for {
+				m := peak.Load()
+				if n <= m || peak.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			running.Add(-1)
+			return 0
+		})
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > 3 {
+		t.Errorf("%d tasks ran at once, want at most 3", got)
+	}
+}
+
+func TestOneWorkerKeepsOrder(t *testing.T) {
+	p := New(Options{Bounds: Bounds{Initial: 1, Max: 1}, QueueSize: 4})
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		p.Submit(context.Background(), 0, func() int64 {
+			defer wg.Done()
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			return 0
+		})
+	}
+	wg.Wait()
+
+	for i, n := range order {
+		if n != i {
+			t.Fatalf("order = %v", order)
+		}
+	}
+}
+
+// run submits n tasks of size bytes and returns how long they took
+func run(p *Pool, ctx context.Context, n int, size int64) time.Duration {
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		p.Submit(ctx, size, func() int64 {
+			defer wg.Done()
+			return size
+		})
+	}
+	wg.Wait()
+	return time.Since(start)
+}
+
+func TestOpsRate(t *testing.T) {
+	p := New(Options{Bounds: Bounds{Initial: 4, Max: 4}, OpsPerSecond: 100, QueueSize: 10})
+
+	// The first task starts at once, the other 20 one every 10ms
+	if took := run(p, context.Background(), 21, 0); took < 180*time.Millisecond {
+		t.Errorf("21 tasks at 100/s took %v, want about 200ms", took)
+	}
+}
+
+func TestBytesRate(t *testing.T) {
+	p := New(Options{Bounds: Bounds{Initial: 4, Max: 4}, BytesPerSecond: 10000, QueueSize: 10})
+
+	// A second's worth starts at once, then each task waits 500ms for its
+	// 5000 bytes
+	if took := run(p, context.Background(), 5, 5000); took < 130*time.Millisecond {
+		t.Errorf("5 tasks of 5000 bytes at 10000 B/s took %v, want about 150ms", took)
+	}
+}
+
+func TestBytesReservedBeforeRun(t *testing.T) {
+	p := New(Options{Bounds: Bounds{Initial: 1, Max: 1}, BytesPerSecond: 1000, QueueSize: 10})
+
+	// One deletion larger than the burst waits for the rest of its budget
+	// before it starts, rather than being charged after it ran
+	if took := run(p, context.Background(), 1, 1500); took < 400*time.Millisecond {
+		t.Errorf("a task of 1500 bytes at 1000 B/s started after %v, want about 500ms", took)
+	}
+}
+
+func TestBytesBeyondTheReservationAreCharged(t *testing.T) {
+	p := New(Options{Bounds: Bounds{Initial: 1, Max: 1}, BytesPerSecond: 1000, QueueSize: 10})
+
+	// The first task reserved nothing but handled 1200 bytes
+	var wg sync.WaitGroup
+	wg.Add(1)
+	p.Submit(context.Background(), 0, func() int64 {
+		defer wg.Done()
+		return 1200
+	})
+	wg.Wait()
+	if took := run(p, context.Background(), 1, 0); took < 150*time.Millisecond {
+		t.Errorf("the next task started after %v, want about 200ms", took)
+	}
+}
+
+func TestSubmitGivesUpOnCancel(t *testing.T) {
+	p := New(Options{Bounds: Bounds{Initial: 1, Max: 1}, QueueSize: 1})
+
+	// One task holds the only worker and another fills the queue
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	p.Submit(context.Background(), 0, func() int64 {
+		close(started)
+		<-release
+		return 0
+	})
+	<-started
+	p.Submit(context.Background(), 0, func() int64 { return 0 })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queued := make(chan bool)
+	go func() {
+		queued <- p.Submit(ctx, 0, func() int64 { return 0 })
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case ok := <-queued:
+		if ok {
+			t.Error("Submit queued the task after its context was cancelled")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Submit kept waiting for room after its context was cancelled")
+	}
+}
+
+func TestCancelledTasksSkipTheRate(t *testing.T) {
+	p := New(Options{Bounds: Bounds{Initial: 1, Max: 1}, OpsPerSecond: 1, QueueSize: 10})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if took := run(p, ctx, 5, 0); took > time.Second {
+		t.Errorf("cancelled tasks took %v, want them to run at once", took)
+	}
+}
+
+func TestClimb(t *testing.T) {
+	p := New(Options{Bounds: Bounds{Initial: 8, Max: 16}, QueueSize: 1})
+
+	// More workers helped: keep adding
+	p.climb(100)
+	p.climb(200)
+	if p.limit != 10 || p.direction != 1 {
+		t.Fatalf("limit = %d, direction = %d after rising throughput, want 10 going up", p.limit, p.direction)
+	}
+	// They no longer help: turn back
+	p.climb(201)
+	if p.limit != 9 || p.direction != -1 {
+		t.Fatalf("limit = %d, direction = %d after flat throughput, want 9 going down", p.limit, p.direction)
+	}
+	// Never above Max or below one
+	p.tune(Bounds{Initial: 16, Max: 16})
+	p.climb(100)
+	if p.limit != 16 {
+		t.Errorf("limit = %d, want it clamped to 16", p.limit)
+	}
+	p.tune(Bounds{Initial: 1, Max: 16})
+	p.direction = -1
+	p.climb(100)
+	if p.limit != 1 {
+		t.Errorf("limit = %d, want it clamped to 1", p.limit)
+	}
+}
+
+func TestTuneKeepsLearnedLimitPerVolume(t *testing.T) {
+	p := New(Options{Bounds: Bounds{Initial: 2, Max: 8}, QueueSize: 1})
+	p.Tune("ssd", Bounds{Initial: 2, Max: 8})
+	p.climb(100)
+
+	p.Tune("ssd", Bounds{Initial: 2, Max: 8})
+	if got := p.Load().Limit; got != 3 {
+		t.Errorf("limit = %d after the same volume, want the learned 3", got)
+	}
+	p.Tune("share", Bounds{Initial: 4, Max: 8})
+	if got := p.Load().Limit; got != 4 {
+		t.Errorf("limit = %d on another volume, want its initial 4", got)
+	}
+	p.climb(100)
+
+	// Coming back resumes what was learned about each volume
+	p.Tune("ssd", Bounds{Initial: 2, Max: 8})
+	if got := p.Load().Limit; got != 3 {
+		t.Errorf("limit = %d back on the first volume, want its learned 3", got)
+	}
+	p.Tune("share", Bounds{Initial: 4, Max: 8})
+	if got := p.Load().Limit; got != 5 {
+		t.Errorf("limit = %d back on the second volume, want its learned 5", got)
+	}
+	// Bounds beyond one worker are clamped, not relearned each time
+	p.Tune("hdd", Bounds{Initial: 16, Max: 1})
+	p.Tune("hdd", Bounds{Initial: 16, Max: 1})
+	if got := p.Load().Limit; got != 1 {
+		t.Errorf("limit = %d, want 1", got)
+	}
+}
@@ -0,0 +1,198 @@
+// Package profiles finds the local user profiles that an all-users run cleans
+package profiles
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"nScript/internal/config"
+	"nScript/internal/fsys"
+	"nScript/internal/winreg"
+)
+
+// profileListKey lists every profile Windows knows, one subkey per SID
+const profileListKey = `SOFTWARE\Microsoft\Windows NT\CurrentVersion\ProfileList`
+
+// hiveName is the file holding a profile's HKEY_CURRENT_USER
+const hiveName = "NTUSER.DAT"
+
+// passwdFile lists the accounts of a Linux system; accounts of people have a
+// UID of at least firstUserID, as useradd assigns by default
+const (
+	passwdFile  = "/etc/passwd"
+	firstUserID = 1000
+	nobodyID    = 65534
+)
+
+// Profile is a local user profile
+type Profile struct {
+	// User is the profile folder name, which is the account name for most accounts
+	User string
+	// SID is empty when the profile was found in the Users directory rather than in ProfileList
+	SID  string
+	Home string
+}
+
+// Hive returns the path of the profile's registry hive
+func (p Profile) Hive() string {
+	return filepath.Join(p.Home, hiveName)
+}
+
+// skipped are the folder names of profiles that never belong to a person
+var skipped = []string{"default", "default user", "public", "all users", "wdagutilityaccount"}
+
+// Skipped reports whether a profile folder is a built-in profile or on allowlist
+func Skipped(user string, allowlist []string) bool {
+	lower := strings.ToLower(user)
+	if slices.Contains(skipped, lower) || strings.HasPrefix(lower, "defaultuser") {
+		return true
+	}
+	return slices.ContainsFunc(allowlist, func(name string) bool { return strings.EqualFold(name, user) })
+}
+
+// List returns the user profiles to clean, sorted by user. Profiles are read
+// from ProfileList, and on Linux from the accounts in /etc/passwd; when neither
+// can be read, the folders of usersDir that contain a registry hive are used
+// instead. Built-in and service profiles, profiles whose folder is missing and
+// accounts on allowlist are left out.
+func List(reg winreg.Registry, filesystem fsys.FS, usersDir string, allowlist []string) ([]Profile, error) {
+	found, err := fromProfileList(reg)
+	if err != nil && runtime.GOOS == "linux" {
+		found, err = fromPasswd(filesystem, usersDir)
+	}
+	if err != nil {
+		found, err = fromUsersDir(filesystem, usersDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var list []Profile
+	for _, p := range found {
+		if Skipped(p.User, allowlist) {
+			continue
+		}
+		if info, err := filesystem.Stat(p.Home); err != nil || !info.IsDir() {
+			continue
+		}
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return strings.ToLower(list[i].User) < strings.ToLower(list[j].User) })
+	return list, nil
+}
+
+// fromProfileList reads the profiles of user accounts from the registry. Local
+// and domain accounts have S-1-5-21 SIDs and Microsoft Entra accounts S-1-12-1;
+// SYSTEM and the service accounts have neither.
+func fromProfileList(reg winreg.Registry) ([]Profile, error) {
+	key, err := reg.OpenKey(winreg.LocalMachine, profileListKey, winreg.Read)
+	if err != nil {
+		return nil, err
+	}
+	sids, err := key.ReadSubKeyNames()
+	key.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Profile
+	for _, sid := range sids {
+		if !strings.HasPrefix(sid, "S-1-5-21-") && !strings.HasPrefix(sid, "S-1-12-1-") {
+			continue
+		}
+		home, err := profilePath(reg, sid)
+		if err != nil {
+			continue
+		}
+		list = append(list, Profile{User: filepath.Base(home), SID: sid, Home: home})
+	}
+	return list, nil
+}
+
+// profilePath reads and expands the home directory of one ProfileList entry
+func profilePath(reg winreg.Registry, sid string) (string, error) {
+	key, err := reg.OpenKey(winreg.LocalMachine, profileListKey+`\`+sid, winreg.Read)
+	if err != nil {
+		return "", err
+	}
+	defer key.Close()
+	value, err := key.GetValue("ProfileImagePath")
+	if err != nil {
+		return "", err
+	}
+	home, err := config.ExpandEnv(value.Text(), os.LookupEnv)
+	if err != nil {
+		return "", err
+	}
+	if home == "" {
+		return "", errors.New("empty profile path")
+	}
+	return filepath.Clean(home), nil
+}
+
+// fromPasswd reads the accounts of people from /etc/passwd: those with a UID
+// from firstUserID up, other than nobody, whose home is a folder of usersDir.
+// System and service accounts have lower UIDs or live elsewhere.
+func fromPasswd(filesystem fsys.FS, usersDir string) ([]Profile, error) {
+	data, err := fsys.ReadFile(filesystem, passwdFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user accounts: %v", err)
+	}
+
+	var list []Profile
+	for _, line := range strings.Split(string(data), "\n") {
+		// name:password:UID:GID:comment:home:shell
+		fields := strings.Split(line, ":")
+		if len(fields) < 7 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		uid, err := strconv.Atoi(fields[2])
+		if err != nil || uid < firstUserID || uid == nobodyID {
+			continue
+		}
+		home := filepath.Clean(fields[5])
+		if filepath.Dir(home) != filepath.Clean(usersDir) {
+			continue
+		}
+		list = append(list, Profile{User: fields[0], Home: home})
+	}
+	return list, nil
+}
+
+// fromUsersDir treats every folder of usersDir that holds a registry hive as a profile
+func fromUsersDir(filesystem fsys.FS, usersDir string) ([]Profile, error) {
+	entries, err := filesystem.ReadDir(usersDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user profiles in %s: %v", usersDir, err)
+	}
+
+	var list []Profile
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		home := filepath.Join(usersDir, entry.Name())
+		if _, err := filesystem.Stat(filepath.Join(home, hiveName)); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		list = append(list, Profile{User: entry.Name(), Home: home})
+	}
+	return list, nil
+}
+
+// Homes returns the home directories of profiles
+func Homes(list []Profile) []string {
+	homes := make([]string, 0, len(list))
+	for _, p := range list {
+		homes = append(homes, p.Home)
+	}
+	return homes
+}
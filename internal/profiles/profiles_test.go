@@ -0,0 +1,117 @@
+package profiles
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"nScript/internal/fsys"
+	"nScript/internal/regfile"
+	"nScript/internal/winreg"
+)
+
+var usersDir = filepath.Join(string(filepath.Separator), "Users")
+
+func addProfile(t *testing.T, reg *winreg.Mem, sid, home string) {
+	t.Helper()
+	key, err := reg.CreateKey(winreg.LocalMachine, profileListKey+`\`+sid, winreg.Write)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	if err := key.SetValue(regfile.ExpandString("ProfileImagePath", home)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func users(list []Profile) []string {
+	var names []string
+	for _, p := range list {
+		names = append(names, p.User)
+	}
+	return names
+}
+
+func TestListFromProfileList(t *testing.T) {
+	reg := winreg.NewMem()
+	mem := fsys.NewMem()
+	for _, user := range []string{"bob", "Alice", "Public", "carol"} {
+		mem.AddDir(filepath.Join(usersDir, user), time.Now())
+	}
+	addProfile(t, reg, "S-1-5-21-1-1001", filepath.Join(usersDir, "bob"))
+	addProfile(t, reg, "S-1-12-1-2-1002", filepath.Join(usersDir, "Alice"))
+	addProfile(t, reg, "S-1-5-21-1-1003", filepath.Join(usersDir, "carol"))
+	addProfile(t, reg, "S-1-5-21-1-1004", filepath.Join(usersDir, "gone"))
+	addProfile(t, reg, "S-1-5-18", filepath.Join(usersDir, "systemprofile"))
+	addProfile(t, reg, "S-1-5-21-1-1005", filepath.Join(usersDir, "Public"))
+
+	list, err := List(reg, mem, usersDir, []string{"CAROL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := users(list); len(got) != 2 || got[0] != "Alice" || got[1] != "bob" {
+		t.Fatalf("List = %+v", list)
+	}
+	if list[1].SID != "S-1-5-21-1-1001" || list[1].Hive() != filepath.Join(usersDir, "bob", "NTUSER.DAT") {
+		t.Errorf("bob = %+v", list[1])
+	}
+}
+
+func TestListFromUsersDir(t *testing.T) {
+	mem := fsys.NewMem()
+	for _, user := range []string{"bob", "Default", "defaultuser0"} {
+		mem.AddFile(filepath.Join(usersDir, user, "NTUSER.DAT"), nil, time.Now())
+	}
+	mem.AddDir(filepath.Join(usersDir, "nohive"), time.Now())
+	mem.AddFile(filepath.Join(usersDir, "desktop.ini"), nil, time.Now())
+
+	// Without ProfileList the Users directory is used
+	list, err := List(winreg.NewMem(), mem, usersDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].User != "bob" || list[0].SID != "" {
+		t.Errorf("List = %+v", list)
+	}
+
+	if _, err := List(winreg.NewMem(), fsys.NewMem(), usersDir, nil); err == nil {
+		t.Error("List without ProfileList or Users directory succeeded")
+	}
+}
+
+func TestListFromPasswd(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("accounts are read from /etc/passwd only on Linux")
+	}
+	mem := fsys.NewMem()
+	home := "/home"
+	for _, user := range []string{"bob", "alice", "carol", "nobody"} {
+		mem.AddDir(filepath.Join(home, user), time.Now())
+	}
+	mem.AddFile(passwdFile, []byte(`root:x:0:0:root:/root:/bin/bash
+daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin
+syslog:x:104:110::/home/syslog:/usr/sbin/nologin
+# a comment
+bob:x:1000:1000:Bob,,,:/home/bob:/bin/bash
+alice:x:1001:1001::/home/alice/:/bin/zsh
+carol:x:1002:1002::/home/carol:/bin/bash
+dave:x:1003:1003::/home/dave:/bin/bash
+eve:x:1004:1004::/srv/eve:/bin/bash
+nobody:x:65534:65534:nobody:/home/nobody:/usr/sbin/nologin
+broken:x:oops:1005::/home/broken:/bin/bash
+`), time.Now())
+
+	// Without ProfileList the accounts of people with a home in /home are
+	// used, without requiring a registry hive
+	list, err := List(winreg.NewMem(), mem, home, []string{"CAROL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := users(list); len(got) != 2 || got[0] != "alice" || got[1] != "bob" {
+		t.Fatalf("List = %+v", list)
+	}
+	if list[0].Home != filepath.Join(home, "alice") || list[0].SID != "" {
+		t.Errorf("alice = %+v", list[0])
+	}
+}
@@ -0,0 +1,39 @@
+//go:build !windows
+
+package protect
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// longPathName is nil: there are no short names to expand
+var longPathName func(string) string
+
+// builtin returns the system directories and, protected only themselves, the
+// directories user data lives in
+func builtin() (trees, exact []string) {
+	trees = []string{"/bin", "/boot", "/dev", "/etc", "/lib", "/lib32", "/lib64", "/libx32", "/proc", "/run", "/sbin", "/snap", "/sys", "/usr", "/var/lib"}
+	exact = []string{"/home", "/root", "/var", "/tmp", "/opt", "/mnt", "/media", "/srv"}
+
+	home := os.Getenv("HOME")
+	if home == "" {
+		return trees, exact
+	}
+	xdg := func(env string, fallback ...string) string {
+		if dir := os.Getenv(env); filepath.IsAbs(dir) {
+			return dir
+		}
+		return filepath.Join(append([]string{home}, fallback...)...)
+	}
+	// nScript's own quarantine
+	trees = append(trees, filepath.Join(xdg("XDG_STATE_HOME", ".local", "state"), "nScript"))
+	exact = append(exact, home,
+		filepath.Join(home, ".local"),
+		xdg("XDG_CONFIG_HOME", ".config"),
+		xdg("XDG_DATA_HOME", ".local", "share"),
+		xdg("XDG_STATE_HOME", ".local", "state"),
+		xdg("XDG_CACHE_HOME", ".cache"),
+	)
+	return trees, exact
+}
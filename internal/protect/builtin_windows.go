@@ -0,0 +1,92 @@
+package protect
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// builtin returns the protected paths of this Windows installation, taken
+// from the environment and from the known-folder API so a Windows folder on
+// another drive or a redirected profile folder is protected too
+func builtin() (trees, exact []string) {
+	env := func(name string, elem ...string) string {
+		dir := os.Getenv(name)
+		if dir == "" {
+			return ""
+		}
+		return filepath.Join(append([]string{dir}, elem...)...)
+	}
+	known := func(id *windows.KNOWNFOLDERID) string {
+		dir, err := windows.KnownFolderPath(id, windows.KF_FLAG_DONT_VERIFY)
+		if err != nil {
+			return ""
+		}
+		return dir
+	}
+
+	programFiles := []string{
+		env("ProgramFiles"), env("ProgramW6432"), env("ProgramFiles(x86)"),
+		known(windows.FOLDERID_ProgramFiles), known(windows.FOLDERID_ProgramFilesX64), known(windows.FOLDERID_ProgramFilesX86),
+	}
+	systemDrive := os.Getenv("SystemDrive")
+
+	trees = []string{
+		env("SystemRoot"), env("windir"),
+		known(windows.FOLDERID_Windows), known(windows.FOLDERID_System), known(windows.FOLDERID_SystemX86),
+		env("CommonProgramFiles"), env("CommonProgramW6432"), env("CommonProgramFiles(x86)"),
+		known(windows.FOLDERID_ProgramFilesCommon), known(windows.FOLDERID_ProgramFilesCommonX64), known(windows.FOLDERID_ProgramFilesCommonX86),
+		env("ProgramData", "Microsoft", "Windows Defender"),
+		// nScript's own quarantine, backups, reports and logs
+		env("ProgramData", "nScript"),
+	}
+	if systemDrive != "" {
+		for _, dir := range []string{"Boot", "Recovery", "System Volume Information", "$Recycle.Bin"} {
+			trees = append(trees, filepath.Join(systemDrive+`\`, dir))
+		}
+	}
+	for _, dir := range programFiles {
+		if dir == "" {
+			continue
+		}
+		for _, name := range []string{"Windows NT", "WindowsApps", "ModifiableWindowsApps", "Windows Defender",
+			"Windows Defender Advanced Threat Protection", "Windows Security", "Windows Mail", "Windows Media Player",
+			"Windows Photo Viewer", "Windows Portable Devices", "Windows Sidebar", "Internet Explorer"} {
+			trees = append(trees, filepath.Join(dir, name))
+		}
+	}
+
+	exact = append(programFiles,
+		env("SystemDrive", "Users"), known(windows.FOLDERID_UserProfiles),
+		env("ProgramData"), env("ALLUSERSPROFILE"), known(windows.FOLDERID_ProgramData),
+		env("PUBLIC"), known(windows.FOLDERID_Public),
+		env("USERPROFILE"), known(windows.FOLDERID_Profile),
+		env("APPDATA"), env("LOCALAPPDATA"),
+		known(windows.FOLDERID_RoamingAppData), known(windows.FOLDERID_LocalAppData), known(windows.FOLDERID_LocalAppDataLow),
+		known(windows.FOLDERID_Desktop), known(windows.FOLDERID_Documents), known(windows.FOLDERID_Downloads),
+		known(windows.FOLDERID_Music), known(windows.FOLDERID_Pictures), known(windows.FOLDERID_Videos),
+		known(windows.FOLDERID_SavedGames), known(windows.FOLDERID_Favorites), known(windows.FOLDERID_Links),
+		known(windows.FOLDERID_Contacts), known(windows.FOLDERID_Objects3D), known(windows.FOLDERID_OneDrive),
+		known(windows.FOLDERID_StartMenu), known(windows.FOLDERID_Programs), known(windows.FOLDERID_Startup),
+		known(windows.FOLDERID_CommonStartMenu), known(windows.FOLDERID_CommonPrograms), known(windows.FOLDERID_CommonStartup),
+		known(windows.FOLDERID_Recent),
+	)
+	return trees, exact
+}
+
+// longPathName expands the 8.3 short names in path. A path that does not
+// exist is expanded up to its longest existing parent.
+func longPathName(path string) string {
+	if p, err := windows.UTF16PtrFromString(path); err == nil {
+		buf := make([]uint16, windows.MAX_LONG_PATH)
+		if n, err := windows.GetLongPathName(p, &buf[0], uint32(len(buf))); err == nil && n < uint32(len(buf)) {
+			return windows.UTF16ToString(buf[:n])
+		}
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+	return filepath.Join(longPathName(parent), filepath.Base(path))
+}
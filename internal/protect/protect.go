@@ -0,0 +1,257 @@
+// Package protect decides which paths nScript must never delete: the operating
+// system's own folders, the folders every profile is built on and the paths an
+// administrator adds.
+package protect
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// Policy holds the protected paths of a system in normalized form
+type Policy struct {
+	windows bool
+	// longPath expands 8.3 short names; nil leaves them as they are
+	longPath func(string) string
+	// localHosts are the names of this computer in UNC paths
+	localHosts []string
+
+	// Trees are protected with everything below them. Exact paths are only
+	// protected themselves: the user's Documents may be cleaned, not removed.
+	trees []entry
+	exact []entry
+}
+
+// entry is a protected path as configured and in normalized form
+type entry struct {
+	path string
+	key  string
+}
+
+// New returns the built-in policy of this system with extra added, each path
+// protected with everything below it
+func New(extra []string) *Policy {
+	trees, exact := builtin()
+	return newPolicy(runtime.GOOS == "windows", longPathName, append(trees, extra...), exact)
+}
+
+func newPolicy(windows bool, longPath func(string) string, trees, exact []string) *Policy {
+	p := &Policy{windows: windows, longPath: longPath, localHosts: []string{"localhost", "::1", "[::1]", "0--1.ipv6-literal.net"}}
+	if host, err := os.Hostname(); err == nil {
+		p.localHosts = append(p.localHosts, strings.ToLower(host))
+	}
+
+	// Built-in paths whose variable is not set are left out
+	for _, t := range trees {
+		if n, err := p.normalize(t); err == nil {
+			p.trees = append(p.trees, entry{path: t, key: n.key(p.separator())})
+		}
+	}
+	for _, e := range exact {
+		if n, err := p.normalize(e); err == nil {
+			p.exact = append(p.exact, entry{path: e, key: n.key(p.separator())})
+		}
+	}
+	return p
+}
+
+// Check returns an error when path must not be deleted: it is protected, lies
+// inside a protected tree, is the root of a volume or share, or cannot be
+// normalized and so cannot be checked
+func (p *Policy) Check(path string) error {
+	n, err := p.normalize(path)
+	if err != nil {
+		return err
+	}
+	if len(n.parts) == 0 {
+		return fmt.Errorf("cannot operate on protected path %s: it is the root of a volume", path)
+	}
+	key := n.key(p.separator())
+	for _, e := range p.exact {
+		if key == e.key {
+			return fmt.Errorf("cannot operate on protected path %s", path)
+		}
+	}
+	return p.checkTrees(path, key)
+}
+
+// CheckTarget returns an error when a target directory lies inside a protected
+// tree. Targets are cleaned but never removed, so protected folders such as the
+// user's Downloads may be targets.
+func (p *Policy) CheckTarget(path string) error {
+	n, err := p.normalize(path)
+	if err != nil {
+		return err
+	}
+	return p.checkTrees(path, n.key(p.separator()))
+}
+
+// checkTrees returns an error when key, the normalized form of path, is a protected tree or inside one
+func (p *Policy) checkTrees(path, key string) error {
+	sep := p.separator()
+	for _, e := range p.trees {
+		// key is e.key or below it; a key such as c:\ already ends in the separator
+		rest, ok := strings.CutPrefix(key, e.key)
+		if ok && (rest == "" || strings.HasSuffix(e.key, sep) || strings.HasPrefix(rest, sep)) {
+			return fmt.Errorf("cannot operate on protected path %s: inside %s", path, e.path)
+		}
+	}
+	return nil
+}
+
+func (p *Policy) separator() string {
+	if p.windows {
+		return `\`
+	}
+	return "/"
+}
+
+// normalized is a path reduced to the form protected paths are compared in
+type normalized struct {
+	// volume is a lowercase drive such as c: or a share such as \\server\share,
+	// empty outside Windows
+	volume string
+	parts  []string
+}
+
+func (n normalized) key(sep string) string {
+	return n.volume + sep + strings.Join(n.parts, sep)
+}
+
+func (p *Policy) normalize(name string) (normalized, error) {
+	if p.windows {
+		return p.normalizeWindows(name, true)
+	}
+	return normalizeUnix(name)
+}
+
+// normalizeUnix cleans an absolute path; Unix paths are case-sensitive
+func normalizeUnix(name string) (normalized, error) {
+	if !strings.HasPrefix(name, "/") {
+		return normalized{}, fmt.Errorf("path %s is not absolute", name)
+	}
+	cleaned := strings.TrimPrefix(path.Clean(name), "/")
+	if cleaned == "" {
+		return normalized{}, nil
+	}
+	return normalized{parts: strings.Split(cleaned, "/")}, nil
+}
+
+// normalizeWindows reduces the many spellings Windows accepts for one file to
+// one: either separator, \\?\ and \\.\ prefixes, administrative shares of this
+// computer, alternate data streams, trailing dots and spaces, . and ..
+// components, 8.3 short names and letter case. Device paths that name no drive,
+// like \\?\Volume{...}, cannot be checked and are rejected.
+func (p *Policy) normalizeWindows(name string, expand bool) (normalized, error) {
+	s := strings.ReplaceAll(name, "/", `\`)
+	for {
+		rest, ok := cutDevicePrefix(s)
+		if !ok {
+			break
+		}
+		switch {
+		case hasPrefixFold(rest, `UNC\`):
+			s = `\\` + rest[len(`UNC\`):]
+		case isDrive(rest):
+			s = rest
+		default:
+			return normalized{}, fmt.Errorf("cannot check device path %s", name)
+		}
+	}
+
+	var n normalized
+	var rest string
+	switch {
+	case isDrive(s) && len(s) > 2 && s[2] == '\\':
+		n.volume, rest = s[:2], s[3:]
+	case strings.HasPrefix(s, `\\`):
+		server, after, _ := strings.Cut(s[2:], `\`)
+		share, after, _ := strings.Cut(after, `\`)
+		if server == "" || share == "" {
+			return normalized{}, fmt.Errorf("path %s is not absolute", name)
+		}
+		n.volume, rest = `\\`+server+`\`+share, after
+		if p.isLocalHost(server) {
+			// C$ is drive C:; ADMIN$ is the Windows folder
+			if drive := strings.TrimSuffix(share, "$"); len(share) == 2 && isDrive(drive+":") {
+				n.volume = drive + ":"
+			} else if strings.EqualFold(share, "ADMIN$") {
+				return normalized{}, fmt.Errorf("cannot operate on protected path %s: it is the Windows folder", name)
+			}
+		}
+	default:
+		return normalized{}, fmt.Errorf("path %s is not absolute", name)
+	}
+
+	shortNames := false
+	for _, part := range strings.Split(rest, `\`) {
+		// A stream name follows the first colon; file::$DATA is file itself
+		part, _, _ = strings.Cut(part, ":")
+		part = strings.TrimRight(part, " ")
+		if part != "." && part != ".." {
+			part = strings.TrimRight(part, ". ")
+		}
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(n.parts) > 0 {
+				n.parts = n.parts[:len(n.parts)-1]
+			}
+			continue
+		}
+		shortNames = shortNames || strings.Contains(part, "~")
+		n.parts = append(n.parts, part)
+	}
+
+	if shortNames && expand && p.longPath != nil {
+		return p.normalizeWindows(p.longPath(n.key(`\`)), false)
+	}
+
+	n.volume = strings.ToLower(n.volume)
+	for i := range n.parts {
+		n.parts[i] = strings.ToLower(n.parts[i])
+	}
+	return n, nil
+}
+
+// cutDevicePrefix strips the \\?\, \??\ or \\.\ prefix that passes a path to
+// Windows without the usual normalization
+func cutDevicePrefix(s string) (string, bool) {
+	for _, prefix := range []string{`\\?\`, `\??\`, `\\.\`} {
+		if rest, ok := strings.CutPrefix(s, prefix); ok {
+			return rest, true
+		}
+	}
+	return s, false
+}
+
+// isDrive reports whether s starts with a drive letter and a colon
+func isDrive(s string) bool {
+	if len(s) < 2 || s[1] != ':' {
+		return false
+	}
+	c := s[0] | 0x20
+	return c >= 'a' && c <= 'z' && (len(s) == 2 || s[2] == '\\')
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// isLocalHost reports whether server names this computer; any 127.x.x.x address is loopback
+func (p *Policy) isLocalHost(server string) bool {
+	server = strings.ToLower(server)
+	if strings.HasPrefix(server, "127.") {
+		return true
+	}
+	for _, host := range p.localHosts {
+		if server == host {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package protect
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// shortNames stands in for GetLongPathName on a system drive with the usual 8.3 names
+var shortNames = map[string]string{
+	"progra~1": "Program Files",
+	"progra~2": "Program Files (x86)",
+	"window~1": "Windows NT",
+}
+
+func fakeLongPath(path string) string {
+	parts := strings.Split(path, `\`)
+	for i, part := range parts {
+		if long, ok := shortNames[strings.ToLower(part)]; ok {
+			parts[i] = long
+		}
+	}
+	return strings.Join(parts, `\`)
+}
+
+func windowsPolicy() *Policy {
+	return newPolicy(true, fakeLongPath,
+		[]string{`C:\Windows`, `C:\Program Files\Windows NT`, `D:\Exams`},
+		[]string{`C:\Users`, `C:\Users\student`, `C:\Program Files`})
+}
+
+func TestCheckWindows(t *testing.T) {
+	p := windowsPolicy()
+
+	for _, path := range []string{
+		`C:\Windows`,
+		`c:\windows\system32\drivers`,
+		`C:/Windows/System32`,
+		`C:\Windows.\System32`,
+		`C:\Windows \System32`,
+		`C:\Windows...  \System32\kernel32.dll`,
+		`C:\Windows::$INDEX_ALLOCATION\System32`,
+		`C:\Windows\System32\kernel32.dll::$DATA`,
+		`C:\Users\student\..\..\Windows\System32`,
+		`C:\Temp\.\..\Windows`,
+		`C:\\Windows\\\System32`,
+		`\\?\C:\Windows\System32`,
+		`\\.\C:\Windows`,
+		`\??\C:\Windows`,
+		`\\?\UNC\localhost\C$\Windows`,
+		`\\localhost\c$\Windows\System32`,
+		`\\127.0.0.1\C$\Windows`,
+		`\\[::1]\C$\Windows`,
+		`\\localhost\ADMIN$\System32`,
+		`C:\PROGRA~1\WINDOW~1\Accessories`,
+		`D:\Exams\2026\answers.docx`,
+		`C:\`,
+		`D:\`,
+		`\\server\share`,
+		`C:\Users`,
+		`C:\Users\Student`,
+		`C:\Program Files.`,
+		`\\?\GLOBALROOT\Device\HarddiskVolume3\Windows`,
+		`\\?\Volume{0f6f5d9c-0000-0000-0000-100000000000}\Windows`,
+		`C:Windows\System32`,
+		`\Windows\System32`,
+		`Windows`,
+		``,
+	} {
+		if err := p.Check(path); err == nil {
+			t.Errorf("Check(%q) = nil, want error", path)
+		}
+	}
+
+	for _, path := range []string{
+		`C:\Users\student\Downloads\setup.exe`,
+		`C:\Program Files\Epic Games`,
+		`C:\Windows2\file`,
+		`C:\Windows NT`,
+		`D:\Exams2`,
+		`\\server\share\Windows`,
+		`\\localhost\Public\Windows`,
+		`\\?\C:\Users\student\Documents\a.txt`,
+	} {
+		if err := p.Check(path); err != nil {
+			t.Errorf("Check(%q) = %v, want nil", path, err)
+		}
+	}
+}
+
+func TestCheckTarget(t *testing.T) {
+	p := windowsPolicy()
+
+	for _, path := range []string{`C:\Users\student`, `C:\Program Files`, `C:\`} {
+		if err := p.CheckTarget(path); err != nil {
+			t.Errorf("CheckTarget(%q) = %v, want nil", path, err)
+		}
+	}
+	if err := p.CheckTarget(`C:\Windows\Temp`); err == nil {
+		t.Error("CheckTarget inside a protected tree = nil, want error")
+	}
+}
+
+func TestCheckUnix(t *testing.T) {
+	p := newPolicy(false, nil, []string{"/usr", "/srv/exams"}, []string{"/home", "/home/student"})
+
+	for _, path := range []string{"/", "/usr", "/usr/lib/libc.so", "//usr/lib", "/home/student/../../usr", "/srv/exams/a", "/home", "/home/student/", "usr/lib", ""} {
+		if err := p.Check(path); err == nil {
+			t.Errorf("Check(%q) = nil, want error", path)
+		}
+	}
+	for _, path := range []string{"/home/student/Downloads", "/usrdata", "/USR/lib", "/home/Student", "/srv/exams2"} {
+		if err := p.Check(path); err != nil {
+			t.Errorf("Check(%q) = %v, want nil", path, err)
+		}
+	}
+}
+
+func TestNewAddsProtectedPaths(t *testing.T) {
+	p := newPolicy(false, nil, append([]string{"/usr"}, "/data/keep"), nil)
+	if err := p.Check("/data/keep/report.txt"); err == nil || !strings.Contains(err.Error(), "/data/keep") {
+		t.Errorf("Check = %v, want error naming /data/keep", err)
+	}
+}
+
+// respell writes path the way the bits of how select. Each spelling names the
+// same file to Windows, or one Windows resolves the same way once it strips
+// what the spelling adds.
+func respell(path string, how uint8) string {
+	if how&1 != 0 {
+		path = strings.Map(func(r rune) rune {
+			if unicode.IsUpper(r) {
+				return unicode.ToLower(r)
+			}
+			return unicode.ToUpper(r)
+		}, path)
+	}
+	if how&2 != 0 {
+		path = strings.ReplaceAll(path, `\`, "/")
+	}
+
+	sep := `\`
+	if how&2 != 0 {
+		sep = "/"
+	}
+	volume, rest, _ := strings.Cut(path, sep)
+	parts := strings.Split(rest, sep)
+	for i, part := range parts {
+		if strings.Trim(part, ". ") == "" {
+			continue
+		}
+		if how&4 != 0 {
+			parts[i] += ". "
+		}
+		if how&8 != 0 && strings.EqualFold(part, "Program Files") {
+			parts[i] = "PROGRA~1"
+		}
+	}
+	if how&16 != 0 {
+		parts = append([]string{".", "nul-dir", ".."}, parts...)
+	}
+	if last := len(parts) - 1; how&32 != 0 && last >= 0 && strings.Trim(parts[last], ". ") != "" {
+		parts[len(parts)-1] += "::$DATA"
+	}
+	path = volume + sep + strings.Join(parts, sep)
+
+	switch {
+	case how&64 != 0 && how&128 != 0:
+		return `\\?\UNC\127.0.0.1\` + string(volume[0]) + "$" + sep + strings.Join(parts, sep)
+	case how&64 != 0:
+		return `\\?\` + path
+	case how&128 != 0:
+		return `\\localhost\` + string(volume[0]) + "$" + sep + strings.Join(parts, sep)
+	}
+	return path
+}
+
+// FuzzCheckWindows makes sure no other spelling of a protected path gets
+// past Check
+func FuzzCheckWindows(f *testing.F) {
+	for _, seed := range []string{
+		`C:\Windows\System32\config\SAM`,
+		`C:\Program Files\Windows NT\Accessories\wordpad.exe`,
+		`D:\Exams\2026`,
+		`C:\Users\student`,
+		`C:\Windows\..\Windows\System32`,
+		`C:\Windows\ .\..\System32`,
+	} {
+		for how := range 256 {
+			f.Add(seed, uint8(how))
+		}
+	}
+
+	p := windowsPolicy()
+	f.Fuzz(func(t *testing.T, path string, how uint8) {
+		n, err := p.normalize(path)
+		if err == nil {
+			// Normalizing is idempotent
+			again, err := p.normalize(n.key(`\`))
+			if err != nil || again.key(`\`) != n.key(`\`) {
+				t.Fatalf("normalize(%q) = %q, normalized again %q, %v", path, n.key(`\`), again.key(`\`), err)
+			}
+		}
+
+		if len(path) < 3 || !isDrive(path) || p.Check(path) == nil {
+			return
+		}
+		if spelled := respell(path, how); p.Check(spelled) == nil {
+			t.Errorf("Check(%q) = nil for protected %q", spelled, path)
+		}
+	})
+}
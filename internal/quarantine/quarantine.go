@@ -0,0 +1,607 @@
+package quarantine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"nScript/internal/fsys"
+)
+
+const (
+	manifestName = "manifest.jsonl"
+	itemsDir     = "items"
+	runIDFormat  = "20060102-150405"
+)
+
+// Entry describes one quarantined file or directory
+type Entry struct {
+	Original      string      `json:"original"`
+	Stored        string      `json:"stored"`
+	Dir           bool        `json:"dir"`
+	Size          int64       `json:"size"`
+	Mode          fs.FileMode `json:"mode"`
+	ModTime       time.Time   `json:"modTime"`
+	QuarantinedAt time.Time   `json:"quarantinedAt"`
+	Restored      bool        `json:"restored,omitempty"`
+	// Partial is set when part of the item could not be moved and stayed at
+	// its original path; Stored holds only what was moved
+	Partial bool `json:"partial,omitempty"`
+	// State is empty once the item was moved, StatePending while it is being
+	// moved and StateFailed when the move failed
+	State string `json:"state,omitempty"`
+}
+
+// States of a manifest entry. An entry is written as pending before its item is
+// moved and written again once the move succeeded or failed; the last line
+// written for a stored name wins.
+const (
+	StatePending = "pending"
+	StateFailed  = "failed"
+)
+
+// PartialMoveError reports an item only part of which was moved into quarantine
+type PartialMoveError struct {
+	Path string
+	Err  error
+}
+
+func (e *PartialMoveError) Error() string {
+	return fmt.Sprintf("only part of %s was moved to quarantine: %v", e.Path, e.Err)
+}
+
+func (e *PartialMoveError) Unwrap() error {
+	return e.Err
+}
+
+// RunInfo summarizes a quarantine run
+type RunInfo struct {
+	ID      string
+	Created time.Time
+	Items   int
+	Bytes   int64
+}
+
+// Store is a directory holding one subdirectory per quarantine run
+type Store struct {
+	fs   fsys.FS
+	root string
+}
+
+// DefaultRoot returns the quarantine location: under ProgramData on Windows and
+// under the XDG state directory elsewhere. No built-in target covers either and
+// both are protected. Without them there is no safe place, as a temporary
+// directory would be cleaned by a later run, so an error is returned.
+func DefaultRoot() (string, error) {
+	if base := os.Getenv("ProgramData"); base != "" {
+		return filepath.Join(base, "nScript", "quarantine"), nil
+	}
+	if runtime.GOOS != "windows" {
+		if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+			return filepath.Join(dir, "nScript", "quarantine"), nil
+		}
+		if home := os.Getenv("HOME"); home != "" {
+			return filepath.Join(home, ".local", "state", "nScript", "quarantine"), nil
+		}
+		return "", errors.New("no quarantine location: neither XDG_STATE_HOME nor HOME is set")
+	}
+	return "", errors.New("no quarantine location: ProgramData is not set")
+}
+
+// NewStore opens the quarantine store rooted at root
+func NewStore(filesystem fsys.FS, root string) *Store {
+	return &Store{fs: filesystem, root: root}
+}
+
+// Root returns the store directory
+func (s *Store) Root() string {
+	return s.root
+}
+
+// Run is an open quarantine run that items are moved into
+type Run struct {
+	store *Store
+	id    string
+	dir   string
+
+	mu       sync.Mutex
+	sequence int
+	entries  int
+}
+
+// Begin starts a new quarantine run named after the current time
+func (s *Store) Begin() (*Run, error) {
+	id := time.Now().Format(runIDFormat)
+	dir := filepath.Join(s.root, id)
+	for n := 2; ; n++ {
+		if _, err := s.fs.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		id = fmt.Sprintf("%s-%d", time.Now().Format(runIDFormat), n)
+		dir = filepath.Join(s.root, id)
+	}
+
+	if err := s.fs.MkdirAll(filepath.Join(dir, itemsDir), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create quarantine directory: %v", err)
+	}
+	if err := fsys.WriteFile(s.fs, filepath.Join(dir, manifestName), nil, 0600); err != nil {
+		return nil, fmt.Errorf("failed to create quarantine manifest: %v", err)
+	}
+
+	return &Run{store: s, id: id, dir: dir}, nil
+}
+
+// ID returns the run identifier used by restore
+func (r *Run) ID() string {
+	return r.id
+}
+
+// Count returns the number of items moved into the run so far
+func (r *Run) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.entries
+}
+
+// Move moves path into the run. Its manifest entry is written as pending
+// before the move and confirmed after it, so a crash mid-run still leaves every
+// moved item restorable; when the pending entry cannot be written nothing is
+// moved. When only part of a directory could be moved, that part is recorded
+// and a *PartialMoveError returned.
+func (r *Run) Move(path string, info fs.FileInfo) error {
+	r.mu.Lock()
+	r.sequence++
+	stored := filepath.Join(itemsDir, fmt.Sprintf("%06d_%s", r.sequence, info.Name()))
+	r.mu.Unlock()
+
+	size := info.Size()
+	if info.IsDir() {
+		size = treeSize(r.store.fs, path)
+	}
+	entry := Entry{
+		Original:      path,
+		Stored:        stored,
+		Dir:           info.IsDir(),
+		Size:          size,
+		Mode:          info.Mode(),
+		ModTime:       info.ModTime(),
+		QuarantinedAt: time.Now(),
+		State:         StatePending,
+	}
+	if err := r.record(entry); err != nil {
+		return err
+	}
+
+	moveErr := move(r.store.fs, path, filepath.Join(r.dir, stored))
+	var partial *PartialMoveError
+	if moveErr != nil && !errors.As(moveErr, &partial) {
+		// Should this fail too, the pending entry is dropped on reading as
+		// nothing is stored under its name
+		entry.State = StateFailed
+		r.record(entry)
+		return moveErr
+	}
+	if partial != nil {
+		entry.Size = treeSize(r.store.fs, filepath.Join(r.dir, stored))
+	}
+
+	entry.State, entry.Partial = "", partial != nil
+	r.mu.Lock()
+	r.entries++
+	r.mu.Unlock()
+	// The item is in the run either way: restore treats an entry left pending
+	// as one that may have been moved in part
+	if err := r.record(entry); err != nil {
+		return err
+	}
+	return moveErr
+}
+
+// record appends entry to the manifest
+func (r *Run) record(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file, err := r.store.fs.OpenFile(filepath.Join(r.dir, manifestName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to update quarantine manifest: %v", err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to update quarantine manifest: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to update quarantine manifest: %v", err)
+	}
+	return nil
+}
+
+// Entries reads the manifest of a run
+func (s *Store) Entries(runID string) ([]Entry, error) {
+	data, err := fsys.ReadFile(s.fs, filepath.Join(s.root, runID, manifestName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("quarantine run %s not found", runID)
+		}
+		return nil, fmt.Errorf("failed to read quarantine manifest: %v", err)
+	}
+
+	// Later lines for a stored name replace earlier ones in place
+	var entries []Entry
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("quarantine manifest %s line %d: %v", runID, line, err)
+		}
+		if i, ok := index[entry.Stored]; ok {
+			entries[i] = entry
+			continue
+		}
+		index[entry.Stored] = len(entries)
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// A failed move left nothing behind, and neither did a pending one that
+	// never got to move its item
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.State == StateFailed {
+			continue
+		}
+		if _, err := s.fs.Lstat(filepath.Join(s.root, runID, entry.Stored)); entry.State == StatePending && err != nil && !entry.Restored {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	return kept, nil
+}
+
+// Runs lists the quarantine runs, oldest first
+func (s *Store) Runs() ([]RunInfo, error) {
+	dirs, err := s.fs.ReadDir(s.root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read quarantine directory: %v", err)
+	}
+
+	var runs []RunInfo
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		created, err := time.ParseInLocation(runIDFormat, dir.Name()[:min(len(dir.Name()), len(runIDFormat))], time.Local)
+		if err != nil {
+			continue
+		}
+		entries, err := s.Entries(dir.Name())
+		if err != nil {
+			continue
+		}
+
+		info := RunInfo{ID: dir.Name(), Created: created}
+		for _, entry := range entries {
+			if !entry.Restored {
+				info.Items++
+				info.Bytes += entry.Size
+			}
+		}
+		runs = append(runs, info)
+	}
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].ID < runs[j].ID })
+	return runs, nil
+}
+
+// RestoreResult reports the outcome of a restore
+type RestoreResult struct {
+	Restored  int
+	Conflicts []string
+	Failed    map[string]error
+}
+
+// Restore moves the items of a run whose original path matches pattern back into
+// place. An empty pattern restores everything; a pattern without wildcards
+// restores that path and everything below it. Items whose original path is
+// occupied again are reported as conflicts and left in quarantine.
+func (s *Store) Restore(runID, pattern string) (*RestoreResult, error) {
+	entries, err := s.Entries(runID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RestoreResult{Failed: make(map[string]error)}
+	runDir := filepath.Join(s.root, runID)
+
+	// Newest first: a directory quarantined after its children comes back before them
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := &entries[i]
+		if entry.Restored || !Matches(pattern, entry.Original) {
+			continue
+		}
+
+		stored := filepath.Join(runDir, entry.Stored)
+		if _, err := s.fs.Lstat(entry.Original); err == nil {
+			// What stayed behind of a partial move is merged with what was
+			// moved, as is a directory whose move was never confirmed
+			if !entry.Partial && !(entry.State == StatePending && entry.Dir) {
+				result.Conflicts = append(result.Conflicts, entry.Original)
+				continue
+			}
+			conflicts, err := merge(s.fs, stored, entry.Original)
+			result.Conflicts = append(result.Conflicts, conflicts...)
+			if err != nil {
+				result.Failed[entry.Original] = err
+			}
+			if err != nil || len(conflicts) > 0 {
+				continue
+			}
+			entry.Restored = true
+			result.Restored++
+			continue
+		}
+
+		if err := s.fs.MkdirAll(filepath.Dir(entry.Original), 0755); err != nil {
+			result.Failed[entry.Original] = err
+			continue
+		}
+		if err := move(s.fs, stored, entry.Original); err != nil {
+			result.Failed[entry.Original] = err
+			continue
+		}
+		s.fs.Chtimes(entry.Original, entry.ModTime, entry.ModTime)
+
+		entry.Restored = true
+		result.Restored++
+	}
+
+	if result.Restored > 0 {
+		if err := s.writeManifest(runID, entries); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// writeManifest replaces a run manifest, writing to a temporary file first
+func (s *Store) writeManifest(runID string, entries []Entry) error {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	path := filepath.Join(s.root, runID, manifestName)
+	tmp := path + ".tmp"
+	if err := fsys.WriteFile(s.fs, tmp, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write quarantine manifest: %v", err)
+	}
+	if err := s.fs.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write quarantine manifest: %v", err)
+	}
+	return nil
+}
+
+// Purge deletes quarantine runs created more than olderThan ago and returns their IDs
+func (s *Store) Purge(olderThan time.Duration) ([]string, error) {
+	runs, err := s.Runs()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	var purged []string
+	var lastErr error
+	for _, run := range runs {
+		if !run.Created.Before(cutoff) {
+			continue
+		}
+		if err := s.fs.RemoveAll(filepath.Join(s.root, run.ID)); err != nil {
+			lastErr = fmt.Errorf("failed to purge quarantine run %s: %v", run.ID, err)
+			continue
+		}
+		purged = append(purged, run.ID)
+	}
+	return purged, lastErr
+}
+
+// Matches reports whether original is selected by a restore pattern
+func Matches(pattern, original string) bool {
+	if pattern == "" {
+		return true
+	}
+	if runtime.GOOS == "windows" {
+		pattern = strings.ToLower(pattern)
+		original = strings.ToLower(original)
+	}
+	pattern = filepath.Clean(pattern)
+
+	if !strings.ContainsAny(pattern, "*?[") {
+		return original == pattern || strings.HasPrefix(original, pattern+string(filepath.Separator))
+	}
+	matched, _ := filepath.Match(pattern, original)
+	return matched
+}
+
+// move renames src to dst, copying across volumes when a rename is not possible
+func move(filesystem fsys.FS, src, dst string) error {
+	err := filesystem.Rename(src, dst)
+	if err == nil || !fsys.IsCrossDevice(err) {
+		return err
+	}
+
+	if err := copyTree(filesystem, src, dst); err != nil {
+		// Nothing was removed from src yet, so the copy is not needed
+		filesystem.RemoveAll(dst)
+		return fmt.Errorf("failed to copy %s to quarantine: %v", src, err)
+	}
+	if err := filesystem.RemoveAll(src); err != nil {
+		// Part of src is gone and dst holds its only copy. What is left of src
+		// stays where it is, and dst keeps just the part that was moved.
+		if _, statErr := filesystem.Lstat(src); statErr != nil {
+			return nil
+		}
+		prune(filesystem, src, dst)
+		if _, statErr := filesystem.Lstat(dst); statErr != nil {
+			// Nothing could be removed, so nothing was moved
+			return err
+		}
+		return &PartialMoveError{Path: src, Err: err}
+	}
+	return nil
+}
+
+// prune removes from the copy dst what still exists at src, keeping the
+// directories that src no longer has
+func prune(filesystem fsys.FS, src, dst string) {
+	info, err := filesystem.Lstat(dst)
+	if err != nil {
+		return
+	}
+	if !info.IsDir() {
+		if _, err := filesystem.Lstat(src); err == nil {
+			filesystem.Remove(dst)
+		}
+		return
+	}
+
+	entries, err := filesystem.ReadDir(dst)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		prune(filesystem, filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()))
+	}
+	if _, err := filesystem.Lstat(src); err == nil {
+		// Remove fails while something that was moved is still below dst
+		filesystem.Remove(dst)
+	}
+}
+
+// merge moves the entries below the directory src into the existing directory
+// dst, returning the paths that are occupied again and so left in src
+func merge(filesystem fsys.FS, src, dst string) ([]string, error) {
+	entries, err := filesystem.ReadDir(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []string
+	for _, entry := range entries {
+		from, to := filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())
+		existing, err := filesystem.Lstat(to)
+		switch {
+		case err != nil:
+			if err := move(filesystem, from, to); err != nil {
+				return conflicts, err
+			}
+		case entry.IsDir() && existing.IsDir() && !fsys.IsLink(existing):
+			below, err := merge(filesystem, from, to)
+			conflicts = append(conflicts, below...)
+			if err != nil {
+				return conflicts, err
+			}
+		default:
+			conflicts = append(conflicts, to)
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil, filesystem.Remove(src)
+	}
+	return conflicts, nil
+}
+
+// copyTree copies a file or directory tree, preserving modification times
+func copyTree(filesystem fsys.FS, src, dst string) error {
+	info, err := filesystem.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		if err := copyFile(filesystem, src, dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+		return filesystem.Chtimes(dst, info.ModTime(), info.ModTime())
+	}
+
+	if err := filesystem.MkdirAll(dst, info.Mode().Perm()|0700); err != nil {
+		return err
+	}
+	entries, err := filesystem.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		child := filepath.Join(src, entry.Name())
+		// Copying a link would copy what it points to; the link itself is
+		// unlinked with the rest of src
+		if childInfo, err := filesystem.Lstat(child); err == nil && fsys.IsLink(childInfo) {
+			continue
+		}
+		if err := copyTree(filesystem, child, filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return filesystem.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+func copyFile(filesystem fsys.FS, src, dst string, perm fs.FileMode) error {
+	in, err := filesystem.OpenFile(src, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := filesystem.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// treeSize sums the sizes of the files below path
+func treeSize(filesystem fsys.FS, path string) int64 {
+	var size int64
+	fsys.Walk(filesystem, path, func(_ string, info fs.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
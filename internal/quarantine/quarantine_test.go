@@ -0,0 +1,334 @@
+package quarantine
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nScript/internal/fsys"
+)
+
+func path(parts ...string) string {
+	return filepath.Join(append([]string{string(filepath.Separator), "home", "student"}, parts...)...)
+}
+
+var storeRoot = filepath.Join(string(filepath.Separator), "ProgramData", "nScript", "quarantine")
+
+func moveAll(t *testing.T, mem *fsys.Mem, run *Run, paths ...string) {
+	t.Helper()
+	for _, p := range paths {
+		info, err := mem.Stat(p)
+		if err != nil {
+			t.Fatalf("Stat %s: %v", p, err)
+		}
+		if err := run.Move(p, info); err != nil {
+			t.Fatalf("Move %s: %v", p, err)
+		}
+	}
+}
+
+func TestMoveAndRestore(t *testing.T) {
+	mem := fsys.NewMem()
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	mem.AddFile(path("Downloads", "setup.exe"), []byte("binary"), modTime)
+	mem.AddFile(path("Documents", "game", "save.dat"), []byte("save"), modTime)
+	mem.AddFile(path("Documents", "game", "config.ini"), []byte("cfg"), modTime)
+	mem.AddDir(path("Documents", "game"), modTime)
+	mem.AddDir(storeRoot, modTime)
+
+	store := NewStore(mem, storeRoot)
+	run, err := store.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+
+	// A child first, then its parent, as the cleaner's deepest-first batches do
+	moveAll(t, mem, run, path("Downloads", "setup.exe"), path("Documents", "game", "save.dat"), path("Documents", "game"))
+
+	if mem.Exists(path("Downloads", "setup.exe")) || mem.Exists(path("Documents", "game")) {
+		t.Fatal("quarantined items still at their original paths")
+	}
+	if run.Count() != 3 {
+		t.Errorf("Count = %d, want 3", run.Count())
+	}
+
+	entries, err := store.Entries(run.ID())
+	if err != nil {
+		t.Fatalf("Entries: %v", err)
+	}
+	if len(entries) != 3 || entries[0].Original != path("Downloads", "setup.exe") || entries[0].Size != 6 || !entries[0].ModTime.Equal(modTime) {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if !entries[2].Dir || entries[2].Size != 3 {
+		t.Errorf("directory entry = %+v, want dir with 3 bytes", entries[2])
+	}
+
+	result, err := store.Restore(run.ID(), "")
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if result.Restored != 3 || len(result.Conflicts) != 0 || len(result.Failed) != 0 {
+		t.Fatalf("Restore result = %+v", result)
+	}
+	for _, p := range []string{path("Downloads", "setup.exe"), path("Documents", "game", "save.dat"), path("Documents", "game", "config.ini")} {
+		info, err := mem.Stat(p)
+		if err != nil {
+			t.Errorf("%s not restored: %v", p, err)
+			continue
+		}
+		if !info.ModTime().Equal(modTime) {
+			t.Errorf("%s mtime = %v, want %v", p, info.ModTime(), modTime)
+		}
+	}
+
+	// Restored entries are not restored twice
+	result, err = store.Restore(run.ID(), "")
+	if err != nil || result.Restored != 0 {
+		t.Errorf("second Restore = %+v, %v", result, err)
+	}
+}
+
+func TestRestorePatternAndConflicts(t *testing.T) {
+	mem := fsys.NewMem()
+	now := time.Now()
+	mem.AddFile(path("Downloads", "a.zip"), nil, now)
+	mem.AddFile(path("Downloads", "b.exe"), nil, now)
+	mem.AddFile(path("Desktop", "c.zip"), nil, now)
+
+	store := NewStore(mem, storeRoot)
+	run, err := store.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	moveAll(t, mem, run, path("Downloads", "a.zip"), path("Downloads", "b.exe"), path("Desktop", "c.zip"))
+
+	result, err := store.Restore(run.ID(), filepath.Join(path("Downloads"), "*.zip"))
+	if err != nil || result.Restored != 1 {
+		t.Fatalf("glob Restore = %+v, %v", result, err)
+	}
+	if !mem.Exists(path("Downloads", "a.zip")) || mem.Exists(path("Downloads", "b.exe")) {
+		t.Error("glob restored the wrong items")
+	}
+
+	// The user recreated c.zip since the run; it must not be overwritten
+	mem.AddFile(path("Desktop", "c.zip"), []byte("new"), now)
+	result, err = store.Restore(run.ID(), path("Desktop"))
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if result.Restored != 0 || len(result.Conflicts) != 1 || result.Conflicts[0] != path("Desktop", "c.zip") {
+		t.Errorf("conflict Restore = %+v", result)
+	}
+	if info, _ := mem.Stat(path("Desktop", "c.zip")); info.Size() != 3 {
+		t.Error("conflicting file was overwritten")
+	}
+}
+
+func TestMoveAcrossVolumes(t *testing.T) {
+	mem := fsys.NewMem()
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	mem.AddFile(path("Games", "Steam", "steam.exe"), []byte("exe"), modTime)
+	mem.AddFile(path("Games", "Steam", "logs", "log.txt"), []byte("log"), modTime)
+	mem.SplitDevice(path("Games"))
+
+	store := NewStore(mem, storeRoot)
+	run, err := store.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	moveAll(t, mem, run, path("Games", "Steam"))
+
+	if mem.Exists(path("Games", "Steam")) {
+		t.Fatal("source still exists after cross-volume move")
+	}
+
+	if result, err := store.Restore(run.ID(), ""); err != nil || result.Restored != 1 {
+		t.Fatalf("Restore = %+v, %v", result, err)
+	}
+	data, err := fsys.ReadFile(mem, path("Games", "Steam", "logs", "log.txt"))
+	if err != nil || string(data) != "log" {
+		t.Errorf("restored log.txt = %q, %v", data, err)
+	}
+	if info, _ := mem.Stat(path("Games", "Steam", "steam.exe")); !info.ModTime().Equal(modTime) {
+		t.Errorf("restored mtime = %v, want %v", info.ModTime(), modTime)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	mem := fsys.NewMem()
+	old := time.Now().Add(-40 * 24 * time.Hour).Format(runIDFormat)
+	recent := time.Now().Add(-2 * 24 * time.Hour).Format(runIDFormat)
+	for _, id := range []string{old, recent} {
+		mem.AddFile(filepath.Join(storeRoot, id, manifestName), nil, time.Now())
+	}
+	mem.AddDir(filepath.Join(storeRoot, "not-a-run"), time.Now())
+
+	store := NewStore(mem, storeRoot)
+	purged, err := store.Purge(30 * 24 * time.Hour)
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if len(purged) != 1 || purged[0] != old {
+		t.Errorf("purged = %v, want [%s]", purged, old)
+	}
+	if mem.Exists(filepath.Join(storeRoot, old)) || !mem.Exists(filepath.Join(storeRoot, recent)) || !mem.Exists(filepath.Join(storeRoot, "not-a-run")) {
+		t.Error("Purge removed the wrong directories")
+	}
+
+	runs, err := store.Runs()
+	if err != nil || len(runs) != 1 || runs[0].ID != recent {
+		t.Errorf("Runs = %+v, %v", runs, err)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		pattern, original string
+		want              bool
+	}{
+		{"", path("a.txt"), true},
+		{path("Downloads"), path("Downloads", "x", "y.txt"), true},
+		{path("Downloads"), path("DownloadsOld", "y.txt"), false},
+		{filepath.Join(path("Downloads"), "*.txt"), path("Downloads", "y.txt"), true},
+		{filepath.Join(path("Downloads"), "*.txt"), path("Downloads", "x", "y.txt"), false},
+	}
+	for _, tt := range tests {
+		if got := Matches(tt.pattern, tt.original); got != tt.want {
+			t.Errorf("Matches(%q, %q) = %v, want %v", tt.pattern, tt.original, got, tt.want)
+		}
+	}
+}
+
+func TestPartialMoveAcrossVolumes(t *testing.T) {
+	mem := fsys.NewMem()
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	mem.AddFile(path("Games", "Steam", "steam.exe"), []byte("exe"), modTime)
+	mem.AddFile(path("Games", "Steam", "logs", "log.txt"), []byte("log"), modTime)
+	mem.AddFile(path("Games", "Steam", "cache", "a.bin"), []byte("aaaa"), modTime)
+	mem.SplitDevice(path("Games"))
+	// The locked file stops the removal of the original halfway
+	mem.Lock(path("Games", "Steam", "steam.exe"))
+
+	store := NewStore(mem, storeRoot)
+	run, err := store.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	info, _ := mem.Stat(path("Games", "Steam"))
+	err = run.Move(path("Games", "Steam"), info)
+	var partial *PartialMoveError
+	if !errors.As(err, &partial) || partial.Path != path("Games", "Steam") {
+		t.Fatalf("Move = %v, want a partial move", err)
+	}
+
+	// The moved files survive in quarantine, recorded with just their size
+	entries, err := store.Entries(run.ID())
+	if err != nil || len(entries) != 1 || !entries[0].Partial || entries[0].Size != 7 {
+		t.Fatalf("entries = %+v, %v", entries, err)
+	}
+	stored := filepath.Join(storeRoot, run.ID(), entries[0].Stored)
+	for _, p := range []string{filepath.Join(stored, "logs", "log.txt"), filepath.Join(stored, "cache", "a.bin")} {
+		if !mem.Exists(p) {
+			t.Errorf("%s was not kept in quarantine", p)
+		}
+	}
+	if mem.Exists(filepath.Join(stored, "steam.exe")) || !mem.Exists(path("Games", "Steam", "steam.exe")) {
+		t.Error("the file left in place is not only at its original path")
+	}
+
+	// Restoring merges the moved part back with what stayed
+	result, err := store.Restore(run.ID(), "")
+	if err != nil || result.Restored != 1 || len(result.Conflicts) != 0 || len(result.Failed) != 0 {
+		t.Fatalf("Restore = %+v, %v", result, err)
+	}
+	for _, p := range []string{path("Games", "Steam", "steam.exe"), path("Games", "Steam", "logs", "log.txt"), path("Games", "Steam", "cache", "a.bin")} {
+		if !mem.Exists(p) {
+			t.Errorf("%s not restored", p)
+		}
+	}
+}
+
+func TestFailedMoveKeepsNothing(t *testing.T) {
+	mem := fsys.NewMem()
+	mem.AddFile(path("Games", "save.dat"), []byte("save"), time.Now())
+	mem.SplitDevice(path("Games"))
+	mem.Lock(path("Games", "save.dat"))
+
+	store := NewStore(mem, storeRoot)
+	run, err := store.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	info, _ := mem.Stat(path("Games", "save.dat"))
+	var partial *PartialMoveError
+	if err := run.Move(path("Games", "save.dat"), info); err == nil || errors.As(err, &partial) {
+		t.Fatalf("Move = %v, want a plain failure", err)
+	}
+	if entries, _ := store.Entries(run.ID()); len(entries) != 0 {
+		t.Errorf("entries = %+v, want none", entries)
+	}
+}
+
+func TestManifestFailureMovesNothing(t *testing.T) {
+	mem := fsys.NewMem()
+	mem.AddFile(path("Downloads", "setup.exe"), []byte("binary"), time.Now())
+
+	store := NewStore(mem, storeRoot)
+	run, err := store.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	mem.Lock(filepath.Join(storeRoot, run.ID(), manifestName))
+
+	info, _ := mem.Stat(path("Downloads", "setup.exe"))
+	if err := run.Move(path("Downloads", "setup.exe"), info); err == nil {
+		t.Fatal("Move without a writable manifest = nil, want error")
+	}
+	if !mem.Exists(path("Downloads", "setup.exe")) {
+		t.Error("the item was moved although its manifest entry could not be written")
+	}
+	if items, _ := mem.ReadDir(filepath.Join(storeRoot, run.ID(), itemsDir)); len(items) != 0 || run.Count() != 0 {
+		t.Errorf("%d items stored, Count = %d, want none", len(items), run.Count())
+	}
+}
+
+func TestUnconfirmedMoveIsRestorable(t *testing.T) {
+	mem := fsys.NewMem()
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	mem.AddFile(path("Downloads", "setup.exe"), []byte("binary"), modTime)
+	mem.AddFile(path("Downloads", "notes.txt"), []byte("notes"), modTime)
+
+	store := NewStore(mem, storeRoot)
+	run, err := store.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	moveAll(t, mem, run, path("Downloads", "setup.exe"))
+
+	// A crash right after the move leaves only the pending entry, and one
+	// before the move a pending entry with nothing stored under it
+	manifest := filepath.Join(storeRoot, run.ID(), manifestName)
+	data, err := fsys.ReadFile(mem, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, _, _ := strings.Cut(string(data), "\n")
+	never := strings.ReplaceAll(strings.ReplaceAll(pending, "setup.exe", "notes.txt"), "000001_", "000002_")
+	if err := fsys.WriteFile(mem, manifest, []byte(pending+"\n"+never+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := store.Entries(run.ID())
+	if err != nil || len(entries) != 1 || entries[0].State != StatePending || entries[0].Original != path("Downloads", "setup.exe") {
+		t.Fatalf("entries = %+v, %v, want setup.exe pending", entries, err)
+	}
+	result, err := store.Restore(run.ID(), "")
+	if err != nil || result.Restored != 1 || len(result.Conflicts) != 0 || len(result.Failed) != 0 {
+		t.Fatalf("Restore = %+v, %v", result, err)
+	}
+	if !mem.Exists(path("Downloads", "setup.exe")) || !mem.Exists(path("Downloads", "notes.txt")) {
+		t.Error("restore did not bring back the moved item or touched the one never moved")
+	}
+}
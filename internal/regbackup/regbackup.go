@@ -0,0 +1,411 @@
+// Package regbackup keeps the registry backups of each run together: while a run
+// is open its .reg files are written to a staging directory, and closing the run
+// packs them into one zip archive with a manifest.
+package regbackup
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"nScript/internal/fsys"
+	"nScript/internal/regfile"
+)
+
+const (
+	manifestName = "manifest.json"
+	journalName  = "manifest.jsonl"
+	archiveExt   = ".zip"
+	runIDFormat  = "20060102-150405"
+
+	// maxNameLength keeps backup file names of deep keys well below MAX_PATH
+	maxNameLength = 120
+)
+
+// Entry is one backed-up key
+type Entry struct {
+	Key        string    `json:"key"`
+	File       string    `json:"file"`
+	BackedUpAt time.Time `json:"backedUpAt"`
+}
+
+// Manifest lists the backups of one run in the order they were taken
+type Manifest struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Entries []Entry   `json:"entries"`
+}
+
+// RunInfo summarizes a backup run
+type RunInfo struct {
+	ID      string
+	Created time.Time
+	Entries int
+	Size    int64
+	// Incomplete runs were never archived, usually because nScript was killed mid-run
+	Incomplete bool
+}
+
+// Store is a directory holding one archive per run
+type Store struct {
+	fs   fsys.FS
+	root string
+}
+
+// DefaultRoot returns the backup location under ProgramData
+func DefaultRoot() string {
+	base := os.Getenv("ProgramData")
+	if base == "" {
+		base = os.TempDir()
+	}
+	return filepath.Join(base, "nScript", "registry-backups")
+}
+
+// NewStore opens the backup store rooted at root
+func NewStore(filesystem fsys.FS, root string) *Store {
+	return &Store{fs: filesystem, root: root}
+}
+
+// Root returns the store directory
+func (s *Store) Root() string {
+	return s.root
+}
+
+// ArchivePath returns the archive of a run
+func (s *Store) ArchivePath(id string) string {
+	return filepath.Join(s.root, id+archiveExt)
+}
+
+// Run is an open backup run that .reg files are added to
+type Run struct {
+	store   *Store
+	id      string
+	dir     string
+	created time.Time
+	entries []Entry
+}
+
+// Begin starts a new backup run named after the current time
+func (s *Store) Begin() (*Run, error) {
+	created := time.Now()
+	id := created.Format(runIDFormat)
+	for n := 2; s.exists(id); n++ {
+		id = fmt.Sprintf("%s-%d", created.Format(runIDFormat), n)
+	}
+
+	dir := filepath.Join(s.root, id)
+	if err := s.fs.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %v", err)
+	}
+	return &Run{store: s, id: id, dir: dir, created: created}, nil
+}
+
+// exists reports whether a run with this ID is archived or staged
+func (s *Store) exists(id string) bool {
+	for _, path := range []string{filepath.Join(s.root, id), s.ArchivePath(id)} {
+		if _, err := s.fs.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+			return true
+		}
+	}
+	return false
+}
+
+// ID returns the run identifier used by restore-registry and backups
+func (r *Run) ID() string {
+	return r.id
+}
+
+// Add writes the backup of key to the staging directory and returns the file
+// name it has in the archive. The journal is appended one line per backup so a
+// crash mid-run still leaves every backup restorable.
+func (r *Run) Add(key string, f *regfile.File) (string, error) {
+	name := fmt.Sprintf("%03d_%s.reg", len(r.entries)+1, fileName(key))
+
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		return "", fmt.Errorf("failed to encode backup: %v", err)
+	}
+	if err := fsys.WriteFile(r.store.fs, filepath.Join(r.dir, name), buf.Bytes(), 0600); err != nil {
+		return "", fmt.Errorf("failed to write backup file: %v", err)
+	}
+
+	entry := Entry{Key: key, File: name, BackedUpAt: time.Now()}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	journal, err := r.store.fs.OpenFile(filepath.Join(r.dir, journalName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to update backup manifest: %v", err)
+	}
+	_, err = journal.Write(append(line, '\n'))
+	if closeErr := journal.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to update backup manifest: %v", err)
+	}
+
+	r.entries = append(r.entries, entry)
+	return name, nil
+}
+
+// Len returns the number of backups in the run
+func (r *Run) Len() int {
+	return len(r.entries)
+}
+
+// Close packs the run into its archive and removes the staging directory. A run
+// without backups leaves nothing behind and returns an empty path.
+func (r *Run) Close() (string, error) {
+	if len(r.entries) == 0 {
+		return "", r.store.fs.RemoveAll(r.dir)
+	}
+
+	manifest := Manifest{ID: r.id, Created: r.created, Entries: r.entries}
+	if err := r.store.archive(r.dir, manifest); err != nil {
+		return "", err
+	}
+	if err := r.store.fs.RemoveAll(r.dir); err != nil {
+		return "", fmt.Errorf("failed to remove backup staging directory: %v", err)
+	}
+	return r.store.ArchivePath(r.id), nil
+}
+
+// archive writes the manifest and the staged .reg files into the run's archive,
+// through a temporary file so a failure never leaves a truncated archive
+func (s *Store) archive(dir string, manifest Manifest) error {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := addToZip(zw, manifestName, manifest.Created, data); err != nil {
+		return err
+	}
+	for _, entry := range manifest.Entries {
+		data, err := fsys.ReadFile(s.fs, filepath.Join(dir, entry.File))
+		if err != nil {
+			return fmt.Errorf("failed to read backup file: %v", err)
+		}
+		if err := addToZip(zw, entry.File, entry.BackedUpAt, data); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write backup archive: %v", err)
+	}
+
+	path := s.ArchivePath(manifest.ID)
+	tmp := path + ".tmp"
+	if err := fsys.WriteFile(s.fs, tmp, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write backup archive: %v", err)
+	}
+	if err := s.fs.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write backup archive: %v", err)
+	}
+	return nil
+}
+
+// addToZip adds one compressed file to an archive
+func addToZip(zw *zip.Writer, name string, modified time.Time, data []byte) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return fmt.Errorf("failed to write backup archive: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write backup archive: %v", err)
+	}
+	return nil
+}
+
+// fileName turns a key path into a file name
+func fileName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`\/:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, key)
+	if len(name) > maxNameLength {
+		name = name[len(name)-maxNameLength:]
+	}
+	return name
+}
+
+// Runs lists the backup runs, oldest first
+func (s *Store) Runs() ([]RunInfo, error) {
+	entries, err := s.fs.ReadDir(s.root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read backup directory: %v", err)
+	}
+
+	var runs []RunInfo
+	for _, entry := range entries {
+		id, archived := strings.CutSuffix(entry.Name(), archiveExt)
+		if archived == entry.IsDir() {
+			continue
+		}
+		created, ok := parseID(id)
+		if !ok {
+			continue
+		}
+		manifest, err := s.Manifest(id)
+		if err != nil {
+			continue
+		}
+
+		info := RunInfo{ID: id, Created: created, Entries: len(manifest.Entries), Incomplete: !archived}
+		if archived {
+			if stat, err := s.fs.Stat(s.ArchivePath(id)); err == nil {
+				info.Size = stat.Size()
+			}
+		}
+		runs = append(runs, info)
+	}
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].ID < runs[j].ID })
+	return runs, nil
+}
+
+// parseID returns the creation time encoded in a run ID
+func parseID(id string) (time.Time, bool) {
+	created, err := time.ParseInLocation(runIDFormat, id[:min(len(id), len(runIDFormat))], time.Local)
+	return created, err == nil
+}
+
+// Manifest reads the manifest of an archived run, or the journal of an incomplete one
+func (s *Store) Manifest(id string) (*Manifest, error) {
+	zr, err := s.openArchive(id)
+	if err == nil {
+		data, err := readZipFile(zr, manifestName)
+		if err != nil {
+			return nil, err
+		}
+		var manifest Manifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("backup %s: invalid manifest: %v", id, err)
+		}
+		return &manifest, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	data, err := fsys.ReadFile(s.fs, filepath.Join(s.root, id, journalName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("registry backup %s not found", id)
+		}
+		return nil, fmt.Errorf("failed to read backup manifest: %v", err)
+	}
+
+	manifest := &Manifest{ID: id}
+	manifest.Created, _ = parseID(id)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("backup manifest %s line %d: %v", id, line, err)
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+	return manifest, scanner.Err()
+}
+
+// ReadFile returns one .reg file of a run
+func (s *Store) ReadFile(id, name string) ([]byte, error) {
+	if name != filepath.Base(name) || name == manifestName || name == journalName {
+		return nil, fmt.Errorf("invalid backup file name %q", name)
+	}
+
+	zr, err := s.openArchive(id)
+	if err == nil {
+		return readZipFile(zr, name)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	data, err := fsys.ReadFile(s.fs, filepath.Join(s.root, id, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup file: %v", err)
+	}
+	return data, nil
+}
+
+// openArchive opens the archive of a run; a run without one returns fs.ErrNotExist
+func (s *Store) openArchive(id string) (*zip.Reader, error) {
+	if id == "" || id != filepath.Base(id) {
+		return nil, fmt.Errorf("invalid backup ID %q", id)
+	}
+	data, err := fsys.ReadFile(s.fs, s.ArchivePath(id))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read backup archive: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("backup %s: invalid archive: %v", id, err)
+	}
+	return zr, nil
+}
+
+// readZipFile reads one file of an archive
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	f, err := zr.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("backup file %s not found in archive", name)
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// Prune deletes the runs beyond the newest keep and the runs created more than
+// maxAge ago, and returns their IDs. A zero limit is not applied.
+func (s *Store) Prune(keep int, maxAge time.Duration) ([]string, error) {
+	runs, err := s.Runs()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	var pruned []string
+	var lastErr error
+	for i, run := range runs {
+		tooMany := keep > 0 && i < len(runs)-keep
+		tooOld := maxAge > 0 && run.Created.Before(cutoff)
+		if !tooMany && !tooOld {
+			continue
+		}
+		path := s.ArchivePath(run.ID)
+		if run.Incomplete {
+			path = filepath.Join(s.root, run.ID)
+		}
+		if err := s.fs.RemoveAll(path); err != nil {
+			lastErr = fmt.Errorf("failed to prune registry backup %s: %v", run.ID, err)
+			continue
+		}
+		pruned = append(pruned, run.ID)
+	}
+	return pruned, lastErr
+}
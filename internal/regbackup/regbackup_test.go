@@ -0,0 +1,148 @@
+package regbackup
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"nScript/internal/fsys"
+	"nScript/internal/regfile"
+)
+
+var storeRoot = filepath.Join(string(filepath.Separator), "ProgramData", "nScript", "registry-backups")
+
+func backupOf(key string) *regfile.File {
+	return &regfile.File{Keys: []regfile.Key{{Path: key, Values: []regfile.Value{regfile.DWordValue("Count", 1)}}}}
+}
+
+func TestRunArchive(t *testing.T) {
+	mem := fsys.NewMem()
+	store := NewStore(mem, storeRoot)
+
+	run, err := store.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	keys := []string{`HKCU\Software\Microsoft\Windows\CurrentVersion\Explorer\RunMRU`, `HKCU\Software\x`}
+	var files []string
+	for _, key := range keys {
+		name, err := run.Add(key, backupOf(key))
+		if err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		files = append(files, name)
+	}
+	if files[0] != "001_HKCU_Software_Microsoft_Windows_CurrentVersion_Explorer_RunMRU.reg" {
+		t.Errorf("file name = %s", files[0])
+	}
+
+	archive, err := run.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if archive != store.ArchivePath(run.ID()) || !mem.Exists(archive) || mem.Exists(filepath.Join(storeRoot, run.ID())) {
+		t.Fatalf("archive %s not written or staging directory left behind", archive)
+	}
+
+	manifest, err := store.Manifest(run.ID())
+	if err != nil {
+		t.Fatalf("Manifest: %v", err)
+	}
+	if manifest.ID != run.ID() || len(manifest.Entries) != 2 || manifest.Entries[1].Key != keys[1] || manifest.Entries[1].File != files[1] {
+		t.Errorf("manifest = %+v", manifest)
+	}
+
+	data, err := store.ReadFile(run.ID(), files[0])
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	f, err := regfile.Parse(data)
+	if err != nil || len(f.Keys) != 1 || len(f.Keys[0].Values) != 1 || f.Keys[0].Values[0].Uint64() != 1 {
+		t.Errorf("archived backup = %+v, %v", f, err)
+	}
+	if _, err := store.ReadFile(run.ID(), manifestName); err == nil {
+		t.Error("ReadFile returned the manifest")
+	}
+
+	runs, err := store.Runs()
+	if err != nil || len(runs) != 1 || runs[0].Entries != 2 || runs[0].Incomplete || runs[0].Size == 0 {
+		t.Errorf("Runs = %+v, %v", runs, err)
+	}
+
+	// A run without backups leaves nothing behind
+	empty, err := store.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if empty.ID() == run.ID() {
+		t.Error("second run in the same second reused the ID")
+	}
+	if archive, err := empty.Close(); err != nil || archive != "" || mem.Exists(filepath.Join(storeRoot, empty.ID())) {
+		t.Errorf("empty run Close = %q, %v", archive, err)
+	}
+}
+
+func TestIncompleteRun(t *testing.T) {
+	mem := fsys.NewMem()
+	store := NewStore(mem, storeRoot)
+	run, err := store.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	name, err := run.Add(`HKCU\Software\x`, backupOf(`HKCU\Software\x`))
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	// The run is never closed, as when nScript is killed mid-run
+	runs, err := store.Runs()
+	if err != nil || len(runs) != 1 || !runs[0].Incomplete || runs[0].Entries != 1 {
+		t.Fatalf("Runs = %+v, %v", runs, err)
+	}
+	if _, err := store.ReadFile(run.ID(), name); err != nil {
+		t.Errorf("ReadFile of a staged backup: %v", err)
+	}
+	if _, err := store.Manifest("20200101-000000"); err == nil {
+		t.Error("Manifest of a missing run succeeded")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	mem := fsys.NewMem()
+	store := NewStore(mem, storeRoot)
+
+	// Archive one run per age, renaming each to an ID from the past
+	var ids []string
+	for _, days := range []int{200, 60, 30, 2, 1} {
+		run, err := store.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		run.Add(`HKCU\Software\x`, backupOf(`HKCU\Software\x`))
+		archive, err := run.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := time.Now().Add(-time.Duration(days) * 24 * time.Hour).Format(runIDFormat)
+		if err := mem.Rename(archive, store.ArchivePath(id)); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	mem.AddFile(filepath.Join(storeRoot, "notes.txt"), nil, time.Now())
+
+	pruned, err := store.Prune(0, 90*24*time.Hour)
+	if err != nil || !slices.Equal(pruned, ids[:1]) {
+		t.Errorf("Prune by age = %v, %v, want %v", pruned, err, ids[:1])
+	}
+	pruned, err = store.Prune(2, 0)
+	if err != nil || !slices.Equal(pruned, ids[1:3]) {
+		t.Errorf("Prune by count = %v, %v, want %v", pruned, err, ids[1:3])
+	}
+
+	runs, _ := store.Runs()
+	if len(runs) != 2 || runs[0].ID != ids[3] || !mem.Exists(filepath.Join(storeRoot, "notes.txt")) {
+		t.Errorf("Runs after prune = %+v", runs)
+	}
+}
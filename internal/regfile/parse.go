@@ -0,0 +1,222 @@
+package regfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse reads a REGEDIT5 file encoded as UTF-16LE with a byte order mark, as
+// regedit writes it, or as UTF-8. Root names may be given in long or short form;
+// key paths are returned with the long form.
+func Parse(data []byte) (*File, error) {
+	lines := joinContinuations(decode(data))
+
+	f := &File{}
+	header := false
+	for _, l := range lines {
+		text := strings.TrimSpace(l.text)
+		if text == "" || strings.HasPrefix(text, ";") {
+			continue
+		}
+		if !header {
+			if text != Header {
+				return nil, fmt.Errorf("line %d: not a REGEDIT5 file, expected %q", l.number, Header)
+			}
+			header = true
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+			key, err := parseKey(text)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", l.number, err)
+			}
+			f.Keys = append(f.Keys, key)
+			continue
+		}
+
+		if len(f.Keys) == 0 || f.Keys[len(f.Keys)-1].Delete {
+			return nil, fmt.Errorf("line %d: value outside of a key", l.number)
+		}
+		value, err := parseValue(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", l.number, err)
+		}
+		key := &f.Keys[len(f.Keys)-1]
+		key.Values = append(key.Values, value)
+	}
+
+	if !header {
+		return nil, errors.New("empty file")
+	}
+	return f, nil
+}
+
+// line is one logical line and the physical line number it starts on
+type line struct {
+	number int
+	text   string
+}
+
+// decode turns the file bytes into text, detecting UTF-16LE by its byte order mark
+func decode(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		return decodeUTF16(data[2:])
+	case bytes.HasPrefix(data, []byte{0xef, 0xbb, 0xbf}):
+		return string(data[3:])
+	}
+	return string(data)
+}
+
+// joinContinuations joins lines ending in a backslash with the line after them
+func joinContinuations(text string) []line {
+	var lines []line
+	var current *line
+	for i, raw := range strings.Split(text, "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		if current != nil {
+			current.text += strings.TrimLeft(raw, " \t")
+		} else {
+			lines = append(lines, line{number: i + 1, text: raw})
+			current = &lines[len(lines)-1]
+		}
+		if trimmed := strings.TrimRight(current.text, " \t"); strings.HasSuffix(trimmed, `\`) {
+			current.text = strings.TrimSuffix(trimmed, `\`)
+		} else {
+			current = nil
+		}
+	}
+	return lines
+}
+
+// parseKey parses [path] and [-path]
+func parseKey(text string) (Key, error) {
+	if !strings.HasSuffix(text, "]") {
+		return Key{}, fmt.Errorf("unterminated key %s", text)
+	}
+	path := text[1 : len(text)-1]
+	var key Key
+	if strings.HasPrefix(path, "-") {
+		key.Delete = true
+		path = path[1:]
+	}
+	root, subkey, err := SplitPath(path)
+	if err != nil {
+		return Key{}, err
+	}
+	key.Path = root
+	if subkey != "" {
+		key.Path += `\` + subkey
+	}
+	return key, nil
+}
+
+// parseValue parses "name"=data and @=data
+func parseValue(text string) (Value, error) {
+	var v Value
+	var rest string
+	switch {
+	case strings.HasPrefix(text, "@"):
+		rest = text[1:]
+	case strings.HasPrefix(text, `"`):
+		name, n, err := unquote(text)
+		if err != nil {
+			return Value{}, err
+		}
+		v.Name, rest = name, text[n:]
+	default:
+		return Value{}, fmt.Errorf("expected a value name: %s", text)
+	}
+
+	rest = strings.TrimSpace(rest)
+	if !strings.HasPrefix(rest, "=") {
+		return Value{}, fmt.Errorf("expected = after value name %q", v.Name)
+	}
+	data := strings.TrimSpace(rest[1:])
+
+	switch {
+	case data == "-":
+		v.Delete = true
+	case strings.HasPrefix(data, `"`):
+		s, n, err := unquote(data)
+		if err != nil {
+			return Value{}, err
+		}
+		if strings.TrimSpace(data[n:]) != "" {
+			return Value{}, fmt.Errorf("unexpected text after string value %q", v.Name)
+		}
+		v.Type, v.Data = SZ, encodeUTF16(s, true)
+	case strings.HasPrefix(data, "dword:"):
+		n, err := strconv.ParseUint(data[len("dword:"):], 16, 32)
+		if err != nil {
+			return Value{}, fmt.Errorf("invalid dword for %q: %v", v.Name, err)
+		}
+		v.Type, v.Data = DWord, binary.LittleEndian.AppendUint32(nil, uint32(n))
+	case strings.HasPrefix(data, "hex"):
+		typ, raw, err := parseHex(data)
+		if err != nil {
+			return Value{}, fmt.Errorf("invalid hex data for %q: %v", v.Name, err)
+		}
+		v.Type, v.Data = typ, raw
+	default:
+		return Value{}, fmt.Errorf("unsupported data for %q: %s", v.Name, data)
+	}
+	return v, nil
+}
+
+// unquote reads a quoted string at the start of text and returns it with the
+// number of bytes consumed
+func unquote(text string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 < len(text) {
+				i++
+			}
+		}
+		b.WriteByte(text[i])
+	}
+	return "", 0, fmt.Errorf("unterminated string: %s", text)
+}
+
+// parseHex parses hex:.. (REG_BINARY) and hex(type):..
+func parseHex(data string) (ValueType, []byte, error) {
+	typ := Binary
+	prefix, list, ok := strings.Cut(data, ":")
+	if !ok {
+		return 0, nil, errors.New("missing ':'")
+	}
+	if prefix != "hex" {
+		inner, found := strings.CutPrefix(prefix, "hex(")
+		inner, closed := strings.CutSuffix(inner, ")")
+		if !found || !closed {
+			return 0, nil, fmt.Errorf("invalid type %s", prefix)
+		}
+		n, err := strconv.ParseUint(inner, 16, 32)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid type %s", prefix)
+		}
+		typ = ValueType(n)
+	}
+
+	var out []byte
+	if list = strings.TrimSpace(list); list == "" {
+		return typ, out, nil
+	}
+	for _, item := range strings.Split(list, ",") {
+		b, err := strconv.ParseUint(strings.TrimSpace(item), 16, 8)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid byte %q", item)
+		}
+		out = append(out, byte(b))
+	}
+	return typ, out, nil
+}
@@ -0,0 +1,159 @@
+// Package regfile reads and writes registry exports in the Windows .reg
+// (REGEDIT5) format. It only deals with text and raw value bytes, so it builds
+// and is tested on every platform.
+package regfile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Header is the first line of a REGEDIT5 file
+const Header = "Windows Registry Editor Version 5.00"
+
+// ValueType is a registry value type as stored by Windows
+type ValueType uint32
+
+// Registry value types
+const (
+	None     ValueType = 0
+	SZ       ValueType = 1
+	ExpandSZ ValueType = 2
+	Binary   ValueType = 3
+	DWord    ValueType = 4
+	MultiSZ  ValueType = 7
+	QWord    ValueType = 11
+)
+
+// File is the content of one .reg file
+type File struct {
+	Keys []Key
+}
+
+// Key is a registry key with its values. Path starts with the root, e.g.
+// HKEY_CURRENT_USER\Software\Microsoft. Delete marks a [-key] entry that
+// removes the key and everything below it.
+type Key struct {
+	Path   string
+	Values []Value
+	Delete bool
+}
+
+// Value is a registry value. Data holds the bytes exactly as the registry
+// stores them: UTF-16LE with terminating NULs for strings, little-endian for numbers.
+// An empty Name is the key's default value, and Delete marks a "name"=- entry.
+type Value struct {
+	Name   string
+	Type   ValueType
+	Data   []byte
+	Delete bool
+}
+
+// Roots maps the long and short names of the predefined roots to their long name
+var Roots = map[string]string{
+	"HKEY_CLASSES_ROOT":   "HKEY_CLASSES_ROOT",
+	"HKEY_CURRENT_USER":   "HKEY_CURRENT_USER",
+	"HKEY_LOCAL_MACHINE":  "HKEY_LOCAL_MACHINE",
+	"HKEY_USERS":          "HKEY_USERS",
+	"HKEY_CURRENT_CONFIG": "HKEY_CURRENT_CONFIG",
+	"HKCR":                "HKEY_CLASSES_ROOT",
+	"HKCU":                "HKEY_CURRENT_USER",
+	"HKLM":                "HKEY_LOCAL_MACHINE",
+	"HKU":                 "HKEY_USERS",
+	"HKCC":                "HKEY_CURRENT_CONFIG",
+}
+
+// SplitPath splits a key path into its long root name and the path below the root
+func SplitPath(path string) (root, subkey string, err error) {
+	first, rest, _ := strings.Cut(path, `\`)
+	root, ok := Roots[strings.ToUpper(first)]
+	if !ok {
+		return "", "", fmt.Errorf("unknown registry root %q", first)
+	}
+	return root, rest, nil
+}
+
+// String returns a REG_SZ value
+func String(name, s string) Value {
+	return Value{Name: name, Type: SZ, Data: encodeUTF16(s, true)}
+}
+
+// ExpandString returns a REG_EXPAND_SZ value
+func ExpandString(name, s string) Value {
+	return Value{Name: name, Type: ExpandSZ, Data: encodeUTF16(s, true)}
+}
+
+// MultiString returns a REG_MULTI_SZ value
+func MultiString(name string, list []string) Value {
+	var data []byte
+	for _, s := range list {
+		data = append(data, encodeUTF16(s, true)...)
+	}
+	return Value{Name: name, Type: MultiSZ, Data: append(data, 0, 0)}
+}
+
+// DWordValue returns a REG_DWORD value
+func DWordValue(name string, v uint32) Value {
+	return Value{Name: name, Type: DWord, Data: binary.LittleEndian.AppendUint32(nil, v)}
+}
+
+// QWordValue returns a REG_QWORD value
+func QWordValue(name string, v uint64) Value {
+	return Value{Name: name, Type: QWord, Data: binary.LittleEndian.AppendUint64(nil, v)}
+}
+
+// BinaryValue returns a REG_BINARY value
+func BinaryValue(name string, data []byte) Value {
+	return Value{Name: name, Type: Binary, Data: data}
+}
+
+// Text decodes the data of a string value, dropping the terminating NUL
+func (v Value) Text() string {
+	s := decodeUTF16(v.Data)
+	s, _, _ = strings.Cut(s, "\x00")
+	return s
+}
+
+// Strings decodes the data of a REG_MULTI_SZ value
+func (v Value) Strings() []string {
+	s := strings.TrimRight(decodeUTF16(v.Data), "\x00")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\x00")
+}
+
+// Uint64 decodes the data of a REG_DWORD or REG_QWORD value
+func (v Value) Uint64() uint64 {
+	switch len(v.Data) {
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(v.Data))
+	case 8:
+		return binary.LittleEndian.Uint64(v.Data)
+	}
+	return 0
+}
+
+// encodeUTF16 encodes s as UTF-16LE, optionally with a terminating NUL
+func encodeUTF16(s string, terminate bool) []byte {
+	units := utf16.Encode([]rune(s))
+	if terminate {
+		units = append(units, 0)
+	}
+	data := make([]byte, 0, len(units)*2)
+	for _, u := range units {
+		data = binary.LittleEndian.AppendUint16(data, u)
+	}
+	return data
+}
+
+// decodeUTF16 decodes UTF-16LE bytes; an odd trailing byte is ignored
+func decodeUTF16(data []byte) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
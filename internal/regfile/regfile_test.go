@@ -0,0 +1,154 @@
+package regfile
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	long := make([]byte, 100)
+	for i := range long {
+		long[i] = byte(i)
+	}
+	f := &File{Keys: []Key{
+		{Path: `HKEY_CURRENT_USER\Software\nScript`, Values: []Value{
+			String("", "default"),
+			String("Path", `C:\Users\"quoted"\`),
+			ExpandString("Temp", `%USERPROFILE%\AppData\Local\Temp`),
+			MultiString("List", []string{"one", "two", "thrée"}),
+			DWordValue("Flag", 0xdeadbeef),
+			QWordValue("Big", 1<<40+7),
+			BinaryValue("Blob", long),
+			BinaryValue("Empty", nil),
+			String("Lines", "first\r\nsecond"),
+			{Name: "Custom", Type: 0x20, Data: []byte{1, 2}},
+		}},
+		{Path: `HKEY_CURRENT_USER\Software\nScript\Child`},
+		{Path: `HKEY_LOCAL_MACHINE\Software\Gone`, Delete: true},
+	}}
+
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte{0xff, 0xfe}) {
+		t.Error("missing UTF-16LE byte order mark")
+	}
+
+	got, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(got.Keys) != len(f.Keys) {
+		t.Fatalf("got %d keys, want %d", len(got.Keys), len(f.Keys))
+	}
+	for i, key := range f.Keys {
+		g := got.Keys[i]
+		if g.Path != key.Path || g.Delete != key.Delete || len(g.Values) != len(key.Values) {
+			t.Errorf("key %d = %+v, want %+v", i, g, key)
+			continue
+		}
+		for j, v := range key.Values {
+			gv := g.Values[j]
+			if gv.Name != v.Name || gv.Type != v.Type || !bytes.Equal(gv.Data, v.Data) {
+				t.Errorf("value %q = %+v, want %+v", v.Name, gv, v)
+			}
+		}
+	}
+
+	v := got.Keys[0].Values
+	if v[1].Text() != `C:\Users\"quoted"\` || v[3].Strings()[2] != "thrée" || v[4].Uint64() != 0xdeadbeef || v[5].Uint64() != 1<<40+7 {
+		t.Errorf("decoded values do not match: %q %q %d %d", v[1].Text(), v[3].Strings(), v[4].Uint64(), v[5].Uint64())
+	}
+}
+
+func TestFormat(t *testing.T) {
+	f := &File{Keys: []Key{{Path: `HKEY_CURRENT_USER\Software\x`, Values: []Value{
+		String("", "a"),
+		String("Path", `C:\x`),
+		DWordValue("Flag", 1),
+		QWordValue("Big", 2),
+		MultiString("List", []string{"a"}),
+		{Name: "Gone", Delete: true},
+	}}}}
+
+	want := strings.Join([]string{
+		Header,
+		``,
+		`[HKEY_CURRENT_USER\Software\x]`,
+		`@="a"`,
+		`"Path"="C:\\x"`,
+		`"Flag"=dword:00000001`,
+		`"Big"=hex(b):02,00,00,00,00,00,00,00`,
+		`"List"=hex(7):61,00,00,00,00,00`,
+		`"Gone"=-`,
+		``,
+		``,
+	}, "\r\n")
+	if got := f.Format(); got != want {
+		t.Errorf("Format() =\n%s\nwant\n%s", got, want)
+	}
+
+	long := formatValue(BinaryValue("Blob", make([]byte, 60)))
+	for _, l := range strings.Split(long, "\r\n") {
+		if len(l) > lineWidth+1 {
+			t.Errorf("line longer than %d: %q", lineWidth+1, l)
+		}
+	}
+	if !strings.Contains(long, ",\\\r\n  00") {
+		t.Errorf("hex data not wrapped: %q", long)
+	}
+}
+
+func TestParseUTF8(t *testing.T) {
+	data := "\ufeffWindows Registry Editor Version 5.00\n" +
+		"; exported by hand\n" +
+		"[HKCU\\Software\\x]\n" +
+		"\"A\"=dword:0000000a\n" +
+		"\"B\"=hex:01,02,\\\n" +
+		"    03\n" +
+		"\"C\"=-\n" +
+		"[-hklm\\Software\\y]\n"
+
+	got, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &File{Keys: []Key{
+		{Path: `HKEY_CURRENT_USER\Software\x`, Values: []Value{
+			DWordValue("A", 10),
+			BinaryValue("B", []byte{1, 2, 3}),
+			{Name: "C", Delete: true},
+		}},
+		{Path: `HKEY_LOCAL_MACHINE\Software\y`, Delete: true},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"", "empty file"},
+		{"REGEDIT4\n", "not a REGEDIT5 file"},
+		{Header + "\n\"A\"=dword:1\n", "line 2: value outside of a key"},
+		{Header + "\n[HKEY_NOWHERE\\x]\n", `unknown registry root "HKEY_NOWHERE"`},
+		{Header + "\n[HKCU\\x\n", "unterminated key"},
+		{Header + "\n[HKCU\\x]\n\"A\"=dword:xyz\n", "invalid dword"},
+		{Header + "\n[HKCU\\x]\n\"A\"=hex:01,zz\n", `invalid byte "zz"`},
+		{Header + "\n[HKCU\\x]\n\"A=\"b\"\n", "expected = after value name"},
+		{Header + "\n[HKCU\\x]\n\"A\"=qword:1\n", "unsupported data"},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v, want %q", tt.data, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package regfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// lineWidth is where hex data wraps, as in files exported by regedit
+const lineWidth = 77
+
+// Format returns the file as REGEDIT5 text with CRLF line endings
+func (f *File) Format() string {
+	var b strings.Builder
+	b.WriteString(Header + "\r\n")
+	for _, key := range f.Keys {
+		b.WriteString("\r\n")
+		if key.Delete {
+			fmt.Fprintf(&b, "[-%s]\r\n", key.Path)
+			continue
+		}
+		fmt.Fprintf(&b, "[%s]\r\n", key.Path)
+		for _, v := range key.Values {
+			b.WriteString(formatValue(v))
+			b.WriteString("\r\n")
+		}
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// Write writes the file as UTF-16LE with a byte order mark, the encoding regedit uses
+func (f *File) Write(w io.Writer) error {
+	units := utf16.Encode([]rune(f.Format()))
+	buf := bytes.NewBuffer(make([]byte, 0, 2+2*len(units)))
+	buf.Write([]byte{0xff, 0xfe})
+	for _, u := range units {
+		buf.Write(binary.LittleEndian.AppendUint16(nil, u))
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// formatValue returns the line(s) for one value
+func formatValue(v Value) string {
+	name := "@"
+	if v.Name != "" {
+		name = quote(v.Name)
+	}
+	if v.Delete {
+		return name + "=-"
+	}
+
+	switch v.Type {
+	case SZ:
+		if s, ok := plainString(v.Data); ok {
+			return name + "=" + quote(s)
+		}
+	case DWord:
+		if len(v.Data) == 4 {
+			return fmt.Sprintf("%s=dword:%08x", name, binary.LittleEndian.Uint32(v.Data))
+		}
+	}
+
+	prefix := "hex:"
+	if v.Type != Binary {
+		prefix = fmt.Sprintf("hex(%x):", uint32(v.Type))
+	}
+	return formatHex(name+"="+prefix, v.Data)
+}
+
+// plainString decodes REG_SZ data that can be written as a quoted string
+// without losing bytes: NUL terminated and free of line breaks and embedded NULs
+func plainString(data []byte) (string, bool) {
+	if len(data) < 2 || len(data)%2 != 0 {
+		return "", false
+	}
+	s := decodeUTF16(data)
+	if !strings.HasSuffix(s, "\x00") {
+		return "", false
+	}
+	s = s[:len(s)-1]
+	if strings.ContainsAny(s, "\x00\r\n") || !bytes.Equal(encodeUTF16(s, true), data) {
+		return "", false
+	}
+	return s, true
+}
+
+// quote returns s in double quotes with backslashes and quotes escaped
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// formatHex writes data as comma-separated hex bytes after prefix, wrapping long lines
+func formatHex(prefix string, data []byte) string {
+	var b strings.Builder
+	line := prefix
+	for i, c := range data {
+		piece := fmt.Sprintf("%02x", c)
+		if i < len(data)-1 {
+			piece += ","
+		}
+		if len(line)+len(piece) > lineWidth {
+			b.WriteString(line + "\\\r\n")
+			line = "  "
+		}
+		line += piece
+	}
+	b.WriteString(line)
+	return b.String()
+}
@@ -0,0 +1,342 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"nScript/internal/breaker"
+	"nScript/internal/cleanup"
+	"nScript/internal/profiles"
+	"nScript/internal/system"
+)
+
+// SchemaVersion is bumped whenever a field is renamed or removed. Adding fields keeps the version.
+const SchemaVersion = 1
+
+// Run modes
+const (
+	ModeClean      = "clean"
+	ModeDryRun     = "dry-run"
+	ModeQuarantine = "quarantine"
+)
+
+// Report is the machine-readable record of one run
+type Report struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Version       string    `json:"version"`
+	Host          string    `json:"host"`
+	StartedAt     time.Time `json:"startedAt"`
+	FinishedAt    time.Time `json:"finishedAt"`
+	Mode          string    `json:"mode"`
+	Force         bool      `json:"force"`
+	Interrupted   bool      `json:"interrupted"`
+	ExitCode      int       `json:"exitCode"`
+	ConfigSource  string    `json:"configSource,omitempty"`
+	QuarantineRun string    `json:"quarantineRun,omitempty"`
+	PlanFile      string    `json:"planFile,omitempty"`
+	Only          []string  `json:"only,omitempty"`
+	Skip          []string  `json:"skip,omitempty"`
+
+	Phases    []Phase   `json:"phases"`
+	Totals    Totals    `json:"totals"`
+	Targets   []Target  `json:"targets"`
+	Failures  []Failure `json:"failures"`
+	Registry  Registry  `json:"registry"`
+	Processes []Process `json:"processes"`
+	Disk      Disk      `json:"disk"`
+	// Profiles is only set by all-users runs
+	Profiles []Profile `json:"profiles,omitempty"`
+	// SafetyAbort is only set when a safety limit stopped the run
+	SafetyAbort *SafetyAbort `json:"safetyAbort,omitempty"`
+}
+
+// SafetyAbort is the safety limit that stopped the run
+type SafetyAbort struct {
+	Phase string `json:"phase"`
+	// Limit is files, bytes or volume-share; Scope is run or target
+	Limit  string `json:"limit"`
+	Scope  string `json:"scope"`
+	Target string `json:"target,omitempty"`
+	Volume string `json:"volume,omitempty"`
+	// Ceiling and Value are counts, bytes or fractions of the volume, depending on Limit
+	Ceiling float64 `json:"ceiling"`
+	Value   float64 `json:"value"`
+	Message string  `json:"message"`
+}
+
+// Phase is the outcome of one cleanup phase
+type Phase struct {
+	Name       string    `json:"name"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Skipped    bool      `json:"skipped,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Totals are the run-wide counters
+type Totals struct {
+	DeletedFiles     int64 `json:"deletedFiles"`
+	DeletedFolders   int64 `json:"deletedFolders"`
+	Skipped          int64 `json:"skipped"`
+	Failed           int64 `json:"failed"`
+	BytesFreed       int64 `json:"bytesFreed"`
+	BytesSkipped     int64 `json:"bytesSkipped"`
+	BytesFailed      int64 `json:"bytesFailed"`
+	FailuresOmitted  int64 `json:"failuresOmitted"`
+	QuarantinedItems int   `json:"quarantinedItems,omitempty"`
+}
+
+// Target holds the counters of one target directory or browser
+type Target struct {
+	Name           string `json:"name"`
+	Kind           string `json:"kind"`
+	DeletedFiles   int64  `json:"deletedFiles"`
+	DeletedFolders int64  `json:"deletedFolders"`
+	Skipped        int64  `json:"skipped"`
+	Failed         int64  `json:"failed"`
+	BytesFreed     int64  `json:"bytesFreed"`
+	BytesSkipped   int64  `json:"bytesSkipped"`
+	BytesFailed    int64  `json:"bytesFailed"`
+}
+
+// Profile holds the results of one user profile in an all-users run. Browser
+// counters are kept per browser, not per profile, and are not included.
+type Profile struct {
+	User                  string `json:"user"`
+	SID                   string `json:"sid,omitempty"`
+	Home                  string `json:"home"`
+	Hive                  string `json:"hive,omitempty"`
+	Error                 string `json:"error,omitempty"`
+	DeletedFiles          int64  `json:"deletedFiles"`
+	DeletedFolders        int64  `json:"deletedFolders"`
+	Failed                int64  `json:"failed"`
+	BytesFreed            int64  `json:"bytesFreed"`
+	RegistryKeysDeleted   int    `json:"registryKeysDeleted"`
+	RegistryValuesChanged int    `json:"registryValuesChanged"`
+}
+
+// Failure is one item or operation that failed
+type Failure struct {
+	Phase  string `json:"phase"`
+	Target string `json:"target,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Error  string `json:"error"`
+}
+
+// Registry lists the registry changes of the run
+type Registry struct {
+	BackupDirectory string         `json:"backupDirectory,omitempty"`
+	BackupArchive   string         `json:"backupArchive,omitempty"`
+	BackedUp        []RegistryFile `json:"backedUp"`
+	Deleted         []string       `json:"deleted"`
+	Changed         []string       `json:"changed"`
+}
+
+// RegistryFile is a backed-up key and the file in the backup archive holding it
+type RegistryFile struct {
+	Key  string `json:"key"`
+	File string `json:"file"`
+}
+
+// Process is a process ended during the run
+type Process struct {
+	Phase string `json:"phase"`
+	Name  string `json:"name"`
+	PID   uint32 `json:"pid"`
+	// Stage is the shutdown stage that ended the process: closed or terminated
+	Stage string `json:"stage,omitempty"`
+}
+
+// Disk holds free space on the system drive before and after the run
+type Disk struct {
+	TotalBytes       uint64 `json:"totalBytes,omitempty"`
+	FreeBytesBefore  uint64 `json:"freeBytesBefore,omitempty"`
+	FreeBytesAfter   uint64 `json:"freeBytesAfter,omitempty"`
+	FreeBytesChanged int64  `json:"freeBytesChanged"`
+}
+
+// New starts a report for a run of the given version
+func New(version string, started time.Time) *Report {
+	host, _ := os.Hostname()
+	return &Report{
+		SchemaVersion: SchemaVersion,
+		Version:       version,
+		Host:          host,
+		StartedAt:     started,
+		Mode:          ModeClean,
+		Phases:        []Phase{},
+		Targets:       []Target{},
+		Failures:      []Failure{},
+		Registry:      Registry{BackedUp: []RegistryFile{}, Deleted: []string{}, Changed: []string{}},
+		Processes:     []Process{},
+	}
+}
+
+// AddPhase records a finished phase that began at started
+func (r *Report) AddPhase(name string, started time.Time, err error) {
+	phase := Phase{Name: name, StartedAt: started, FinishedAt: time.Now()}
+	if err != nil {
+		phase.Error = err.Error()
+	}
+	r.Phases = append(r.Phases, phase)
+}
+
+// SkipPhase records a phase that was deselected with --only or --skip
+func (r *Report) SkipPhase(name string) {
+	now := time.Now()
+	r.Phases = append(r.Phases, Phase{Name: name, StartedAt: now, FinishedAt: now, Skipped: true})
+}
+
+// AddStats copies the file, browser and empty-directory counters and failures
+func (r *Report) AddStats(stats *cleanup.Stats) {
+	failures, omitted := stats.Failures()
+	r.Totals.DeletedFiles = stats.DeletedFiles.Load()
+	r.Totals.DeletedFolders = stats.DeletedFolders.Load()
+	r.Totals.Skipped = stats.SkippedFiles.Load()
+	r.Totals.Failed = stats.FailedFiles.Load()
+	r.Totals.BytesFreed = stats.BytesFreed.Load()
+	r.Totals.BytesSkipped = stats.BytesSkipped.Load()
+	r.Totals.BytesFailed = stats.BytesFailed.Load()
+	r.Totals.FailuresOmitted = omitted
+
+	for _, t := range stats.Targets() {
+		r.Targets = append(r.Targets, Target(t))
+	}
+	r.AddFailures(failures)
+}
+
+// AddFailures appends failures reported by a cleaner
+func (r *Report) AddFailures(failures []cleanup.Failure) {
+	for _, f := range failures {
+		r.Failures = append(r.Failures, Failure{Phase: f.Phase, Target: f.Target, Path: f.Path, Error: f.Err})
+	}
+}
+
+// AddRegistry records the registry keys backed up and deleted and the values set or deleted
+func (r *Report) AddRegistry(backupDir, archive string, backups []system.RegistryBackup, deleted, changed []string) {
+	r.Registry.BackupDirectory = backupDir
+	r.Registry.BackupArchive = archive
+	for _, b := range backups {
+		r.Registry.BackedUp = append(r.Registry.BackedUp, RegistryFile{Key: b.Key, File: b.File})
+	}
+	r.Registry.Deleted = append(r.Registry.Deleted, deleted...)
+	r.Registry.Changed = append(r.Registry.Changed, changed...)
+}
+
+// AddProfiles breaks the targets, failures and registry changes recorded so far
+// down by profile, so it is called after AddStats, AddFailures and AddRegistry
+func (r *Report) AddProfiles(list []profiles.Profile, results []cleanup.ProfileResult) {
+	for _, p := range list {
+		entry := Profile{User: p.User, SID: p.SID, Home: p.Home}
+		for _, result := range results {
+			if result.Profile.Home == p.Home {
+				entry.Hive, entry.Error = result.Hive, result.Err
+			}
+		}
+		for _, t := range r.Targets {
+			if t.Kind == cleanup.TargetDirectory && within(t.Name, p.Home) {
+				entry.DeletedFiles += t.DeletedFiles
+				entry.DeletedFolders += t.DeletedFolders
+				entry.Failed += t.Failed
+				entry.BytesFreed += t.BytesFreed
+			}
+		}
+		if p.SID != "" {
+			hive := `HKU\` + p.SID
+			for _, key := range r.Registry.Deleted {
+				if within(key, hive) {
+					entry.RegistryKeysDeleted++
+				}
+			}
+			for _, value := range r.Registry.Changed {
+				if within(value, hive) {
+					entry.RegistryValuesChanged++
+				}
+			}
+		}
+		r.Profiles = append(r.Profiles, entry)
+	}
+}
+
+// within reports whether path is below dir, ignoring case as Windows does
+func within(path, dir string) bool {
+	return len(path) > len(dir) && strings.EqualFold(path[:len(dir)], dir) && (path[len(dir)] == '\\' || path[len(dir)] == '/')
+}
+
+// AddProcesses records processes terminated during a phase
+func (r *Report) AddProcesses(phase string, processes []system.ProcessInfo) {
+	for _, p := range processes {
+		r.Processes = append(r.Processes, Process{Phase: phase, Name: p.Name, PID: p.PID, Stage: p.Stage})
+	}
+}
+
+// SetSafetyAbort records the safety limit that stopped the run during phase
+func (r *Report) SetSafetyAbort(phase string, trip *breaker.Trip) {
+	r.SafetyAbort = &SafetyAbort{
+		Phase:   phase,
+		Limit:   trip.Limit,
+		Scope:   trip.Scope,
+		Target:  trip.Target,
+		Volume:  trip.Volume,
+		Ceiling: trip.Ceiling,
+		Value:   trip.Value,
+		Message: trip.Error(),
+	}
+}
+
+// SetDisk records free space before and after the run; either snapshot may be nil
+func (r *Report) SetDisk(before, after *system.DiskInfo) {
+	if after != nil {
+		r.Disk.TotalBytes = after.TotalBytes
+		r.Disk.FreeBytesAfter = after.FreeBytes
+	}
+	if before != nil {
+		r.Disk.FreeBytesBefore = before.FreeBytes
+	}
+	if before != nil && after != nil {
+		r.Disk.FreeBytesChanged = int64(after.FreeBytes) - int64(before.FreeBytes)
+	}
+}
+
+// DefaultPath returns the report location used when --report is not given
+func DefaultPath(started time.Time) string {
+	name := fmt.Sprintf("nScript-report-%s.json", started.Format("20060102-150405"))
+	programData := os.Getenv("ProgramData")
+	if programData == "" {
+		return name
+	}
+	return filepath.Join(programData, "nScript", "reports", name)
+}
+
+// WriteFile finishes the report and writes it as indented JSON. The file is
+// written under a temporary name first so collectors never read a partial report.
+func (r *Report) WriteFile(path string) error {
+	if r.FinishedAt.IsZero() {
+		r.FinishedAt = time.Now()
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %v", err)
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create report directory: %v", err)
+		}
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nScript/internal/breaker"
+	"nScript/internal/cleanup"
+	"nScript/internal/profiles"
+	"nScript/internal/system"
+)
+
+func TestWriteFile(t *testing.T) {
+	started := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+	r := New("2.0.8", started)
+	r.Mode = ModeQuarantine
+	r.AddPhase(cleanup.PhaseFiles, started, nil)
+	r.SkipPhase(cleanup.PhaseBrowsers)
+	r.AddPhase(cleanup.PhaseWindows, started, errors.New("access denied"))
+	r.AddStats(&cleanup.Stats{})
+	r.AddFailures([]cleanup.Failure{{Phase: cleanup.PhaseWindows, Target: "Dark mode", Err: "access denied"}})
+	r.AddRegistry(`C:\backup`, `C:\backup\20240601-080000.zip`, []system.RegistryBackup{{Key: `HKCU\Software\x`, File: `001_HKCU_Software_x.reg`}}, []string{`HKCU\Software\x`}, []string{`HKCU\Software\y\Flag`})
+	r.AddProcesses(cleanup.PhaseBrowsers, []system.ProcessInfo{{Name: "chrome.exe", PID: 42, Stage: system.StageClosed}})
+	r.SetDisk(&system.DiskInfo{TotalBytes: 1000, FreeBytes: 100}, &system.DiskInfo{TotalBytes: 1000, FreeBytes: 250})
+
+	path := filepath.Join(t.TempDir(), "reports", "run.json")
+	if err := r.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("temporary file left behind")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Collectors depend on these names; renaming one requires a schema version bump
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("report is not valid JSON: %v", err)
+	}
+	for _, key := range []string{"schemaVersion", "version", "host", "startedAt", "finishedAt", "mode", "force", "interrupted", "exitCode", "phases", "totals", "targets", "failures", "registry", "processes", "disk"} {
+		if _, ok := doc[key]; !ok {
+			t.Errorf("report has no %q field", key)
+		}
+	}
+
+	var got Report
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.SchemaVersion != SchemaVersion || got.Mode != ModeQuarantine || got.FinishedAt.IsZero() {
+		t.Errorf("header = %+v", got)
+	}
+	if len(got.Phases) != 3 || !got.Phases[1].Skipped || got.Phases[2].Error != "access denied" {
+		t.Errorf("phases = %+v", got.Phases)
+	}
+	if len(got.Failures) != 1 || len(got.Registry.BackedUp) != 1 || len(got.Registry.Deleted) != 1 || len(got.Registry.Changed) != 1 || len(got.Processes) != 1 {
+		t.Errorf("journals = %+v %+v %+v", got.Failures, got.Registry, got.Processes)
+	}
+	if got.Processes[0].Stage != system.StageClosed {
+		t.Errorf("process stage = %q, want %q", got.Processes[0].Stage, system.StageClosed)
+	}
+	if got.Disk.FreeBytesChanged != 150 {
+		t.Errorf("free bytes changed = %d, want 150", got.Disk.FreeBytesChanged)
+	}
+}
+
+func TestEmptyListsAreArrays(t *testing.T) {
+	data, err := json.Marshal(New("2.0.8", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	json.Unmarshal(data, &doc)
+	for _, key := range []string{"phases", "targets", "failures", "processes"} {
+		if _, ok := doc[key].([]any); !ok {
+			t.Errorf("%s = %v, want an empty array", key, doc[key])
+		}
+	}
+}
+
+func TestSetSafetyAbort(t *testing.T) {
+	r := New("2.0.8", time.Now())
+	r.SetSafetyAbort(cleanup.PhaseFiles, &breaker.Trip{Limit: breaker.LimitFiles, Scope: breaker.ScopeTarget, Target: `C:\Users\student\Downloads`, Ceiling: 100, Value: 101})
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Report
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	abort := got.SafetyAbort
+	if abort == nil || abort.Phase != cleanup.PhaseFiles || abort.Limit != breaker.LimitFiles || abort.Scope != breaker.ScopeTarget || abort.Value != 101 || abort.Message == "" {
+		t.Errorf("safetyAbort = %+v", abort)
+	}
+
+	data, _ = json.Marshal(New("2.0.8", time.Now()))
+	var doc map[string]any
+	json.Unmarshal(data, &doc)
+	if _, ok := doc["safetyAbort"]; ok {
+		t.Error("safetyAbort set on a run no limit stopped")
+	}
+}
+
+func TestAddProfiles(t *testing.T) {
+	r := New("2.0.8", time.Now())
+	r.Targets = []Target{
+		{Name: `C:\Users\bob\AppData\Local\Temp`, Kind: cleanup.TargetDirectory, DeletedFiles: 3, BytesFreed: 300},
+		{Name: `C:\Users\bobby\AppData\Local\Temp`, Kind: cleanup.TargetDirectory, DeletedFiles: 5, BytesFreed: 500},
+		{Name: `C:\Windows\Temp`, Kind: cleanup.TargetDirectory, DeletedFiles: 7},
+	}
+	r.AddRegistry("", "", nil, []string{`HKU\S-1-5-21-1-1001\Software\x`, `HKCU\Software\x`}, []string{`HKU\S-1-5-21-1-1001\Software\y\Flag`})
+
+	bob := profiles.Profile{User: "bob", SID: "S-1-5-21-1-1001", Home: `C:\Users\bob`}
+	bobby := profiles.Profile{User: "bobby", Home: `C:\Users\bobby`}
+	r.AddProfiles([]profiles.Profile{bob, bobby}, []cleanup.ProfileResult{{Profile: bob, Hive: cleanup.HiveLoaded}})
+
+	if len(r.Profiles) != 2 {
+		t.Fatalf("profiles = %+v", r.Profiles)
+	}
+	got := r.Profiles[0]
+	if got.DeletedFiles != 3 || got.BytesFreed != 300 || got.Hive != cleanup.HiveLoaded || got.RegistryKeysDeleted != 1 || got.RegistryValuesChanged != 1 {
+		t.Errorf("bob = %+v", got)
+	}
+	if got := r.Profiles[1]; got.DeletedFiles != 5 || got.Hive != "" || got.RegistryKeysDeleted != 0 {
+		t.Errorf("bobby = %+v", got)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package rules
+
+import (
+	"io/fs"
+	"strings"
+)
+
+// attributesOf treats dot files as hidden; there is no system attribute outside Windows
+func attributesOf(info fs.FileInfo) attributes {
+	attrs := modeAttributes(info)
+	if strings.HasPrefix(info.Name(), ".") {
+		attrs |= attrHidden
+	}
+	return attrs
+}
@@ -0,0 +1,27 @@
+package rules
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// attributesOf reads the Windows file attributes, falling back to the file mode
+// for filesystems that do not provide them
+func attributesOf(info fs.FileInfo) attributes {
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return modeAttributes(info)
+	}
+
+	var attrs attributes
+	if data.FileAttributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0 {
+		attrs |= attrHidden
+	}
+	if data.FileAttributes&syscall.FILE_ATTRIBUTE_SYSTEM != 0 {
+		attrs |= attrSystem
+	}
+	if data.FileAttributes&syscall.FILE_ATTRIBUTE_READONLY != 0 {
+		attrs |= attrReadOnly
+	}
+	return attrs
+}
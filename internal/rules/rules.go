@@ -0,0 +1,335 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Action is what a matching rule decides for a path
+type Action int
+
+const (
+	// Include makes a path eligible for cleanup
+	Include Action = iota
+	// Exclude keeps a path
+	Exclude
+)
+
+func (a Action) String() string {
+	if a == Exclude {
+		return "exclude"
+	}
+	return "include"
+}
+
+// Attribute names accepted in Rule.Attributes. A "!" prefix requires the attribute to be unset.
+const (
+	AttrHidden   = "hidden"
+	AttrSystem   = "system"
+	AttrReadOnly = "readonly"
+)
+
+// Rule is one entry of an ordered rule list. A rule matches a path when its
+// pattern and every limit it sets match; zero limits are not checked.
+type Rule struct {
+	Action Action
+
+	// Pattern is a slash-separated glob relative to the target directory.
+	// "**" matches any number of directories, a pattern without a slash
+	// matches the base name at any depth and an empty pattern matches everything.
+	Pattern string
+
+	MinSize    int64
+	MaxSize    int64
+	OlderThan  time.Duration
+	NewerThan  time.Duration
+	Attributes []string
+
+	// Name replaces the generated description in skip reasons
+	Name string
+}
+
+// Parse builds a rule from a pattern, where a leading "!" makes it an exclude rule
+func Parse(spec string) Rule {
+	if pattern, ok := strings.CutPrefix(spec, "!"); ok {
+		return Rule{Action: Exclude, Pattern: pattern}
+	}
+	return Rule{Action: Include, Pattern: spec}
+}
+
+// String describes the rule for plans and reports
+func (r Rule) String() string {
+	if r.Name != "" {
+		return r.Name
+	}
+
+	var b strings.Builder
+	b.WriteString("rule ")
+	if r.Action == Exclude {
+		b.WriteByte('!')
+	}
+	if r.Pattern == "" {
+		b.WriteString("**")
+	} else {
+		b.WriteString(r.Pattern)
+	}
+
+	var limits []string
+	if r.MinSize > 0 {
+		limits = append(limits, fmt.Sprintf("size >= %d", r.MinSize))
+	}
+	if r.MaxSize > 0 {
+		limits = append(limits, fmt.Sprintf("size <= %d", r.MaxSize))
+	}
+	if r.OlderThan > 0 {
+		limits = append(limits, "older than "+r.OlderThan.String())
+	}
+	if r.NewerThan > 0 {
+		limits = append(limits, "newer than "+r.NewerThan.String())
+	}
+	if len(r.Attributes) > 0 {
+		limits = append(limits, strings.Join(r.Attributes, ","))
+	}
+	if len(limits) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(limits, ", "))
+	}
+	return b.String()
+}
+
+// Validate reports whether the rule can be compiled
+func (r Rule) Validate() error {
+	_, err := compile(r)
+	return err
+}
+
+// compiled is a rule with its pattern split into lower-case segments
+type compiled struct {
+	rule     Rule
+	segments []string
+	attrSet  attributes
+	attrClr  attributes
+}
+
+// Set is a compiled, ordered rule list
+type Set struct {
+	rules []compiled
+}
+
+// Compile validates rules and prepares them for matching. Rules are evaluated in order.
+func Compile(list []Rule) (*Set, error) {
+	set := &Set{rules: make([]compiled, 0, len(list))}
+	for i, r := range list {
+		c, err := compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %v", i+1, r, err)
+		}
+		set.rules = append(set.rules, c)
+	}
+	return set, nil
+}
+
+func compile(r Rule) (compiled, error) {
+	c := compiled{rule: r}
+
+	if r.MinSize < 0 || r.MaxSize < 0 {
+		return c, errors.New("size limits cannot be negative")
+	}
+	if r.MaxSize > 0 && r.MinSize > r.MaxSize {
+		return c, errors.New("minimum size is larger than maximum size")
+	}
+	if r.OlderThan < 0 || r.NewerThan < 0 {
+		return c, errors.New("age limits cannot be negative")
+	}
+
+	for _, name := range r.Attributes {
+		attr, ok := attributeNames[strings.ToLower(strings.TrimPrefix(name, "!"))]
+		if !ok {
+			return c, fmt.Errorf("unknown attribute %q", name)
+		}
+		if strings.HasPrefix(name, "!") {
+			c.attrClr |= attr
+		} else {
+			c.attrSet |= attr
+		}
+	}
+	if c.attrSet&c.attrClr != 0 {
+		return c, errors.New("attribute is both required and forbidden")
+	}
+
+	pattern := strings.ToLower(strings.ReplaceAll(r.Pattern, `\`, "/"))
+	switch {
+	case pattern == "":
+		c.segments = []string{"**"}
+	case strings.HasPrefix(pattern, "/"):
+		pattern = strings.TrimPrefix(pattern, "/")
+	case !strings.Contains(strings.TrimSuffix(pattern, "/"), "/"):
+		// A bare name matches at any depth
+		pattern = "**/" + pattern
+	}
+	if c.segments == nil {
+		for _, segment := range strings.Split(strings.Trim(pattern, "/"), "/") {
+			if segment == "" {
+				continue
+			}
+			if _, err := path.Match(segment, ""); err != nil {
+				return c, fmt.Errorf("invalid pattern %q", r.Pattern)
+			}
+			c.segments = append(c.segments, segment)
+		}
+	}
+	return c, nil
+}
+
+// Match returns the first rule matching a path below the target directory. rel is
+// the path relative to the target, info describes it and age is how old it is
+// according to the target's age source.
+func (s *Set) Match(rel string, info fs.FileInfo, age time.Duration) (Rule, bool) {
+	if s == nil {
+		return Rule{}, false
+	}
+
+	rel = strings.ToLower(strings.ReplaceAll(filepath.ToSlash(rel), `\`, "/"))
+	var segments []string
+	if rel != "." && rel != "" {
+		segments = strings.Split(strings.Trim(rel, "/"), "/")
+	}
+
+	var attrs attributes
+	attrsLoaded := false
+
+	for _, c := range s.rules {
+		if !matchSegments(c.segments, segments) {
+			continue
+		}
+
+		r := c.rule
+		if r.MinSize > 0 || r.MaxSize > 0 {
+			// Size limits only describe files
+			if info.IsDir() || info.Size() < r.MinSize || (r.MaxSize > 0 && info.Size() > r.MaxSize) {
+				continue
+			}
+		}
+
+		if r.OlderThan > 0 && age <= r.OlderThan {
+			continue
+		}
+		if r.NewerThan > 0 && age > r.NewerThan {
+			continue
+		}
+
+		if c.attrSet != 0 || c.attrClr != 0 {
+			if !attrsLoaded {
+				attrs = attributesOf(info)
+				attrsLoaded = true
+			}
+			if attrs&c.attrSet != c.attrSet || attrs&c.attrClr != 0 {
+				continue
+			}
+		}
+
+		return r, true
+	}
+	return Rule{}, false
+}
+
+// MatchGlob reports whether path matches pattern, where "*" matches within one
+// path segment and "**" spans any number of segments. Like rule patterns it
+// ignores case and treats \ and / alike.
+func MatchGlob(pattern, path string) bool {
+	split := func(s string) []string {
+		s = strings.Trim(strings.ToLower(strings.ReplaceAll(s, `\`, "/")), "/")
+		return strings.Split(s, "/")
+	}
+	return matchSegments(split(pattern), split(path))
+}
+
+// matchSegments matches path segments against pattern segments, where "**" spans any number of segments
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return true
+			}
+			// Without another "**" the rest only matches the last segments
+			if !slices.Contains(pattern, "**") {
+				return len(name) >= len(pattern) && matchSegments(pattern, name[len(name)-len(pattern):])
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if !matchSegment(pattern[0], name[0]) {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// matchSegment matches one path segment against a pattern segment. Most
+// patterns are literals and "*" only, such as "*steam*", and are matched
+// without path.Match, which is much slower on the many paths of a walk.
+func matchSegment(pattern, name string) bool {
+	if strings.ContainsAny(pattern, `?[\`) {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}
+	first, rest, wild := strings.Cut(pattern, "*")
+	if !wild {
+		return pattern == name
+	}
+	name, ok := strings.CutPrefix(name, first)
+	if !ok {
+		return false
+	}
+	// Each literal between stars matches at its first place, the last at the end
+	for {
+		piece, more, wild := strings.Cut(rest, "*")
+		if !wild {
+			return strings.HasSuffix(name, piece)
+		}
+		i := strings.Index(name, piece)
+		if i < 0 {
+			return false
+		}
+		name, rest = name[i+len(piece):], more
+	}
+}
+
+// attributes is a bit set of file attributes
+type attributes uint8
+
+const (
+	attrHidden attributes = 1 << iota
+	attrSystem
+	attrReadOnly
+)
+
+var attributeNames = map[string]attributes{
+	AttrHidden:   attrHidden,
+	AttrSystem:   attrSystem,
+	AttrReadOnly: attrReadOnly,
+}
+
+// modeAttributes derives attributes from the portable parts of a FileInfo
+func modeAttributes(info fs.FileInfo) attributes {
+	var attrs attributes
+	if info.Mode().Perm()&0o200 == 0 {
+		attrs |= attrReadOnly
+	}
+	return attrs
+}
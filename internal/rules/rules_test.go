@@ -0,0 +1,196 @@
+package rules
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// fileInfo is a minimal fs.FileInfo for matching
+type fileInfo struct {
+	name string
+	size int64
+	mode fs.FileMode
+	age  time.Duration
+}
+
+func (f fileInfo) Name() string       { return f.name }
+func (f fileInfo) Size() int64        { return f.size }
+func (f fileInfo) Mode() fs.FileMode  { return f.mode }
+func (f fileInfo) ModTime() time.Time { return now.Add(-f.age) }
+func (f fileInfo) IsDir() bool        { return f.mode.IsDir() }
+func (f fileInfo) Sys() any           { return nil }
+
+func file(rel string, size int64, age time.Duration) fileInfo {
+	return fileInfo{name: rel[strings.LastIndex(rel, "/")+1:], size: size, mode: 0o644, age: age}
+}
+
+func mustCompile(t *testing.T, list ...Rule) *Set {
+	t.Helper()
+	set, err := Compile(list)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	return set
+}
+
+func TestPatterns(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		want    bool
+	}{
+		{"**/*.sav", "game.sav", true},
+		{"**/*.sav", "Games/Slot1/GAME.SAV", true},
+		{"**/*.sav", "game.sav.bak", false},
+		{"*.iso", "iso/ubuntu.iso", true},
+		{"*.iso", "ubuntu.iso/readme.txt", false},
+		{"School/**", "School", true},
+		{"School/**", "School/math/notes.docx", true},
+		{"School/**", "Schoolwork/notes.docx", false},
+		{"School/**", "Archive/School/notes.docx", false},
+		{"/notes.txt", "notes.txt", true},
+		{"/notes.txt", "sub/notes.txt", false},
+		{`Documents\School\**`, "documents/school/a.txt", true},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/?/b", "a/xy/b", false},
+		{"", "anything/at/all", true},
+	}
+
+	for _, tt := range tests {
+		set := mustCompile(t, Parse(tt.pattern))
+		if _, got := set.Match(tt.rel, file(tt.rel, 1, 0), 0); got != tt.want {
+			t.Errorf("%q matching %q = %v, want %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestMatchSegmentAgreesWithPathMatch(t *testing.T) {
+	// Every pattern and name of up to four characters
+	var expand func(alphabet string, n int) []string
+	expand = func(alphabet string, n int) []string {
+		if n == 0 {
+			return []string{""}
+		}
+		shorter := expand(alphabet, n-1)
+		all := shorter
+		for _, s := range shorter {
+			if len(s) == n-1 {
+				for _, r := range alphabet {
+					all = append(all, s+string(r))
+				}
+			}
+		}
+		return all
+	}
+
+	for _, pattern := range expand("ab*", 4) {
+		for _, name := range expand("ab", 4) {
+			want, _ := path.Match(pattern, name)
+			if got := matchSegment(pattern, name); got != want {
+				t.Errorf("matchSegment(%q, %q) = %v, path.Match says %v", pattern, name, got, want)
+			}
+		}
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{`C:\Program Files\Google\**\chrome.exe`, `c:\program files\google\Chrome\Application\chrome.exe`, true},
+		{`C:\Program Files\Google\**\chrome.exe`, `C:\Users\kid\AppData\Local\Temp\Google\chrome.exe`, false},
+		{`C:\Users\*\AppData\**\*.exe`, `C:\Users\kid\AppData\Local\Discord\Discord.exe`, true},
+		{"/opt/google/chrome/chrome", "/opt/google/chrome/chrome", true},
+		{"/opt/*/chrome", "/opt/google/chrome/chrome", false},
+	}
+	for _, tt := range tests {
+		if got := MatchGlob(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFirstMatchWins(t *testing.T) {
+	set := mustCompile(t,
+		Parse("!Documents/School/**"),
+		Parse("**/*.sav"),
+		Parse("!*.sav"),
+	)
+
+	tests := []struct {
+		rel        string
+		wantAction Action
+		wantMatch  bool
+	}{
+		{"Documents/School/slot.sav", Exclude, true},
+		{"Documents/Games/slot.sav", Include, true},
+		{"Documents/notes.txt", Include, false},
+	}
+	for _, tt := range tests {
+		r, ok := set.Match(tt.rel, file(tt.rel, 1, 0), 0)
+		if ok != tt.wantMatch || (ok && r.Action != tt.wantAction) {
+			t.Errorf("Match(%q) = %v, %v; want %v, %v", tt.rel, r.Action, ok, tt.wantAction, tt.wantMatch)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		info fileInfo
+		want bool
+	}{
+		{"min size met", Rule{MinSize: 100}, file("a", 100, 0), true},
+		{"min size missed", Rule{MinSize: 100}, file("a", 99, 0), false},
+		{"max size met", Rule{MaxSize: 100}, file("a", 100, 0), true},
+		{"max size missed", Rule{MaxSize: 100}, file("a", 101, 0), false},
+		{"size never matches directories", Rule{MaxSize: 100}, fileInfo{name: "d", mode: fs.ModeDir | 0o755}, false},
+		{"older than met", Rule{OlderThan: 24 * time.Hour}, file("a", 0, 48*time.Hour), true},
+		{"older than missed", Rule{OlderThan: 24 * time.Hour}, file("a", 0, time.Hour), false},
+		{"newer than met", Rule{NewerThan: 24 * time.Hour}, file("a", 0, time.Hour), true},
+		{"newer than missed", Rule{NewerThan: 24 * time.Hour}, file("a", 0, 48*time.Hour), false},
+		{"readonly required", Rule{Attributes: []string{"readonly"}}, fileInfo{name: "a", mode: 0o444}, true},
+		{"readonly missing", Rule{Attributes: []string{"readonly"}}, fileInfo{name: "a", mode: 0o644}, false},
+		{"readonly forbidden", Rule{Attributes: []string{"!readonly"}}, fileInfo{name: "a", mode: 0o444}, false},
+	}
+
+	for _, tt := range tests {
+		set := mustCompile(t, tt.rule)
+		if _, got := set.Match(tt.info.name, tt.info, tt.info.age); got != tt.want {
+			t.Errorf("%s: match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, r := range []Rule{
+		{Pattern: "[a-"},
+		{MinSize: 10, MaxSize: 5},
+		{OlderThan: -time.Hour},
+		{Attributes: []string{"compressed"}},
+		{Attributes: []string{"hidden", "!hidden"}},
+	} {
+		if _, err := Compile([]Rule{r}); err == nil {
+			t.Errorf("Compile(%+v) = nil error", r)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	r := Rule{Action: Exclude, Pattern: "**/*.sav", NewerThan: 24 * time.Hour}
+	if got, want := r.String(), "rule !**/*.sav (newer than 24h0m0s)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := (Rule{Name: "excluded extension .iso"}).String(); got != "excluded extension .iso" {
+		t.Errorf("named String() = %q", got)
+	}
+}
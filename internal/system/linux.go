@@ -0,0 +1,235 @@
+//go:build linux
+
+package system
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// procDir is where the kernel exposes one directory per running process
+const procDir = "/proc"
+
+// ListProcesses returns all running processes. Processes that exit while the
+// list is read are left out.
+func (pm *ProcessManager) ListProcesses() ([]ProcessInfo, error) {
+	entries, err := os.ReadDir(procDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %v", err)
+	}
+
+	var processes []ProcessInfo
+	for _, entry := range entries {
+		pid, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		name := processName(entry.Name())
+		if name == "" {
+			continue
+		}
+		stat, err := readStat(uint32(pid))
+		if err != nil {
+			continue
+		}
+		processes = append(processes, ProcessInfo{Name: name, PID: uint32(pid), ParentPID: stat.ppid, Path: imagePath(entry.Name())})
+	}
+
+	return processes, nil
+}
+
+// processName returns the executable name of a process. comm is cut to 15
+// characters, so the first command line argument is preferred when it names
+// the same program.
+func processName(pid string) string {
+	data, err := os.ReadFile(filepath.Join(procDir, pid, "comm"))
+	if err != nil {
+		return ""
+	}
+	comm := strings.TrimSpace(string(data))
+
+	cmdline, err := os.ReadFile(filepath.Join(procDir, pid, "cmdline"))
+	if err == nil {
+		arg0, _, _ := strings.Cut(string(cmdline), "\x00")
+		if name := filepath.Base(arg0); len(comm) == 15 && strings.HasPrefix(name, comm) {
+			return name
+		}
+	}
+	return comm
+}
+
+// imagePath returns the executable of a process, empty when it is not readable,
+// as for other users' processes without root
+func imagePath(pid string) string {
+	path, err := os.Readlink(filepath.Join(procDir, pid, "exe"))
+	if err != nil {
+		return ""
+	}
+	// An executable replaced by an update while running is marked as deleted
+	return strings.TrimSuffix(path, " (deleted)")
+}
+
+// sameName compares process names; Linux names are case-sensitive
+func sameName(a, b string) bool {
+	return a == b
+}
+
+// procStat holds the fields of /proc/<pid>/stat that nScript uses
+type procStat struct {
+	ppid uint32
+	// startTime is in clock ticks since boot
+	startTime uint64
+}
+
+// readStat parses /proc/<pid>/stat. The command name in parentheses may
+// contain spaces, so the fields are counted from the last parenthesis.
+func readStat(pid uint32) (procStat, error) {
+	data, err := os.ReadFile(filepath.Join(procDir, strconv.FormatUint(uint64(pid), 10), "stat"))
+	if err != nil {
+		return procStat{}, err
+	}
+	end := strings.LastIndexByte(string(data), ')')
+	if end < 0 {
+		return procStat{}, errors.New("malformed stat")
+	}
+	// Fields after the name start with the state, field 3 in proc(5)
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 20 {
+		return procStat{}, errors.New("malformed stat")
+	}
+	ppid, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return procStat{}, err
+	}
+	start, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return procStat{}, err
+	}
+	return procStat{ppid: uint32(ppid), startTime: start}, nil
+}
+
+// requestClose sends SIGTERM, which lets the process save its state and exit
+func (pm *ProcessManager) requestClose(pid uint32) error {
+	return signal(pid, syscall.SIGTERM)
+}
+
+// terminate sends SIGKILL
+func (pm *ProcessManager) terminate(pid uint32) error {
+	return signal(pid, syscall.SIGKILL)
+}
+
+// startTime returns when a process started, in clock ticks since boot
+func (pm *ProcessManager) startTime(pid uint32) (uint64, error) {
+	stat, err := readStat(pid)
+	return stat.startTime, err
+}
+
+// signal sends sig to a process, returning errExited when it is gone
+func signal(pid uint32, sig syscall.Signal) error {
+	err := syscall.Kill(int(pid), sig)
+	if errors.Is(err, syscall.ESRCH) {
+		return errExited
+	}
+	return err
+}
+
+// GetDiskInfo returns disk information for the filesystem holding the home directories
+func GetDiskInfo() (*DiskInfo, error) {
+	path := os.Getenv("HOME")
+	if path == "" {
+		path = "/"
+	}
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return nil, fmt.Errorf("statfs %s failed: %v", path, err)
+	}
+
+	totalBytes := st.Blocks * uint64(st.Bsize)
+	totalFreeBytes := st.Bavail * uint64(st.Bsize)
+	if totalBytes == 0 {
+		return nil, errors.New("invalid disk size returned")
+	}
+
+	totalGB := float64(totalBytes) / (1024 * 1024 * 1024)
+	freeGB := float64(totalFreeBytes) / (1024 * 1024 * 1024)
+	usedGB := totalGB - freeGB
+	freePercent := (freeGB / totalGB) * 100
+	usedPercent := 100 - freePercent
+
+	return &DiskInfo{
+		TotalGB:     totalGB,
+		UsedGB:      usedGB,
+		FreeGB:      freeGB,
+		UsedPercent: usedPercent,
+		FreePercent: freePercent,
+		TotalBytes:  totalBytes,
+		FreeBytes:   totalFreeBytes,
+	}, nil
+}
+
+// GetVolumeInfo returns the mount point and size of the filesystem holding path
+func GetVolumeInfo(path string) (*VolumeInfo, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return nil, fmt.Errorf("statfs %s failed: %v", path, err)
+	}
+
+	// The mount point is the topmost directory on the same device
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		return nil, fmt.Errorf("stat %s failed: %v", path, err)
+	}
+	root := filepath.Clean(path)
+	for root != "/" {
+		var parent syscall.Stat_t
+		if err := syscall.Stat(filepath.Dir(root), &parent); err != nil || parent.Dev != stat.Dev {
+			break
+		}
+		root = filepath.Dir(root)
+	}
+
+	return &VolumeInfo{Root: root, TotalBytes: st.Blocks * uint64(st.Bsize), Kind: volumeKind(uint32(st.Type), stat.Dev)}, nil
+}
+
+// remoteFilesystems are the statfs magic numbers of network filesystems
+var remoteFilesystems = map[uint32]bool{
+	0x6969:     true, // NFS
+	0x517B:     true, // SMB
+	0xFF534D42: true, // CIFS
+	0xFE534D42: true, // SMB2
+	0x01021997: true, // 9P
+}
+
+// volumeKind tells network filesystems from block devices, which the kernel
+// marks as rotational or not. Filesystems without a block device of their own,
+// such as tmpfs or btrfs subvolumes, are unknown.
+func volumeKind(fsType uint32, dev uint64) VolumeKind {
+	if remoteFilesystems[fsType] {
+		return VolumeRemote
+	}
+
+	major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+	minor := dev&0xff | (dev>>12)&^0xff
+	device, err := filepath.EvalSymlinks(fmt.Sprintf("/sys/dev/block/%d:%d", major, minor))
+	if err != nil {
+		return VolumeUnknown
+	}
+	// A partition has no queue of its own; its disk is the directory above
+	data, err := os.ReadFile(filepath.Join(device, "queue", "rotational"))
+	if err != nil {
+		data, err = os.ReadFile(filepath.Join(device, "..", "queue", "rotational"))
+	}
+	if err != nil {
+		return VolumeUnknown
+	}
+	if strings.TrimSpace(string(data)) == "1" {
+		return VolumeRotational
+	}
+	return VolumeSolid
+}
@@ -0,0 +1,62 @@
+//go:build linux
+
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListProcesses(t *testing.T) {
+	processes, err := NewProcessManager().ListProcesses()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, proc := range processes {
+		if int(proc.PID) == os.Getpid() {
+			if proc.Name != filepath.Base(exe) || proc.Path != exe || int(proc.ParentPID) != os.Getppid() {
+				t.Errorf("this process = %+v, want %s with parent %d", proc, exe, os.Getppid())
+			}
+			return
+		}
+	}
+	t.Errorf("this process (PID %d) is not listed", os.Getpid())
+}
+
+func TestIsProcessRunningByPath(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := NewProcessManager()
+	if err := pm.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if !pm.IsProcessRunning(filepath.Join(filepath.Dir(exe), "*.test")) || !pm.IsProcessRunning("/**/"+filepath.Base(exe)) {
+		t.Error("this process is not found by its image path")
+	}
+	if pm.IsProcessRunning("/nonexistent/**/" + filepath.Base(exe)) {
+		t.Error("a glob of another directory matched")
+	}
+}
+
+func TestVolumeKind(t *testing.T) {
+	if kind := volumeKind(0x6969, 0); kind != VolumeRemote {
+		t.Errorf("NFS kind = %s, want %s", kind, VolumeRemote)
+	}
+	info, err := GetVolumeInfo(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch info.Kind {
+	case VolumeSolid, VolumeRotational, VolumeRemote, VolumeUnknown:
+	default:
+		t.Errorf("kind = %q", info.Kind)
+	}
+}
@@ -0,0 +1,49 @@
+//go:build !windows && !linux
+
+package system
+
+// ProcessManager is a no-op outside Windows and Linux: no process is ever reported as running
+type ProcessManager struct{}
+
+// NewProcessManager creates a new process manager
+func NewProcessManager() *ProcessManager {
+	return &ProcessManager{}
+}
+
+// SetShutdownPolicies does nothing outside Windows and Linux
+func (pm *ProcessManager) SetShutdownPolicies(policies ShutdownPolicies) {}
+
+// Refresh is not supported outside Windows and Linux
+func (pm *ProcessManager) Refresh() error {
+	return ErrUnsupported
+}
+
+// ListProcesses is not supported outside Windows and Linux
+func (pm *ProcessManager) ListProcesses() ([]ProcessInfo, error) {
+	return nil, ErrUnsupported
+}
+
+// IsProcessRunning always reports false outside Windows and Linux
+func (pm *ProcessManager) IsProcessRunning(selector string) bool {
+	return false
+}
+
+// KillProcess is not supported outside Windows and Linux
+func (pm *ProcessManager) KillProcess(selector string) error {
+	return ErrUnsupported
+}
+
+// Killed returns nothing outside Windows and Linux
+func (pm *ProcessManager) Killed() []ProcessInfo {
+	return nil
+}
+
+// GetDiskInfo is not supported outside Windows and Linux
+func GetDiskInfo() (*DiskInfo, error) {
+	return nil, ErrUnsupported
+}
+
+// GetVolumeInfo is not supported outside Windows and Linux
+func GetVolumeInfo(path string) (*VolumeInfo, error) {
+	return nil, ErrUnsupported
+}
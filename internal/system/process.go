@@ -0,0 +1,145 @@
+//go:build windows || linux
+
+package system
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"nScript/internal/rules"
+)
+
+// ProcessManager finds and ends processes. Processes are selected by name, or
+// by a glob of their full image path when the selector contains a path
+// separator, e.g. C:\Program Files\Google\**\chrome.exe.
+type ProcessManager struct {
+	policies ShutdownPolicies
+
+	mu sync.Mutex
+	// processCache is the process list Refresh took; IsProcessRunning answers
+	// from it until the next Refresh. Without one every call lists processes.
+	processCache []ProcessInfo
+	cached       bool
+	killed       []ProcessInfo
+}
+
+// NewProcessManager creates a new process manager
+func NewProcessManager() *ProcessManager {
+	return &ProcessManager{}
+}
+
+// SetShutdownPolicies sets how KillProcess ends each process
+func (pm *ProcessManager) SetShutdownPolicies(policies ShutdownPolicies) {
+	pm.policies = policies
+}
+
+// Refresh takes the process list that IsProcessRunning answers from, so a phase
+// checking many browsers lists the processes once
+func (pm *ProcessManager) Refresh() error {
+	processes, err := pm.ListProcesses()
+	if err != nil {
+		return err
+	}
+	pm.mu.Lock()
+	pm.processCache, pm.cached = processes, true
+	pm.mu.Unlock()
+	return nil
+}
+
+// snapshot returns the cached process list, or a new one when there is none
+func (pm *ProcessManager) snapshot() ([]ProcessInfo, error) {
+	pm.mu.Lock()
+	processes, cached := pm.processCache, pm.cached
+	pm.mu.Unlock()
+	if cached {
+		return processes, nil
+	}
+	return pm.ListProcesses()
+}
+
+// matchProcess reports whether selector, a process name or an image path glob, selects proc
+func matchProcess(proc ProcessInfo, selector string) bool {
+	if strings.ContainsAny(selector, `\/`) {
+		return proc.Path != "" && rules.MatchGlob(selector, proc.Path)
+	}
+	return sameName(proc.Name, selector)
+}
+
+// IsProcessRunning reports whether a process matching selector is running
+func (pm *ProcessManager) IsProcessRunning(selector string) bool {
+	if selector == "" {
+		return false
+	}
+
+	processes, err := pm.snapshot()
+	if err != nil {
+		return false
+	}
+
+	for _, proc := range processes {
+		if matchProcess(proc, selector) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// KillProcess ends every process matching selector following its shutdown
+// policy. It always lists the processes anew: a PID from an older list may
+// belong to another program by now.
+func (pm *ProcessManager) KillProcess(selector string) error {
+	if selector == "" {
+		return errors.New("process name cannot be empty")
+	}
+
+	processes, err := pm.ListProcesses()
+	if err != nil {
+		return fmt.Errorf("failed to list processes: %v", err)
+	}
+
+	var matches []ProcessInfo
+	for _, proc := range processes {
+		if matchProcess(proc, selector) && int(proc.PID) != os.Getpid() {
+			matches = append(matches, proc)
+		}
+	}
+
+	if len(matches) == 0 {
+		return fmt.Errorf("process %s not found", selector)
+	}
+
+	ended, err := shutdown(pm, matches, pm.policies.For(selector))
+
+	pm.mu.Lock()
+	pm.killed = append(pm.killed, ended...)
+	if pm.cached {
+		pm.processCache = processes
+		for _, proc := range ended {
+			pm.processCache = removePID(pm.processCache, proc.PID)
+		}
+	}
+	pm.mu.Unlock()
+	return err
+}
+
+// removePID returns procs without the process with the given PID
+func removePID(procs []ProcessInfo, pid uint32) []ProcessInfo {
+	kept := make([]ProcessInfo, 0, len(procs))
+	for _, p := range procs {
+		if p.PID != pid {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// Killed returns the processes this manager has ended
+func (pm *ProcessManager) Killed() []ProcessInfo {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return append([]ProcessInfo(nil), pm.killed...)
+}
@@ -1,118 +1,368 @@
 package system
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
-	"time"
 
-	"golang.org/x/sys/windows/registry"
+	"nScript/internal/logging"
+	"nScript/internal/plan"
+	"nScript/internal/regbackup"
+	"nScript/internal/regfile"
+	"nScript/internal/tweaks"
+	"nScript/internal/winreg"
 )
 
 // RegistryManager handles Windows registry operations with backup functionality
 type RegistryManager struct {
-	backupDir string
+	reg      winreg.Registry
+	store    *regbackup.Store
+	run      *regbackup.Run
+	backupID string
+	archive  string
+	plan     *plan.Plan
+	backups  []RegistryBackup
+	deleted  []string
+	changed  []string
+
+	// mount loads the registry hive of a signed-out user for Import; mounted
+	// holds the unmount function of each hive it loaded, keyed by SID, and nil
+	// for hives that were already there
+	mount   func(sid string) (unmount func(), err error)
+	mounted map[string]func()
 }
 
-// NewRegistryManager creates a new registry manager
-func NewRegistryManager() *RegistryManager {
-	backupDir := filepath.Join(os.Getenv("TEMP"), "nScript_registry_backup")
-	os.MkdirAll(backupDir, 0755)
-
+// NewRegistryManager creates a new registry manager operating on reg that keeps its backups in store
+func NewRegistryManager(reg winreg.Registry, store *regbackup.Store) *RegistryManager {
 	return &RegistryManager{
-		backupDir: backupDir,
+		reg:   reg,
+		store: store,
 	}
 }
 
-// BackupKey creates a backup of a registry key before deletion
-func (rm *RegistryManager) BackupKey(root registry.Key, path string) error {
+// SetHiveMounter lets Import load the registry hive of a signed-out user whose
+// backup is under HKEY_USERS\<SID>. UnmountHives unloads what mount loaded.
+func (rm *RegistryManager) SetHiveMounter(mount func(sid string) (unmount func(), err error)) {
+	rm.mount = mount
+}
+
+// UnmountHives unloads the hives Import loaded
+func (rm *RegistryManager) UnmountHives() {
+	for _, unmount := range rm.mounted {
+		if unmount != nil {
+			unmount()
+		}
+	}
+	rm.mounted = nil
+}
+
+// SetPlan switches the manager to dry-run mode, recording changes into p instead of making them
+func (rm *RegistryManager) SetPlan(p *plan.Plan) {
+	rm.plan = p
+}
+
+// BackupKey exports a registry key and everything below it to a .reg file before deletion
+func (rm *RegistryManager) BackupKey(root winreg.Root, path string) error {
 	if path == "" {
 		return errors.New("registry path cannot be empty")
 	}
 
-	timestamp := time.Now().Format("20060102_150405")
-	backupFile := filepath.Join(rm.backupDir, fmt.Sprintf("%s_%s.backup", strings.ReplaceAll(path, "\\", "_"), timestamp))
+	f := &regfile.File{}
+	if err := rm.exportKey(root, path, f); err != nil {
+		if err == winreg.ErrNotExist {
+			return nil // Nothing to back up
+		}
+		return fmt.Errorf("failed to export key: %v", err)
+	}
+
+	return rm.writeBackup(root, path, f)
+}
+
+// writeBackup adds a backup of a key to this run's backups, starting the run on the first one
+func (rm *RegistryManager) writeBackup(root winreg.Root, path string, f *regfile.File) error {
+	if rm.run == nil {
+		run, err := rm.store.Begin()
+		if err != nil {
+			return err
+		}
+		rm.run = run
+		rm.backupID = run.ID()
+	}
+
+	key := root.String() + `\` + path
+	file, err := rm.run.Add(key, f)
+	if err != nil {
+		return err
+	}
+	rm.backups = append(rm.backups, RegistryBackup{Key: key, File: file})
+	return nil
+}
 
-	// Create backup file
-	file, err := os.Create(backupFile)
+// FinishBackups packs this run's backups into one archive and returns its path,
+// or an empty path when nothing was backed up
+func (rm *RegistryManager) FinishBackups() (string, error) {
+	if rm.run == nil {
+		return rm.archive, nil
+	}
+	archive, err := rm.run.Close()
 	if err != nil {
-		return fmt.Errorf("failed to create backup file: %v", err)
+		return "", fmt.Errorf("failed to archive registry backups: %v", err)
 	}
-	defer file.Close()
+	rm.run = nil
+	rm.archive = archive
+	return archive, nil
+}
 
-	// Write registry path info
-	file.WriteString(fmt.Sprintf("Registry Key Backup\n"))
-	file.WriteString(fmt.Sprintf("Path: %s\n", path))
-	file.WriteString(fmt.Sprintf("Root: %v\n", root))
-	file.WriteString(fmt.Sprintf("Timestamp: %s\n", time.Now().String()))
-	file.WriteString("---\n")
+// BackupID returns the ID of this run's backups, empty when nothing was backed up
+func (rm *RegistryManager) BackupID() string {
+	return rm.backupID
+}
 
-	// Try to backup key values
-	key, err := registry.OpenKey(root, path, registry.QUERY_VALUE|registry.ENUMERATE_SUB_KEYS)
+// exportKey appends a key, its values with their raw data and all its subkeys to f
+func (rm *RegistryManager) exportKey(root winreg.Root, path string, f *regfile.File) error {
+	key, err := rm.reg.OpenKey(root, path, winreg.Read)
 	if err != nil {
-		file.WriteString(fmt.Sprintf("Key not accessible: %v\n", err))
-		return nil // Key doesn't exist or not accessible - that's ok for backup
+		return err
 	}
 	defer key.Close()
 
-	// Backup values
-	valueNames, err := key.ReadValueNames(-1)
-	if err == nil {
-		file.WriteString("Values:\n")
-		for _, valueName := range valueNames {
-			val, _, err := key.GetValue(valueName, nil)
-			if err == nil {
-				file.WriteString(fmt.Sprintf("  %s = %v\n", valueName, val))
-			}
+	entry := regfile.Key{Path: root.LongName() + `\` + path}
+	names, err := key.ReadValueNames()
+	if err != nil {
+		return fmt.Errorf("failed to read values of %s: %v", path, err)
+	}
+	for _, name := range names {
+		value, err := key.GetValue(name)
+		if err != nil {
+			return fmt.Errorf("failed to read value %s of %s: %v", name, path, err)
 		}
+		entry.Values = append(entry.Values, value)
 	}
+	f.Keys = append(f.Keys, entry)
 
-	// Backup subkeys
-	subkeyNames, err := key.ReadSubKeyNames(-1)
-	if err == nil {
-		file.WriteString("Subkeys:\n")
-		for _, subkeyName := range subkeyNames {
-			file.WriteString(fmt.Sprintf("  %s\n", subkeyName))
+	subkeys, err := key.ReadSubKeyNames()
+	if err != nil {
+		return fmt.Errorf("failed to read subkeys of %s: %v", path, err)
+	}
+	for _, sub := range subkeys {
+		if err := rm.exportKey(root, path+`\`+sub, f); err != nil && err != winreg.ErrNotExist {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportBackup applies a .reg file written by BackupKey, or any REGEDIT5 file
+func (rm *RegistryManager) ImportBackup(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	imported, err := rm.Import(data)
+	if err != nil {
+		return imported, fmt.Errorf("%s: %v", path, err)
+	}
+	return imported, nil
+}
+
+// RestoreBackup imports the backups of one run whose key starts with prefix, or
+// all of them when prefix is empty. The newest backups are imported first, so a
+// key changed several times in a run ends up as it was before the run.
+func (rm *RegistryManager) RestoreBackup(id, prefix string) (int, error) {
+	manifest, err := rm.store.Manifest(id)
+	if err != nil {
+		return 0, err
+	}
+
+	imported, matched := 0, 0
+	for i := len(manifest.Entries) - 1; i >= 0; i-- {
+		entry := manifest.Entries[i]
+		if !hasKeyPrefix(entry.Key, prefix) {
+			continue
+		}
+		matched++
+		data, err := rm.store.ReadFile(id, entry.File)
+		if err != nil {
+			return imported, err
+		}
+		n, err := rm.Import(data)
+		imported += n
+		if err != nil {
+			return imported, fmt.Errorf("%s: %v", entry.File, err)
+		}
+	}
+	if matched == 0 && prefix != "" {
+		return 0, fmt.Errorf("backup %s has no key below %s", id, prefix)
+	}
+	return imported, nil
+}
+
+// hasKeyPrefix reports whether key is prefix or below it, ignoring case
+func hasKeyPrefix(key, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	prefix = strings.TrimSuffix(prefix, `\`)
+	// Accept HKEY_CURRENT_USER\... as well as the HKCU\... used in manifests
+	if rootName, rest, _ := strings.Cut(prefix, `\`); rest != "" {
+		if root, err := winreg.ParseRoot(rootName); err == nil {
+			prefix = root.String() + `\` + rest
+		}
+	}
+	return strings.EqualFold(key, prefix) ||
+		len(key) > len(prefix) && strings.EqualFold(key[:len(prefix)], prefix) && key[len(prefix)] == '\\'
+}
+
+// Import applies the contents of a .reg file: keys are created, values are
+// written with their original type, and [-key] and "name"=- entries delete.
+// Existing values not named in the file are left alone.
+func (rm *RegistryManager) Import(data []byte) (int, error) {
+	f, err := regfile.Parse(data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse backup: %v", err)
+	}
+
+	imported := 0
+	for _, entry := range f.Keys {
+		rootName, subkey, _ := strings.Cut(entry.Path, `\`)
+		root, err := winreg.ParseRoot(rootName)
+		if err != nil {
+			return imported, err
+		}
+		if subkey == "" {
+			return imported, fmt.Errorf("refusing to import into the root key %s", rootName)
 		}
+		if root == winreg.Users {
+			if err := rm.mountUser(subkey); err != nil {
+				return imported, err
+			}
+		}
+
+		if entry.Delete {
+			if err := rm.DeleteKeyRecursive(root, subkey); err != nil {
+				return imported, err
+			}
+			imported++
+			continue
+		}
+
+		key, err := rm.reg.CreateKey(root, subkey, winreg.Write)
+		if err != nil {
+			return imported, fmt.Errorf("failed to create key %s: %v", entry.Path, err)
+		}
+		err = importValues(key, entry.Values)
+		key.Close()
+		if err != nil {
+			return imported, fmt.Errorf("failed to import %s: %v", entry.Path, err)
+		}
+		imported++
 	}
+	return imported, nil
+}
 
+// mountUser makes sure the hive of the user whose key below HKEY_USERS is path
+// is loaded, loading a signed-out user's through the hive mounter
+func (rm *RegistryManager) mountUser(path string) error {
+	sid, _, _ := strings.Cut(path, `\`)
+	if !strings.HasPrefix(strings.ToUpper(sid), "S-1-") {
+		return nil
+	}
+	sid = strings.ToUpper(sid)
+	if _, ok := rm.mounted[sid]; ok {
+		return nil
+	}
+	if key, err := rm.reg.OpenKey(winreg.Users, sid, winreg.Read); err == nil {
+		key.Close()
+		rm.remember(sid, nil)
+		return nil
+	}
+	if rm.mount == nil {
+		return fmt.Errorf("the registry of %s is not loaded; sign in as that user and restore again", sid)
+	}
+	unmount, err := rm.mount(sid)
+	if err != nil {
+		return fmt.Errorf("the registry of %s is not loaded: %v", sid, err)
+	}
+	rm.remember(sid, unmount)
+	return nil
+}
+
+// remember records a hive mountUser found or loaded
+func (rm *RegistryManager) remember(sid string, unmount func()) {
+	if rm.mounted == nil {
+		rm.mounted = make(map[string]func())
+	}
+	rm.mounted[sid] = unmount
+}
+
+// importValues writes or deletes the values of one key
+func importValues(key winreg.Key, values []regfile.Value) error {
+	for _, v := range values {
+		if v.Delete {
+			if err := key.DeleteValue(v.Name); err != nil && err != winreg.ErrNotExist {
+				return fmt.Errorf("failed to delete value %s: %v", v.Name, err)
+			}
+			continue
+		}
+		if err := key.SetValue(v); err != nil {
+			return fmt.Errorf("failed to set value %s: %v", v.Name, err)
+		}
+	}
 	return nil
 }
 
-// DeleteKeyWithBackup safely deletes a registry key after backing it up
-func (rm *RegistryManager) DeleteKeyWithBackup(root registry.Key, path string) error {
+// DeleteKeyWithBackup safely deletes a registry key after backing it up. A missing key is not an error.
+func (rm *RegistryManager) DeleteKeyWithBackup(root winreg.Root, path string) error {
 	if path == "" {
 		return errors.New("registry path cannot be empty")
 	}
 
+	key, err := rm.reg.OpenKey(root, path, winreg.Read)
+	if err == winreg.ErrNotExist {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open key %s: %v", path, err)
+	}
+	key.Close()
+
+	if rm.plan != nil {
+		rm.plan.Add(plan.Action{Phase: "windows", Kind: plan.DeleteRegistryKey, Target: root.String() + `\` + path, Reason: "backed up, then deleted recursively"})
+		return nil
+	}
+
 	// Create backup first
 	if err := rm.BackupKey(root, path); err != nil {
 		return fmt.Errorf("backup failed: %v", err)
 	}
 
 	// Delete the key
-	return rm.DeleteKeyRecursive(root, path)
+	if err := rm.DeleteKeyRecursive(root, path); err != nil {
+		return err
+	}
+	rm.deleted = append(rm.deleted, root.String()+`\`+path)
+	return nil
 }
 
 // DeleteKeyRecursive recursively deletes a registry key with improved error handling
-func (rm *RegistryManager) DeleteKeyRecursive(root registry.Key, path string) error {
+func (rm *RegistryManager) DeleteKeyRecursive(root winreg.Root, path string) error {
 	if path == "" {
 		return errors.New("registry path cannot be empty")
 	}
 
-	key, err := registry.OpenKey(root, path, registry.ENUMERATE_SUB_KEYS|registry.SET_VALUE)
+	key, err := rm.reg.OpenKey(root, path, winreg.Read)
 	if err != nil {
 		// Key doesn't exist - that's fine
-		if err == registry.ErrNotExist {
+		if err == winreg.ErrNotExist {
 			return nil
 		}
 		return fmt.Errorf("failed to open key %s: %v", path, err)
 	}
 
 	// Get all subkeys
-	subkeys, err := key.ReadSubKeyNames(-1)
+	subkeys, err := key.ReadSubKeyNames()
 	key.Close()
 
 	if err == nil {
@@ -121,172 +371,174 @@ func (rm *RegistryManager) DeleteKeyRecursive(root registry.Key, path string) er
 			subkeyPath := path + `\` + subkey
 			if err := rm.DeleteKeyRecursive(root, subkeyPath); err != nil {
 				// Log error but continue with other subkeys
-				fmt.Printf("[-] Failed to delete subkey %s: %v\n", subkeyPath, err)
+				logging.Warn("Failed to delete registry subkey", "key", root.String()+`\`+subkeyPath, "error", err)
 			}
 		}
 	}
 
 	// Delete the key itself
-	err = registry.DeleteKey(root, path)
-	if err != nil && err != registry.ErrNotExist {
+	err = rm.reg.DeleteKey(root, path)
+	if err != nil && err != winreg.ErrNotExist {
 		return fmt.Errorf("failed to delete key %s: %v", path, err)
 	}
 
 	return nil
 }
 
-// ClearQuickAccessRecent clears File Explorer Quick Access with backup
-func (rm *RegistryManager) ClearQuickAccessRecent() error {
-	fmt.Println("[*] Clearing File Explorer Quick Access recent files...")
-
-	// Registry keys to clear
-	registryKeys := []string{
-		`Software\Microsoft\Windows\CurrentVersion\Explorer\RecentDocs`,
-		`Software\Microsoft\Windows\CurrentVersion\Explorer\TypedPaths`,
-		`Software\Microsoft\Windows\CurrentVersion\Explorer\RunMRU`,
-	}
-
-	for _, regPath := range registryKeys {
-		if err := rm.DeleteKeyWithBackup(registry.CURRENT_USER, regPath); err != nil {
-			fmt.Printf("[-] Failed to clear %s: %v\n", regPath, err)
-		}
-	}
-
-	// Clear file system locations
-	userHome := os.Getenv("APPDATA")
-
-	locations := []string{
-		filepath.Join(userHome, "Microsoft", "Windows", "Recent", "AutomaticDestinations"),
-		filepath.Join(userHome, "Microsoft", "Windows", "Recent", "CustomDestinations"),
-	}
-
-	for _, location := range locations {
-		if entries, err := os.ReadDir(location); err == nil {
-			for _, entry := range entries {
-				if err := os.Remove(filepath.Join(location, entry.Name())); err != nil {
-					fmt.Printf("[-] Failed to remove %s: %v\n", entry.Name(), err)
-				}
-			}
-		}
+// ApplyTweak performs one registry tweak. Keys are backed up before they are
+// deleted and values before they are changed, so restore-registry undoes the tweak.
+func (rm *RegistryManager) ApplyTweak(ctx context.Context, t tweaks.Tweak) error {
+	switch t.Kind {
+	case tweaks.DeleteKey:
+		return rm.DeleteKeyWithBackup(t.Root, t.Key)
+	case tweaks.DeleteSubkeys:
+		return rm.deleteSubkeys(ctx, t)
+	case tweaks.DeleteValue, tweaks.SetValue:
+		return rm.changeValue(t)
 	}
-
-	fmt.Println("[+] File Explorer Quick Access cleared")
-	return nil
+	return fmt.Errorf("unknown registry tweak %q", t.Kind)
 }
 
-// ClearExplorerUserAssist clears Explorer UserAssist data with backup
-func (rm *RegistryManager) ClearExplorerUserAssist() error {
-	fmt.Println("[*] Clearing Explorer UserAssist data (registry)...")
-	regPath := `Software\Microsoft\Windows\CurrentVersion\Explorer\UserAssist`
-
-	// Get subkeys to delete
-	key, err := registry.OpenKey(registry.CURRENT_USER, regPath, registry.ENUMERATE_SUB_KEYS)
+// deleteSubkeys deletes the subkeys matching the tweak's pattern, continuing past failures
+func (rm *RegistryManager) deleteSubkeys(ctx context.Context, t tweaks.Tweak) error {
+	key, err := rm.reg.OpenKey(t.Root, t.Key, winreg.Read)
+	if err == winreg.ErrNotExist {
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("could not open UserAssist key: %v", err)
+		return fmt.Errorf("could not open key %s: %v", t.Key, err)
 	}
-	defer key.Close()
-
-	subkeys, err := key.ReadSubKeyNames(-1)
+	subkeys, err := key.ReadSubKeyNames()
+	key.Close()
 	if err != nil {
 		return fmt.Errorf("failed to read subkeys: %v", err)
 	}
 
-	for _, sub := range subkeys {
-		fullPath := regPath + `\` + sub
-		if err := rm.DeleteKeyWithBackup(registry.CURRENT_USER, fullPath); err != nil {
-			fmt.Printf("[-] Failed to delete UserAssist subkey %s: %v\n", fullPath, err)
+	failed := 0
+	for _, subkey := range subkeys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !t.Matches(subkey) {
+			continue
+		}
+		fullPath := t.Key + `\` + subkey
+		if err := rm.DeleteKeyWithBackup(t.Root, fullPath); err != nil {
+			logging.Warn("Failed to delete registry key", "key", t.Root.String()+`\`+fullPath, "error", err)
+			failed++
 		}
 	}
-
-	fmt.Println("[+] Explorer UserAssist data cleared")
+	if failed > 0 {
+		return fmt.Errorf("%d subkeys of %s could not be deleted", failed, t.Key)
+	}
 	return nil
 }
 
-// ClearComDlgMRU clears common Open/Save dialog MRU entries with backup
-func (rm *RegistryManager) ClearComDlgMRU() error {
-	fmt.Println("[*] Clearing common Open/Save dialog MRU entries (ComDlg32)...")
+// changeValue sets or deletes one value. The backup holds the previous value,
+// or a deletion entry when the value did not exist before. When the key did not
+// exist either, the backup deletes the key that setting the value creates.
+func (rm *RegistryManager) changeValue(t tweaks.Tweak) error {
+	name := t.Value.Name
+	target := t.Root.String() + `\` + t.Key + `\` + name
+
+	previous := regfile.Value{Name: name, Delete: true}
+	keyExisted := true
+	key, err := rm.reg.OpenKey(t.Root, t.Key, winreg.Read)
+	switch {
+	case err == nil:
+		if v, err := key.GetValue(name); err == nil {
+			previous = v
+		} else if err != winreg.ErrNotExist {
+			key.Close()
+			return fmt.Errorf("failed to read %s: %v", name, err)
+		}
+		key.Close()
+	case err == winreg.ErrNotExist:
+		keyExisted = false
+	default:
+		return fmt.Errorf("failed to open key %s: %v", t.Key, err)
+	}
 
-	keys := []string{
-		`Software\Microsoft\Windows\CurrentVersion\Explorer\ComDlg32\OpenSavePidlMRU`,
-		`Software\Microsoft\Windows\CurrentVersion\Explorer\ComDlg32\OpenSaveMRU`,
-		`Software\Microsoft\Windows\CurrentVersion\Explorer\ComDlg32\LastVisitedPidlMRU`,
+	if t.Kind == tweaks.DeleteValue && previous.Delete {
+		return nil // Nothing to delete
 	}
 
-	for _, k := range keys {
-		if err := rm.DeleteKeyWithBackup(registry.CURRENT_USER, k); err != nil {
-			fmt.Printf("[-] Failed to clear %s: %v\n", k, err)
+	if rm.plan != nil {
+		kind := plan.SetRegistryValue
+		if t.Kind == tweaks.DeleteValue {
+			kind = plan.DeleteRegistryValue
 		}
+		rm.plan.Add(plan.Action{Phase: "windows", Kind: kind, Target: t.String(), Reason: "registry tweak " + t.Name})
+		return nil
 	}
 
-	fmt.Println("[+] ComDlg32 MRU entries cleared")
-	return nil
-}
-
-// ClearStartMenuRegistry clears Start Menu registry entries with backup
-func (rm *RegistryManager) ClearStartMenuRegistry() error {
-	fmt.Println("[*] Clearing Start Menu registry entries...")
-	regPath := `Software\Microsoft\Windows\CurrentVersion\CloudStore\Store\Cache\DefaultAccount`
-
-	key, err := registry.OpenKey(registry.CURRENT_USER, regPath, registry.ENUMERATE_SUB_KEYS)
-	if err != nil {
-		return fmt.Errorf("could not open CloudStore key: %v", err)
+	backup := &regfile.File{Keys: []regfile.Key{{Path: t.Root.LongName() + `\` + t.Key, Values: []regfile.Value{previous}}}}
+	if !keyExisted {
+		backup.Keys[0] = regfile.Key{Path: t.Root.LongName() + `\` + rm.firstMissingKey(t.Root, t.Key), Delete: true}
 	}
-	defer key.Close()
-
-	subkeys, err := key.ReadSubKeyNames(-1)
-	if err != nil {
-		return fmt.Errorf("failed to read subkeys: %v", err)
+	if err := rm.writeBackup(t.Root, t.Key, backup); err != nil {
+		return fmt.Errorf("backup failed: %v", err)
 	}
 
-	// Delete subkeys that contain start menu related data
-	for _, subkey := range subkeys {
-		lowerSubkey := strings.ToLower(subkey)
-		if strings.Contains(lowerSubkey, "start.tilegrid") ||
-			strings.Contains(lowerSubkey, "windows.data.placeholdertilecollection") ||
-			strings.Contains(lowerSubkey, "microsoft.windows.startmenuexperiencehost") {
-
-			fullPath := regPath + `\` + subkey
-			if err := rm.DeleteKeyWithBackup(registry.CURRENT_USER, fullPath); err != nil {
-				fmt.Printf("[-] Failed to delete Start Menu registry key %s: %v\n", fullPath, err)
-			}
+	if t.Kind == tweaks.DeleteValue {
+		key, err := rm.reg.OpenKey(t.Root, t.Key, winreg.Write)
+		if err != nil {
+			return fmt.Errorf("failed to open key %s: %v", t.Key, err)
+		}
+		defer key.Close()
+		if err := key.DeleteValue(name); err != nil && err != winreg.ErrNotExist {
+			return fmt.Errorf("failed to delete %s: %v", name, err)
+		}
+	} else {
+		// Create the key if it doesn't exist
+		key, err := rm.reg.CreateKey(t.Root, t.Key, winreg.Write)
+		if err != nil {
+			return fmt.Errorf("failed to create/open key %s: %v", t.Key, err)
+		}
+		defer key.Close()
+		if err := key.SetValue(t.Value); err != nil {
+			return fmt.Errorf("failed to set %s: %v", name, err)
 		}
 	}
-
-	fmt.Println("[+] Start Menu registry cache cleared")
+	rm.changed = append(rm.changed, target)
 	return nil
 }
 
-// EnableDarkMode enables Windows dark mode through registry
-func (rm *RegistryManager) EnableDarkMode() error {
-	regPath := `Software\Microsoft\Windows\CurrentVersion\Themes\Personalize`
-
-	key, err := registry.OpenKey(registry.CURRENT_USER, regPath, registry.ALL_ACCESS)
-	if err != nil {
-		// Create the key if it doesn't exist
-		key, _, err = registry.CreateKey(registry.CURRENT_USER, regPath, registry.ALL_ACCESS)
-		if err != nil {
-			return fmt.Errorf("failed to create/open Personalize key: %v", err)
+// firstMissingKey returns the topmost key of path that does not exist, which
+// is the one CreateKey creates along with everything below it
+func (rm *RegistryManager) firstMissingKey(root winreg.Root, path string) string {
+	for {
+		i := strings.LastIndex(path, `\`)
+		if i < 0 {
+			return path
+		}
+		key, err := rm.reg.OpenKey(root, path[:i], winreg.Read)
+		if err != winreg.ErrNotExist {
+			if err == nil {
+				key.Close()
+			}
+			return path
 		}
+		path = path[:i]
 	}
-	defer key.Close()
+}
 
-	// Set dark mode values
-	values := map[string]uint32{
-		"SystemUsesLightTheme": 0,
-		"AppsUseLightTheme":    0,
-		"ForceDarkMode":        1,
-	}
+// Backups returns the keys backed up during this run
+func (rm *RegistryManager) Backups() []RegistryBackup {
+	return rm.backups
+}
 
-	for name, value := range values {
-		if err := key.SetDWordValue(name, value); err != nil {
-			return fmt.Errorf("failed to set %s: %v", name, err)
-		}
-	}
+// DeletedKeys returns the keys deleted during this run
+func (rm *RegistryManager) DeletedKeys() []string {
+	return rm.deleted
+}
 
-	return nil
+// ChangedValues returns the values set or deleted during this run
+func (rm *RegistryManager) ChangedValues() []string {
+	return rm.changed
 }
 
 // GetBackupDirectory returns the backup directory path
 func (rm *RegistryManager) GetBackupDirectory() string {
-	return rm.backupDir
+	return rm.store.Root()
 }
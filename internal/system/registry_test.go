@@ -0,0 +1,386 @@
+package system
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"nScript/internal/fsys"
+	"nScript/internal/plan"
+	"nScript/internal/regbackup"
+	"nScript/internal/regfile"
+	"nScript/internal/tweaks"
+	"nScript/internal/winreg"
+)
+
+const (
+	explorerKey    = `Software\Microsoft\Windows\CurrentVersion\Explorer`
+	userAssistKey  = explorerKey + `\UserAssist`
+	comDlgKey      = explorerKey + `\ComDlg32`
+	cloudStoreKey  = `Software\Microsoft\Windows\CurrentVersion\CloudStore\Store\Cache\DefaultAccount`
+	personalizeKey = `Software\Microsoft\Windows\CurrentVersion\Themes\Personalize`
+)
+
+// backupCheckingRegistry fails the test when a key is deleted that no backup file contains
+type backupCheckingRegistry struct {
+	*winreg.Mem
+	t   *testing.T
+	dir string
+}
+
+func (r *backupCheckingRegistry) DeleteKey(root winreg.Root, path string) error {
+	if !backedUp(r.t, r.dir, root.LongName()+`\`+path) {
+		r.t.Errorf(`%s\%s deleted without a backup`, root, path)
+	}
+	return r.Mem.DeleteKey(root, path)
+}
+
+// backedUp reports whether a .reg file staged in dir contains key
+func backedUp(t *testing.T, dir, key string) bool {
+	files, _ := filepath.Glob(filepath.Join(dir, "*", "*.reg"))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := regfile.Parse(data)
+		if err != nil {
+			t.Fatalf("backup %s: %v", file, err)
+		}
+		for _, k := range f.Keys {
+			if strings.EqualFold(k.Path, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyOperation applies the built-in tweaks of one operation
+func applyOperation(rm *RegistryManager, name string) error {
+	var lastError error
+	for _, t := range tweaks.Defaults() {
+		if t.Name == name {
+			if err := rm.ApplyTweak(context.Background(), t); err != nil {
+				lastError = err
+			}
+		}
+	}
+	return lastError
+}
+
+// newTestManager returns a manager on an in-memory registry populated with keys
+func newTestManager(t *testing.T, keys ...string) (*RegistryManager, *winreg.Mem) {
+	mem := winreg.NewMem()
+	for _, path := range keys {
+		key, err := mem.CreateKey(winreg.CurrentUser, path, winreg.Write)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key.SetValue(regfile.String("", path))
+		key.SetValue(regfile.BinaryValue("MRUListEx", []byte{0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff}))
+		key.Close()
+	}
+	dir := t.TempDir()
+	rm := NewRegistryManager(mem, regbackup.NewStore(fsys.OS{}, dir))
+	rm.reg = &backupCheckingRegistry{Mem: mem, t: t, dir: dir}
+	return rm, mem
+}
+
+func TestRegistryOperations(t *testing.T) {
+	startTiles := cloudStoreKey + `\$de${7cd1c8ba}$start.tilegrid$windows.data.curatedtilecollection.tilecollection`
+	placeholders := cloudStoreKey + `\$de${7cd1c8ba}$windows.data.placeholdertilecollection`
+	experienceHost := cloudStoreKey + `\$de${7cd1c8ba}$microsoft.windows.startmenuexperiencehost$start`
+	notifications := cloudStoreKey + `\$de${7cd1c8ba}$windows.data.notifications.quickactiontilecollection`
+
+	tests := []struct {
+		name    string
+		keys    []string
+		removed []string
+	}{
+		{
+			"quick-access",
+			[]string{explorerKey + `\RecentDocs\.docx`, explorerKey + `\TypedPaths`, explorerKey + `\RunMRU`, explorerKey + `\Advanced`},
+			[]string{explorerKey + `\RecentDocs`, explorerKey + `\TypedPaths`, explorerKey + `\RunMRU`},
+		},
+		{
+			"userassist",
+			[]string{userAssistKey + `\{CEBFF5CD-ACE2-4F4F-9178-9926F41749EA}\Count`, userAssistKey + `\{F4E57C4B-2036-45F0-A9AB-443BCFE33D9F}\Count`},
+			[]string{userAssistKey + `\{CEBFF5CD-ACE2-4F4F-9178-9926F41749EA}`, userAssistKey + `\{F4E57C4B-2036-45F0-A9AB-443BCFE33D9F}`},
+		},
+		{
+			"comdlg-mru",
+			[]string{comDlgKey + `\OpenSavePidlMRU\docx`, comDlgKey + `\LastVisitedPidlMRU`, comDlgKey + `\CIDSizeMRU`},
+			[]string{comDlgKey + `\OpenSavePidlMRU`, comDlgKey + `\LastVisitedPidlMRU`},
+		},
+		{
+			"start-menu",
+			[]string{startTiles + `\Current`, placeholders, experienceHost, notifications},
+			[]string{startTiles, placeholders, experienceHost},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rm, mem := newTestManager(t, tt.keys...)
+			if err := applyOperation(rm, tt.name); err != nil {
+				t.Fatal(err)
+			}
+
+			var want []string
+			for _, path := range tt.removed {
+				want = append(want, `HKCU\`+path)
+				if mem.Exists(winreg.CurrentUser, path) {
+					t.Errorf("%s was not removed", path)
+				}
+			}
+			if got := rm.DeletedKeys(); !slices.Equal(got, want) {
+				t.Errorf("DeletedKeys() = %q, want %q", got, want)
+			}
+			if len(rm.Backups()) != len(tt.removed) {
+				t.Errorf("got %d backups, want %d", len(rm.Backups()), len(tt.removed))
+			}
+
+			for _, path := range tt.keys {
+				removed := slices.ContainsFunc(tt.removed, func(r string) bool { return strings.HasPrefix(path, r) })
+				if !removed && !mem.Exists(winreg.CurrentUser, path) {
+					t.Errorf("%s was removed", path)
+				}
+			}
+		})
+	}
+}
+
+func TestDeniedAndMissingKeys(t *testing.T) {
+	denied := userAssistKey + `\{CEBFF5CD-ACE2-4F4F-9178-9926F41749EA}`
+	allowed := userAssistKey + `\{F4E57C4B-2036-45F0-A9AB-443BCFE33D9F}`
+	rm, mem := newTestManager(t, denied+`\Count`, allowed+`\Count`)
+	mem.Deny(winreg.CurrentUser, denied)
+
+	if err := applyOperation(rm, "userassist"); err == nil {
+		t.Error("denied subkey was not reported")
+	}
+	if got := rm.DeletedKeys(); !slices.Equal(got, []string{`HKCU\` + allowed}) {
+		t.Errorf("DeletedKeys() = %q", got)
+	}
+	if !mem.Exists(winreg.CurrentUser, denied) {
+		t.Error("denied key was removed")
+	}
+
+	// None of the keys exist: nothing is backed up or deleted
+	rm, _ = newTestManager(t)
+	for _, op := range []string{"comdlg-mru", "userassist"} {
+		if err := applyOperation(rm, op); err != nil {
+			t.Errorf("%s: %v", op, err)
+		}
+	}
+	if len(rm.DeletedKeys()) != 0 || len(rm.Backups()) != 0 {
+		t.Errorf("deleted %q, backed up %v", rm.DeletedKeys(), rm.Backups())
+	}
+}
+
+func TestBackupRestoresDeletedKey(t *testing.T) {
+	path := comDlgKey + `\OpenSavePidlMRU`
+	rm, mem := newTestManager(t, path+`\docx`)
+	key, _ := mem.OpenKey(winreg.CurrentUser, path, winreg.Write)
+	values := []regfile.Value{
+		regfile.ExpandString("Expand", `%USERPROFILE%\Documents`),
+		regfile.MultiString("Multi", []string{"a", "b"}),
+		regfile.DWordValue("DWord", 7),
+		regfile.QWordValue("QWord", 1<<33),
+	}
+	for _, v := range values {
+		key.SetValue(v)
+	}
+	key.Close()
+
+	if err := applyOperation(rm, "comdlg-mru"); err != nil {
+		t.Fatal(err)
+	}
+	if mem.Exists(winreg.CurrentUser, path) {
+		t.Fatal("key was not removed")
+	}
+
+	if len(rm.Backups()) != 1 {
+		t.Fatalf("got %d backups, want 1", len(rm.Backups()))
+	}
+	archive, err := rm.FinishBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(archive); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	if _, err := rm.RestoreBackup(rm.BackupID(), `HKCU\Software\Other`); err == nil {
+		t.Error("restoring below a key without backups succeeded")
+	}
+	if n, err := rm.RestoreBackup(rm.BackupID(), `HKEY_CURRENT_USER\`+path); err != nil || n != 2 {
+		t.Fatalf("RestoreBackup = %d, %v", n, err)
+	}
+
+	key, err = mem.OpenKey(winreg.CurrentUser, path, winreg.Read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	for _, want := range values {
+		got, err := key.GetValue(want.Name)
+		if err != nil || got.Type != want.Type || !bytes.Equal(got.Data, want.Data) {
+			t.Errorf("value %s = %+v, %v, want %+v", want.Name, got, err, want)
+		}
+	}
+	if !mem.Exists(winreg.CurrentUser, path+`\docx`) {
+		t.Error("subkey was not restored")
+	}
+}
+
+func TestValueTweaksAreUndoable(t *testing.T) {
+	rm, mem := newTestManager(t, personalizeKey)
+	key, _ := mem.OpenKey(winreg.CurrentUser, personalizeKey, winreg.Write)
+	key.SetValue(regfile.DWordValue("AppsUseLightTheme", 1))
+	key.Close()
+
+	if err := applyOperation(rm, "dark-mode"); err != nil {
+		t.Fatal(err)
+	}
+	wordWheel := tweaks.Tweak{Name: "wordwheel", Kind: tweaks.DeleteValue, Root: winreg.CurrentUser, Key: personalizeKey, Value: regfile.Value{Name: "MRUListEx"}}
+	if err := rm.ApplyTweak(context.Background(), wordWheel); err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ = mem.OpenKey(winreg.CurrentUser, personalizeKey, winreg.Read)
+	for name, want := range map[string]uint64{"SystemUsesLightTheme": 0, "AppsUseLightTheme": 0, "ForceDarkMode": 1} {
+		v, err := key.GetValue(name)
+		if err != nil || v.Type != regfile.DWord || v.Uint64() != want {
+			t.Errorf("%s = %+v, %v, want dword %d", name, v, err, want)
+		}
+	}
+	if _, err := key.GetValue("MRUListEx"); err != winreg.ErrNotExist {
+		t.Errorf("MRUListEx was not deleted: %v", err)
+	}
+	key.Close()
+	if got := len(rm.ChangedValues()); got != 4 {
+		t.Errorf("got %d changed values, want 4", got)
+	}
+
+	// Restoring the backups puts back the old value and removes the new ones
+	if len(rm.Backups()) != 4 {
+		t.Fatalf("got %d backups, want 4", len(rm.Backups()))
+	}
+	if _, err := rm.FinishBackups(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := rm.RestoreBackup(rm.BackupID(), ""); err != nil || n != 4 {
+		t.Fatalf("RestoreBackup = %d, %v", n, err)
+	}
+	key, _ = mem.OpenKey(winreg.CurrentUser, personalizeKey, winreg.Read)
+	defer key.Close()
+	names, _ := key.ReadValueNames()
+	slices.Sort(names)
+	if want := []string{"", "AppsUseLightTheme", "MRUListEx"}; !slices.Equal(names, want) {
+		t.Errorf("values after restore = %q, want %q", names, want)
+	}
+	if v, _ := key.GetValue("AppsUseLightTheme"); v.Uint64() != 1 {
+		t.Errorf("AppsUseLightTheme = %d after restore, want 1", v.Uint64())
+	}
+}
+
+func TestRegistryPlanChangesNothing(t *testing.T) {
+	path := comDlgKey + `\OpenSaveMRU`
+	rm, mem := newTestManager(t, path)
+	p := plan.New()
+	rm.SetPlan(p)
+
+	for _, op := range []string{"comdlg-mru", "dark-mode"} {
+		if err := applyOperation(rm, op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !mem.Exists(winreg.CurrentUser, path) || mem.Exists(winreg.CurrentUser, personalizeKey) {
+		t.Error("dry run changed the registry")
+	}
+	if len(rm.Backups()) != 0 || len(rm.DeletedKeys()) != 0 || rm.BackupID() != "" {
+		t.Error("dry run recorded backups or deletions")
+	}
+}
+
+func TestImportLoadsSignedOutUsersHive(t *testing.T) {
+	const sid = "S-1-5-21-1-1001"
+	rm, mem := newTestManager(t)
+	hive := filepath.Join("Users", "bob", "NTUSER.DAT")
+	mem.AddHive(hive)
+	backup := (&regfile.File{Keys: []regfile.Key{
+		{Path: `HKEY_USERS\` + sid + `\` + personalizeKey, Values: []regfile.Value{regfile.DWordValue("AppsUseLightTheme", 1)}},
+	}}).Format()
+
+	// Without a way to load the hive the user must be signed in
+	if _, err := rm.Import([]byte(backup)); err == nil || !strings.Contains(err.Error(), "sign in") {
+		t.Fatalf("Import for a signed-out user = %v, want an error asking to sign in", err)
+	}
+
+	var loaded []string
+	rm.SetHiveMounter(func(sid string) (func(), error) {
+		loaded = append(loaded, sid)
+		if err := mem.LoadHive(sid, hive); err != nil {
+			return nil, err
+		}
+		return func() { mem.UnloadHive(sid) }, nil
+	})
+	for range 2 {
+		if n, err := rm.Import([]byte(backup)); err != nil || n != 1 {
+			t.Fatalf("Import = %d, %v", n, err)
+		}
+	}
+	if len(loaded) != 1 || !mem.Exists(winreg.Users, sid+`\`+personalizeKey) {
+		t.Fatalf("hive loaded %d times, key restored: %v", len(loaded), mem.Exists(winreg.Users, sid+`\`+personalizeKey))
+	}
+	rm.UnmountHives()
+	if mem.Exists(winreg.Users, sid) {
+		t.Error("the hive is still loaded after UnmountHives")
+	}
+
+	// A signed-in user's hive is used as it is and left loaded
+	if err := mem.LoadHive(sid, hive); err != nil {
+		t.Fatal(err)
+	}
+	loaded = nil
+	if _, err := rm.Import([]byte(backup)); err != nil || len(loaded) != 0 {
+		t.Fatalf("Import for a signed-in user = %v, loaded %v", err, loaded)
+	}
+	rm.UnmountHives()
+	if !mem.Exists(winreg.Users, sid) {
+		t.Error("a signed-in user's hive was unloaded")
+	}
+}
+
+func TestRestoreRemovesCreatedKey(t *testing.T) {
+	rm, mem := newTestManager(t, `Software\Policies`)
+	created := `Software\Policies\Microsoft\Windows\Explorer`
+	tweak := tweaks.Tweak{Name: "policy", Kind: tweaks.SetValue, Root: winreg.CurrentUser, Key: created, Value: regfile.DWordValue("DisableSearchBoxSuggestions", 1)}
+	if err := rm.ApplyTweak(context.Background(), tweak); err != nil {
+		t.Fatal(err)
+	}
+	if !mem.Exists(winreg.CurrentUser, created) {
+		t.Fatal("the key was not created")
+	}
+
+	if _, err := rm.FinishBackups(); err != nil {
+		t.Fatal(err)
+	}
+	// Deleting what the tweak created needs no backup
+	rm.reg = mem
+	if n, err := rm.RestoreBackup(rm.BackupID(), ""); err != nil || n != 1 {
+		t.Fatalf("RestoreBackup = %d, %v", n, err)
+	}
+	// Every key the tweak created goes, the one that was there stays
+	if mem.Exists(winreg.CurrentUser, `Software\Policies\Microsoft`) {
+		t.Error("keys created by the tweak are left after the restore")
+	}
+	if !mem.Exists(winreg.CurrentUser, `Software\Policies`) {
+		t.Error("the restore deleted a key that existed before the tweak")
+	}
+}
@@ -0,0 +1,148 @@
+//go:build windows || linux
+
+package system
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"nScript/internal/logging"
+)
+
+// shutdownPoll is how often processes asked to close are checked for exit
+const shutdownPoll = 250 * time.Millisecond
+
+// errExited is returned by terminate and requestClose for a process that is already gone
+var errExited = errors.New("process has exited")
+
+// processControl is what the shutdown escalation needs from the platform
+type processControl interface {
+	ListProcesses() ([]ProcessInfo, error)
+	// requestClose asks a process to exit; it fails when the process cannot be asked
+	requestClose(pid uint32) error
+	terminate(pid uint32) error
+	// startTime orders processes by start; its unit differs per platform
+	startTime(pid uint32) (uint64, error)
+}
+
+// shutdown ends procs according to policy: it asks them to close, waits up to
+// the policy's timeout and then terminates what is left, with its process tree
+// when the policy says so. It returns the processes that ended, each with the
+// stage that ended it.
+func shutdown(pc processControl, procs []ProcessInfo, policy ShutdownPolicy) ([]ProcessInfo, error) {
+	var ended []ProcessInfo
+	remaining := procs
+
+	if policy.Close {
+		asked := false
+		for _, proc := range procs {
+			if err := pc.requestClose(proc.PID); err == nil || errors.Is(err, errExited) {
+				asked = true
+			} else {
+				logging.Debug("Cannot ask process to close", "process", proc.Name, "pid", proc.PID, "error", err)
+			}
+		}
+		if asked {
+			remaining = waitForExit(pc, procs, policy.Timeout)
+			for _, proc := range procs {
+				if !containsPID(remaining, proc.PID) {
+					proc.Stage = StageClosed
+					ended = append(ended, proc)
+				}
+			}
+		}
+	}
+	if len(remaining) == 0 {
+		return ended, nil
+	}
+
+	var running []ProcessInfo
+	if policy.Tree {
+		var err error
+		if running, err = pc.ListProcesses(); err != nil {
+			return ended, fmt.Errorf("failed to list processes: %v", err)
+		}
+	}
+	terminated := make(map[uint32]bool)
+	for _, proc := range remaining {
+		members := []ProcessInfo{proc}
+		if policy.Tree {
+			members = processTree(pc, running, proc)
+		}
+		for _, member := range members {
+			if terminated[member.PID] {
+				continue
+			}
+			err := pc.terminate(member.PID)
+			if errors.Is(err, errExited) {
+				continue
+			}
+			if err != nil {
+				if member.PID == proc.PID {
+					return ended, fmt.Errorf("failed to terminate process %s (PID: %d): %v", proc.Name, proc.PID, err)
+				}
+				logging.Debug("Failed to terminate child process", "process", member.Name, "pid", member.PID, "error", err)
+				continue
+			}
+			terminated[member.PID] = true
+			member.Stage = StageTerminated
+			ended = append(ended, member)
+		}
+	}
+	return ended, nil
+}
+
+// waitForExit waits up to timeout for procs to exit and returns those still running
+func waitForExit(pc processControl, procs []ProcessInfo, timeout time.Duration) []ProcessInfo {
+	deadline := time.Now().Add(timeout)
+	for {
+		running, err := pc.ListProcesses()
+		if err != nil {
+			return procs
+		}
+		var left []ProcessInfo
+		for _, proc := range procs {
+			// A reused PID belongs to another program
+			if slices.ContainsFunc(running, func(p ProcessInfo) bool { return p.PID == proc.PID && p.Name == proc.Name }) {
+				left = append(left, proc)
+			}
+		}
+		if len(left) == 0 || !time.Now().Before(deadline) {
+			return left
+		}
+		procs = left
+		time.Sleep(shutdownPoll)
+	}
+}
+
+// processTree returns root and its descendants among running, children before
+// their parents. A process whose parent PID was reused is not a descendant, so
+// a child that started before its parent is left out, as is nScript itself.
+func processTree(pc processControl, running []ProcessInfo, root ProcessInfo) []ProcessInfo {
+	tree := []ProcessInfo{root}
+	for i := 0; i < len(tree); i++ {
+		parentStart, err := pc.startTime(tree[i].PID)
+		if err != nil {
+			continue
+		}
+		for _, proc := range running {
+			if proc.ParentPID != tree[i].PID || int(proc.PID) == os.Getpid() || containsPID(tree, proc.PID) {
+				continue
+			}
+			if start, err := pc.startTime(proc.PID); err != nil || start < parentStart {
+				continue
+			}
+			tree = append(tree, proc)
+		}
+	}
+	slices.Reverse(tree)
+	return tree
+}
+
+// containsPID reports whether procs holds the process with the given PID
+func containsPID(procs []ProcessInfo, pid uint32) bool {
+	return slices.ContainsFunc(procs, func(p ProcessInfo) bool { return p.PID == pid })
+}
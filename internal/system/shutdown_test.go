@@ -0,0 +1,117 @@
+//go:build windows || linux
+
+package system
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeProcesses is a process table that processes leave when closed or terminated
+type fakeProcesses struct {
+	running []ProcessInfo
+	// closable processes exit when asked to close, with their children
+	closable   map[uint32]bool
+	started    map[uint32]uint64
+	terminated []uint32
+}
+
+func (f *fakeProcesses) ListProcesses() ([]ProcessInfo, error) {
+	return slices.Clone(f.running), nil
+}
+
+func (f *fakeProcesses) requestClose(pid uint32) error {
+	if f.closable[pid] {
+		f.running = slices.DeleteFunc(f.running, func(p ProcessInfo) bool { return p.PID == pid || p.ParentPID == pid })
+	}
+	return nil
+}
+
+func (f *fakeProcesses) terminate(pid uint32) error {
+	if !containsPID(f.running, pid) {
+		return errExited
+	}
+	f.terminated = append(f.terminated, pid)
+	f.running = slices.DeleteFunc(f.running, func(p ProcessInfo) bool { return p.PID == pid })
+	return nil
+}
+
+func (f *fakeProcesses) startTime(pid uint32) (uint64, error) {
+	return f.started[pid], nil
+}
+
+func browserProcesses() *fakeProcesses {
+	return &fakeProcesses{
+		running: []ProcessInfo{
+			{Name: "chrome.exe", PID: 10, ParentPID: 1},
+			{Name: "chrome.exe", PID: 11, ParentPID: 10},
+			{Name: "crashpad.exe", PID: 12, ParentPID: 11},
+			// Started before 10, so its parent PID belongs to an older process
+			{Name: "notepad.exe", PID: 13, ParentPID: 10},
+		},
+		closable: map[uint32]bool{},
+		started:  map[uint32]uint64{10: 100, 11: 101, 12: 102, 13: 50},
+	}
+}
+
+func stages(ended []ProcessInfo) map[uint32]string {
+	m := make(map[uint32]string)
+	for _, p := range ended {
+		m[p.PID] = p.Stage
+	}
+	return m
+}
+
+func TestShutdownClosesFirst(t *testing.T) {
+	f := browserProcesses()
+	f.closable[10] = true
+	ended, err := shutdown(f, slices.Clone(f.running[:1]), ShutdownPolicy{Close: true, Timeout: time.Second, Tree: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ended) != 1 || ended[0].Stage != StageClosed || len(f.terminated) != 0 {
+		t.Errorf("ended = %+v, terminated = %v", ended, f.terminated)
+	}
+}
+
+func TestShutdownTerminatesTree(t *testing.T) {
+	f := browserProcesses()
+	start := time.Now()
+	ended, err := shutdown(f, slices.Clone(f.running[:1]), ShutdownPolicy{Close: true, Timeout: 2 * shutdownPoll, Tree: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 2*shutdownPoll {
+		t.Error("terminated before the timeout")
+	}
+	// Children first, and never the unrelated process with a reused parent PID
+	if !slices.Equal(f.terminated, []uint32{12, 11, 10}) {
+		t.Errorf("terminated = %v", f.terminated)
+	}
+	if got := stages(ended); len(got) != 3 || got[10] != StageTerminated {
+		t.Errorf("stages = %v", got)
+	}
+}
+
+func TestShutdownWithoutClose(t *testing.T) {
+	f := browserProcesses()
+	f.closable[10] = true
+	ended, err := shutdown(f, slices.Clone(f.running[:1]), ShutdownPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(f.terminated, []uint32{10}) || len(ended) != 1 || ended[0].Stage != StageTerminated {
+		t.Errorf("ended = %+v, terminated = %v", ended, f.terminated)
+	}
+}
+
+func TestShutdownPolicies(t *testing.T) {
+	policies := ShutdownPolicies{
+		Default:   ShutdownPolicy{Close: true, Timeout: time.Second},
+		Overrides: map[string]ShutdownPolicy{"startmenuexperiencehost.exe": {}},
+	}
+	if policies.For("StartMenuExperienceHost.exe").Close || !policies.For("chrome.exe").Close {
+		t.Errorf("For ignores the overrides")
+	}
+}
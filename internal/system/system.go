@@ -0,0 +1,93 @@
+package system
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrUnsupported is returned by operations that do not exist on the running system
+var ErrUnsupported = errors.New("operation is not supported on this system")
+
+// ProcessInfo contains process information
+type ProcessInfo struct {
+	Name      string
+	PID       uint32
+	ParentPID uint32
+	// Path is the full path of the executable, empty when it cannot be read
+	Path string
+	// Stage is how KillProcess ended the process, set only in Killed
+	Stage string
+}
+
+// Stages of the shutdown escalation, recorded for every process KillProcess ended
+const (
+	// StageClosed means the process exited after being asked to close
+	StageClosed = "closed"
+	// StageTerminated means the process, or the one that started it, was terminated
+	StageTerminated = "terminated"
+)
+
+// ShutdownPolicy says how KillProcess ends a process
+type ShutdownPolicy struct {
+	// Close asks the process to exit before terminating it: WM_CLOSE to its
+	// top-level windows on Windows, SIGTERM on Linux
+	Close bool
+	// Timeout is how long to wait for the process to exit after asking
+	Timeout time.Duration
+	// Tree also terminates the processes the process started, such as a
+	// browser's GPU and crash handler processes
+	Tree bool
+}
+
+// ShutdownPolicies is the policy for every process with overrides for single
+// processes, keyed by lower-case process name
+type ShutdownPolicies struct {
+	Default   ShutdownPolicy
+	Overrides map[string]ShutdownPolicy
+}
+
+// For returns the policy of the named process
+func (p ShutdownPolicies) For(name string) ShutdownPolicy {
+	if policy, ok := p.Overrides[strings.ToLower(name)]; ok {
+		return policy
+	}
+	return p.Default
+}
+
+// RegistryBackup is a registry key saved before it was changed
+type RegistryBackup struct {
+	Key  string
+	File string
+}
+
+// VolumeInfo identifies the volume holding a path
+type VolumeInfo struct {
+	// Root is where the volume is mounted, e.g. C:\ or /home
+	Root       string
+	TotalBytes uint64
+	Kind       VolumeKind
+}
+
+// VolumeKind is the kind of storage behind a volume, which decides how many
+// file operations it takes at once
+type VolumeKind string
+
+const (
+	VolumeUnknown    VolumeKind = "unknown"
+	VolumeSolid      VolumeKind = "ssd"
+	VolumeRotational VolumeKind = "hdd"
+	// VolumeRemote is a network share, such as a redirected profile folder
+	VolumeRemote VolumeKind = "remote"
+)
+
+// DiskInfo contains disk space information
+type DiskInfo struct {
+	TotalGB     float64
+	UsedGB      float64
+	FreeGB      float64
+	UsedPercent float64
+	FreePercent float64
+	TotalBytes  uint64
+	FreeBytes   uint64
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package system
+
+// GetWindowsVersion is not supported outside Windows
+func GetWindowsVersion() (major, minor, build uint32, err error) {
+	return 0, 0, 0, ErrUnsupported
+}
+
+// ClearRecycleBin is not supported outside Windows
+func ClearRecycleBin() error {
+	return ErrUnsupported
+}
+
+// RestartExplorer is not supported outside Windows
+func RestartExplorer(pm *ProcessManager) error {
+	return ErrUnsupported
+}
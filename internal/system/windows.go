@@ -1,3 +1,5 @@
+//go:build windows
+
 package system
 
 import (
@@ -7,30 +9,13 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 	"unsafe"
 
 	"golang.org/x/sys/windows"
 )
 
-// ProcessManager handles Windows process operations with improved safety
-type ProcessManager struct {
-	processCache map[string]*windows.ProcessEntry32
-}
-
-// NewProcessManager creates a new process manager
-func NewProcessManager() *ProcessManager {
-	return &ProcessManager{
-		processCache: make(map[string]*windows.ProcessEntry32),
-	}
-}
-
-// ProcessInfo contains process information
-type ProcessInfo struct {
-	Name string
-	PID  uint32
-}
-
 // ListProcesses returns all running processes with validation
 func (pm *ProcessManager) ListProcesses() ([]ProcessInfo, error) {
 	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
@@ -56,8 +41,10 @@ func (pm *ProcessManager) ListProcesses() ([]ProcessInfo, error) {
 		exeName := windows.UTF16ToString(pe32.ExeFile[:])
 		if exeName != "" { // Validate process name
 			processes = append(processes, ProcessInfo{
-				Name: exeName,
-				PID:  pe32.ProcessID,
+				Name:      exeName,
+				PID:       pe32.ProcessID,
+				ParentPID: pe32.ParentProcessID,
+				Path:      imagePath(pe32.ProcessID),
 			})
 		}
 
@@ -69,68 +56,103 @@ func (pm *ProcessManager) ListProcesses() ([]ProcessInfo, error) {
 	return processes, nil
 }
 
-// IsProcessRunning checks if a process is running with validation
-func (pm *ProcessManager) IsProcessRunning(name string) bool {
-	if name == "" {
-		return false
-	}
-
-	processes, err := pm.ListProcesses()
+// imagePath returns the full path of a process's executable, empty for
+// protected and system processes that cannot be opened
+func imagePath(pid uint32) string {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
 	if err != nil {
-		return false
+		return ""
 	}
-
-	name = strings.ToLower(name)
-	for _, proc := range processes {
-		if strings.ToLower(proc.Name) == name {
-			return true
+	defer windows.CloseHandle(handle)
+
+	// Few executables live in paths longer than MAX_PATH, so try that size first
+	for _, n := range []int{windows.MAX_PATH, windows.MAX_LONG_PATH} {
+		buf := make([]uint16, n)
+		size := uint32(len(buf))
+		err := windows.QueryFullProcessImageName(handle, 0, &buf[0], &size)
+		if err == nil {
+			return windows.UTF16ToString(buf[:size])
+		}
+		if !errors.Is(err, windows.ERROR_INSUFFICIENT_BUFFER) {
+			break
 		}
 	}
+	return ""
+}
 
-	return false
+// sameName compares process names the way Windows does, ignoring case
+func sameName(a, b string) bool {
+	return strings.EqualFold(a, b)
 }
 
-// KillProcess safely terminates a process with confirmation
-func (pm *ProcessManager) KillProcess(name string, forceMode bool) error {
-	if name == "" {
-		return errors.New("process name cannot be empty")
-	}
+const wmClose = 0x0010
+
+var (
+	user32          = windows.NewLazySystemDLL("user32.dll")
+	procPostMessage = user32.NewProc("PostMessageW")
+
+	// EnumWindows reports windows through a callback, and Go limits how many
+	// callbacks a program may create, so one callback collects into shared state
+	enumMu      sync.Mutex
+	enumOwner   uint32
+	enumFound   []windows.HWND
+	enumWindows = windows.NewCallback(func(hwnd windows.HWND, _ uintptr) uintptr {
+		var pid uint32
+		if _, err := windows.GetWindowThreadProcessId(hwnd, &pid); err == nil && pid == enumOwner && windows.IsWindowVisible(hwnd) {
+			enumFound = append(enumFound, hwnd)
+		}
+		return 1 // continue enumerating
+	})
+)
 
-	processes, err := pm.ListProcesses()
+// requestClose posts WM_CLOSE to the visible top-level windows of a process,
+// as clicking their close buttons would. A process without windows cannot be asked.
+func (pm *ProcessManager) requestClose(pid uint32) error {
+	enumMu.Lock()
+	enumOwner, enumFound = pid, nil
+	err := windows.EnumWindows(enumWindows, nil)
+	found := enumFound
+	enumMu.Unlock()
 	if err != nil {
-		return fmt.Errorf("failed to list processes: %v", err)
+		return fmt.Errorf("failed to enumerate windows: %v", err)
+	}
+	if len(found) == 0 {
+		return errors.New("process has no windows")
 	}
 
-	name = strings.ToLower(name)
-	var killed []uint32
-
-	for _, proc := range processes {
-		if strings.ToLower(proc.Name) == name {
-			if !forceMode {
-				fmt.Printf("[+] Killing process %s (PID: %d)\n", proc.Name, proc.PID)
-			}
-
-			handle, err := windows.OpenProcess(windows.PROCESS_TERMINATE, false, proc.PID)
-			if err != nil {
-				return fmt.Errorf("failed to open process %s (PID: %d): %v", proc.Name, proc.PID, err)
-			}
-
-			err = windows.TerminateProcess(handle, 0)
-			windows.CloseHandle(handle) // Always close handle
-
-			if err != nil {
-				return fmt.Errorf("failed to terminate process %s (PID: %d): %v", proc.Name, proc.PID, err)
-			}
+	for _, hwnd := range found {
+		procPostMessage.Call(uintptr(hwnd), wmClose, 0, 0)
+	}
+	return nil
+}
 
-			killed = append(killed, proc.PID)
+// terminate ends a process immediately with TerminateProcess
+func (pm *ProcessManager) terminate(pid uint32) error {
+	handle, err := windows.OpenProcess(windows.PROCESS_TERMINATE, false, pid)
+	if err != nil {
+		// OpenProcess reports a PID that no longer exists as an invalid parameter
+		if errors.Is(err, windows.ERROR_INVALID_PARAMETER) {
+			return errExited
 		}
+		return err
 	}
+	defer windows.CloseHandle(handle)
+	return windows.TerminateProcess(handle, 0)
+}
 
-	if len(killed) == 0 {
-		return fmt.Errorf("process %s not found", name)
+// startTime returns a process's creation time as a FILETIME
+func (pm *ProcessManager) startTime(pid uint32) (uint64, error) {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return 0, err
 	}
+	defer windows.CloseHandle(handle)
 
-	return nil
+	var creation, exit, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(handle, &creation, &exit, &kernel, &user); err != nil {
+		return 0, err
+	}
+	return uint64(creation.HighDateTime)<<32 | uint64(creation.LowDateTime), nil
 }
 
 // GetWindowsVersion returns Windows version information with validation
@@ -145,15 +167,6 @@ func GetWindowsVersion() (major, minor, build uint32, err error) {
 	return version.MajorVersion, version.MinorVersion, version.BuildNumber, nil
 }
 
-// DiskInfo contains disk space information
-type DiskInfo struct {
-	TotalGB     float64
-	UsedGB      float64
-	FreeGB      float64
-	UsedPercent float64
-	FreePercent float64
-}
-
 // GetDiskInfo returns disk information for C: drive with validation
 func GetDiskInfo() (*DiskInfo, error) {
 	kernel32 := windows.NewLazyDLL("kernel32.dll")
@@ -194,6 +207,8 @@ func GetDiskInfo() (*DiskInfo, error) {
 		FreeGB:      freeGB,
 		UsedPercent: usedPercent,
 		FreePercent: freePercent,
+		TotalBytes:  totalBytes,
+		FreeBytes:   totalFreeBytes,
 	}, nil
 }
 
@@ -215,12 +230,10 @@ func ClearRecycleBin() error {
 	return nil
 }
 
-// RestartExplorer safely restarts Windows Explorer
-func RestartExplorer() error {
-	pm := NewProcessManager()
-
-	// Kill explorer
-	if err := pm.KillProcess("explorer.exe", true); err != nil {
+// RestartExplorer ends Windows Explorer through pm, following pm's shutdown
+// policy for explorer.exe, and starts it again
+func RestartExplorer(pm *ProcessManager) error {
+	if err := pm.KillProcess("explorer.exe"); err != nil {
 		return fmt.Errorf("failed to kill explorer: %v", err)
 	}
 
@@ -242,3 +255,80 @@ func RestartExplorer() error {
 
 	return nil
 }
+
+// GetVolumeInfo returns the volume root and size of the volume holding path
+func GetVolumeInfo(path string) (*VolumeInfo, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path %s: %v", path, err)
+	}
+	root := make([]uint16, windows.MAX_LONG_PATH)
+	if err := windows.GetVolumePathName(p, &root[0], uint32(len(root))); err != nil {
+		return nil, fmt.Errorf("GetVolumePathName failed: %v", err)
+	}
+
+	var freeBytesAvailable, totalBytes, totalFreeBytes uint64
+	if err := windows.GetDiskFreeSpaceEx(&root[0], &freeBytesAvailable, &totalBytes, &totalFreeBytes); err != nil {
+		return nil, fmt.Errorf("GetDiskFreeSpaceEx failed: %v", err)
+	}
+
+	return &VolumeInfo{Root: windows.UTF16ToString(root), TotalBytes: totalBytes, Kind: volumeKind(&root[0])}, nil
+}
+
+const (
+	ioctlStorageQueryProperty        = 0x2D1400
+	storageDeviceSeekPenaltyProperty = 7
+	propertyStandardQuery            = 0
+)
+
+// storagePropertyQuery is STORAGE_PROPERTY_QUERY without additional parameters
+type storagePropertyQuery struct {
+	PropertyID uint32
+	QueryType  uint32
+	Additional [1]byte
+}
+
+// deviceSeekPenaltyDescriptor is DEVICE_SEEK_PENALTY_DESCRIPTOR
+type deviceSeekPenaltyDescriptor struct {
+	Version           uint32
+	Size              uint32
+	IncursSeekPenalty byte
+}
+
+// volumeKind tells network drives from local ones, which the storage stack
+// reports as incurring a seek penalty or not
+func volumeKind(root *uint16) VolumeKind {
+	if windows.GetDriveType(root) == windows.DRIVE_REMOTE {
+		return VolumeRemote
+	}
+
+	// The volume device is its GUID path without the trailing backslash
+	name := make([]uint16, windows.MAX_PATH)
+	if err := windows.GetVolumeNameForVolumeMountPoint(root, &name[0], uint32(len(name))); err != nil {
+		return VolumeUnknown
+	}
+	device, err := windows.UTF16PtrFromString(strings.TrimSuffix(windows.UTF16ToString(name), `\`))
+	if err != nil {
+		return VolumeUnknown
+	}
+	// Querying properties needs no access rights, so no elevation either
+	handle, err := windows.CreateFile(device, 0, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return VolumeUnknown
+	}
+	defer windows.CloseHandle(handle)
+
+	query := storagePropertyQuery{PropertyID: storageDeviceSeekPenaltyProperty, QueryType: propertyStandardQuery}
+	var descriptor deviceSeekPenaltyDescriptor
+	var returned uint32
+	if err := windows.DeviceIoControl(handle, ioctlStorageQueryProperty,
+		(*byte)(unsafe.Pointer(&query)), uint32(unsafe.Sizeof(query)),
+		(*byte)(unsafe.Pointer(&descriptor)), uint32(unsafe.Sizeof(descriptor)),
+		&returned, nil); err != nil {
+		return VolumeUnknown
+	}
+	if descriptor.IncursSeekPenalty != 0 {
+		return VolumeRotational
+	}
+	return VolumeSolid
+}
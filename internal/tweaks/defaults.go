@@ -0,0 +1,39 @@
+package tweaks
+
+import (
+	"nScript/internal/regfile"
+	"nScript/internal/winreg"
+)
+
+const (
+	explorerKey    = `Software\Microsoft\Windows\CurrentVersion\Explorer`
+	cloudStoreKey  = `Software\Microsoft\Windows\CurrentVersion\CloudStore\Store\Cache\DefaultAccount`
+	personalizeKey = `Software\Microsoft\Windows\CurrentVersion\Themes\Personalize`
+)
+
+// Defaults returns the built-in tweaks behind the start-menu, quick-access,
+// userassist, comdlg-mru and dark-mode operations
+func Defaults() []Tweak {
+	return []Tweak{
+		// Start Menu tile and layout caches
+		{Name: "start-menu", Kind: DeleteSubkeys, Root: winreg.CurrentUser, Key: cloudStoreKey, Pattern: "*start.tilegrid*"},
+		{Name: "start-menu", Kind: DeleteSubkeys, Root: winreg.CurrentUser, Key: cloudStoreKey, Pattern: "*windows.data.placeholdertilecollection*"},
+		{Name: "start-menu", Kind: DeleteSubkeys, Root: winreg.CurrentUser, Key: cloudStoreKey, Pattern: "*microsoft.windows.startmenuexperiencehost*"},
+
+		// Recently opened documents, typed Explorer paths and Run dialog history
+		{Name: "quick-access", Kind: DeleteKey, Root: winreg.CurrentUser, Key: explorerKey + `\RecentDocs`},
+		{Name: "quick-access", Kind: DeleteKey, Root: winreg.CurrentUser, Key: explorerKey + `\TypedPaths`},
+		{Name: "quick-access", Kind: DeleteKey, Root: winreg.CurrentUser, Key: explorerKey + `\RunMRU`},
+
+		{Name: "userassist", Kind: DeleteSubkeys, Root: winreg.CurrentUser, Key: explorerKey + `\UserAssist`, Pattern: "*"},
+
+		// Common Open/Save dialog history
+		{Name: "comdlg-mru", Kind: DeleteKey, Root: winreg.CurrentUser, Key: explorerKey + `\ComDlg32\OpenSavePidlMRU`},
+		{Name: "comdlg-mru", Kind: DeleteKey, Root: winreg.CurrentUser, Key: explorerKey + `\ComDlg32\OpenSaveMRU`},
+		{Name: "comdlg-mru", Kind: DeleteKey, Root: winreg.CurrentUser, Key: explorerKey + `\ComDlg32\LastVisitedPidlMRU`},
+
+		{Name: "dark-mode", Kind: SetValue, Root: winreg.CurrentUser, Key: personalizeKey, Value: regfile.DWordValue("SystemUsesLightTheme", 0)},
+		{Name: "dark-mode", Kind: SetValue, Root: winreg.CurrentUser, Key: personalizeKey, Value: regfile.DWordValue("AppsUseLightTheme", 0)},
+		{Name: "dark-mode", Kind: SetValue, Root: winreg.CurrentUser, Key: personalizeKey, Value: regfile.DWordValue("ForceDarkMode", 1)},
+	}
+}
@@ -0,0 +1,178 @@
+// Package tweaks defines registry changes declaratively, so that new ones can be
+// added in the config file instead of in code.
+package tweaks
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"nScript/internal/regfile"
+	"nScript/internal/winreg"
+)
+
+// Kind is what a tweak does
+type Kind string
+
+const (
+	// DeleteKey deletes a key and everything below it
+	DeleteKey Kind = "deleteKey"
+	// DeleteSubkeys deletes the subkeys of a key whose names match Pattern
+	DeleteSubkeys Kind = "deleteSubkeys"
+	// DeleteValue deletes one value
+	DeleteValue Kind = "deleteValue"
+	// SetValue creates the key if needed and writes one value
+	SetValue Kind = "setValue"
+)
+
+// Tweak is one registry change. Tweaks sharing a Name form one operation that
+// --only and --skip select as a whole.
+type Tweak struct {
+	Name string
+	Kind Kind
+	Root winreg.Root
+	Key  string
+	// Pattern is a case-insensitive glob matched against subkey names, for DeleteSubkeys
+	Pattern string
+	// Value names the value for DeleteValue and holds the data for SetValue
+	Value regfile.Value
+	// MinBuild and MaxBuild limit the tweak to a range of Windows builds; zero means unbounded
+	MinBuild uint32
+	MaxBuild uint32
+}
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Reserved are the names of the cleanup phases and of the Windows operations
+// that are not made of tweaks; tweaks cannot use them
+var Reserved = []string{"files", "browsers", "empty-dirs", "windows", "recent-items", "thumbnails", "recycle-bin"}
+
+// String describes the tweak for logs and plans
+func (t Tweak) String() string {
+	key := t.Root.String() + `\` + t.Key
+	switch t.Kind {
+	case DeleteSubkeys:
+		return fmt.Sprintf(`delete %s\%s`, key, t.Pattern)
+	case DeleteValue:
+		return fmt.Sprintf(`delete value %s\%s`, key, t.Value.Name)
+	case SetValue:
+		return fmt.Sprintf(`set %s\%s = %s`, key, t.Value.Name, FormatData(t.Value))
+	}
+	return "delete " + key
+}
+
+// Validate checks that the tweak is complete and consistent
+func (t Tweak) Validate() error {
+	if !namePattern.MatchString(t.Name) {
+		return fmt.Errorf("name %q must be lowercase letters, digits and dashes", t.Name)
+	}
+	if slices.Contains(Reserved, t.Name) {
+		return fmt.Errorf("name %q is used by a phase or operation that is not a registry operation", t.Name)
+	}
+	if strings.Trim(t.Key, `\`) == "" {
+		return errors.New("key cannot be empty")
+	}
+	switch t.Kind {
+	case DeleteKey:
+	case DeleteSubkeys:
+		if t.Pattern == "" {
+			return errors.New("deleteSubkeys needs a pattern")
+		}
+		if _, err := path.Match(t.Pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", t.Pattern)
+		}
+	case DeleteValue, SetValue:
+		// The default value has an empty name, so only SetValue needs data
+		if t.Kind == SetValue && t.Value.Type == regfile.None {
+			return errors.New("setValue needs a type")
+		}
+	default:
+		return fmt.Errorf("unknown action %q, expected deleteKey, deleteSubkeys, deleteValue or setValue", t.Kind)
+	}
+	if t.MaxBuild != 0 && t.MaxBuild < t.MinBuild {
+		return fmt.Errorf("maxBuild %d is below minBuild %d", t.MaxBuild, t.MinBuild)
+	}
+	return nil
+}
+
+// AppliesTo reports whether the tweak runs on a Windows build. An unknown
+// build, zero, only runs tweaks without a build range.
+func (t Tweak) AppliesTo(build uint32) bool {
+	if build == 0 {
+		return t.MinBuild == 0 && t.MaxBuild == 0
+	}
+	return build >= t.MinBuild && (t.MaxBuild == 0 || build <= t.MaxBuild)
+}
+
+// Matches reports whether a subkey name matches the tweak's pattern
+func (t Tweak) Matches(subkey string) bool {
+	ok, _ := path.Match(strings.ToLower(t.Pattern), strings.ToLower(subkey))
+	return ok
+}
+
+// ForUser returns the tweak applied to another user's hive, mounted as
+// HKEY_USERS\sid, instead of HKEY_CURRENT_USER. Other tweaks are returned unchanged.
+func (t Tweak) ForUser(sid string) Tweak {
+	if t.Root == winreg.CurrentUser {
+		t.Root = winreg.Users
+		t.Key = sid + `\` + t.Key
+	}
+	return t
+}
+
+// Names returns the operation names in list in first-seen order
+func Names(list []Tweak) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, t := range list {
+		if !seen[t.Name] {
+			seen[t.Name] = true
+			names = append(names, t.Name)
+		}
+	}
+	return names
+}
+
+// FormatData returns value data in the short form used in plans and logs
+func FormatData(v regfile.Value) string {
+	switch v.Type {
+	case regfile.SZ, regfile.ExpandSZ:
+		return fmt.Sprintf("%s:%q", TypeName(v.Type), v.Text())
+	case regfile.MultiSZ:
+		return fmt.Sprintf("%s:%q", TypeName(v.Type), v.Strings())
+	case regfile.DWord, regfile.QWord:
+		return fmt.Sprintf("%s:%d", TypeName(v.Type), v.Uint64())
+	}
+	return fmt.Sprintf("%s:%x", TypeName(v.Type), v.Data)
+}
+
+// typeNames are the value types accepted in the config file
+var typeNames = map[regfile.ValueType]string{
+	regfile.SZ:       "REG_SZ",
+	regfile.ExpandSZ: "REG_EXPAND_SZ",
+	regfile.MultiSZ:  "REG_MULTI_SZ",
+	regfile.DWord:    "REG_DWORD",
+	regfile.QWord:    "REG_QWORD",
+	regfile.Binary:   "REG_BINARY",
+}
+
+// TypeName returns the REG_* name of a value type
+func TypeName(t regfile.ValueType) string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("type%d", uint32(t))
+}
+
+// ParseType accepts a REG_* type name, case-insensitively
+func ParseType(name string) (regfile.ValueType, error) {
+	for t, n := range typeNames {
+		if strings.EqualFold(n, name) {
+			return t, nil
+		}
+	}
+	return regfile.None, fmt.Errorf("unknown value type %q, expected REG_SZ, REG_EXPAND_SZ, REG_MULTI_SZ, REG_DWORD, REG_QWORD or REG_BINARY", name)
+}
@@ -0,0 +1,90 @@
+package tweaks
+
+import (
+	"strings"
+	"testing"
+
+	"nScript/internal/regfile"
+	"nScript/internal/winreg"
+)
+
+func TestDefaultsAreValid(t *testing.T) {
+	for _, tweak := range Defaults() {
+		if err := tweak.Validate(); err != nil {
+			t.Errorf("%s: %v", tweak, err)
+		}
+	}
+	want := "start-menu quick-access userassist comdlg-mru dark-mode"
+	if got := strings.Join(Names(Defaults()), " "); got != want {
+		t.Errorf("Names() = %q, want %q", got, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	base := Tweak{Name: "wordwheel-query", Kind: DeleteKey, Root: winreg.CurrentUser, Key: `Software\x`}
+	tests := []struct {
+		change func(*Tweak)
+		want   string
+	}{
+		{func(t *Tweak) { t.Name = "WordWheel" }, "lowercase"},
+		{func(t *Tweak) { t.Name = "thumbnails" }, "not a registry operation"},
+		{func(t *Tweak) { t.Key = `\` }, "key cannot be empty"},
+		{func(t *Tweak) { t.Kind = "rename" }, `unknown action "rename"`},
+		{func(t *Tweak) { t.Kind = DeleteSubkeys }, "needs a pattern"},
+		{func(t *Tweak) { t.Kind, t.Pattern = DeleteSubkeys, "[" }, "invalid pattern"},
+		{func(t *Tweak) { t.Kind = SetValue }, "needs a type"},
+		{func(t *Tweak) { t.MinBuild, t.MaxBuild = 22000, 19041 }, "below minBuild"},
+	}
+
+	if err := base.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		tweak := base
+		tt.change(&tweak)
+		if err := tweak.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Validate(%+v) = %v, want %q", tweak, err, tt.want)
+		}
+	}
+}
+
+func TestAppliesTo(t *testing.T) {
+	tests := []struct {
+		min, max uint32
+		build    uint32
+		want     bool
+	}{
+		{0, 0, 0, true},
+		{0, 0, 22631, true},
+		{22000, 0, 22631, true},
+		{22000, 0, 19045, false},
+		{0, 19045, 19045, true},
+		{0, 19045, 22000, false},
+		{22000, 0, 0, false},
+	}
+	for _, tt := range tests {
+		tweak := Tweak{MinBuild: tt.min, MaxBuild: tt.max}
+		if got := tweak.AppliesTo(tt.build); got != tt.want {
+			t.Errorf("[%d, %d].AppliesTo(%d) = %v, want %v", tt.min, tt.max, tt.build, got, tt.want)
+		}
+	}
+}
+
+func TestMatchesAndString(t *testing.T) {
+	tweak := Tweak{Kind: DeleteSubkeys, Root: winreg.CurrentUser, Key: `Software\x`, Pattern: "*Start.TileGrid*"}
+	if !tweak.Matches("$de${1}$start.tilegrid$windows") || tweak.Matches("$de${1}$notifications") {
+		t.Error("pattern does not match case-insensitively")
+	}
+
+	if got, want := tweak.ForUser("S-1-5-21-7").String(), `delete HKU\S-1-5-21-7\Software\x\*Start.TileGrid*`; got != want {
+		t.Errorf("ForUser = %s, want %s", got, want)
+	}
+
+	set := Tweak{Kind: SetValue, Root: winreg.LocalMachine, Key: `Software\Policies\x`, Value: regfile.String("Wallpaper", `C:\w.jpg`)}
+	if got, want := set.String(), `set HKLM\Software\Policies\x\Wallpaper = REG_SZ:"C:\\w.jpg"`; got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+	if set.ForUser("S-1-5-21-7").String() != set.String() {
+		t.Error("ForUser changed an HKLM tweak")
+	}
+}
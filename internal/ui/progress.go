@@ -7,20 +7,25 @@ import (
 
 	"nScript/internal/cleanup"
 	"nScript/internal/config"
+	"nScript/internal/logging"
+	"nScript/internal/plan"
+	"nScript/internal/pool"
 	"nScript/internal/system"
 )
 
 // ProgressTracker handles progress reporting
 type ProgressTracker struct {
 	stats    *cleanup.Stats
+	pool     *pool.Pool
 	stopFlag atomic.Bool
 	label    string
 }
 
-// NewProgressTracker creates a new progress tracker
-func NewProgressTracker(stats *cleanup.Stats) *ProgressTracker {
+// NewProgressTracker creates a new progress tracker showing stats and the load of p
+func NewProgressTracker(stats *cleanup.Stats, p *pool.Pool) *ProgressTracker {
 	return &ProgressTracker{
 		stats: stats,
+		pool:  p,
 	}
 }
 
@@ -44,8 +49,10 @@ func (pt *ProgressTracker) StartProgress(label string) func() {
 				folders := pt.stats.DeletedFolders.Load()
 				skipped := pt.stats.SkippedFiles.Load()
 				failed := pt.stats.FailedFiles.Load()
-				fmt.Printf("\r[*] %s | Files: %d | Folders: %d | Skipped: %d | Failed: %d",
-					pt.label, files, folders, skipped, failed)
+				load := pt.pool.Load()
+				logging.SetStatus("[*] %s | Files: %d | Folders: %d | Skipped: %d | Failed: %d | Queue: %d | Workers: %d/%d | %.0f ops/s | %s/s",
+					pt.label, files, folders, skipped, failed,
+					load.Queued, load.Active, load.Limit, load.OpsPerSecond, FormatBytes(int64(load.BytesPerSecond)))
 			case <-done:
 				return
 			}
@@ -56,64 +63,149 @@ func (pt *ProgressTracker) StartProgress(label string) func() {
 		pt.stopFlag.Store(true)
 		done <- struct{}{}
 		close(done)
-		fmt.Println()
+		logging.ClearStatus()
 	}
 }
 
-// PrintHeader displays the application header
-func PrintHeader(version string, forceMode bool) {
+// PrintHeader displays the application header. In force mode it pauses after
+// the warning so it can still be aborted; pass a zero pause for unattended runs.
+func PrintHeader(version string, forceMode bool, pause time.Duration) {
 	versionStr := version
 	if forceMode {
 		versionStr += "-force"
 	}
 
-	fmt.Printf("[*] Starting nScript v%s\n", versionStr)
+	logging.Info(fmt.Sprintf("Starting nScript v%s", versionStr))
 
 	if forceMode {
-		fmt.Println("[!] Force mode enabled - all files will be removed!")
-		fmt.Println("[!] WARNING: This will delete files regardless of age!")
-		fmt.Println("[!] Make sure you have backups of important data!")
-		time.Sleep(3 * time.Second)
+		logging.Notice("Force mode enabled - all files will be removed!")
+		logging.Notice("WARNING: This will delete files regardless of age!")
+		logging.Notice("Make sure you have backups of important data!")
+		time.Sleep(pause)
 	}
 }
 
-// PrintStats displays cleanup statistics
-func PrintStats(stats *cleanup.Stats, elapsed time.Duration, diskInfo *system.DiskInfo) {
-	fmt.Println("\n[+] nScript completed")
-	fmt.Println("[*] ============================================")
-	fmt.Println("[*] Deletion Summary:")
-	fmt.Printf("[*]    Files deleted: %d\n", stats.DeletedFiles.Load())
-	fmt.Printf("[*]    Folders deleted: %d\n", stats.DeletedFolders.Load())
-	fmt.Printf("[*]    Files skipped: %d\n", stats.SkippedFiles.Load())
-	fmt.Printf("[*]    Failed operations: %d\n", stats.FailedFiles.Load())
-	fmt.Printf("[*]    Total items deleted: %d\n", stats.DeletedFiles.Load()+stats.DeletedFolders.Load())
-	fmt.Printf("[*]    Time taken: %.2f seconds\n", elapsed.Seconds())
-
-	if diskInfo != nil {
-		fmt.Println("[*] ============================================")
-		fmt.Println("[*] Disk Information (C:):")
-		fmt.Printf("[*]    Total: %.2f GB\n", diskInfo.TotalGB)
-		fmt.Printf("[*]    Used: %.2f GB (%.2f%%)\n", diskInfo.UsedGB, diskInfo.UsedPercent)
-		fmt.Printf("[*]    Free: %.2f GB (%.2f%%)\n", diskInfo.FreeGB, diskInfo.FreePercent)
+// PrintStats displays cleanup statistics and the free-space change between two disk snapshots
+func PrintStats(stats *cleanup.Stats, elapsed time.Duration, before, after *system.DiskInfo) {
+	logging.Success("\nnScript completed")
+	logging.Info("============================================")
+	logging.Info("Deletion Summary:")
+	logging.Info(fmt.Sprintf("   Files deleted: %d", stats.DeletedFiles.Load()))
+	logging.Info(fmt.Sprintf("   Folders deleted: %d", stats.DeletedFolders.Load()))
+	logging.Info(fmt.Sprintf("   Files skipped: %d", stats.SkippedFiles.Load()))
+	logging.Info(fmt.Sprintf("   Failed operations: %d", stats.FailedFiles.Load()))
+	logging.Info(fmt.Sprintf("   Total items deleted: %d", stats.DeletedFiles.Load()+stats.DeletedFolders.Load()))
+	logging.Info(fmt.Sprintf("   Space freed: %s", FormatBytes(stats.BytesFreed.Load())))
+	logging.Info(fmt.Sprintf("   Space skipped: %s", FormatBytes(stats.BytesSkipped.Load())))
+	logging.Info(fmt.Sprintf("   Space failed: %s", FormatBytes(stats.BytesFailed.Load())))
+	logging.Info(fmt.Sprintf("   Time taken: %.2f seconds", elapsed.Seconds()))
+
+	targets := stats.Targets()
+	if len(targets) > 0 {
+		logging.Info("============================================")
+		logging.Info("Top Targets:")
+		for i, t := range targets {
+			if i == maxTargetsShown {
+				logging.Info(fmt.Sprintf("   ... and %d more", len(targets)-maxTargetsShown))
+				break
+			}
+			logging.Info(fmt.Sprintf("   %-10s %10s freed  %s", t.Kind, FormatBytes(t.BytesFreed), t.Name))
+		}
+	}
+
+	if after != nil {
+		logging.Info("============================================")
+		logging.Info("Disk Information (C:):")
+		logging.Info(fmt.Sprintf("   Total: %.2f GB", after.TotalGB))
+		logging.Info(fmt.Sprintf("   Used: %.2f GB (%.2f%%)", after.UsedGB, after.UsedPercent))
+		logging.Info(fmt.Sprintf("   Free: %.2f GB (%.2f%%)", after.FreeGB, after.FreePercent))
+		if before != nil {
+			logging.Info(fmt.Sprintf("   Free space change: %s", formatDelta(int64(after.FreeBytes)-int64(before.FreeBytes))))
+		}
+	}
+}
+
+// maxTargetsShown limits the per-target list in the final statistics
+const maxTargetsShown = 10
+
+// FormatBytes formats a byte count using binary units
+func FormatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// formatDelta formats a signed byte count with an explicit sign
+func formatDelta(bytes int64) string {
+	if bytes < 0 {
+		return "-" + FormatBytes(-bytes)
 	}
+	return "+" + FormatBytes(bytes)
 }
 
-// PrintClosingMessage displays the closing message
-func PrintClosingMessage() {
-	fmt.Println("[*] ============================================")
-	fmt.Println("[*] Made by Nyx :3 https://nyx.meowery.eu/")
-	fmt.Println("[*] ============================================")
-	fmt.Print("[*] Closing in 3s...")
-	time.Sleep(1 * time.Second)
-	fmt.Print(" 2s...")
-	time.Sleep(1 * time.Second)
-	fmt.Print(" 1s...")
-	time.Sleep(1 * time.Second)
-	fmt.Println()
+// PrintPlanSummary displays what a dry run would have done
+func PrintPlanSummary(p *plan.Plan, elapsed time.Duration, planFile string) {
+	logging.Success("\nnScript dry run completed - nothing was changed")
+	logging.Info("============================================")
+	logging.Info("Planned Actions:")
+
+	summary := p.Summary()
+	if len(summary) == 0 {
+		logging.Info("   Nothing to do")
+	}
+
+	phase := ""
+	for _, line := range summary {
+		if line.Phase != phase {
+			phase = line.Phase
+			logging.Info(fmt.Sprintf("   %s:", phase))
+		}
+		if line.Bytes > 0 {
+			logging.Info(fmt.Sprintf("      %-20s %8d  (%.2f MB)", line.Kind, line.Count, float64(line.Bytes)/(1024*1024)))
+		} else {
+			logging.Info(fmt.Sprintf("      %-20s %8d", line.Kind, line.Count))
+		}
+	}
+
+	logging.Info(fmt.Sprintf("   Time taken: %.2f seconds", elapsed.Seconds()))
+	if planFile != "" {
+		logging.Info(fmt.Sprintf("Full plan written to: %s", planFile))
+	}
 }
 
-// ShowBackupInfo displays information about registry backups
-func ShowBackupInfo(backupDir string) {
-	fmt.Printf("[*] Registry backups created in: %s\n", backupDir)
-	fmt.Println("[*] You can restore registry keys from backups if needed")
+// PrintClosingMessage displays the closing message, then counts down for delay
+// so the console window stays readable. A zero delay returns immediately.
+func PrintClosingMessage(delay time.Duration) {
+	logging.Info("============================================")
+	logging.Info("Made by Nyx :3 https://nyx.meowery.eu/")
+	logging.Info("============================================")
+	if delay <= 0 {
+		return
+	}
+	countdown := "[*] Closing in"
+	for i := int(delay / time.Second); i > 0; i-- {
+		countdown += fmt.Sprintf(" %ds...", i)
+		logging.SetStatus("%s", countdown)
+		time.Sleep(1 * time.Second)
+	}
+	logging.ClearStatus()
+}
+
+// ShowBackupInfo displays where the registry backups of the run were archived
+// and how to undo its changes; id is empty when nothing was backed up
+func ShowBackupInfo(archive, id string) {
+	if id == "" {
+		return
+	}
+	if archive != "" {
+		logging.Info(fmt.Sprintf("Registry backups archived in: %s", archive))
+	}
+	logging.Info(fmt.Sprintf("Undo the registry changes with: nScript.exe restore-registry %s [key]", id))
 }
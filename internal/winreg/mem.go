@@ -0,0 +1,272 @@
+package winreg
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"nScript/internal/regfile"
+)
+
+// Mem is an in-memory Registry for tests. Like the real registry it compares
+// names case-insensitively, refuses to delete keys that have subkeys and lets
+// subtrees be denied. Hive files added with AddHive can be mounted below HKEY_USERS.
+type Mem struct {
+	mu      sync.Mutex
+	roots   map[Root]*memKey
+	hives   map[string]*memKey
+	mounted map[string]string
+}
+
+type memKey struct {
+	name    string
+	values  []regfile.Value
+	subkeys map[string]*memKey
+	denied  bool
+	deleted bool
+}
+
+// NewMem creates an empty in-memory registry
+func NewMem() *Mem {
+	return &Mem{roots: make(map[Root]*memKey), hives: make(map[string]*memKey), mounted: make(map[string]string)}
+}
+
+// splitPath returns the components of a key path
+func splitPath(path string) []string {
+	var parts []string
+	for _, part := range strings.Split(path, `\`) {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// root returns the node of a root key, creating it on first use
+func (m *Mem) root(r Root) *memKey {
+	node, ok := m.roots[r]
+	if !ok {
+		node = &memKey{name: r.LongName(), subkeys: make(map[string]*memKey)}
+		m.roots[r] = node
+	}
+	return node
+}
+
+// lookup finds a key, creating missing keys when create is set. A denied key
+// denies access to itself and everything below it.
+func (m *Mem) lookup(root Root, path string, create bool) (*memKey, error) {
+	node := m.root(root)
+	for _, part := range splitPath(path) {
+		if node.denied {
+			return nil, ErrAccessDenied
+		}
+		child, ok := node.subkeys[strings.ToLower(part)]
+		if !ok {
+			if !create {
+				return nil, ErrNotExist
+			}
+			child = &memKey{name: part, subkeys: make(map[string]*memKey)}
+			node.subkeys[strings.ToLower(part)] = child
+		}
+		node = child
+	}
+	if node.denied {
+		return nil, ErrAccessDenied
+	}
+	return node, nil
+}
+
+func (m *Mem) OpenKey(root Root, path string, access Access) (Key, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, err := m.lookup(root, path, false)
+	if err != nil {
+		return nil, err
+	}
+	return &memHandle{m: m, node: node, access: access}, nil
+}
+
+func (m *Mem) CreateKey(root Root, path string, access Access) (Key, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, err := m.lookup(root, path, true)
+	if err != nil {
+		return nil, err
+	}
+	return &memHandle{m: m, node: node, access: access}, nil
+}
+
+func (m *Mem) DeleteKey(root Root, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	parts := splitPath(path)
+	if len(parts) == 0 {
+		return ErrAccessDenied
+	}
+	parent, err := m.lookup(root, strings.Join(parts[:len(parts)-1], `\`), false)
+	if err != nil {
+		return err
+	}
+	name := strings.ToLower(parts[len(parts)-1])
+	node, ok := parent.subkeys[name]
+	switch {
+	case !ok:
+		return ErrNotExist
+	case node.denied || len(node.subkeys) > 0:
+		return ErrAccessDenied
+	}
+	node.deleted = true
+	delete(parent.subkeys, name)
+	return nil
+}
+
+// Deny makes a key and everything below it inaccessible, creating it if needed
+func (m *Mem) Deny(root Root, path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, err := m.lookup(root, path, true)
+	if err != nil {
+		panic(err)
+	}
+	node.denied = true
+}
+
+// Exists reports whether a key exists
+func (m *Mem) Exists(root Root, path string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := m.lookup(root, path, false)
+	return err != ErrNotExist
+}
+
+// AddHive creates an empty hive file that LoadHive can mount
+func (m *Mem) AddHive(file string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hives[strings.ToLower(file)] = &memKey{subkeys: make(map[string]*memKey)}
+}
+
+func (m *Mem) LoadHive(name, file string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hive, ok := m.hives[strings.ToLower(file)]
+	if !ok {
+		return ErrNotExist
+	}
+	users := m.root(Users)
+	if _, exists := users.subkeys[strings.ToLower(name)]; exists {
+		return ErrAccessDenied
+	}
+	hive.name = name
+	users.subkeys[strings.ToLower(name)] = hive
+	m.mounted[strings.ToLower(name)] = file
+	return nil
+}
+
+func (m *Mem) UnloadHive(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.mounted[strings.ToLower(name)]; !ok {
+		return ErrNotExist
+	}
+	delete(m.root(Users).subkeys, strings.ToLower(name))
+	delete(m.mounted, strings.ToLower(name))
+	return nil
+}
+
+// memHandle is an open key of a Mem registry
+type memHandle struct {
+	m      *Mem
+	node   *memKey
+	access Access
+}
+
+// check returns an error when the key was deleted or opened without access
+func (h *memHandle) check(access Access) error {
+	if h.node.deleted {
+		return ErrNotExist
+	}
+	if h.access&access != access {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+func (h *memHandle) Close() error { return nil }
+
+func (h *memHandle) ReadSubKeyNames() ([]string, error) {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	if err := h.check(Read); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(h.node.subkeys))
+	for _, sub := range h.node.subkeys {
+		names = append(names, sub.name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (h *memHandle) ReadValueNames() ([]string, error) {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	if err := h.check(Read); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(h.node.values))
+	for _, v := range h.node.values {
+		names = append(names, v.Name)
+	}
+	return names, nil
+}
+
+// value returns the index of a value, or -1
+func (h *memHandle) value(name string) int {
+	return slices.IndexFunc(h.node.values, func(v regfile.Value) bool { return strings.EqualFold(v.Name, name) })
+}
+
+func (h *memHandle) GetValue(name string) (regfile.Value, error) {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	if err := h.check(Read); err != nil {
+		return regfile.Value{}, err
+	}
+	i := h.value(name)
+	if i < 0 {
+		return regfile.Value{}, ErrNotExist
+	}
+	v := h.node.values[i]
+	v.Data = slices.Clone(v.Data)
+	return v, nil
+}
+
+func (h *memHandle) SetValue(v regfile.Value) error {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	if err := h.check(Write); err != nil {
+		return err
+	}
+	v.Data = slices.Clone(v.Data)
+	if i := h.value(v.Name); i >= 0 {
+		h.node.values[i] = v
+	} else {
+		h.node.values = append(h.node.values, v)
+	}
+	return nil
+}
+
+func (h *memHandle) DeleteValue(name string) error {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	if err := h.check(Write); err != nil {
+		return err
+	}
+	i := h.value(name)
+	if i < 0 {
+		return ErrNotExist
+	}
+	h.node.values = slices.Delete(h.node.values, i, i+1)
+	return nil
+}
@@ -0,0 +1,94 @@
+package winreg
+
+import (
+	"testing"
+
+	"nScript/internal/regfile"
+)
+
+func TestMem(t *testing.T) {
+	m := NewMem()
+	key, err := m.CreateKey(CurrentUser, `Software\nScript\Child`, Read|Write)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := key.SetValue(regfile.DWordValue("Count", 3)); err != nil {
+		t.Fatal(err)
+	}
+	key.Close()
+
+	key, err = m.OpenKey(CurrentUser, `SOFTWARE\NSCRIPT\child`, Read)
+	if err != nil {
+		t.Fatalf("lookup is not case-insensitive: %v", err)
+	}
+	if v, err := key.GetValue("count"); err != nil || v.Uint64() != 3 {
+		t.Errorf("GetValue = %+v, %v", v, err)
+	}
+	if err := key.SetValue(regfile.DWordValue("Count", 4)); err != ErrAccessDenied {
+		t.Errorf("SetValue on a read-only handle = %v, want ErrAccessDenied", err)
+	}
+
+	if _, err := m.OpenKey(CurrentUser, `Software\Missing`, Read); err != ErrNotExist {
+		t.Errorf("OpenKey of a missing key = %v, want ErrNotExist", err)
+	}
+	if err := m.DeleteKey(CurrentUser, `Software\nScript`); err != ErrAccessDenied {
+		t.Errorf("DeleteKey of a key with subkeys = %v, want ErrAccessDenied", err)
+	}
+
+	m.Deny(CurrentUser, `Software\Locked`)
+	if _, err := m.OpenKey(CurrentUser, `Software\Locked\Below`, Read); err != ErrAccessDenied {
+		t.Errorf("OpenKey below a denied key = %v, want ErrAccessDenied", err)
+	}
+
+	if err := m.DeleteKey(CurrentUser, `Software\nScript\Child`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := key.ReadValueNames(); err != ErrNotExist {
+		t.Errorf("handle of a deleted key = %v, want ErrNotExist", err)
+	}
+	if m.Exists(CurrentUser, `Software\nScript\Child`) {
+		t.Error("deleted key still exists")
+	}
+}
+
+func TestMemHives(t *testing.T) {
+	m := NewMem()
+	if err := m.LoadHive("S-1-5-21-1", `C:\Users\ana\NTUSER.DAT`); err != ErrNotExist {
+		t.Errorf("LoadHive of a missing file = %v, want ErrNotExist", err)
+	}
+
+	m.AddHive(`C:\Users\ana\NTUSER.DAT`)
+	if err := m.LoadHive("S-1-5-21-1", `C:\Users\ana\NTUSER.DAT`); err != nil {
+		t.Fatal(err)
+	}
+	key, err := m.CreateKey(Users, `S-1-5-21-1\Software\nScript`, Write)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.Close()
+	if err := m.UnloadHive("S-1-5-21-1"); err != nil {
+		t.Fatal(err)
+	}
+	if m.Exists(Users, `S-1-5-21-1`) {
+		t.Error("unloaded hive is still mounted")
+	}
+
+	// The hive keeps its contents between loads
+	if err := m.LoadHive("S-1-5-21-1", `c:\users\ana\ntuser.dat`); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Exists(Users, `S-1-5-21-1\Software\nScript`) {
+		t.Error("hive contents were lost")
+	}
+}
+
+func TestParseRoot(t *testing.T) {
+	for name, want := range map[string]Root{"HKCU": CurrentUser, "HKEY_LOCAL_MACHINE": LocalMachine, "hku": Users} {
+		if got, err := ParseRoot(name); err != nil || got != want {
+			t.Errorf("ParseRoot(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseRoot("HKEY_NOWHERE"); err == nil {
+		t.Error("unknown root was accepted")
+	}
+}
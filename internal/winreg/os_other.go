@@ -0,0 +1,20 @@
+//go:build !windows
+
+package winreg
+
+// OS is the Registry backed by the Windows registry; outside Windows every operation fails
+type OS struct{}
+
+func (OS) OpenKey(root Root, path string, access Access) (Key, error) {
+	return nil, ErrUnsupported
+}
+
+func (OS) CreateKey(root Root, path string, access Access) (Key, error) {
+	return nil, ErrUnsupported
+}
+
+func (OS) DeleteKey(root Root, path string) error { return ErrUnsupported }
+
+func (OS) LoadHive(name, file string) error { return ErrUnsupported }
+
+func (OS) UnloadHive(name string) error { return ErrUnsupported }
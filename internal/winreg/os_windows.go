@@ -0,0 +1,193 @@
+//go:build windows
+
+package winreg
+
+import (
+	"errors"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+
+	"nScript/internal/regfile"
+)
+
+// OS is the Registry backed by the Windows registry
+type OS struct{}
+
+var (
+	advapi32          = windows.NewLazySystemDLL("advapi32.dll")
+	procRegSetValueEx = advapi32.NewProc("RegSetValueExW")
+	procRegLoadKey    = advapi32.NewProc("RegLoadKeyW")
+	procRegUnLoadKey  = advapi32.NewProc("RegUnLoadKeyW")
+)
+
+var rootKeys = []registry.Key{
+	ClassesRoot:   registry.CLASSES_ROOT,
+	CurrentUser:   registry.CURRENT_USER,
+	LocalMachine:  registry.LOCAL_MACHINE,
+	Users:         registry.USERS,
+	CurrentConfig: registry.CURRENT_CONFIG,
+}
+
+// accessMask converts Access into registry access rights
+func accessMask(access Access) uint32 {
+	var mask uint32
+	if access&Read != 0 {
+		mask |= registry.QUERY_VALUE | registry.ENUMERATE_SUB_KEYS
+	}
+	if access&Write != 0 {
+		mask |= registry.SET_VALUE | registry.CREATE_SUB_KEY
+	}
+	return mask
+}
+
+// mapError translates Windows errors into the package's errors
+func mapError(err error) error {
+	switch {
+	case errors.Is(err, registry.ErrNotExist):
+		return ErrNotExist
+	case errors.Is(err, windows.ERROR_ACCESS_DENIED), errors.Is(err, windows.ERROR_PRIVILEGE_NOT_HELD):
+		return ErrAccessDenied
+	}
+	return err
+}
+
+func (OS) OpenKey(root Root, path string, access Access) (Key, error) {
+	k, err := registry.OpenKey(rootKeys[root], path, accessMask(access))
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return osKey{k}, nil
+}
+
+func (OS) CreateKey(root Root, path string, access Access) (Key, error) {
+	k, _, err := registry.CreateKey(rootKeys[root], path, accessMask(access))
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return osKey{k}, nil
+}
+
+func (OS) DeleteKey(root Root, path string) error {
+	return mapError(registry.DeleteKey(rootKeys[root], path))
+}
+
+// osKey is a Key backed by an open registry handle
+type osKey struct {
+	k registry.Key
+}
+
+func (k osKey) Close() error { return k.k.Close() }
+
+func (k osKey) ReadSubKeyNames() ([]string, error) {
+	names, err := k.k.ReadSubKeyNames(-1)
+	return names, mapError(err)
+}
+
+func (k osKey) ReadValueNames() ([]string, error) {
+	names, err := k.k.ReadValueNames(-1)
+	return names, mapError(err)
+}
+
+func (k osKey) GetValue(name string) (regfile.Value, error) {
+	size, _, err := k.k.GetValue(name, nil)
+	if err != nil {
+		return regfile.Value{}, mapError(err)
+	}
+	data := make([]byte, size)
+	n, valtype, err := k.k.GetValue(name, data)
+	if err != nil {
+		return regfile.Value{}, mapError(err)
+	}
+	return regfile.Value{Name: name, Type: regfile.ValueType(valtype), Data: data[:n]}, nil
+}
+
+func (k osKey) DeleteValue(name string) error {
+	return mapError(k.k.DeleteValue(name))
+}
+
+// SetValue writes the data unchanged with its type. The registry package only
+// offers typed setters, which cannot restore arbitrary types or raw string bytes.
+func (k osKey) SetValue(v regfile.Value) error {
+	pname, err := windows.UTF16PtrFromString(v.Name)
+	if err != nil {
+		return err
+	}
+	var pdata *byte
+	if len(v.Data) > 0 {
+		pdata = &v.Data[0]
+	}
+
+	ret, _, _ := procRegSetValueEx.Call(
+		uintptr(k.k),
+		uintptr(unsafe.Pointer(pname)),
+		0,
+		uintptr(v.Type),
+		uintptr(unsafe.Pointer(pdata)),
+		uintptr(len(v.Data)),
+	)
+	if ret != 0 {
+		return mapError(windows.Errno(ret))
+	}
+	return nil
+}
+
+// LoadHive mounts a hive file below HKEY_USERS. It needs the backup and restore
+// privileges, which administrators hold but have to enable first.
+func (OS) LoadHive(name, file string) error {
+	if err := enablePrivileges("SeBackupPrivilege", "SeRestorePrivilege"); err != nil {
+		return err
+	}
+	pname, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	pfile, err := windows.UTF16PtrFromString(file)
+	if err != nil {
+		return err
+	}
+	ret, _, _ := procRegLoadKey.Call(uintptr(registry.USERS), uintptr(unsafe.Pointer(pname)), uintptr(unsafe.Pointer(pfile)))
+	if ret != 0 {
+		return mapError(windows.Errno(ret))
+	}
+	return nil
+}
+
+func (OS) UnloadHive(name string) error {
+	pname, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	ret, _, _ := procRegUnLoadKey.Call(uintptr(registry.USERS), uintptr(unsafe.Pointer(pname)))
+	if ret != 0 {
+		return mapError(windows.Errno(ret))
+	}
+	return nil
+}
+
+// enablePrivileges enables privileges held by the process token
+func enablePrivileges(names ...string) error {
+	var token windows.Token
+	if err := windows.OpenProcessToken(windows.CurrentProcess(), windows.TOKEN_ADJUST_PRIVILEGES|windows.TOKEN_QUERY, &token); err != nil {
+		return err
+	}
+	defer token.Close()
+
+	for _, name := range names {
+		pname, err := windows.UTF16PtrFromString(name)
+		if err != nil {
+			return err
+		}
+		var luid windows.LUID
+		if err := windows.LookupPrivilegeValue(nil, pname, &luid); err != nil {
+			return err
+		}
+		privileges := windows.Tokenprivileges{PrivilegeCount: 1}
+		privileges.Privileges[0] = windows.LUIDAndAttributes{Luid: luid, Attributes: windows.SE_PRIVILEGE_ENABLED}
+		if err := windows.AdjustTokenPrivileges(token, false, &privileges, 0, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
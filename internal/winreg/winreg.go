@@ -0,0 +1,108 @@
+// Package winreg abstracts the Windows registry so the code changing it can be
+// tested against an in-memory tree on every platform.
+package winreg
+
+import (
+	"errors"
+	"fmt"
+
+	"nScript/internal/regfile"
+)
+
+var (
+	// ErrNotExist is returned when a key or value does not exist
+	ErrNotExist = errors.New("the registry key or value does not exist")
+	// ErrAccessDenied is returned when a key may not be opened or changed. Like
+	// RegDeleteKey, DeleteKey also returns it for a key that still has subkeys.
+	ErrAccessDenied = errors.New("access to the registry key is denied")
+	// ErrUnsupported is returned by OS outside Windows
+	ErrUnsupported = errors.New("the registry is only available on Windows")
+)
+
+// Root is a predefined root key
+type Root int
+
+// Predefined root keys
+const (
+	ClassesRoot Root = iota
+	CurrentUser
+	LocalMachine
+	Users
+	CurrentConfig
+)
+
+var rootNames = []struct{ short, long string }{
+	ClassesRoot:   {"HKCR", "HKEY_CLASSES_ROOT"},
+	CurrentUser:   {"HKCU", "HKEY_CURRENT_USER"},
+	LocalMachine:  {"HKLM", "HKEY_LOCAL_MACHINE"},
+	Users:         {"HKU", "HKEY_USERS"},
+	CurrentConfig: {"HKCC", "HKEY_CURRENT_CONFIG"},
+}
+
+// String returns the short name of the root, e.g. HKCU
+func (r Root) String() string {
+	if r < 0 || int(r) >= len(rootNames) {
+		return fmt.Sprintf("Root(%d)", int(r))
+	}
+	return rootNames[r].short
+}
+
+// LongName returns the name used in .reg files, e.g. HKEY_CURRENT_USER
+func (r Root) LongName() string {
+	if r < 0 || int(r) >= len(rootNames) {
+		return r.String()
+	}
+	return rootNames[r].long
+}
+
+// ParseRoot accepts the long or short name of a root
+func ParseRoot(name string) (Root, error) {
+	long, _, err := regfile.SplitPath(name)
+	if err != nil {
+		return 0, err
+	}
+	for r, names := range rootNames {
+		if names.long == long {
+			return Root(r), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown registry root %q", name)
+}
+
+// Access is the set of rights a key is opened with
+type Access uint32
+
+// Access rights
+const (
+	Read  Access = 1 << iota // read values and enumerate subkeys
+	Write                    // set and delete values, create subkeys
+)
+
+// Registry is the set of registry operations used by nScript. Paths are
+// relative to root and use backslashes; names compare case-insensitively.
+type Registry interface {
+	OpenKey(root Root, path string, access Access) (Key, error)
+	// CreateKey opens a key, creating it and any missing parents
+	CreateKey(root Root, path string, access Access) (Key, error)
+	// DeleteKey deletes a key without subkeys
+	DeleteKey(root Root, path string) error
+}
+
+// Key is an open registry key. Values are exchanged with their raw type and bytes.
+type Key interface {
+	ReadSubKeyNames() ([]string, error)
+	ReadValueNames() ([]string, error)
+	GetValue(name string) (regfile.Value, error)
+	SetValue(v regfile.Value) error
+	DeleteValue(name string) error
+	Close() error
+}
+
+// Hives mounts registry hive files, such as the NTUSER.DAT of a signed-out user,
+// below HKEY_USERS
+type Hives interface {
+	// LoadHive mounts file as HKEY_USERS\name
+	LoadHive(name, file string) error
+	// UnloadHive writes back and unmounts a hive loaded with LoadHive
+	UnloadHive(name string) error
+}
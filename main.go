@@ -1,132 +1,413 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
+	"os/signal"
 	"runtime"
 	"time"
 
 	"nScript/internal/cleanup"
+	"nScript/internal/cli"
 	"nScript/internal/config"
+	"nScript/internal/fsys"
+	"nScript/internal/logging"
+	"nScript/internal/plan"
+	"nScript/internal/profiles"
+	"nScript/internal/quarantine"
+	"nScript/internal/regbackup"
+	"nScript/internal/report"
 	"nScript/internal/system"
 	"nScript/internal/ui"
 )
 
 func main() {
-	// Ensure we're running on Windows
-	if runtime.GOOS != "windows" {
-		log.Fatal("This program only runs on Windows")
+	// Ensure we're running on a supported system
+	if runtime.GOOS != "windows" && runtime.GOOS != "linux" {
+		log.Fatal("This program only runs on Windows and Linux")
 	}
 
-	// Parse command line arguments
-	forceMode := parseArguments()
+	cmd, err := cli.Parse(os.Args[1:])
+	if err != nil {
+		fmt.Printf("%v\n\n", err)
+		fmt.Print(cli.Usage())
+		os.Exit(cli.ExitConfigError)
+	}
+
+	// Route all output through the console and file loggers
+	closeLog, err := logging.Setup(logging.Options{Level: logLevel(cmd), LogDir: logging.DefaultDir()})
+	if err != nil {
+		logging.Warn("File logging disabled", "error", err)
+	}
 
-	// Initialize configuration
-	cfg := config.GetConfig()
+	ctx, stop := interruptContext()
+	code := run(ctx, cmd)
+	stop()
+	closeLog()
+	os.Exit(code)
+}
 
-	// Display header and warnings
-	ui.PrintHeader(config.Version, forceMode)
+// interruptContext returns a context that is cancelled by the first Ctrl+C. A
+// second Ctrl+C exits immediately without waiting for in-flight work.
+func interruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt)
 
-	// Confirm destructive operations in force mode
-	if forceMode {
-		fmt.Println("[!] Force mode enabled - all files will be removed!")
-		time.Sleep(3 * time.Second)
-	}
+	go func() {
+		select {
+		case <-signals:
+		case <-ctx.Done():
+			return
+		}
+		logging.Notice("Interrupted - finishing in-flight work, press Ctrl+C again to exit immediately")
+		cancel()
 
-	// Initialize components
-	cleaner := cleanup.NewCleaner()
-	windowsCleaner := cleanup.NewWindowsCleaner()
-	progressTracker := ui.NewProgressTracker(cleaner.GetStats())
+		<-signals
+		logging.Error("Interrupted again - exiting immediately")
+		os.Exit(cli.ExitInterrupted)
+	}()
 
-	fmt.Println("\n[*] Starting cleanup operations...")
-	startTime := time.Now()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
 
-	// Phase 1: File and directory cleanup with streaming
-	fmt.Println("\n[*] Phase 1: File and directory cleanup")
-	stopProgress := progressTracker.StartProgress("Cleaning directories")
+// run executes cmd and returns the exit code
+func run(ctx context.Context, cmd *cli.Command) int {
+	switch cmd.Name {
+	case cli.CmdHelp:
+		fmt.Print(cli.Usage())
+		return cli.ExitSuccess
+	case cli.CmdVersion:
+		return runVersion()
+	case cli.CmdRestore:
+		return runRestore(cmd)
+	case cli.CmdRestoreRegistry:
+		return runRestoreRegistry(cmd)
+	case cli.CmdPurge:
+		return runPurge(cmd)
+	case cli.CmdBackups:
+		return runBackups(cmd)
+	case cli.CmdTargets:
+		return runTargets(cmd)
+	case cli.CmdDoctor:
+		return runDoctor(cmd)
+	}
+	return runCleanup(ctx, cmd)
+}
 
-	err := cleaner.StreamingCleanDirectories(
-		cfg.UserDirectories,
-		config.OnlyRemoveOlderThan,
-		cfg.ExcludedExtensions,
-		forceMode,
-	)
-	stopProgress()
+// runCleanup implements "run" and "plan"
+func runCleanup(ctx context.Context, cmd *cli.Command) int {
+	forceMode := cmd.Force
+	dryRun := cmd.Name == cli.CmdPlan
 
+	// Load configuration from file, falling back to built-in defaults
+	cfg, err := config.Load(cmd.ConfigPath)
 	if err != nil {
-		fmt.Printf("[-] Warning: Directory cleanup encountered errors: %v\n", err)
+		logging.Error("Invalid configuration", "error", err)
+		return cli.ExitConfigError
 	}
 
-	// Phase 2: Browser data cleanup
-	fmt.Println("\n[*] Phase 2: Browser data cleanup")
-	err = cleaner.CleanBrowserData(cfg.BrowserInformation, forceMode)
+	// Registry operations defined in the config can be selected too
+	selection, err := cli.NewSelection(cmd.Only, cmd.Skip, cleanup.Operations(cfg.RegistryTweaks))
 	if err != nil {
-		fmt.Printf("[-] Warning: Browser cleanup encountered errors: %v\n", err)
+		fmt.Printf("%v\n\n", err)
+		fmt.Print(cli.Usage())
+		return cli.ExitConfigError
 	}
 
-	// Phase 3: Empty directory removal
-	fmt.Println("\n[*] Phase 3: Empty directory cleanup")
-	stopProgress = progressTracker.StartProgress("Removing empty directories")
+	// Unattended runs never pause: nobody is watching the console
+	forcePause, closingDelay := config.ForceWarningDelay, config.ClosingDelay
+	if cmd.Unattended {
+		forcePause, closingDelay = 0, 0
+	}
+	if dryRun {
+		forcePause = 0
+	}
 
-	err = cleaner.RemoveEmptyDirectories(cfg.UserDirectories)
-	stopProgress()
+	// Display header and warnings; in force mode the pause leaves time to abort
+	ui.PrintHeader(config.Version, forceMode, forcePause)
+	if cfg.Source != "" {
+		logging.Info(fmt.Sprintf("Using configuration from %s", cfg.Source))
+	}
 
-	if err != nil {
-		fmt.Printf("[-] Warning: Empty directory cleanup encountered errors: %v\n", err)
+	if err := cfg.CheckHome(); err != nil {
+		logging.Error("Refusing to run", "error", err)
+		return cli.ExitSafetyAbort
 	}
 
-	// Phase 4: Windows-specific cleanup
-	fmt.Println("\n[*] Phase 4: Windows system cleanup")
-	err = windowsCleaner.RunAllWindowsCleanup()
+	// In all-users mode the per-user targets are repeated for every profile
+	userProfiles, err := allUsers(cmd, cfg)
 	if err != nil {
-		fmt.Printf("[-] Warning: Windows cleanup encountered errors: %v\n", err)
+		logging.Error("Could not list user profiles", "error", err)
+		return cli.ExitFailure
+	}
+	if userProfiles != nil {
+		cfg = cfg.ForProfiles(profiles.Homes(userProfiles))
 	}
 
+	// Initialize components
+	cleaner := cleanup.NewCleaner(cfg, fsys.OS{})
+	windowsCleaner := cleanup.NewWindowsCleaner(cfg, fsys.OS{})
+	windowsCleaner.SetOperationFilter(selection.WindowsOperation)
+	if userProfiles != nil {
+		windowsCleaner.SetProfiles(userProfiles)
+	}
+	progressTracker := ui.NewProgressTracker(cleaner.GetStats(), cleaner.Pool())
+
+	// In dry-run mode every phase records into the plan and nothing is touched
+	var runPlan *plan.Plan
+	if dryRun {
+		runPlan = plan.New()
+		cleaner.SetPlan(runPlan)
+		windowsCleaner.SetPlan(runPlan)
+		logging.Info("Dry run: nothing will be deleted, killed or modified")
+	}
+
+	// In quarantine mode matched files are moved aside instead of deleted
+	var quarantineRun *quarantine.Run
+	if cmd.Quarantine {
+		root, err := quarantine.DefaultRoot()
+		if err == nil {
+			quarantineRun, err = quarantine.NewStore(fsys.OS{}, root).Begin()
+		}
+		if err != nil {
+			logging.Error("Could not start quarantine", "error", err)
+			return cli.ExitFailure
+		}
+		cleaner.SetQuarantine(quarantineRun)
+		logging.Info(fmt.Sprintf("Quarantine mode: items are moved to %s", root))
+	}
+
+	// Snapshot free space so the report can show what the run actually freed
+	diskBefore, err := system.GetDiskInfo()
+	if err != nil && err != system.ErrUnsupported {
+		logging.Warn("Could not get disk information", "error", err)
+	}
+
+	logging.Info("\nStarting cleanup operations...")
+	startTime := time.Now()
+
+	runReport := report.New(config.Version, startTime)
+	runReport.Force = forceMode
+	runReport.ConfigSource = cfg.Source
+	runReport.Only = cmd.Only
+	runReport.Skip = cmd.Skip
+	switch {
+	case runPlan != nil:
+		runReport.Mode = report.ModeDryRun
+	case quarantineRun != nil:
+		runReport.Mode = report.ModeQuarantine
+		runReport.QuarantineRun = quarantineRun.ID()
+	}
+
+	// Run the phases in order; after Ctrl+C, or once a safety limit is reached,
+	// no further phase is started
+	phases := []struct {
+		name        string
+		title       string
+		progress    string
+		windowsOnly bool
+		run         func() error
+	}{
+		{cleanup.PhaseFiles, "File and directory cleanup", "Cleaning directories", false, func() error {
+			return cleaner.StreamingCleanDirectories(ctx, cfg.Targets, forceMode)
+		}},
+		{cleanup.PhaseBrowsers, "Browser data cleanup", "", false, func() error {
+			return cleaner.CleanBrowserData(ctx, cfg.BrowserInformation, forceMode)
+		}},
+		{cleanup.PhaseEmptyDirs, "Empty directory cleanup", "Removing empty directories", false, func() error {
+			return cleaner.RemoveEmptyDirectories(ctx, cfg.Targets)
+		}},
+		{cleanup.PhaseWindows, "Windows system cleanup", "", true, func() error {
+			return windowsCleaner.RunAllWindowsCleanup(ctx)
+		}},
+	}
+
+	phaseFailed := false
+	for i, phase := range phases {
+		if ctx.Err() != nil {
+			break
+		}
+		if !selection.Phase(phase.name) {
+			logging.Info(fmt.Sprintf("\nPhase %d: %s (skipped)", i+1, phase.title))
+			runReport.SkipPhase(phase.name)
+			continue
+		}
+		if phase.windowsOnly && runtime.GOOS != "windows" {
+			logging.Info(fmt.Sprintf("\nPhase %d: %s (not available on %s)", i+1, phase.title, runtime.GOOS))
+			runReport.SkipPhase(phase.name)
+			continue
+		}
+
+		logging.Info(fmt.Sprintf("\nPhase %d: %s", i+1, phase.title))
+		phaseStart := time.Now()
+		stopProgress := func() {}
+		if phase.progress != "" {
+			stopProgress = progressTracker.StartProgress(phase.progress)
+		}
+
+		err := phase.run()
+		stopProgress()
+		runReport.AddPhase(phase.name, phaseStart, err)
+
+		if trip := cleaner.Tripped(); trip != nil {
+			logging.Error(phase.title+" stopped", "error", trip)
+			runReport.SetSafetyAbort(phase.name, trip)
+			break
+		}
+		if err != nil && ctx.Err() == nil {
+			logging.Warn(phase.title+" encountered errors", "error", err)
+			phaseFailed = true
+		}
+	}
+	interrupted := ctx.Err() != nil
+	runReport.Interrupted = interrupted
+	tripped := cleaner.Tripped() != nil
+
 	// Calculate elapsed time
 	elapsed := time.Since(startTime)
 
 	// Get disk information for final report
-	diskInfo, err := system.GetDiskInfo()
+	diskAfter, err := system.GetDiskInfo()
+	if err != nil && err != system.ErrUnsupported {
+		logging.Warn("Could not get disk information", "error", err)
+	}
+
+	// Pack this run's registry backups into one archive, then apply the retention limits
+	backupArchive, err := windowsCleaner.FinishRegistryBackups()
 	if err != nil {
-		fmt.Printf("[-] Warning: Could not get disk information: %v\n", err)
+		logging.Warn("Could not archive registry backups", "error", err)
+	}
+	if runPlan == nil {
+		backups := regbackup.NewStore(fsys.OS{}, cfg.RegistryBackupDir)
+		pruned, err := backups.Prune(cfg.RegistryBackupKeep, cfg.RegistryBackupMaxAge)
+		for _, id := range pruned {
+			logging.Debug("Pruned registry backup", "backup", id)
+		}
+		if err != nil {
+			logging.Warn("Could not prune registry backups", "error", err)
+		}
+	}
+
+	// Assemble the run report from the components' journals
+	runReport.AddStats(cleaner.GetStats())
+	runReport.AddFailures(windowsCleaner.Failures())
+	runReport.AddProcesses(cleanup.PhaseBrowsers, cleaner.Killed())
+	runReport.AddProcesses(cleanup.PhaseWindows, windowsCleaner.Killed())
+	runReport.AddRegistry(windowsCleaner.RegistryBackupDirectory(), backupArchive, windowsCleaner.RegistryBackups(),
+		windowsCleaner.DeletedRegistryKeys(), windowsCleaner.ChangedRegistryValues())
+	if userProfiles != nil {
+		runReport.AddProfiles(userProfiles, windowsCleaner.Profiles())
+	}
+	runReport.SetDisk(diskBefore, diskAfter)
+	if quarantineRun != nil {
+		runReport.Totals.QuarantinedItems = quarantineRun.Count()
+	}
+
+	// A finished run with failed items or operations is a partial failure
+	exitCode := cli.ExitSuccess
+	switch {
+	case tripped:
+		exitCode = cli.ExitSafetyAbort
+	case interrupted:
+		exitCode = cli.ExitInterrupted
+	case phaseFailed || cleaner.GetStats().FailedFiles.Load() > 0 || len(windowsCleaner.Failures()) > 0:
+		exitCode = cli.ExitPartial
+	}
+	runReport.ExitCode = exitCode
+
+	if runPlan != nil {
+		planFile := writePlan(runPlan, cmd.PlanFile)
+		runReport.PlanFile = planFile
+		writeReport(runReport, cmd.ReportFile)
+		ui.PrintPlanSummary(runPlan, elapsed, planFile)
+		if tripped {
+			logging.Notice("Dry run stopped by a safety limit - a real run would stop at the same point")
+			return exitCode
+		}
+		if interrupted {
+			logging.Notice("Dry run interrupted - the plan covers only the phases that ran")
+			return exitCode
+		}
+		ui.PrintClosingMessage(closingDelay)
+		return exitCode
 	}
 
 	// Display final statistics
-	ui.PrintStats(cleaner.GetStats(), elapsed, diskInfo)
+	ui.PrintStats(cleaner.GetStats(), elapsed, diskBefore, diskAfter)
+
+	if quarantineRun != nil {
+		logging.Info(fmt.Sprintf("Quarantined %d items as run %s", quarantineRun.Count(), quarantineRun.ID()))
+		logging.Info(fmt.Sprintf("Undo with: nScript.exe restore %s [path-glob]", quarantineRun.ID()))
+	}
 
 	// Show backup information
-	registryManager := system.NewRegistryManager()
-	ui.ShowBackupInfo(registryManager.GetBackupDirectory())
+	ui.ShowBackupInfo(backupArchive, windowsCleaner.RegistryBackupID())
+
+	// What the breaker stopped is kept as a plan to review
+	if tripped {
+		runReport.PlanFile = writePlan(cleaner.Held(), "")
+		if runReport.PlanFile != "" {
+			logging.Notice(fmt.Sprintf("Deletions stopped by the safety limit were saved to %s", runReport.PlanFile))
+		}
+	}
+	writeReport(runReport, cmd.ReportFile)
+
+	if tripped {
+		logging.Error("Run stopped by a safety limit - remaining phases were skipped", "exitCode", exitCode)
+		return exitCode
+	}
+	if interrupted {
+		logging.Notice("Run interrupted - remaining phases were skipped")
+		return exitCode
+	}
+	if exitCode == cli.ExitPartial {
+		logging.Warn("Run finished with failures", "exitCode", exitCode)
+	}
 
 	// Display closing message
-	ui.PrintClosingMessage()
+	ui.PrintClosingMessage(closingDelay)
+	return exitCode
 }
 
-// parseArguments parses command line arguments and returns force mode status
-func parseArguments() bool {
-	forceMode := false
-	for _, arg := range os.Args[1:] {
-		if arg == "-Force" || arg == "--force" {
-			forceMode = true
-		} else {
-			// Show help for unknown arguments
-			fmt.Printf("Unknown argument: %s\n", arg)
-			showHelp()
-			os.Exit(1)
-		}
+// logLevel returns the console level selected by --verbose and --quiet
+func logLevel(cmd *cli.Command) slog.Level {
+	switch {
+	case cmd.Verbose:
+		return logging.LevelDebug
+	case cmd.Quiet:
+		return logging.LevelWarn
 	}
-	return forceMode
+	return logging.LevelInfo
 }
 
-// showHelp displays usage information
-func showHelp() {
-	fmt.Println("nScript - Windows System Cleaner")
-	fmt.Println("Usage:")
-	fmt.Println("  nScript.exe           - Normal mode (removes files older than 24 hours)")
-	fmt.Println("  nScript.exe --force   - Force mode (removes ALL files regardless of age)")
-	fmt.Println("  nScript.exe -Force    - Alternative force mode syntax")
-	fmt.Println()
-	fmt.Println("WARNING: Force mode is destructive and cannot be undone!")
-	fmt.Println("Always ensure you have backups of important data before running.")
+// writePlan writes p to path, or to the default plan file when path is empty.
+// It returns the file written, empty when writing failed.
+func writePlan(p *plan.Plan, path string) string {
+	if path == "" {
+		path = plan.DefaultFileName()
+	}
+	if err := p.WriteFile(path, config.Version); err != nil {
+		logging.Warn("Could not write plan", "error", err)
+		return ""
+	}
+	return path
+}
+
+// writeReport writes the run report to path, or to the default report location when path is empty
+func writeReport(r *report.Report, path string) {
+	if path == "" {
+		path = report.DefaultPath(r.StartedAt)
+	}
+	if err := r.WriteFile(path); err != nil {
+		logging.Warn("Could not write run report", "error", err)
+		return
+	}
+	logging.Info(fmt.Sprintf("Run report written to: %s", path))
 }